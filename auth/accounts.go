@@ -2,22 +2,107 @@ package auth
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/bloom42/stdx-go/crypto"
 	"github.com/bloom42/stdx-go/db"
 	"github.com/bloom42/stdx-go/uuid"
 )
 
 type Account struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        uuid.UUID `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	PasswordHash string `db:"password_hash" json:"-"`
 }
 
 func CreateAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID, password string) (err error) {
-	panic("TODO")
+	if password == "" {
+		return ErrPasswordIsEmpty
+	}
+
+	now := time.Now().UTC()
+	account := Account{
+		ID:           accountID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		PasswordHash: crypto.HashPassword([]byte(password), crypto.DefaultHashPasswordParams),
+	}
+
+	const query = `INSERT INTO auth_accounts (id, created_at, updated_at, password_hash)
+		VALUES ($1, $2, $3, $4)`
+	_, err = db.Exec(ctx, query, account.ID, account.CreatedAt, account.UpdatedAt, account.PasswordHash)
+	if err != nil {
+		if isErrAlreadyExists(err) {
+			return ErrAccountAlreadyExists
+		}
+		return err
+	}
+
+	return nil
 }
 
+func GetAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID) (account Account, err error) {
+	const query = "SELECT * FROM auth_accounts WHERE id = $1"
+	err = db.Get(ctx, &account, query, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrAccountNotFound
+		}
+		return
+	}
+
+	return
+}
+
+// VerifyAccountPassword returns the account if password matches the password of the account, and
+// ErrPasswordIsNotValid otherwise.
+func VerifyAccountPassword(ctx context.Context, db db.Queryer, accountID uuid.UUID, password string) (account Account, err error) {
+	account, err = GetAccount(ctx, db, accountID)
+	if err != nil {
+		return
+	}
+
+	if !crypto.VerifyPasswordHash([]byte(password), account.PasswordHash) {
+		err = ErrPasswordIsNotValid
+		return
+	}
+
+	return
+}
+
+// UpdateAccountPassword changes the password of the account and deletes all its sessions.
+func UpdateAccountPassword(ctx context.Context, db db.Queryer, accountID uuid.UUID, newPassword string) (err error) {
+	if newPassword == "" {
+		return ErrPasswordIsEmpty
+	}
+
+	passwordHash := crypto.HashPassword([]byte(newPassword), crypto.DefaultHashPasswordParams)
+
+	const query = "UPDATE auth_accounts SET updated_at = $1, password_hash = $2 WHERE id = $3"
+	res, err := db.Exec(ctx, query, time.Now().UTC(), passwordHash, accountID)
+	if err != nil {
+		return err
+	}
+	err = checkRowsAffected(res, ErrAccountNotFound)
+	if err != nil {
+		return err
+	}
+
+	return DeleteSessionsForAccount(ctx, db, accountID)
+}
+
+// DeleteAccount deletes the account. Its sessions and API keys are deleted by the database
+// (ON DELETE CASCADE).
 func DeleteAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID) (err error) {
-	panic("TODO")
+	const query = "DELETE FROM auth_accounts WHERE id = $1"
+	res, err := db.Exec(ctx, query, accountID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, ErrAccountNotFound)
 }
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+func createTestAccount(t *testing.T, database *memoryDB, password string) uuid.UUID {
+	t.Helper()
+	accountID := uuid.NewV7()
+	err := CreateAccount(context.Background(), database, accountID, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return accountID
+}
+
+func TestAccounts(t *testing.T) {
+	ctx := context.Background()
+	database := newMemoryDB()
+
+	if err := CreateAccount(ctx, database, uuid.NewV7(), ""); !errors.Is(err, ErrPasswordIsEmpty) {
+		t.Errorf("empty password: err = %v, want %v", err, ErrPasswordIsEmpty)
+	}
+
+	accountID := createTestAccount(t, database, "password")
+	if err := CreateAccount(ctx, database, accountID, "password"); !errors.Is(err, ErrAccountAlreadyExists) {
+		t.Errorf("duplicate account: err = %v, want %v", err, ErrAccountAlreadyExists)
+	}
+
+	account, err := GetAccount(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !account.ID.Equal(accountID) || account.PasswordHash == "" || account.PasswordHash == "password" {
+		t.Errorf("unexpected account: %+v", account)
+	}
+	if _, err = GetAccount(ctx, database, uuid.NewV7()); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("GetAccount: err = %v, want %v", err, ErrAccountNotFound)
+	}
+
+	if _, err = VerifyAccountPassword(ctx, database, accountID, "password"); err != nil {
+		t.Errorf("VerifyAccountPassword: %v", err)
+	}
+	if _, err = VerifyAccountPassword(ctx, database, accountID, "wrong password"); !errors.Is(err, ErrPasswordIsNotValid) {
+		t.Errorf("wrong password: err = %v, want %v", err, ErrPasswordIsNotValid)
+	}
+
+	// changing the password revokes all the sessions of the account
+	token, err := CreateSession(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = UpdateAccountPassword(ctx, database, accountID, ""); !errors.Is(err, ErrPasswordIsEmpty) {
+		t.Errorf("empty new password: err = %v, want %v", err, ErrPasswordIsEmpty)
+	}
+	err = UpdateAccountPassword(ctx, database, accountID, "new password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifyAccountPassword(ctx, database, accountID, "password"); !errors.Is(err, ErrPasswordIsNotValid) {
+		t.Errorf("old password: err = %v, want %v", err, ErrPasswordIsNotValid)
+	}
+	if _, err = VerifyAccountPassword(ctx, database, accountID, "new password"); err != nil {
+		t.Errorf("new password: %v", err)
+	}
+	if _, err = GetSessionByToken(ctx, database, token); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("session after password change: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	if err = UpdateAccountPassword(ctx, database, uuid.NewV7(), "password"); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("UpdateAccountPassword: err = %v, want %v", err, ErrAccountNotFound)
+	}
+
+	// the sessions and API keys of deleted accounts are deleted
+	token, err = CreateSession(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, apiKeyToken, err := CreateApiKey(ctx, database, CreateApiKeyInput{AccountID: accountID, Name: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DeleteAccount(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetAccount(ctx, database, accountID); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("deleted account: err = %v, want %v", err, ErrAccountNotFound)
+	}
+	if _, err = GetSessionByToken(ctx, database, token); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("session of deleted account: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	if _, err = GetApiKeyByToken(ctx, database, apiKeyToken); !errors.Is(err, ErrApiKeyNotFound) {
+		t.Errorf("API key of deleted account: err = %v, want %v", err, ErrApiKeyNotFound)
+	}
+	if err = DeleteAccount(ctx, database, accountID); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("DeleteAccount: err = %v, want %v", err, ErrAccountNotFound)
+	}
+}
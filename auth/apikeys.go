@@ -1,16 +1,185 @@
 package auth
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/bloom42/stdx-go/db"
 	"github.com/bloom42/stdx-go/uuid"
 )
 
+const ApiKeyNameMaxLength = 128
+
+// ApiKeyScopes are the permissions granted to an API key. Scopes are defined by the application
+// (e.g. "projects:read") and must not contain whitespace.
+// They are stored in the database as a space-delimited string, like OAuth 2.0 scopes.
+type ApiKeyScopes []string
+
 type ApiKey struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        uuid.UUID `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	Name      string       `db:"name" json:"name"`
+	ExpiresAt *time.Time   `db:"expires_at" json:"expires_at"`
+	RevokedAt *time.Time   `db:"revoked_at" json:"revoked_at"`
+	TokenHash []byte       `db:"token_hash" json:"-"`
+	Scopes    ApiKeyScopes `db:"scopes" json:"scopes"`
+
+	AccountID uuid.UUID `db:"account_id" json:"account_id"`
+}
+
+type CreateApiKeyInput struct {
+	AccountID uuid.UUID
+	Name      string
+	// ExpiresAt is optional. If nil the API key never expires.
+	ExpiresAt *time.Time
+	Scopes    []string
+}
+
+// CreateApiKey creates a new API key and returns it along with its token. The token is only known by the
+// caller, so it should be displayed to the user.
+func CreateApiKey(ctx context.Context, db db.Queryer, input CreateApiKeyInput) (apiKey ApiKey, token string, err error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > ApiKeyNameMaxLength {
+		err = ErrApiKeyNameIsNotValid
+		return
+	}
+
+	for _, scope := range input.Scopes {
+		if scope == "" || strings.ContainsFunc(scope, unicode.IsSpace) {
+			err = ErrApiKeyScopeIsNotValid
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	apiKey = ApiKey{
+		ID:        uuid.NewV7(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+		ExpiresAt: input.ExpiresAt,
+		RevokedAt: nil,
+		Scopes:    slices.Clone(input.Scopes),
+		AccountID: input.AccountID,
+	}
+	token, apiKey.TokenHash = generateToken(ApiKeyTokenPrefix, apiKey.ID)
+
+	const query = `INSERT INTO auth_api_keys
+		(id, created_at, updated_at, name, expires_at, revoked_at, token_hash, scopes, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err = db.Exec(ctx, query, apiKey.ID, apiKey.CreatedAt, apiKey.UpdatedAt, apiKey.Name, apiKey.ExpiresAt,
+		apiKey.RevokedAt, apiKey.TokenHash, apiKey.Scopes, apiKey.AccountID)
+	if err != nil {
+		return ApiKey{}, "", err
+	}
+
+	return apiKey, token, nil
+}
+
+// HasScope returns true if the API key has been granted the given scope.
+func (apiKey ApiKey) HasScope(scope string) bool {
+	return slices.Contains(apiKey.Scopes, scope)
+}
+
+// Value implements driver.Valuer.
+func (scopes ApiKeyScopes) Value() (driver.Value, error) {
+	return strings.Join(scopes, " "), nil
+}
+
+// Scan implements sql.Scanner.
+func (scopes *ApiKeyScopes) Scan(src any) error {
+	var value string
+
+	switch src := src.(type) {
+	case nil:
+		value = ""
+	case string:
+		value = src
+	case []byte:
+		value = string(src)
+	default:
+		return fmt.Errorf("auth: can't scan type %T into ApiKeyScopes", src)
+	}
+
+	*scopes = strings.Fields(value)
+	return nil
+}
+
+// GetApiKeyByToken returns the API key identified by token if the token is valid and the API key has
+// neither expired nor been revoked.
+func GetApiKeyByToken(ctx context.Context, db db.Queryer, token string) (apiKey ApiKey, err error) {
+	apiKeyID, tokenHash, err := parseToken(ApiKeyTokenPrefix, token)
+	if err != nil {
+		return
+	}
+
+	const query = "SELECT * FROM auth_api_keys WHERE id = $1"
+	err = db.Get(ctx, &apiKey, query, apiKeyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrApiKeyNotFound
+		}
+		return
+	}
+
+	err = verifyTokenHash(tokenHash, apiKey.TokenHash)
+	if err != nil {
+		return
+	}
+
+	if apiKey.RevokedAt != nil {
+		err = ErrApiKeyRevoked
+		return
+	}
+
+	if apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(time.Now()) {
+		err = ErrApiKeyExpired
+		return
+	}
+
+	return
+}
+
+// GetApiKeysForAccount returns all the API keys of the account, including the expired and revoked ones,
+// the most recent first.
+func GetApiKeysForAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID) (apiKeys []ApiKey, err error) {
+	apiKeys = make([]ApiKey, 0)
+
+	const query = "SELECT * FROM auth_api_keys WHERE account_id = $1 ORDER BY id DESC"
+	err = db.Select(ctx, &apiKeys, query, accountID)
+	return
+}
+
+// RevokeApiKey revokes an API key of the account. Revoked API keys are kept so they can still be listed.
+func RevokeApiKey(ctx context.Context, db db.Queryer, accountID, apiKeyID uuid.UUID) (err error) {
+	now := time.Now().UTC()
+
+	const query = `UPDATE auth_api_keys SET updated_at = $1, revoked_at = $1
+		WHERE id = $2 AND account_id = $3 AND revoked_at IS NULL`
+	res, err := db.Exec(ctx, query, now, apiKeyID, accountID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, ErrApiKeyNotFound)
+}
+
+// DeleteApiKey permanently deletes an API key of the account.
+func DeleteApiKey(ctx context.Context, db db.Queryer, accountID, apiKeyID uuid.UUID) (err error) {
+	const query = "DELETE FROM auth_api_keys WHERE id = $1 AND account_id = $2"
+	res, err := db.Exec(ctx, query, apiKeyID, accountID)
+	if err != nil {
+		return err
+	}
 
-	Name string
-	// ExpiresAt *time.Time
+	return checkRowsAffected(res, ErrApiKeyNotFound)
 }
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+func TestCreateApiKey(t *testing.T) {
+	ctx := context.Background()
+	database := newMemoryDB()
+	accountID := createTestAccount(t, database, "password")
+
+	tests := []struct {
+		input       CreateApiKeyInput
+		expectedErr error
+	}{
+		{CreateApiKeyInput{AccountID: accountID, Name: "CI"}, nil},
+		{CreateApiKeyInput{AccountID: accountID, Name: "CI", Scopes: []string{"projects:read", "projects:write"}}, nil},
+		{CreateApiKeyInput{AccountID: accountID, Name: "  "}, ErrApiKeyNameIsNotValid},
+		{CreateApiKeyInput{AccountID: accountID, Name: strings.Repeat("a", ApiKeyNameMaxLength+1)}, ErrApiKeyNameIsNotValid},
+		{CreateApiKeyInput{AccountID: accountID, Name: "CI", Scopes: []string{""}}, ErrApiKeyScopeIsNotValid},
+		{CreateApiKeyInput{AccountID: accountID, Name: "CI", Scopes: []string{"projects:read projects:write"}}, ErrApiKeyScopeIsNotValid},
+	}
+
+	for index, test := range tests {
+		apiKey, token, err := CreateApiKey(ctx, database, test.input)
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("%d: err = %v, want %v", index, err, test.expectedErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		storedApiKey, err := GetApiKeyByToken(ctx, database, token)
+		if err != nil {
+			t.Errorf("%d: GetApiKeyByToken: %v", index, err)
+			continue
+		}
+		if !storedApiKey.ID.Equal(apiKey.ID) || !storedApiKey.AccountID.Equal(accountID) ||
+			!slices.Equal(storedApiKey.Scopes, apiKey.Scopes) || len(storedApiKey.Scopes) != len(test.input.Scopes) {
+			t.Errorf("%d: stored API key = %+v, want %+v", index, storedApiKey, apiKey)
+		}
+		for _, scope := range test.input.Scopes {
+			if !storedApiKey.HasScope(scope) {
+				t.Errorf("%d: the API key should have the scope %s", index, scope)
+			}
+		}
+		if storedApiKey.HasScope("admin") {
+			t.Errorf("%d: the API key should not have the scope admin", index)
+		}
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	ctx := context.Background()
+	database := newMemoryDB()
+	accountID := createTestAccount(t, database, "password")
+	otherAccountID := createTestAccount(t, database, "password")
+
+	apiKey, token, err := CreateApiKey(ctx, database, CreateApiKeyInput{AccountID: accountID, Name: "CI"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	expiringApiKey, expiringToken, err := CreateApiKey(ctx, database, CreateApiKeyInput{
+		AccountID: accountID,
+		Name:      "temporary",
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = GetApiKeyByToken(ctx, database, expiringToken); err != nil {
+		t.Errorf("API key before its expiration: %v", err)
+	}
+	forgedToken, _ := generateToken(ApiKeyTokenPrefix, apiKey.ID)
+	if _, err = GetApiKeyByToken(ctx, database, forgedToken); !errors.Is(err, ErrTokenIsNotValid) {
+		t.Errorf("forged token: err = %v, want %v", err, ErrTokenIsNotValid)
+	}
+	unknownToken, _ := generateToken(ApiKeyTokenPrefix, uuid.NewV7())
+	if _, err = GetApiKeyByToken(ctx, database, unknownToken); !errors.Is(err, ErrApiKeyNotFound) {
+		t.Errorf("unknown API key: err = %v, want %v", err, ErrApiKeyNotFound)
+	}
+	sessionToken, _ := generateToken(SessionTokenPrefix, apiKey.ID)
+	if _, err = GetApiKeyByToken(ctx, database, sessionToken); !errors.Is(err, ErrTokenIsNotValid) {
+		t.Errorf("session token: err = %v, want %v", err, ErrTokenIsNotValid)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	database.apiKeys[expiringApiKey.ID].ExpiresAt = &expired
+	if _, err = GetApiKeyByToken(ctx, database, expiringToken); !errors.Is(err, ErrApiKeyExpired) {
+		t.Errorf("expired API key: err = %v, want %v", err, ErrApiKeyExpired)
+	}
+
+	// API keys can only be revoked by their account, and only once
+	if err = RevokeApiKey(ctx, database, otherAccountID, apiKey.ID); !errors.Is(err, ErrApiKeyNotFound) {
+		t.Errorf("revoking the API key of another account: err = %v, want %v", err, ErrApiKeyNotFound)
+	}
+	err = RevokeApiKey(ctx, database, accountID, apiKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetApiKeyByToken(ctx, database, token); !errors.Is(err, ErrApiKeyRevoked) {
+		t.Errorf("revoked API key: err = %v, want %v", err, ErrApiKeyRevoked)
+	}
+	if err = RevokeApiKey(ctx, database, accountID, apiKey.ID); !errors.Is(err, ErrApiKeyNotFound) {
+		t.Errorf("revoking a revoked API key: err = %v, want %v", err, ErrApiKeyNotFound)
+	}
+
+	// revoked and expired API keys are still listed
+	apiKeys, err := GetApiKeysForAccount(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiKeys) != 2 || !apiKeys[0].ID.Equal(expiringApiKey.ID) || !apiKeys[1].ID.Equal(apiKey.ID) {
+		t.Errorf("API keys should be listed the most recent first: %+v", apiKeys)
+	}
+	if apiKeys[1].RevokedAt == nil {
+		t.Error("RevokedAt should be set")
+	}
+	apiKeys, err = GetApiKeysForAccount(ctx, database, otherAccountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiKeys) != 0 {
+		t.Errorf("the API keys of other accounts should not be listed: %+v", apiKeys)
+	}
+
+	if err = DeleteApiKey(ctx, database, otherAccountID, apiKey.ID); !errors.Is(err, ErrApiKeyNotFound) {
+		t.Errorf("deleting the API key of another account: err = %v, want %v", err, ErrApiKeyNotFound)
+	}
+	err = DeleteApiKey(ctx, database, accountID, apiKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetApiKeyByToken(ctx, database, token); !errors.Is(err, ErrApiKeyNotFound) {
+		t.Errorf("deleted API key: err = %v, want %v", err, ErrApiKeyNotFound)
+	}
+}
@@ -0,0 +1,103 @@
+// Package auth implements accounts, sessions and API keys stored in a PostgreSQL database.
+//
+// The tables are created by the SQL migrations in MigrationsFS, which can be loaded with migrate.Load.
+//
+// Session and API key tokens are never stored in the database: only a BLAKE3 hash of their secret part is.
+// Tokens look like: "<prefix><base64url(id || secret)>", e.g. "session_AY5t...".
+package auth
+
+import (
+	"embed"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/blake3"
+	"github.com/bloom42/stdx-go/db"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+// MigrationsFS contains the SQL migrations (migrations/*.up.sql and migrations/*.down.sql) that create the
+// tables used by this package. They are compatible with migrate.Load.
+//
+//go:embed migrations/*.sql
+var MigrationsFS embed.FS
+
+const (
+	SessionTokenPrefix = "session_"
+	ApiKeyTokenPrefix  = "apikey_"
+
+	tokenSecretSize = crypto.KeySize256
+	tokenSize       = uuid.Size + tokenSecretSize
+)
+
+var (
+	ErrAccountNotFound       = errors.New("auth: account not found")
+	ErrAccountAlreadyExists  = errors.New("auth: account already exists")
+	ErrPasswordIsEmpty       = errors.New("auth: password is empty")
+	ErrPasswordIsNotValid    = errors.New("auth: password is not valid")
+	ErrTokenIsNotValid       = errors.New("auth: token is not valid")
+	ErrSessionNotFound       = errors.New("auth: session not found")
+	ErrSessionExpired        = errors.New("auth: session has expired")
+	ErrApiKeyNotFound        = errors.New("auth: API key not found")
+	ErrApiKeyExpired         = errors.New("auth: API key has expired")
+	ErrApiKeyRevoked         = errors.New("auth: API key has been revoked")
+	ErrApiKeyNameIsNotValid  = errors.New("auth: API key name is not valid")
+	ErrApiKeyScopeIsNotValid = errors.New("auth: API key scope is not valid")
+)
+
+// isErrAlreadyExists and checkRowsAffected are the functions of the db package, which is not directly
+// accessible from the functions of this package as their db argument shadows it.
+var (
+	isErrAlreadyExists = db.IsErrAlreadyExists
+	checkRowsAffected  = db.CheckRowsAffected
+)
+
+// generateToken generates a new random token for the given object ID and returns the token that should be sent
+// to the client and the hash that should be stored in the database.
+func generateToken(prefix string, id uuid.UUID) (token string, hash []byte) {
+	secret := crypto.RandBytes(tokenSecretSize)
+
+	rawToken := make([]byte, 0, tokenSize)
+	rawToken = append(rawToken, id.Bytes()...)
+	rawToken = append(rawToken, secret...)
+
+	token = prefix + base64.RawURLEncoding.EncodeToString(rawToken)
+	hash = hashTokenSecret(secret)
+	return
+}
+
+// parseToken decodes a token generated by generateToken and returns the ID of the object it belongs to and
+// the hash of its secret.
+func parseToken(prefix, token string) (id uuid.UUID, hash []byte, err error) {
+	encodedToken, found := strings.CutPrefix(token, prefix)
+	if !found {
+		err = ErrTokenIsNotValid
+		return
+	}
+
+	rawToken, err := base64.RawURLEncoding.DecodeString(encodedToken)
+	if err != nil || len(rawToken) != tokenSize {
+		err = ErrTokenIsNotValid
+		return
+	}
+
+	copy(id[:], rawToken[:uuid.Size])
+	hash = hashTokenSecret(rawToken[uuid.Size:])
+	return
+}
+
+// verifyTokenHash compares, in constant time, the hash of the secret of a token with the hash stored
+// in the database.
+func verifyTokenHash(hash, storedHash []byte) error {
+	if !crypto.ConstantTimeCompare(hash, storedHash) {
+		return ErrTokenIsNotValid
+	}
+	return nil
+}
+
+func hashTokenSecret(secret []byte) []byte {
+	hash := blake3.Sum256(secret)
+	return hash[:]
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/migrate"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+func TestToken(t *testing.T) {
+	id := uuid.NewV7()
+
+	token, hash := generateToken(SessionTokenPrefix, id)
+	if !strings.HasPrefix(token, SessionTokenPrefix) {
+		t.Errorf("token (%s) doesn't have the prefix %s", token, SessionTokenPrefix)
+	}
+
+	parsedID, parsedHash, err := parseToken(SessionTokenPrefix, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsedID.Equal(id) {
+		t.Errorf("parsedID (%s) != id (%s)", parsedID, id)
+	}
+	if err = verifyTokenHash(parsedHash, hash); err != nil {
+		t.Errorf("verifyTokenHash: %v", err)
+	}
+
+	otherToken, _ := generateToken(SessionTokenPrefix, id)
+	_, otherHash, err := parseToken(SessionTokenPrefix, otherToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifyTokenHash(otherHash, hash); !errors.Is(err, ErrTokenIsNotValid) {
+		t.Errorf("verifyTokenHash with the hash of another token: err = %v, want %v", err, ErrTokenIsNotValid)
+	}
+
+	invalidTokens := []string{
+		"",
+		SessionTokenPrefix,
+		strings.TrimPrefix(token, SessionTokenPrefix),
+		ApiKeyTokenPrefix + strings.TrimPrefix(token, SessionTokenPrefix),
+		token[:len(token)-1],
+		token + "A",
+		SessionTokenPrefix + "!!!!" + string(crypto.RandBytes(10)),
+	}
+	for _, invalidToken := range invalidTokens {
+		_, _, err = parseToken(SessionTokenPrefix, invalidToken)
+		if !errors.Is(err, ErrTokenIsNotValid) {
+			t.Errorf("parseToken(%q): err = %v, want %v", invalidToken, err, ErrTokenIsNotValid)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := migrate.Load(MigrationsFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upFiles, err := fs.Glob(MigrationsFS, "migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != len(upFiles) {
+		t.Errorf("len(migrations) = %d, want %d", len(migrations), len(upFiles))
+	}
+}
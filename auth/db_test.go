@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloom42/stdx-go/db"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+// memoryDB is an in-memory db.Queryer that implements the queries of the accounts, sessions, API keys and
+// TOTP the same way PostgreSQL does, so their behaviour can be tested without a database server.
+type memoryDB struct {
+	mutex         sync.Mutex
+	accounts      map[uuid.UUID]*Account
+	sessions      map[uuid.UUID]*Session
+	apiKeys       map[uuid.UUID]*ApiKey
+	totps         map[uuid.UUID]*Totp
+	recoveryCodes map[uuid.UUID]*RecoveryCode
+}
+
+// ensure that memoryDB satisfies the db.Queryer interface
+var _ db.Queryer = (*memoryDB)(nil)
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{
+		accounts:      map[uuid.UUID]*Account{},
+		sessions:      map[uuid.UUID]*Session{},
+		apiKeys:       map[uuid.UUID]*ApiKey{},
+		totps:         map[uuid.UUID]*Totp{},
+		recoveryCodes: map[uuid.UUID]*RecoveryCode{},
+	}
+}
+
+var errMemoryDBQueryIsNotSupported = errors.New("memoryDB: query is not supported")
+
+// normalizeQuery collapses the whitespace of query so multi-line queries can be matched.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func (memory *memoryDB) Get(ctx context.Context, dest any, query string, args ...any) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	id := args[0].(uuid.UUID)
+
+	switch normalizeQuery(query) {
+	case "SELECT * FROM auth_accounts WHERE id = $1":
+		account, exists := memory.accounts[id]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		*dest.(*Account) = *account
+	case "SELECT * FROM auth_sessions WHERE id = $1":
+		session, exists := memory.sessions[id]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		*dest.(*Session) = *session
+	case "SELECT * FROM auth_api_keys WHERE id = $1":
+		apiKey, exists := memory.apiKeys[id]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		*dest.(*ApiKey) = *apiKey
+	case "SELECT * FROM auth_totp WHERE account_id = $1":
+		totpConfig, exists := memory.totps[id]
+		if !exists {
+			return sql.ErrNoRows
+		}
+		*dest.(*Totp) = *totpConfig
+	default:
+		return fmt.Errorf("%w: %s", errMemoryDBQueryIsNotSupported, query)
+	}
+
+	return nil
+}
+
+func (memory *memoryDB) Select(ctx context.Context, dest any, query string, args ...any) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	accountID := args[0].(uuid.UUID)
+	// ORDER BY id DESC
+	compareIDs := func(a, b uuid.UUID) int {
+		return -slices.Compare(a[:], b[:])
+	}
+
+	switch normalizeQuery(query) {
+	case "SELECT * FROM auth_sessions WHERE account_id = $1 AND expires_at > $2 ORDER BY id DESC":
+		now := args[1].(time.Time)
+		sessions := make([]Session, 0)
+		for _, session := range memory.sessions {
+			if session.AccountID == accountID && session.ExpiresAt.After(now) {
+				sessions = append(sessions, *session)
+			}
+		}
+		slices.SortFunc(sessions, func(a, b Session) int { return compareIDs(a.ID, b.ID) })
+		*dest.(*[]Session) = sessions
+	case "SELECT * FROM auth_api_keys WHERE account_id = $1 ORDER BY id DESC":
+		apiKeys := make([]ApiKey, 0)
+		for _, apiKey := range memory.apiKeys {
+			if apiKey.AccountID == accountID {
+				apiKeys = append(apiKeys, *apiKey)
+			}
+		}
+		slices.SortFunc(apiKeys, func(a, b ApiKey) int { return compareIDs(a.ID, b.ID) })
+		*dest.(*[]ApiKey) = apiKeys
+	case "SELECT * FROM auth_totp_recovery_codes WHERE account_id = $1 AND used_at IS NULL":
+		recoveryCodes := make([]RecoveryCode, 0)
+		for _, recoveryCode := range memory.recoveryCodes {
+			if recoveryCode.AccountID == accountID && recoveryCode.UsedAt == nil {
+				recoveryCodes = append(recoveryCodes, *recoveryCode)
+			}
+		}
+		*dest.(*[]RecoveryCode) = recoveryCodes
+	case "SELECT * FROM auth_totp_recovery_codes WHERE account_id = $1 ORDER BY created_at":
+		recoveryCodes := make([]RecoveryCode, 0)
+		for _, recoveryCode := range memory.recoveryCodes {
+			if recoveryCode.AccountID == accountID {
+				recoveryCodes = append(recoveryCodes, *recoveryCode)
+			}
+		}
+		slices.SortFunc(recoveryCodes, func(a, b RecoveryCode) int { return a.CreatedAt.Compare(b.CreatedAt) })
+		*dest.(*[]RecoveryCode) = recoveryCodes
+	default:
+		return fmt.Errorf("%w: %s", errMemoryDBQueryIsNotSupported, query)
+	}
+
+	return nil
+}
+
+func (memory *memoryDB) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, fmt.Errorf("%w: %s", errMemoryDBQueryIsNotSupported, query)
+}
+
+func (memory *memoryDB) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	var rowsAffected int64
+
+	switch normalizeQuery(query) {
+	case "INSERT INTO auth_accounts (id, created_at, updated_at, password_hash) VALUES ($1, $2, $3, $4)":
+		account := &Account{
+			ID:           args[0].(uuid.UUID),
+			CreatedAt:    args[1].(time.Time),
+			UpdatedAt:    args[2].(time.Time),
+			PasswordHash: args[3].(string),
+		}
+		if _, exists := memory.accounts[account.ID]; exists {
+			return nil, errors.New(db.ErrAlreadyExists + ` "auth_accounts_pkey"`)
+		}
+		memory.accounts[account.ID] = account
+		rowsAffected = 1
+	case "UPDATE auth_accounts SET updated_at = $1, password_hash = $2 WHERE id = $3":
+		if account, exists := memory.accounts[args[2].(uuid.UUID)]; exists {
+			account.UpdatedAt = args[0].(time.Time)
+			account.PasswordHash = args[1].(string)
+			rowsAffected = 1
+		}
+	case "DELETE FROM auth_accounts WHERE id = $1":
+		accountID := args[0].(uuid.UUID)
+		if _, exists := memory.accounts[accountID]; exists {
+			delete(memory.accounts, accountID)
+			// ON DELETE CASCADE
+			deleteFunc(memory.sessions, func(session *Session) bool { return session.AccountID == accountID })
+			deleteFunc(memory.apiKeys, func(apiKey *ApiKey) bool { return apiKey.AccountID == accountID })
+			delete(memory.totps, accountID)
+			deleteFunc(memory.recoveryCodes, func(recoveryCode *RecoveryCode) bool { return recoveryCode.AccountID == accountID })
+			rowsAffected = 1
+		}
+
+	case "INSERT INTO auth_sessions (id, created_at, updated_at, expires_at, token_hash, account_id) VALUES ($1, $2, $3, $4, $5, $6)":
+		session := &Session{
+			ID:        args[0].(uuid.UUID),
+			CreatedAt: args[1].(time.Time),
+			UpdatedAt: args[2].(time.Time),
+			ExpiresAt: args[3].(time.Time),
+			TokenHash: args[4].([]byte),
+			AccountID: args[5].(uuid.UUID),
+		}
+		if _, exists := memory.accounts[session.AccountID]; !exists {
+			return nil, errors.New(`insert or update on table "auth_sessions" violates foreign key constraint`)
+		}
+		memory.sessions[session.ID] = session
+		rowsAffected = 1
+	case "UPDATE auth_sessions SET updated_at = $1, expires_at = $2, token_hash = $3, previous_token_hash = $4 WHERE id = $5 AND token_hash = $4":
+		session, exists := memory.sessions[args[4].(uuid.UUID)]
+		if exists && slices.Equal(session.TokenHash, args[3].([]byte)) {
+			session.UpdatedAt = args[0].(time.Time)
+			session.ExpiresAt = args[1].(time.Time)
+			session.TokenHash = args[2].([]byte)
+			session.PreviousTokenHash = args[3].([]byte)
+			rowsAffected = 1
+		}
+	case "DELETE FROM auth_sessions WHERE id = $1 AND account_id = $2":
+		session, exists := memory.sessions[args[0].(uuid.UUID)]
+		if exists && session.AccountID == args[1].(uuid.UUID) {
+			delete(memory.sessions, session.ID)
+			rowsAffected = 1
+		}
+	case "DELETE FROM auth_sessions WHERE account_id = $1":
+		accountID := args[0].(uuid.UUID)
+		rowsAffected = deleteFunc(memory.sessions, func(session *Session) bool { return session.AccountID == accountID })
+	case "DELETE FROM auth_sessions WHERE expires_at <= $1":
+		now := args[0].(time.Time)
+		rowsAffected = deleteFunc(memory.sessions, func(session *Session) bool { return !session.ExpiresAt.After(now) })
+
+	case "INSERT INTO auth_api_keys (id, created_at, updated_at, name, expires_at, revoked_at, token_hash, scopes, account_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)":
+		apiKey := &ApiKey{
+			ID:        args[0].(uuid.UUID),
+			CreatedAt: args[1].(time.Time),
+			UpdatedAt: args[2].(time.Time),
+			Name:      args[3].(string),
+			ExpiresAt: args[4].(*time.Time),
+			RevokedAt: args[5].(*time.Time),
+			TokenHash: args[6].([]byte),
+			AccountID: args[8].(uuid.UUID),
+		}
+		// scopes are stored as a string, like in the database
+		scopes, err := args[7].(driver.Valuer).Value()
+		if err != nil {
+			return nil, err
+		}
+		err = apiKey.Scopes.Scan(scopes)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := memory.accounts[apiKey.AccountID]; !exists {
+			return nil, errors.New(`insert or update on table "auth_api_keys" violates foreign key constraint`)
+		}
+		memory.apiKeys[apiKey.ID] = apiKey
+		rowsAffected = 1
+	case "UPDATE auth_api_keys SET updated_at = $1, revoked_at = $1 WHERE id = $2 AND account_id = $3 AND revoked_at IS NULL":
+		apiKey, exists := memory.apiKeys[args[1].(uuid.UUID)]
+		if exists && apiKey.AccountID == args[2].(uuid.UUID) && apiKey.RevokedAt == nil {
+			now := args[0].(time.Time)
+			apiKey.UpdatedAt = now
+			apiKey.RevokedAt = &now
+			rowsAffected = 1
+		}
+	case "DELETE FROM auth_api_keys WHERE id = $1 AND account_id = $2":
+		apiKey, exists := memory.apiKeys[args[0].(uuid.UUID)]
+		if exists && apiKey.AccountID == args[1].(uuid.UUID) {
+			delete(memory.apiKeys, apiKey.ID)
+			rowsAffected = 1
+		}
+
+	case "INSERT INTO auth_totp (account_id, created_at, updated_at, secret, confirmed_at, last_used_step) VALUES ($1, $2, $2, $3, NULL, 0) ON CONFLICT (account_id) DO UPDATE SET created_at = $2, updated_at = $2, secret = $3, last_used_step = 0 WHERE auth_totp.confirmed_at IS NULL":
+		accountID := args[0].(uuid.UUID)
+		now := args[1].(time.Time)
+		if _, exists := memory.accounts[accountID]; !exists {
+			return nil, errors.New(`insert or update on table "auth_totp" violates foreign key constraint`)
+		}
+		totpConfig, exists := memory.totps[accountID]
+		if !exists {
+			memory.totps[accountID] = &Totp{AccountID: accountID, CreatedAt: now, UpdatedAt: now, Secret: args[2].(string)}
+			rowsAffected = 1
+		} else if totpConfig.ConfirmedAt == nil {
+			totpConfig.CreatedAt = now
+			totpConfig.UpdatedAt = now
+			totpConfig.Secret = args[2].(string)
+			totpConfig.LastUsedStep = 0
+			rowsAffected = 1
+		}
+	case "UPDATE auth_totp SET updated_at = $1, confirmed_at = $1, last_used_step = $2 WHERE account_id = $3 AND confirmed_at IS NULL":
+		totpConfig, exists := memory.totps[args[2].(uuid.UUID)]
+		if exists && totpConfig.ConfirmedAt == nil {
+			now := args[0].(time.Time)
+			totpConfig.UpdatedAt = now
+			totpConfig.ConfirmedAt = &now
+			totpConfig.LastUsedStep = args[1].(int64)
+			rowsAffected = 1
+		}
+	case "UPDATE auth_totp SET updated_at = $1, last_used_step = $2 WHERE account_id = $3 AND last_used_step < $2":
+		totpConfig, exists := memory.totps[args[2].(uuid.UUID)]
+		if exists && totpConfig.LastUsedStep < args[1].(int64) {
+			totpConfig.UpdatedAt = args[0].(time.Time)
+			totpConfig.LastUsedStep = args[1].(int64)
+			rowsAffected = 1
+		}
+	case "DELETE FROM auth_totp WHERE account_id = $1":
+		accountID := args[0].(uuid.UUID)
+		if _, exists := memory.totps[accountID]; exists {
+			delete(memory.totps, accountID)
+			rowsAffected = 1
+		}
+
+	case "INSERT INTO auth_totp_recovery_codes (id, created_at, updated_at, code_hash, used_at, account_id) VALUES ($1, $2, $2, $3, NULL, $4)":
+		recoveryCode := &RecoveryCode{
+			ID:        args[0].(uuid.UUID),
+			CreatedAt: args[1].(time.Time),
+			UpdatedAt: args[1].(time.Time),
+			CodeHash:  args[2].(string),
+			AccountID: args[3].(uuid.UUID),
+		}
+		if _, exists := memory.accounts[recoveryCode.AccountID]; !exists {
+			return nil, errors.New(`insert or update on table "auth_totp_recovery_codes" violates foreign key constraint`)
+		}
+		memory.recoveryCodes[recoveryCode.ID] = recoveryCode
+		rowsAffected = 1
+	case "UPDATE auth_totp_recovery_codes SET updated_at = $1, used_at = $1 WHERE id = $2 AND used_at IS NULL":
+		recoveryCode, exists := memory.recoveryCodes[args[1].(uuid.UUID)]
+		if exists && recoveryCode.UsedAt == nil {
+			now := args[0].(time.Time)
+			recoveryCode.UpdatedAt = now
+			recoveryCode.UsedAt = &now
+			rowsAffected = 1
+		}
+	case "DELETE FROM auth_totp_recovery_codes WHERE account_id = $1":
+		accountID := args[0].(uuid.UUID)
+		rowsAffected = deleteFunc(memory.recoveryCodes, func(recoveryCode *RecoveryCode) bool { return recoveryCode.AccountID == accountID })
+
+	default:
+		return nil, fmt.Errorf("%w: %s", errMemoryDBQueryIsNotSupported, query)
+	}
+
+	return driver.RowsAffected(rowsAffected), nil
+}
+
+func (memory *memoryDB) Rebind(query string) string {
+	return query
+}
+
+// deleteFunc deletes the rows of table for which del returns true and returns the number of deleted rows.
+func deleteFunc[T any](table map[uuid.UUID]*T, del func(row *T) bool) (deleted int64) {
+	for id, row := range table {
+		if del(row) {
+			delete(table, id)
+			deleted += 1
+		}
+	}
+	return
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS auth_api_keys;
+DROP TABLE IF EXISTS auth_sessions;
+DROP TABLE IF EXISTS auth_accounts;
@@ -0,0 +1,36 @@
+CREATE TABLE auth_accounts (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  password_hash TEXT NOT NULL
+);
+
+
+CREATE TABLE auth_sessions (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  token_hash BYTEA NOT NULL,
+
+  account_id UUID NOT NULL REFERENCES auth_accounts(id) ON DELETE CASCADE
+);
+CREATE INDEX index_auth_sessions_on_account_id ON auth_sessions (account_id);
+CREATE INDEX index_auth_sessions_on_expires_at ON auth_sessions (expires_at);
+
+
+CREATE TABLE auth_api_keys (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  name TEXT NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE,
+  revoked_at TIMESTAMP WITH TIME ZONE,
+  token_hash BYTEA NOT NULL,
+
+  account_id UUID NOT NULL REFERENCES auth_accounts(id) ON DELETE CASCADE
+);
+CREATE INDEX index_auth_api_keys_on_account_id ON auth_api_keys (account_id);
@@ -0,0 +1,3 @@
+ALTER TABLE auth_api_keys DROP COLUMN scopes;
+
+ALTER TABLE auth_sessions DROP COLUMN previous_token_hash;
@@ -0,0 +1,3 @@
+ALTER TABLE auth_sessions ADD COLUMN previous_token_hash BYTEA;
+
+ALTER TABLE auth_api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
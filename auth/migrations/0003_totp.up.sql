@@ -0,0 +1,22 @@
+CREATE TABLE auth_totp (
+  account_id UUID PRIMARY KEY REFERENCES auth_accounts(id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  secret TEXT NOT NULL,
+  confirmed_at TIMESTAMP WITH TIME ZONE,
+  last_used_step BIGINT NOT NULL
+);
+
+
+CREATE TABLE auth_totp_recovery_codes (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+
+  account_id UUID NOT NULL REFERENCES auth_accounts(id) ON DELETE CASCADE
+);
+CREATE INDEX index_auth_totp_recovery_codes_on_account_id ON auth_totp_recovery_codes (account_id);
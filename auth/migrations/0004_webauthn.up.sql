@@ -0,0 +1,17 @@
+CREATE TABLE auth_webauthn_credentials (
+  id BYTEA PRIMARY KEY,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  name TEXT NOT NULL,
+  public_key BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL,
+  aaguid BYTEA NOT NULL,
+  transports TEXT NOT NULL,
+  backup_eligible BOOLEAN NOT NULL,
+  backed_up BOOLEAN NOT NULL,
+  last_used_at TIMESTAMP WITH TIME ZONE,
+
+  account_id UUID NOT NULL REFERENCES auth_accounts(id) ON DELETE CASCADE
+);
+CREATE INDEX index_auth_webauthn_credentials_on_account_id ON auth_webauthn_credentials (account_id);
@@ -2,32 +2,187 @@ package auth
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/bloom42/stdx-go/db"
 	"github.com/bloom42/stdx-go/uuid"
 )
 
+// SessionDuration is the duration after which a session expires if it has not been refreshed.
+var SessionDuration = 30 * 24 * time.Hour
+
+// SessionRefreshGracePeriod is the duration during which the previous token of a session remains valid
+// after the session has been refreshed, so concurrent requests that were sent with the previous token
+// don't fail.
+var SessionRefreshGracePeriod = time.Minute
+
 type Session struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        uuid.UUID `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 
-	AccountID uuid.UUID
+	ExpiresAt         time.Time `db:"expires_at" json:"expires_at"`
+	TokenHash         []byte    `db:"token_hash" json:"-"`
+	PreviousTokenHash []byte    `db:"previous_token_hash" json:"-"`
+
+	AccountID uuid.UUID `db:"account_id" json:"account_id"`
 }
 
+// CreateSession creates a new session for the account and returns the token of the session. The token is
+// only known by the caller, so it should be sent to the client.
 func CreateSession(ctx context.Context, db db.Queryer, accountID uuid.UUID) (token string, err error) {
-	panic("TODO")
+	now := time.Now().UTC()
+	session := Session{
+		ID:        uuid.NewV7(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(SessionDuration),
+		AccountID: accountID,
+	}
+	token, session.TokenHash = generateToken(SessionTokenPrefix, session.ID)
+
+	const query = `INSERT INTO auth_sessions (id, created_at, updated_at, expires_at, token_hash, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = db.Exec(ctx, query, session.ID, session.CreatedAt, session.UpdatedAt, session.ExpiresAt,
+		session.TokenHash, session.AccountID)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetSessionByToken returns the session identified by token if the token is valid and the session has not
+// expired.
+// The previous token of a session is accepted during SessionRefreshGracePeriod after a refresh.
+func GetSessionByToken(ctx context.Context, db db.Queryer, token string) (session Session, err error) {
+	session, _, err = getSessionByToken(ctx, db, token)
+	return
 }
 
+func getSessionByToken(ctx context.Context, db db.Queryer, token string) (session Session, isPreviousToken bool, err error) {
+	sessionID, tokenHash, err := parseToken(SessionTokenPrefix, token)
+	if err != nil {
+		return
+	}
+
+	session, err = getSession(ctx, db, sessionID)
+	if err != nil {
+		return
+	}
+
+	err = verifyTokenHash(tokenHash, session.TokenHash)
+	if err != nil {
+		if session.PreviousTokenHash == nil || time.Since(session.UpdatedAt) > SessionRefreshGracePeriod {
+			return
+		}
+		err = verifyTokenHash(tokenHash, session.PreviousTokenHash)
+		if err != nil {
+			return
+		}
+		isPreviousToken = true
+	}
+
+	if !session.ExpiresAt.After(time.Now()) {
+		err = ErrSessionExpired
+		return
+	}
+
+	return
+}
+
+// GetSessionsForAccount returns the active (not expired) sessions of the account, the most recent first.
 func GetSessionsForAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID) (sessions []Session, err error) {
-	panic("TODO")
+	sessions = make([]Session, 0)
+
+	const query = `SELECT * FROM auth_sessions
+		WHERE account_id = $1 AND expires_at > $2
+		ORDER BY id DESC`
+	err = db.Select(ctx, &sessions, query, accountID, time.Now().UTC())
+	return
 }
 
+// RefreshSession replaces the token of the session identified by oldToken with a new one and extends the
+// expiration of the session by SessionDuration. oldToken is no longer valid once SessionRefreshGracePeriod
+// has elapsed.
 func RefreshSession(ctx context.Context, db db.Queryer, oldToken string) (newToken string, err error) {
-	panic("TODO")
+	session, isPreviousToken, err := getSessionByToken(ctx, db, oldToken)
+	if err != nil {
+		return
+	}
+
+	// the session has already been refreshed with this token
+	if isPreviousToken {
+		err = ErrTokenIsNotValid
+		return
+	}
+
+	now := time.Now().UTC()
+	newToken, newTokenHash := generateToken(SessionTokenPrefix, session.ID)
+
+	// the condition on token_hash guarantees that a token can be refreshed only once even when
+	// concurrent requests try to refresh the same session
+	const query = `UPDATE auth_sessions SET updated_at = $1, expires_at = $2, token_hash = $3, previous_token_hash = $4
+		WHERE id = $5 AND token_hash = $4`
+	res, err := db.Exec(ctx, query, now, now.Add(SessionDuration), newTokenHash, session.TokenHash, session.ID)
+	if err != nil {
+		return "", err
+	}
+	err = checkRowsAffected(res, ErrSessionNotFound)
+	if err != nil {
+		return "", err
+	}
+
+	return newToken, nil
 }
 
+// DeleteSession deletes (revokes) the session identified by token.
 func DeleteSession(ctx context.Context, db db.Queryer, token string) (err error) {
-	panic("TODO")
+	session, err := GetSessionByToken(ctx, db, token)
+	if err != nil && !errors.Is(err, ErrSessionExpired) {
+		return
+	}
+
+	return DeleteSessionByID(ctx, db, session.AccountID, session.ID)
+}
+
+// DeleteSessionByID deletes (revokes) a session of the account. It can be used to revoke a session
+// listed by GetSessionsForAccount.
+func DeleteSessionByID(ctx context.Context, db db.Queryer, accountID, sessionID uuid.UUID) (err error) {
+	const query = "DELETE FROM auth_sessions WHERE id = $1 AND account_id = $2"
+	res, err := db.Exec(ctx, query, sessionID, accountID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, ErrSessionNotFound)
+}
+
+// DeleteSessionsForAccount deletes (revokes) all the sessions of the account.
+func DeleteSessionsForAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID) (err error) {
+	const query = "DELETE FROM auth_sessions WHERE account_id = $1"
+	_, err = db.Exec(ctx, query, accountID)
+	return err
+}
+
+// DeleteExpiredSessions deletes the sessions that have expired. It should be called periodically.
+func DeleteExpiredSessions(ctx context.Context, db db.Queryer) (err error) {
+	const query = "DELETE FROM auth_sessions WHERE expires_at <= $1"
+	_, err = db.Exec(ctx, query, time.Now().UTC())
+	return err
+}
+
+func getSession(ctx context.Context, db db.Queryer, sessionID uuid.UUID) (session Session, err error) {
+	const query = "SELECT * FROM auth_sessions WHERE id = $1"
+	err = db.Get(ctx, &session, query, sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrSessionNotFound
+		}
+		return
+	}
+
+	return
 }
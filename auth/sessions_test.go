@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	database := newMemoryDB()
+	accountID := createTestAccount(t, database, "password")
+	otherAccountID := createTestAccount(t, database, "password")
+
+	token, err := CreateSession(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := CreateSession(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := GetSessionByToken(ctx, database, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.AccountID.Equal(accountID) {
+		t.Errorf("session.AccountID = %s, want %s", session.AccountID, accountID)
+	}
+	if expiresIn := time.Until(session.ExpiresAt); expiresIn <= SessionDuration-time.Minute || expiresIn > SessionDuration {
+		t.Errorf("the session should expire in %s, not %s", SessionDuration, expiresIn)
+	}
+
+	// tokens are checked against their hash, not only their ID
+	forgedToken, _ := generateToken(SessionTokenPrefix, session.ID)
+	invalidTokens := map[string]error{
+		"":          ErrTokenIsNotValid,
+		"session_":  ErrTokenIsNotValid,
+		forgedToken: ErrTokenIsNotValid,
+	}
+	unknownToken, _ := generateToken(SessionTokenPrefix, uuid.NewV7())
+	invalidTokens[unknownToken] = ErrSessionNotFound
+	for invalidToken, expectedErr := range invalidTokens {
+		if _, err = GetSessionByToken(ctx, database, invalidToken); !errors.Is(err, expectedErr) {
+			t.Errorf("GetSessionByToken(%q): err = %v, want %v", invalidToken, err, expectedErr)
+		}
+	}
+
+	sessions, err := GetSessionsForAccount(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	// expired sessions are rejected, not listed and cleaned up by DeleteExpiredSessions
+	database.sessions[session.ID].ExpiresAt = time.Now().Add(-time.Second)
+	if _, err = GetSessionByToken(ctx, database, token); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expired session: err = %v, want %v", err, ErrSessionExpired)
+	}
+	if _, err = RefreshSession(ctx, database, token); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("refreshing an expired session: err = %v, want %v", err, ErrSessionExpired)
+	}
+	sessions, err = GetSessionsForAccount(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID.Equal(session.ID) {
+		t.Errorf("expired sessions should not be listed: %+v", sessions)
+	}
+	err = DeleteExpiredSessions(ctx, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetSessionByToken(ctx, database, token); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("deleted expired session: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	if _, err = GetSessionByToken(ctx, database, otherToken); err != nil {
+		t.Errorf("active sessions should not be deleted by DeleteExpiredSessions: %v", err)
+	}
+
+	// sessions can only be revoked by their account
+	otherSession, err := GetSessionByToken(ctx, database, otherToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = DeleteSessionByID(ctx, database, otherAccountID, otherSession.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking the session of another account: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	err = DeleteSession(ctx, database, otherToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetSessionByToken(ctx, database, otherToken); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoked session: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	if err = DeleteSession(ctx, database, otherToken); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking a revoked session: err = %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	ctx := context.Background()
+	database := newMemoryDB()
+	accountID := createTestAccount(t, database, "password")
+
+	oldToken, err := CreateSession(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := GetSessionByToken(ctx, database, oldToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.sessions[session.ID].ExpiresAt = time.Now().Add(time.Hour)
+
+	newToken, err := RefreshSession(ctx, database, oldToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newToken == oldToken {
+		t.Fatal("the token should change when the session is refreshed")
+	}
+	refreshedSession, err := GetSessionByToken(ctx, database, newToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !refreshedSession.ID.Equal(session.ID) || time.Until(refreshedSession.ExpiresAt) <= time.Hour {
+		t.Errorf("the expiration of the session should be extended: %s", refreshedSession.ExpiresAt)
+	}
+
+	// the old token remains valid during the grace period, but can't be used to refresh the session again
+	if _, err = GetSessionByToken(ctx, database, oldToken); err != nil {
+		t.Errorf("old token during the grace period: %v", err)
+	}
+	if _, err = RefreshSession(ctx, database, oldToken); !errors.Is(err, ErrTokenIsNotValid) {
+		t.Errorf("refreshing with the old token: err = %v, want %v", err, ErrTokenIsNotValid)
+	}
+
+	database.sessions[session.ID].UpdatedAt = time.Now().Add(-SessionRefreshGracePeriod - time.Second)
+	if _, err = GetSessionByToken(ctx, database, oldToken); !errors.Is(err, ErrTokenIsNotValid) {
+		t.Errorf("old token after the grace period: err = %v, want %v", err, ErrTokenIsNotValid)
+	}
+	if _, err = GetSessionByToken(ctx, database, newToken); err != nil {
+		t.Errorf("new token after the grace period: %v", err)
+	}
+}
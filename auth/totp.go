@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/db"
+	"github.com/bloom42/stdx-go/otp"
+	"github.com/bloom42/stdx-go/otp/hotp"
+	"github.com/bloom42/stdx-go/otp/totp"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+const (
+	// TotpPeriod is the number of seconds a TOTP code is valid for.
+	TotpPeriod = 30
+	// TotpSkew is the number of periods before or after the current time that are accepted, to account for
+	// clock drift between the server and the authenticator app.
+	TotpSkew = 1
+
+	// RecoveryCodesCount is the number of recovery codes generated for an account.
+	RecoveryCodesCount = 10
+	recoveryCodeLength = 10
+	// the 31 lowercase letters and digits that are not easily confused with each other (0/o, 1/l/i)
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// RecoveryCodeHashParams are the parameters used to hash recovery codes. Recovery codes are randomly
+// generated with ~49 bits of entropy, so they don't need the cost of DefaultHashPasswordParams, and all the
+// unused codes of an account have to be checked each time a code is used.
+var RecoveryCodeHashParams = crypto.HashPasswordParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  crypto.KeySize256,
+	KeyLength:   crypto.KeySize256,
+}
+
+var (
+	ErrTotpNotEnabled            = errors.New("auth: two-factor authentication is not enabled")
+	ErrTotpAlreadyEnabled        = errors.New("auth: two-factor authentication is already enabled")
+	ErrTotpEnrollmentNotFound    = errors.New("auth: two-factor authentication enrollment not found")
+	ErrTotpCodeIsNotValid        = errors.New("auth: two-factor authentication code is not valid")
+	ErrRecoveryCodeIsNotValid    = errors.New("auth: recovery code is not valid")
+	ErrTotpIssuerIsNotValid      = errors.New("auth: two-factor authentication issuer is not valid")
+	ErrTotpAccountNameIsNotValid = errors.New("auth: two-factor authentication account name is not valid")
+)
+
+// Totp is the TOTP two-factor authentication configuration of an account.
+type Totp struct {
+	AccountID uuid.UUID `db:"account_id" json:"account_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	// Secret is the base32-encoded TOTP secret. Unlike a password, it can't be hashed because it is needed
+	// to compute the expected codes, so it is stored in plaintext: an attacker who can read the database can
+	// generate valid codes, but still needs the password of the account. Applications that need to protect
+	// the secrets at rest should encrypt the database (or the column) at the storage level.
+	Secret string `db:"secret" json:"-"`
+	// ConfirmedAt is nil until the enrollment has been confirmed with a first valid code.
+	ConfirmedAt *time.Time `db:"confirmed_at" json:"confirmed_at"`
+	// LastUsedStep is the TOTP time step (unix time / TotpPeriod) of the last accepted code. Codes of this
+	// step or of previous steps are rejected to prevent replay attacks.
+	LastUsedStep int64 `db:"last_used_step" json:"-"`
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	CodeHash string     `db:"code_hash" json:"-"`
+	UsedAt   *time.Time `db:"used_at" json:"used_at"`
+
+	AccountID uuid.UUID `db:"account_id" json:"account_id"`
+}
+
+// StartTotpEnrollment generates a new TOTP secret for the account and returns the key that should be
+// displayed to the user (key.QrCode or key.Secret). Two-factor authentication is enabled only once
+// the enrollment is confirmed with ConfirmTotpEnrollment.
+// Starting a new enrollment replaces any pending (unconfirmed) enrollment.
+func StartTotpEnrollment(ctx context.Context, db db.Queryer, accountID uuid.UUID, issuer, accountName string) (key *otp.Key, err error) {
+	if issuer == "" {
+		return nil, ErrTotpIssuerIsNotValid
+	}
+	if accountName == "" {
+		return nil, ErrTotpAccountNameIsNotValid
+	}
+
+	key, err = totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: accountName,
+		Period:      TotpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	const query = `INSERT INTO auth_totp (account_id, created_at, updated_at, secret, confirmed_at, last_used_step)
+		VALUES ($1, $2, $2, $3, NULL, 0)
+		ON CONFLICT (account_id) DO UPDATE SET created_at = $2, updated_at = $2, secret = $3, last_used_step = 0
+		WHERE auth_totp.confirmed_at IS NULL`
+	res, err := db.Exec(ctx, query, accountID, now, key.Secret())
+	if err != nil {
+		return nil, err
+	}
+	err = checkRowsAffected(res, ErrTotpAlreadyEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ConfirmTotpEnrollment enables two-factor authentication for the account if code is valid for the pending
+// enrollment, and returns the recovery codes that should be displayed to the user. They are never displayed
+// again.
+// It executes several queries, so db should be a transaction.
+func ConfirmTotpEnrollment(ctx context.Context, db db.Queryer, accountID uuid.UUID, code string) (recoveryCodes []string, err error) {
+	totpConfig, err := getTotp(ctx, db, accountID)
+	if err != nil {
+		if errors.Is(err, ErrTotpNotEnabled) {
+			err = ErrTotpEnrollmentNotFound
+		}
+		return nil, err
+	}
+	if totpConfig.ConfirmedAt != nil {
+		return nil, ErrTotpAlreadyEnabled
+	}
+
+	step, err := validateTotpCode(totpConfig, code, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	const query = `UPDATE auth_totp SET updated_at = $1, confirmed_at = $1, last_used_step = $2
+		WHERE account_id = $3 AND confirmed_at IS NULL`
+	res, err := db.Exec(ctx, query, now, step, accountID)
+	if err != nil {
+		return nil, err
+	}
+	err = checkRowsAffected(res, ErrTotpEnrollmentNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	return RegenerateRecoveryCodes(ctx, db, accountID)
+}
+
+// IsTotpEnabled returns true if the account has a confirmed TOTP two-factor authentication.
+func IsTotpEnabled(ctx context.Context, db db.Queryer, accountID uuid.UUID) (enabled bool, err error) {
+	totpConfig, err := getTotp(ctx, db, accountID)
+	if err != nil {
+		if errors.Is(err, ErrTotpNotEnabled) {
+			err = nil
+		}
+		return false, err
+	}
+
+	return totpConfig.ConfirmedAt != nil, nil
+}
+
+// ValidateTotp validates a TOTP code during login. A code can be used only once: codes from a time step
+// lower than or equal to the one of the last accepted code are rejected.
+func ValidateTotp(ctx context.Context, db db.Queryer, accountID uuid.UUID, code string) (err error) {
+	totpConfig, err := getTotp(ctx, db, accountID)
+	if err != nil {
+		return err
+	}
+	if totpConfig.ConfirmedAt == nil {
+		return ErrTotpNotEnabled
+	}
+
+	step, err := validateTotpCode(totpConfig, code, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// the condition on last_used_step guarantees that the same code can't be accepted twice by concurrent
+	// requests
+	const query = `UPDATE auth_totp SET updated_at = $1, last_used_step = $2
+		WHERE account_id = $3 AND last_used_step < $2`
+	res, err := db.Exec(ctx, query, time.Now().UTC(), step, accountID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, ErrTotpCodeIsNotValid)
+}
+
+// UseRecoveryCode validates a recovery code during login, as an alternative to ValidateTotp. Each recovery
+// code can be used only once.
+func UseRecoveryCode(ctx context.Context, db db.Queryer, accountID uuid.UUID, code string) (err error) {
+	enabled, err := IsTotpEnabled(ctx, db, accountID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTotpNotEnabled
+	}
+
+	recoveryCodes := make([]RecoveryCode, 0, RecoveryCodesCount)
+	const selectQuery = "SELECT * FROM auth_totp_recovery_codes WHERE account_id = $1 AND used_at IS NULL"
+	err = db.Select(ctx, &recoveryCodes, selectQuery, accountID)
+	if err != nil {
+		return err
+	}
+
+	normalizedCode := []byte(normalizeRecoveryCode(code))
+	for _, recoveryCode := range recoveryCodes {
+		if !crypto.VerifyPasswordHash(normalizedCode, recoveryCode.CodeHash) {
+			continue
+		}
+
+		now := time.Now().UTC()
+		const updateQuery = `UPDATE auth_totp_recovery_codes SET updated_at = $1, used_at = $1
+			WHERE id = $2 AND used_at IS NULL`
+		res, err := db.Exec(ctx, updateQuery, now, recoveryCode.ID)
+		if err != nil {
+			return err
+		}
+		return checkRowsAffected(res, ErrRecoveryCodeIsNotValid)
+	}
+
+	return ErrRecoveryCodeIsNotValid
+}
+
+// GetRecoveryCodesForAccount returns the recovery codes of the account, including the used ones.
+func GetRecoveryCodesForAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID) (recoveryCodes []RecoveryCode, err error) {
+	recoveryCodes = make([]RecoveryCode, 0, RecoveryCodesCount)
+
+	const query = "SELECT * FROM auth_totp_recovery_codes WHERE account_id = $1 ORDER BY created_at"
+	err = db.Select(ctx, &recoveryCodes, query, accountID)
+	return
+}
+
+// RegenerateRecoveryCodes deletes the existing recovery codes of the account and returns
+// RecoveryCodesCount new codes.
+// It executes several queries, so db should be a transaction.
+func RegenerateRecoveryCodes(ctx context.Context, db db.Queryer, accountID uuid.UUID) (recoveryCodes []string, err error) {
+	_, err = db.Exec(ctx, "DELETE FROM auth_totp_recovery_codes WHERE account_id = $1", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	recoveryCodes = make([]string, RecoveryCodesCount)
+	for i := range recoveryCodes {
+		recoveryCodes[i] = generateRecoveryCode()
+		codeHash := crypto.HashPassword([]byte(normalizeRecoveryCode(recoveryCodes[i])), RecoveryCodeHashParams)
+
+		const query = `INSERT INTO auth_totp_recovery_codes (id, created_at, updated_at, code_hash, used_at, account_id)
+			VALUES ($1, $2, $2, $3, NULL, $4)`
+		_, err = db.Exec(ctx, query, uuid.NewV7(), now, codeHash, accountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTotp disables two-factor authentication for the account and deletes its recovery codes.
+// The account can then be enrolled again with StartTotpEnrollment.
+// It executes several queries, so db should be a transaction.
+func DisableTotp(ctx context.Context, db db.Queryer, accountID uuid.UUID) (err error) {
+	_, err = db.Exec(ctx, "DELETE FROM auth_totp_recovery_codes WHERE account_id = $1", accountID)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.Exec(ctx, "DELETE FROM auth_totp WHERE account_id = $1", accountID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, ErrTotpNotEnabled)
+}
+
+func getTotp(ctx context.Context, db db.Queryer, accountID uuid.UUID) (totpConfig Totp, err error) {
+	const query = "SELECT * FROM auth_totp WHERE account_id = $1"
+	err = db.Get(ctx, &totpConfig, query, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrTotpNotEnabled
+		}
+		return
+	}
+
+	return
+}
+
+// validateTotpCode checks code against the time steps around now and returns the time step that matched.
+// Time steps lower than or equal to totpConfig.LastUsedStep are never accepted.
+func validateTotpCode(totpConfig Totp, code string, now time.Time) (step int64, err error) {
+	code = strings.TrimSpace(code)
+	currentStep := now.Unix() / TotpPeriod
+
+	for step = currentStep - TotpSkew; step <= currentStep+TotpSkew; step += 1 {
+		if step <= totpConfig.LastUsedStep {
+			continue
+		}
+
+		valid, err := hotp.ValidateCustom(code, uint64(step), totpConfig.Secret, hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, ErrTotpCodeIsNotValid
+		}
+		if valid {
+			return step, nil
+		}
+	}
+
+	return 0, ErrTotpCodeIsNotValid
+}
+
+// generateRecoveryCode returns a random code formatted as "xxxxx-xxxxx".
+func generateRecoveryCode() string {
+	code := make([]byte, 0, recoveryCodeLength+1)
+	for i := 0; i < recoveryCodeLength; i += 1 {
+		if i == recoveryCodeLength/2 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[crypto.RandInt64Between(0, int64(len(recoveryCodeAlphabet)))])
+	}
+	return string(code)
+}
+
+// normalizeRecoveryCode removes the separators and whitespace that users may type and lowercases the code.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
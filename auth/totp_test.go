@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/otp/totp"
+)
+
+func TestValidateTotpCode(t *testing.T) {
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "stdx", AccountName: "test@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totpConfig := Totp{Secret: key.Secret()}
+	now := time.Now()
+	currentStep := now.Unix() / TotpPeriod
+
+	code, err := totp.GenerateCode(key.Secret(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, err := validateTotpCode(totpConfig, code, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step != currentStep {
+		t.Errorf("step = %d, want %d", step, currentStep)
+	}
+
+	// replay of the same code
+	totpConfig.LastUsedStep = step
+	_, err = validateTotpCode(totpConfig, code, now)
+	if !errors.Is(err, ErrTotpCodeIsNotValid) {
+		t.Errorf("replayed code: err = %v, want %v", err, ErrTotpCodeIsNotValid)
+	}
+
+	// the code of the next period is accepted thanks to the skew
+	nextCode, err := totp.GenerateCode(key.Secret(), now.Add(TotpPeriod*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, err = validateTotpCode(totpConfig, nextCode, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step != currentStep+1 {
+		t.Errorf("step = %d, want %d", step, currentStep+1)
+	}
+
+	// codes outside of the skew are rejected
+	totpConfig.LastUsedStep = 0
+	oldCode, err := totp.GenerateCode(key.Secret(), now.Add(-3*TotpPeriod*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = validateTotpCode(totpConfig, oldCode, now)
+	if !errors.Is(err, ErrTotpCodeIsNotValid) {
+		t.Errorf("old code: err = %v, want %v", err, ErrTotpCodeIsNotValid)
+	}
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code := generateRecoveryCode()
+	if len(code) != recoveryCodeLength+1 || code[recoveryCodeLength/2] != '-' {
+		t.Errorf("recovery code (%s) is not well formatted", code)
+	}
+
+	normalizedCode := normalizeRecoveryCode(code)
+	if strings.Contains(normalizedCode, "-") || len(normalizedCode) != recoveryCodeLength {
+		t.Errorf("normalizeRecoveryCode(%s) = %s", code, normalizedCode)
+	}
+
+	if userInput := " " + strings.ToUpper(code) + "\n"; normalizeRecoveryCode(userInput) != normalizedCode {
+		t.Errorf("normalizeRecoveryCode(%q) = %s, want %s", userInput, normalizeRecoveryCode(userInput), normalizedCode)
+	}
+}
+
+func TestTotp(t *testing.T) {
+	ctx := context.Background()
+	database := newMemoryDB()
+	accountID := createTestAccount(t, database, "password")
+
+	err := ValidateTotp(ctx, database, accountID, "000000")
+	if !errors.Is(err, ErrTotpNotEnabled) {
+		t.Errorf("not enrolled: err = %v, want %v", err, ErrTotpNotEnabled)
+	}
+	_, err = ConfirmTotpEnrollment(ctx, database, accountID, "000000")
+	if !errors.Is(err, ErrTotpEnrollmentNotFound) {
+		t.Errorf("not enrolled: err = %v, want %v", err, ErrTotpEnrollmentNotFound)
+	}
+
+	// a pending enrollment can be replaced, and doesn't enable two-factor authentication
+	_, err = StartTotpEnrollment(ctx, database, accountID, "stdx", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := StartTotpEnrollment(ctx, database, accountID, "stdx", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled, err := IsTotpEnabled(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled {
+		t.Error("two-factor authentication must not be enabled before the enrollment is confirmed")
+	}
+	err = ValidateTotp(ctx, database, accountID, "000000")
+	if !errors.Is(err, ErrTotpNotEnabled) {
+		t.Errorf("pending enrollment: err = %v, want %v", err, ErrTotpNotEnabled)
+	}
+
+	_, err = ConfirmTotpEnrollment(ctx, database, accountID, "abcdef")
+	if !errors.Is(err, ErrTotpCodeIsNotValid) {
+		t.Errorf("wrong code: err = %v, want %v", err, ErrTotpCodeIsNotValid)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := ConfirmTotpEnrollment(ctx, database, accountID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recoveryCodes) != RecoveryCodesCount {
+		t.Errorf("%d recovery codes, want %d", len(recoveryCodes), RecoveryCodesCount)
+	}
+	enabled, err = IsTotpEnabled(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enabled {
+		t.Error("two-factor authentication must be enabled once the enrollment is confirmed")
+	}
+
+	_, err = StartTotpEnrollment(ctx, database, accountID, "stdx", "test@example.com")
+	if !errors.Is(err, ErrTotpAlreadyEnabled) {
+		t.Errorf("enrollment when enabled: err = %v, want %v", err, ErrTotpAlreadyEnabled)
+	}
+	_, err = ConfirmTotpEnrollment(ctx, database, accountID, code)
+	if !errors.Is(err, ErrTotpAlreadyEnabled) {
+		t.Errorf("confirmation when enabled: err = %v, want %v", err, ErrTotpAlreadyEnabled)
+	}
+
+	// the code used to confirm the enrollment can't be replayed
+	err = ValidateTotp(ctx, database, accountID, code)
+	if !errors.Is(err, ErrTotpCodeIsNotValid) {
+		t.Errorf("replayed code: err = %v, want %v", err, ErrTotpCodeIsNotValid)
+	}
+
+	nextCode, err := totp.GenerateCode(key.Secret(), time.Now().Add(TotpPeriod*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateTotp(ctx, database, accountID, nextCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateTotp(ctx, database, accountID, nextCode)
+	if !errors.Is(err, ErrTotpCodeIsNotValid) {
+		t.Errorf("replayed code: err = %v, want %v", err, ErrTotpCodeIsNotValid)
+	}
+	// once a code has been accepted, the codes of the previous time steps are rejected
+	err = ValidateTotp(ctx, database, accountID, code)
+	if !errors.Is(err, ErrTotpCodeIsNotValid) {
+		t.Errorf("code of a previous step: err = %v, want %v", err, ErrTotpCodeIsNotValid)
+	}
+
+	// each recovery code can be used only once
+	err = UseRecoveryCode(ctx, database, accountID, strings.ToUpper(recoveryCodes[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UseRecoveryCode(ctx, database, accountID, recoveryCodes[0])
+	if !errors.Is(err, ErrRecoveryCodeIsNotValid) {
+		t.Errorf("reused recovery code: err = %v, want %v", err, ErrRecoveryCodeIsNotValid)
+	}
+	err = UseRecoveryCode(ctx, database, accountID, "aaaaa-aaaaa")
+	if !errors.Is(err, ErrRecoveryCodeIsNotValid) {
+		t.Errorf("wrong recovery code: err = %v, want %v", err, ErrRecoveryCodeIsNotValid)
+	}
+
+	storedRecoveryCodes, err := GetRecoveryCodesForAccount(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedRecoveryCodes := 0
+	for _, recoveryCode := range storedRecoveryCodes {
+		if recoveryCode.UsedAt != nil {
+			usedRecoveryCodes += 1
+		}
+	}
+	if len(storedRecoveryCodes) != RecoveryCodesCount || usedRecoveryCodes != 1 {
+		t.Errorf("%d recovery codes with %d used, want %d with 1 used", len(storedRecoveryCodes), usedRecoveryCodes, RecoveryCodesCount)
+	}
+
+	// regenerating the recovery codes invalidates the previous ones
+	newRecoveryCodes, err := RegenerateRecoveryCodes(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UseRecoveryCode(ctx, database, accountID, recoveryCodes[1])
+	if !errors.Is(err, ErrRecoveryCodeIsNotValid) {
+		t.Errorf("previous recovery code: err = %v, want %v", err, ErrRecoveryCodeIsNotValid)
+	}
+	err = UseRecoveryCode(ctx, database, accountID, newRecoveryCodes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DisableTotp(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled, err = IsTotpEnabled(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled {
+		t.Error("two-factor authentication must be disabled")
+	}
+	err = UseRecoveryCode(ctx, database, accountID, newRecoveryCodes[2])
+	if !errors.Is(err, ErrTotpNotEnabled) {
+		t.Errorf("recovery code when disabled: err = %v, want %v", err, ErrTotpNotEnabled)
+	}
+	storedRecoveryCodes, err = GetRecoveryCodesForAccount(ctx, database, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(storedRecoveryCodes) != 0 {
+		t.Errorf("%d recovery codes after DisableTotp, want 0", len(storedRecoveryCodes))
+	}
+	err = DisableTotp(ctx, database, accountID)
+	if !errors.Is(err, ErrTotpNotEnabled) {
+		t.Errorf("disabled twice: err = %v, want %v", err, ErrTotpNotEnabled)
+	}
+
+	// the account can be enrolled again
+	_, err = StartTotpEnrollment(ctx, database, accountID, "stdx", "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
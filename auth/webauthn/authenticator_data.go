@@ -0,0 +1,176 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+// Authenticator data flags.
+// See https://www.w3.org/TR/webauthn-3/#sctn-authenticator-data
+const (
+	flagUserPresent            = 1 << 0
+	flagUserVerified           = 1 << 2
+	flagBackupEligible         = 1 << 3
+	flagBackupState            = 1 << 4
+	flagAttestedCredentialData = 1 << 6
+	flagExtensionData          = 1 << 7
+
+	authenticatorDataMinSize = 37
+	aaguidSize               = 16
+	credentialIDMaxSize      = 1023
+)
+
+const (
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+)
+
+var (
+	ErrAuthenticatorDataIsNotValid = errors.New("webauthn: authenticator data is not valid")
+	ErrClientDataIsNotValid        = errors.New("webauthn: client data is not valid")
+	ErrChallengeIsNotValid         = errors.New("webauthn: challenge is not valid")
+	ErrOriginIsNotValid            = errors.New("webauthn: origin is not valid")
+	ErrRelyingPartyIDIsNotValid    = errors.New("webauthn: relying party ID hash is not valid")
+	ErrUserNotPresent              = errors.New("webauthn: user is not present")
+	ErrUserNotVerified             = errors.New("webauthn: user is not verified")
+)
+
+type authenticatorData struct {
+	raw []byte
+
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// attested credential data, only present during registration
+	aaguid              []byte
+	credentialID        []byte
+	credentialPublicKey []byte
+	credentialKey       coseKey
+}
+
+// parseAuthenticatorData parses the authenticator data.
+// See https://www.w3.org/TR/webauthn-3/#sctn-authenticator-data
+func parseAuthenticatorData(data []byte) (authData authenticatorData, err error) {
+	if len(data) < authenticatorDataMinSize {
+		err = ErrAuthenticatorDataIsNotValid
+		return
+	}
+
+	authData.raw = data
+	authData.rpIDHash = data[:32]
+	authData.flags = data[32]
+	authData.signCount = binary.BigEndian.Uint32(data[33:37])
+	rest := data[authenticatorDataMinSize:]
+
+	if authData.flags&flagAttestedCredentialData != 0 {
+		if len(rest) < aaguidSize+2 {
+			err = ErrAuthenticatorDataIsNotValid
+			return
+		}
+		authData.aaguid = rest[:aaguidSize]
+		credentialIDLength := int(binary.BigEndian.Uint16(rest[aaguidSize:]))
+		rest = rest[aaguidSize+2:]
+
+		if credentialIDLength > credentialIDMaxSize || len(rest) < credentialIDLength {
+			err = ErrAuthenticatorDataIsNotValid
+			return
+		}
+		authData.credentialID = rest[:credentialIDLength]
+		rest = rest[credentialIDLength:]
+
+		publicKeyAndRest := rest
+		authData.credentialKey, rest, err = parseCOSEKey(publicKeyAndRest)
+		if err != nil {
+			return
+		}
+		authData.credentialPublicKey = publicKeyAndRest[:len(publicKeyAndRest)-len(rest)]
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		var extensions any
+		extensions, rest, err = cborDecode(rest)
+		if err != nil {
+			return
+		}
+		if _, isMap := extensions.(map[any]any); !isMap {
+			err = ErrAuthenticatorDataIsNotValid
+			return
+		}
+	}
+
+	if len(rest) != 0 {
+		err = ErrAuthenticatorDataIsNotValid
+		return
+	}
+
+	return authData, nil
+}
+
+// verify performs the checks on the authenticator data that are common to registration and authentication.
+func (authData authenticatorData) verify(rpID string, userVerification UserVerificationRequirement) error {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if !slices.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return ErrRelyingPartyIDIsNotValid
+	}
+
+	if authData.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+
+	if userVerification == UserVerificationRequired && authData.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+
+	// the backup state flag can be set only if the credential is backup eligible
+	if authData.flags&flagBackupEligible == 0 && authData.flags&flagBackupState != 0 {
+		return ErrAuthenticatorDataIsNotValid
+	}
+
+	return nil
+}
+
+func (authData authenticatorData) backupEligible() bool {
+	return authData.flags&flagBackupEligible != 0
+}
+
+func (authData authenticatorData) backedUp() bool {
+	return authData.flags&flagBackupState != 0
+}
+
+// collectedClientData is the JSON-compatible serialization of the client data.
+// See https://www.w3.org/TR/webauthn-3/#dictionary-client-data
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData parses clientDataJSON, checks it and returns its SHA-256 hash.
+func verifyClientData(clientDataJSON []byte, expectedType string, expectedChallenge []byte, origins []string) (clientDataHash []byte, err error) {
+	var clientData collectedClientData
+	err = json.Unmarshal(clientDataJSON, &clientData)
+	if err != nil {
+		return nil, ErrClientDataIsNotValid
+	}
+
+	if clientData.Type != expectedType {
+		return nil, ErrClientDataIsNotValid
+	}
+
+	challenge, err := decodeBase64(clientData.Challenge)
+	if err != nil || len(expectedChallenge) == 0 || !slices.Equal(challenge, expectedChallenge) {
+		return nil, ErrChallengeIsNotValid
+	}
+
+	if clientData.CrossOrigin || !slices.Contains(origins, clientData.Origin) {
+		return nil, ErrOriginIsNotValid
+	}
+
+	hash := sha256.Sum256(clientDataJSON)
+	return hash[:], nil
+}
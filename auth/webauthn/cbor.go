@@ -0,0 +1,228 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// This file implements a minimal CBOR (RFC 8949) decoder, sufficient to parse the attestation objects,
+// authenticator data extensions and COSE keys produced by authenticators.
+// CTAP2 requires authenticators to use the CTAP2 canonical CBOR encoding, thus indefinite-length items
+// are not supported.
+
+const (
+	cborMajorTypeUnsignedInt = 0
+	cborMajorTypeNegativeInt = 1
+	cborMajorTypeByteString  = 2
+	cborMajorTypeTextString  = 3
+	cborMajorTypeArray       = 4
+	cborMajorTypeMap         = 5
+	cborMajorTypeTag         = 6
+	cborMajorTypeSimple      = 7
+
+	// cborMaxDepth protects against stack exhaustion with deeply nested items
+	cborMaxDepth = 16
+)
+
+var (
+	ErrCborIsNotValid          = errors.New("webauthn: CBOR data is not valid")
+	ErrCborTypeIsNotSupported  = errors.New("webauthn: CBOR type is not supported")
+	errCborUnexpectedEndOfData = errors.New("webauthn: unexpected end of CBOR data")
+)
+
+// cborDecode decodes the first CBOR item of data and returns it along with the remaining bytes.
+// Decoded values have the following types:
+// unsigned and negative integers: int64, byte strings: []byte, text strings: string, arrays: []any,
+// maps: map[any]any, booleans: bool, null and undefined: nil, floats: float64.
+// Tags are ignored and the tagged item is returned.
+func cborDecode(data []byte) (value any, rest []byte, err error) {
+	return cborDecodeItem(data, 0)
+}
+
+func cborDecodeItem(data []byte, depth int) (value any, rest []byte, err error) {
+	if depth > cborMaxDepth {
+		return nil, nil, ErrCborIsNotValid
+	}
+	if len(data) == 0 {
+		return nil, nil, errCborUnexpectedEndOfData
+	}
+
+	majorType := data[0] >> 5
+	additionalInfo := data[0] & 0x1f
+	data = data[1:]
+
+	if majorType == cborMajorTypeSimple {
+		return cborDecodeSimple(additionalInfo, data)
+	}
+
+	argument, data, err := cborDecodeArgument(additionalInfo, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch majorType {
+	case cborMajorTypeUnsignedInt:
+		if argument > math.MaxInt64 {
+			return nil, nil, ErrCborTypeIsNotSupported
+		}
+		return int64(argument), data, nil
+
+	case cborMajorTypeNegativeInt:
+		if argument > math.MaxInt64 {
+			return nil, nil, ErrCborTypeIsNotSupported
+		}
+		return -1 - int64(argument), data, nil
+
+	case cborMajorTypeByteString, cborMajorTypeTextString:
+		if argument > uint64(len(data)) {
+			return nil, nil, errCborUnexpectedEndOfData
+		}
+		content := data[:argument]
+		if majorType == cborMajorTypeTextString {
+			return string(content), data[argument:], nil
+		}
+		return append([]byte(nil), content...), data[argument:], nil
+
+	case cborMajorTypeArray:
+		// each item is at least 1 byte long
+		if argument > uint64(len(data)) {
+			return nil, nil, errCborUnexpectedEndOfData
+		}
+		array := make([]any, argument)
+		for i := range array {
+			array[i], data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return array, data, nil
+
+	case cborMajorTypeMap:
+		// each pair is at least 2 bytes long
+		if argument > uint64(len(data))/2 {
+			return nil, nil, errCborUnexpectedEndOfData
+		}
+		cborMap := make(map[any]any, argument)
+		for i := uint64(0); i < argument; i += 1 {
+			var key, mapValue any
+			key, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, ErrCborTypeIsNotSupported
+			}
+			if _, exists := cborMap[key]; exists {
+				return nil, nil, ErrCborIsNotValid
+			}
+
+			mapValue, data, err = cborDecodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			cborMap[key] = mapValue
+		}
+		return cborMap, data, nil
+
+	case cborMajorTypeTag:
+		return cborDecodeItem(data, depth+1)
+	}
+
+	return nil, nil, ErrCborIsNotValid
+}
+
+// cborDecodeArgument decodes the argument (length or value) of an item following its initial byte.
+func cborDecodeArgument(additionalInfo byte, data []byte) (argument uint64, rest []byte, err error) {
+	switch {
+	case additionalInfo < 24:
+		return uint64(additionalInfo), data, nil
+	case additionalInfo == 24:
+		if len(data) < 1 {
+			return 0, nil, errCborUnexpectedEndOfData
+		}
+		return uint64(data[0]), data[1:], nil
+	case additionalInfo == 25:
+		if len(data) < 2 {
+			return 0, nil, errCborUnexpectedEndOfData
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case additionalInfo == 26:
+		if len(data) < 4 {
+			return 0, nil, errCborUnexpectedEndOfData
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case additionalInfo == 27:
+		if len(data) < 8 {
+			return 0, nil, errCborUnexpectedEndOfData
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		// 28-30 are reserved and 31 is used by indefinite-length items
+		return 0, nil, ErrCborTypeIsNotSupported
+	}
+}
+
+func cborDecodeSimple(additionalInfo byte, data []byte) (value any, rest []byte, err error) {
+	switch additionalInfo {
+	case 20:
+		return false, data, nil
+	case 21:
+		return true, data, nil
+	case 22, 23:
+		return nil, data, nil
+	case 25:
+		if len(data) < 2 {
+			return nil, nil, errCborUnexpectedEndOfData
+		}
+		return float16ToFloat64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case 26:
+		if len(data) < 4 {
+			return nil, nil, errCborUnexpectedEndOfData
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+	case 27:
+		if len(data) < 8 {
+			return nil, nil, errCborUnexpectedEndOfData
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	default:
+		return nil, nil, ErrCborTypeIsNotSupported
+	}
+}
+
+func float16ToFloat64(bits uint16) float64 {
+	exponent := int(bits>>10) & 0x1f
+	mantissa := float64(bits & 0x3ff)
+
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+
+	if bits&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
+
+// cborMapGet returns the value associated with key in cborMap, converted to T.
+func cborMapGet[T any](cborMap map[any]any, key any) (value T, ok bool) {
+	rawValue, exists := cborMap[key]
+	if !exists {
+		return value, false
+	}
+	value, ok = rawValue.(T)
+	return value, ok
+}
@@ -0,0 +1,183 @@
+package webauthn
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+// COSEAlgorithm is a COSE algorithm identifier.
+// See https://www.iana.org/assignments/cose/cose.xhtml#algorithms
+type COSEAlgorithm int64
+
+const (
+	AlgorithmES256 COSEAlgorithm = -7
+	AlgorithmEdDSA COSEAlgorithm = -8
+	AlgorithmRS256 COSEAlgorithm = -257
+)
+
+// SupportedAlgorithms are the signature algorithms supported by this package, in order of preference.
+var SupportedAlgorithms = []COSEAlgorithm{AlgorithmEdDSA, AlgorithmES256, AlgorithmRS256}
+
+// COSE key parameters. See RFC 9052 and RFC 9053
+const (
+	coseKeyType      = 1
+	coseKeyAlgorithm = 3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseEC2Curve  = -1
+	coseEC2X      = -2
+	coseEC2Y      = -3
+	coseCurveP256 = 1
+
+	coseOKPCurve     = -1
+	coseOKPX         = -2
+	coseCurveEd25519 = 6
+
+	coseRSAN = -1
+	coseRSAE = -2
+
+	rsaMinKeySize = 2048
+)
+
+var (
+	ErrPublicKeyIsNotValid     = errors.New("webauthn: public key is not valid")
+	ErrAlgorithmIsNotSupported = errors.New("webauthn: algorithm is not supported")
+	ErrSignatureIsNotValid     = errors.New("webauthn: signature is not valid")
+)
+
+// coseKey is a parsed COSE_Key public key.
+type coseKey struct {
+	algorithm COSEAlgorithm
+
+	ecdsaKey   *ecdsa.PublicKey
+	ed25519Key crypto.Ed25519PublicKey
+	rsaKey     *rsa.PublicKey
+}
+
+// parseCOSEKey parses the CBOR-encoded COSE_Key at the beginning of data and returns the remaining bytes.
+func parseCOSEKey(data []byte) (key coseKey, rest []byte, err error) {
+	value, rest, err := cborDecode(data)
+	if err != nil {
+		return
+	}
+	coseMap, ok := value.(map[any]any)
+	if !ok {
+		err = ErrPublicKeyIsNotValid
+		return
+	}
+
+	keyType, ok := cborMapGet[int64](coseMap, int64(coseKeyType))
+	if !ok {
+		err = ErrPublicKeyIsNotValid
+		return
+	}
+	algorithm, ok := cborMapGet[int64](coseMap, int64(coseKeyAlgorithm))
+	if !ok {
+		err = ErrPublicKeyIsNotValid
+		return
+	}
+	key.algorithm = COSEAlgorithm(algorithm)
+
+	switch {
+	case key.algorithm == AlgorithmES256 && keyType == coseKeyTypeEC2:
+		key.ecdsaKey, err = parseCOSEP256Key(coseMap)
+	case key.algorithm == AlgorithmEdDSA && keyType == coseKeyTypeOKP:
+		key.ed25519Key, err = parseCOSEEd25519Key(coseMap)
+	case key.algorithm == AlgorithmRS256 && keyType == coseKeyTypeRSA:
+		key.rsaKey, err = parseCOSERSAKey(coseMap)
+	default:
+		err = ErrAlgorithmIsNotSupported
+	}
+	if err != nil {
+		return
+	}
+
+	return key, rest, nil
+}
+
+func parseCOSEP256Key(coseMap map[any]any) (*ecdsa.PublicKey, error) {
+	curve, _ := cborMapGet[int64](coseMap, int64(coseEC2Curve))
+	x, _ := cborMapGet[[]byte](coseMap, int64(coseEC2X))
+	y, _ := cborMapGet[[]byte](coseMap, int64(coseEC2Y))
+	if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+		return nil, ErrPublicKeyIsNotValid
+	}
+
+	// crypto/ecdh checks that the point is on the curve
+	uncompressedPoint := append(append([]byte{4}, x...), y...)
+	_, err := ecdh.P256().NewPublicKey(uncompressedPoint)
+	if err != nil {
+		return nil, ErrPublicKeyIsNotValid
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+func parseCOSEEd25519Key(coseMap map[any]any) (crypto.Ed25519PublicKey, error) {
+	curve, _ := cborMapGet[int64](coseMap, int64(coseOKPCurve))
+	x, _ := cborMapGet[[]byte](coseMap, int64(coseOKPX))
+	if curve != coseCurveEd25519 || len(x) != crypto.Ed25519PublicKeySize {
+		return nil, ErrPublicKeyIsNotValid
+	}
+
+	return crypto.Ed25519PublicKey(x), nil
+}
+
+func parseCOSERSAKey(coseMap map[any]any) (*rsa.PublicKey, error) {
+	n, _ := cborMapGet[[]byte](coseMap, int64(coseRSAN))
+	e, _ := cborMapGet[[]byte](coseMap, int64(coseRSAE))
+	if len(n)*8 < rsaMinKeySize || len(e) == 0 || len(e) > 4 {
+		return nil, ErrPublicKeyIsNotValid
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if exponent.Int64() < 3 || exponent.Bit(0) == 0 {
+		return nil, ErrPublicKeyIsNotValid
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// verify checks that signature is a valid signature of message.
+func (key coseKey) verify(message, signature []byte) error {
+	switch key.algorithm {
+	case AlgorithmES256:
+		hash := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(key.ecdsaKey, hash[:], signature) {
+			return ErrSignatureIsNotValid
+		}
+	case AlgorithmEdDSA:
+		valid, err := key.ed25519Key.Verify(message, signature)
+		if err != nil || !valid {
+			return ErrSignatureIsNotValid
+		}
+	case AlgorithmRS256:
+		hash := sha256.Sum256(message)
+		err := rsa.VerifyPKCS1v15(key.rsaKey, stdcrypto.SHA256, hash[:], signature)
+		if err != nil {
+			return ErrSignatureIsNotValid
+		}
+	default:
+		return ErrAlgorithmIsNotSupported
+	}
+
+	return nil
+}
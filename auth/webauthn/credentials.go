@@ -0,0 +1,136 @@
+package webauthn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bloom42/stdx-go/db"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+const CredentialNameMaxLength = 128
+
+// the db argument of the functions shadows the db package
+var (
+	isErrAlreadyExists = db.IsErrAlreadyExists
+	checkRowsAffected  = db.CheckRowsAffected
+)
+
+// Transports are the transports supported by an authenticator, e.g. "usb", "nfc", "ble", "internal"
+// or "hybrid". They are stored in the database as a space-delimited string.
+type Transports []string
+
+type Credential struct {
+	ID        []byte    `db:"id" json:"id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	Name string `db:"name" json:"name"`
+	// PublicKey is the COSE_Key-encoded public key of the credential
+	PublicKey      []byte     `db:"public_key" json:"-"`
+	SignCount      int64      `db:"sign_count" json:"-"`
+	AAGUID         []byte     `db:"aaguid" json:"aaguid"`
+	Transports     Transports `db:"transports" json:"transports"`
+	BackupEligible bool       `db:"backup_eligible" json:"backup_eligible"`
+	BackedUp       bool       `db:"backed_up" json:"backed_up"`
+	LastUsedAt     *time.Time `db:"last_used_at" json:"last_used_at"`
+
+	AccountID uuid.UUID `db:"account_id" json:"account_id"`
+}
+
+// Value implements driver.Valuer.
+func (transports Transports) Value() (driver.Value, error) {
+	return strings.Join(transports, " "), nil
+}
+
+// Scan implements sql.Scanner.
+func (transports *Transports) Scan(src any) error {
+	var value string
+
+	switch src := src.(type) {
+	case nil:
+		value = ""
+	case string:
+		value = src
+	case []byte:
+		value = string(src)
+	default:
+		return fmt.Errorf("webauthn: can't scan type %T into Transports", src)
+	}
+
+	*transports = strings.Fields(value)
+	return nil
+}
+
+func insertCredential(ctx context.Context, db db.Queryer, credential Credential) (err error) {
+	const query = `INSERT INTO auth_webauthn_credentials
+		(id, created_at, updated_at, name, public_key, sign_count, aaguid, transports, backup_eligible, backed_up,
+			last_used_at, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err = db.Exec(ctx, query, credential.ID, credential.CreatedAt, credential.UpdatedAt, credential.Name,
+		credential.PublicKey, credential.SignCount, credential.AAGUID, credential.Transports,
+		credential.BackupEligible, credential.BackedUp, credential.LastUsedAt, credential.AccountID)
+	if err != nil {
+		if isErrAlreadyExists(err) {
+			err = ErrCredentialAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetCredential returns the credential with the given ID.
+func GetCredential(ctx context.Context, db db.Queryer, credentialID []byte) (credential Credential, err error) {
+	const query = "SELECT * FROM auth_webauthn_credentials WHERE id = $1"
+	err = db.Get(ctx, &credential, query, credentialID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrCredentialNotFound
+		}
+		return
+	}
+
+	return credential, nil
+}
+
+// GetCredentialsForAccount returns the credentials of the account, from the newest to the oldest.
+func GetCredentialsForAccount(ctx context.Context, db db.Queryer, accountID uuid.UUID) (credentials []Credential, err error) {
+	credentials = make([]Credential, 0)
+
+	const query = "SELECT * FROM auth_webauthn_credentials WHERE account_id = $1 ORDER BY created_at DESC"
+	err = db.Select(ctx, &credentials, query, accountID)
+	return
+}
+
+// RenameCredential updates the name of a credential of the account.
+func RenameCredential(ctx context.Context, db db.Queryer, accountID uuid.UUID, credentialID []byte, name string) (err error) {
+	if name == "" || len(name) > CredentialNameMaxLength {
+		return ErrCredentialNameIsNotValid
+	}
+	now := time.Now().UTC()
+
+	const query = "UPDATE auth_webauthn_credentials SET updated_at = $1, name = $2 WHERE id = $3 AND account_id = $4"
+	res, err := db.Exec(ctx, query, now, name, credentialID, accountID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, ErrCredentialNotFound)
+}
+
+// DeleteCredential deletes a credential of the account.
+func DeleteCredential(ctx context.Context, db db.Queryer, accountID uuid.UUID, credentialID []byte) (err error) {
+	const query = "DELETE FROM auth_webauthn_credentials WHERE id = $1 AND account_id = $2"
+	res, err := db.Exec(ctx, query, credentialID, accountID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, ErrCredentialNotFound)
+}
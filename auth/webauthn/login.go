@@ -0,0 +1,141 @@
+package webauthn
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bloom42/stdx-go/db"
+)
+
+// AssertionResult is the result of a successful authentication ceremony.
+type AssertionResult struct {
+	SignCount int64
+	BackedUp  bool
+}
+
+// VerifyLogin verifies the response of navigator.credentials.get() against challenge (the challenge of the
+// options returned by BeginLogin) and credential, the stored credential identified by response.RawID.
+// FinishLogin should be used to also load and update the credential in the database.
+func (rp *RelyingParty) VerifyLogin(credential Credential, challenge string, response AuthenticationResponse) (result AssertionResult, err error) {
+	if response.Type != credentialTypePublicKey {
+		err = ErrCredentialIsNotValid
+		return
+	}
+
+	rawID, err := decodeBase64(response.RawID)
+	if err != nil || !slices.Equal(rawID, credential.ID) {
+		err = ErrCredentialIsNotValid
+		return
+	}
+
+	// userHandle is present for discoverable credentials and must be the ID of the account that owns
+	// the credential
+	if response.Response.UserHandle != "" {
+		var userHandle []byte
+		userHandle, err = decodeBase64(response.Response.UserHandle)
+		if err != nil || !slices.Equal(userHandle, credential.AccountID.Bytes()) {
+			err = ErrUserHandleIsNotValid
+			return
+		}
+	}
+
+	expectedChallenge, err := decodeBase64(challenge)
+	if err != nil {
+		err = ErrChallengeIsNotValid
+		return
+	}
+
+	clientDataJSON, err := decodeBase64(response.Response.ClientDataJSON)
+	if err != nil {
+		err = ErrClientDataIsNotValid
+		return
+	}
+	clientDataHash, err := verifyClientData(clientDataJSON, clientDataTypeGet, expectedChallenge, rp.origins)
+	if err != nil {
+		return
+	}
+
+	rawAuthData, err := decodeBase64(response.Response.AuthenticatorData)
+	if err != nil {
+		err = ErrAuthenticatorDataIsNotValid
+		return
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return
+	}
+	err = authData.verify(rp.id, rp.userVerification)
+	if err != nil {
+		return
+	}
+
+	signature, err := decodeBase64(response.Response.Signature)
+	if err != nil {
+		err = ErrSignatureIsNotValid
+		return
+	}
+	publicKey, _, err := parseCOSEKey(credential.PublicKey)
+	if err != nil {
+		return
+	}
+	err = publicKey.verify(append(slices.Clone(rawAuthData), clientDataHash...), signature)
+	if err != nil {
+		return
+	}
+
+	// authenticators that don't implement a signature counter always return 0. Otherwise the counter must
+	// increase, or the authenticator may have been cloned.
+	// See https://www.w3.org/TR/webauthn-3/#sctn-sign-counter
+	newSignCount := int64(authData.signCount)
+	if (newSignCount != 0 || credential.SignCount != 0) && newSignCount <= credential.SignCount {
+		err = ErrSignCountIsNotValid
+		return
+	}
+
+	result = AssertionResult{
+		SignCount: newSignCount,
+		BackedUp:  authData.backedUp(),
+	}
+	return result, nil
+}
+
+// FinishLogin loads the credential identified by response.RawID, verifies the response of
+// navigator.credentials.get() with VerifyLogin, and updates the sign count of the credential.
+// The account authenticated is credential.AccountID.
+func (rp *RelyingParty) FinishLogin(ctx context.Context, db db.Queryer, challenge string, response AuthenticationResponse) (credential Credential, err error) {
+	credentialID, err := decodeBase64(response.RawID)
+	if err != nil {
+		err = ErrCredentialIsNotValid
+		return
+	}
+
+	credential, err = GetCredential(ctx, db, credentialID)
+	if err != nil {
+		return
+	}
+
+	result, err := rp.VerifyLogin(credential, challenge, response)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	// the condition on sign_count guarantees that the same assertion can't be used by concurrent requests
+	const query = `UPDATE auth_webauthn_credentials SET updated_at = $1, last_used_at = $1, sign_count = $2, backed_up = $3
+		WHERE id = $4 AND sign_count = $5`
+	res, err := db.Exec(ctx, query, now, result.SignCount, result.BackedUp, credential.ID, credential.SignCount)
+	if err != nil {
+		return
+	}
+	err = checkRowsAffected(res, ErrSignCountIsNotValid)
+	if err != nil {
+		return
+	}
+
+	credential.UpdatedAt = now
+	credential.LastUsedAt = &now
+	credential.SignCount = result.SignCount
+	credential.BackedUp = result.BackedUp
+	return credential, nil
+}
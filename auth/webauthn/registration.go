@@ -0,0 +1,221 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/bloom42/stdx-go/db"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+const (
+	attestationFormatNone   = "none"
+	attestationFormatPacked = "packed"
+)
+
+var (
+	ErrAttestationIsNotValid           = errors.New("webauthn: attestation is not valid")
+	ErrAttestationFormatIsNotSupported = errors.New("webauthn: attestation format is not supported")
+	ErrCredentialNameIsNotValid        = errors.New("webauthn: credential name is not valid")
+)
+
+// VerifyRegistration verifies the response of navigator.credentials.create() against challenge (the
+// challenge of the options returned by BeginRegistration) and returns the new credential.
+// The returned credential has neither AccountID nor Name: FinishRegistration should be used to also
+// store the credential.
+func (rp *RelyingParty) VerifyRegistration(challenge string, response RegistrationResponse) (credential Credential, err error) {
+	if response.Type != credentialTypePublicKey {
+		err = ErrCredentialIsNotValid
+		return
+	}
+
+	expectedChallenge, err := decodeBase64(challenge)
+	if err != nil {
+		err = ErrChallengeIsNotValid
+		return
+	}
+
+	clientDataJSON, err := decodeBase64(response.Response.ClientDataJSON)
+	if err != nil {
+		err = ErrClientDataIsNotValid
+		return
+	}
+	clientDataHash, err := verifyClientData(clientDataJSON, clientDataTypeCreate, expectedChallenge, rp.origins)
+	if err != nil {
+		return
+	}
+
+	attestationObject, err := decodeBase64(response.Response.AttestationObject)
+	if err != nil {
+		err = ErrAttestationIsNotValid
+		return
+	}
+	attestationFormat, attestationStatement, authData, err := parseAttestationObject(attestationObject)
+	if err != nil {
+		return
+	}
+
+	err = authData.verify(rp.id, rp.userVerification)
+	if err != nil {
+		return
+	}
+	if authData.flags&flagAttestedCredentialData == 0 {
+		err = ErrAuthenticatorDataIsNotValid
+		return
+	}
+	if !slices.Contains(SupportedAlgorithms, authData.credentialKey.algorithm) {
+		err = ErrAlgorithmIsNotSupported
+		return
+	}
+
+	rawID, err := decodeBase64(response.RawID)
+	if err != nil || !slices.Equal(rawID, authData.credentialID) {
+		err = ErrCredentialIsNotValid
+		return
+	}
+
+	err = verifyAttestationStatement(attestationFormat, attestationStatement, authData, clientDataHash)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	credential = Credential{
+		ID:             slices.Clone(authData.credentialID),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		PublicKey:      slices.Clone(authData.credentialPublicKey),
+		SignCount:      int64(authData.signCount),
+		AAGUID:         slices.Clone(authData.aaguid),
+		Transports:     slices.Clone(response.Response.Transports),
+		BackupEligible: authData.backupEligible(),
+		BackedUp:       authData.backedUp(),
+		LastUsedAt:     nil,
+	}
+	return credential, nil
+}
+
+// FinishRegistration verifies the response of navigator.credentials.create() with VerifyRegistration and
+// stores the new credential for the account. name is a label chosen by the user to identify the credential.
+func (rp *RelyingParty) FinishRegistration(ctx context.Context, db db.Queryer, accountID uuid.UUID, name string, challenge string, response RegistrationResponse) (credential Credential, err error) {
+	if name == "" || len(name) > CredentialNameMaxLength {
+		err = ErrCredentialNameIsNotValid
+		return
+	}
+
+	credential, err = rp.VerifyRegistration(challenge, response)
+	if err != nil {
+		return
+	}
+	credential.Name = name
+	credential.AccountID = accountID
+
+	err = insertCredential(ctx, db, credential)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return credential, nil
+}
+
+// parseAttestationObject parses the CBOR-encoded attestation object.
+// See https://www.w3.org/TR/webauthn-3/#sctn-attestation
+func parseAttestationObject(data []byte) (format string, statement map[any]any, authData authenticatorData, err error) {
+	value, rest, err := cborDecode(data)
+	if err != nil {
+		return
+	}
+	attestationObject, ok := value.(map[any]any)
+	if !ok || len(rest) != 0 {
+		err = ErrAttestationIsNotValid
+		return
+	}
+
+	format, ok = cborMapGet[string](attestationObject, "fmt")
+	if !ok {
+		err = ErrAttestationIsNotValid
+		return
+	}
+	statement, ok = cborMapGet[map[any]any](attestationObject, "attStmt")
+	if !ok {
+		err = ErrAttestationIsNotValid
+		return
+	}
+	rawAuthData, ok := cborMapGet[[]byte](attestationObject, "authData")
+	if !ok {
+		err = ErrAttestationIsNotValid
+		return
+	}
+
+	authData, err = parseAuthenticatorData(rawAuthData)
+	return
+}
+
+// verifyAttestationStatement verifies the signature of the attestation statement.
+// See https://www.w3.org/TR/webauthn-3/#sctn-defined-attestation-formats
+func verifyAttestationStatement(format string, statement map[any]any, authData authenticatorData, clientDataHash []byte) error {
+	switch format {
+	case attestationFormatNone:
+		if len(statement) != 0 {
+			return ErrAttestationIsNotValid
+		}
+		return nil
+
+	case attestationFormatPacked:
+		algorithm, ok := cborMapGet[int64](statement, "alg")
+		if !ok {
+			return ErrAttestationIsNotValid
+		}
+		signature, ok := cborMapGet[[]byte](statement, "sig")
+		if !ok {
+			return ErrAttestationIsNotValid
+		}
+		signedData := append(slices.Clone(authData.raw), clientDataHash...)
+
+		x5c, hasX5c := statement["x5c"]
+		if !hasX5c {
+			// self attestation: the statement is signed with the credential private key
+			if COSEAlgorithm(algorithm) != authData.credentialKey.algorithm {
+				return ErrAttestationIsNotValid
+			}
+			return authData.credentialKey.verify(signedData, signature)
+		}
+
+		certificates, ok := x5c.([]any)
+		if !ok || len(certificates) == 0 {
+			return ErrAttestationIsNotValid
+		}
+		rawCertificate, ok := certificates[0].([]byte)
+		if !ok {
+			return ErrAttestationIsNotValid
+		}
+		certificate, err := x509.ParseCertificate(rawCertificate)
+		if err != nil {
+			return ErrAttestationIsNotValid
+		}
+
+		var signatureAlgorithm x509.SignatureAlgorithm
+		switch COSEAlgorithm(algorithm) {
+		case AlgorithmES256:
+			signatureAlgorithm = x509.ECDSAWithSHA256
+		case AlgorithmEdDSA:
+			signatureAlgorithm = x509.PureEd25519
+		case AlgorithmRS256:
+			signatureAlgorithm = x509.SHA256WithRSA
+		default:
+			return ErrAlgorithmIsNotSupported
+		}
+
+		err = certificate.CheckSignature(signatureAlgorithm, signedData, signature)
+		if err != nil {
+			return ErrSignatureIsNotValid
+		}
+		return nil
+
+	default:
+		return ErrAttestationFormatIsNotSupported
+	}
+}
@@ -0,0 +1,256 @@
+// Package webauthn implements a WebAuthn (passkeys) relying party: registration and authentication
+// ceremonies, and the storage of the credentials of auth accounts.
+//
+// The ceremonies are split in 2 steps:
+//   - Begin* returns the options that should be passed to navigator.credentials.create() / get()
+//     (see PublicKeyCredential.parseCreationOptionsFromJSON). The caller is responsible for storing the
+//     challenge of the options, e.g. in the session of the user, until the ceremony is finished.
+//   - Finish* verifies the response of the browser (PublicKeyCredential.toJSON()) against the stored
+//     challenge and stores or updates the credential in the database.
+//
+// The tables are created by the migrations of the auth package (auth.MigrationsFS).
+//
+// Supported signature algorithms are ES256, EdDSA (Ed25519) and RS256. Supported attestation statement
+// formats are "none" and "packed". The signature of packed attestation statements is verified but their
+// certificate chain is not evaluated: all the authenticators are trusted.
+package webauthn
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+// UserVerificationRequirement describes whether the user must be verified (e.g. with a PIN or a biometric
+// sensor) by the authenticator.
+type UserVerificationRequirement string
+
+const (
+	UserVerificationRequired    UserVerificationRequirement = "required"
+	UserVerificationPreferred   UserVerificationRequirement = "preferred"
+	UserVerificationDiscouraged UserVerificationRequirement = "discouraged"
+)
+
+const (
+	DefaultTimeout = 5 * time.Minute
+
+	challengeSize           = crypto.KeySize256
+	credentialTypePublicKey = "public-key"
+)
+
+var (
+	ErrRelyingPartyIDIsEmpty   = errors.New("webauthn: relying party ID is empty")
+	ErrOriginsAreEmpty         = errors.New("webauthn: origins are empty")
+	ErrCredentialIsNotValid    = errors.New("webauthn: credential is not valid")
+	ErrCredentialNotFound      = errors.New("webauthn: credential not found")
+	ErrCredentialAlreadyExists = errors.New("webauthn: credential already exists")
+	ErrUserHandleIsNotValid    = errors.New("webauthn: user handle is not valid")
+	ErrSignCountIsNotValid     = errors.New("webauthn: sign count is not valid, the authenticator may have been cloned")
+)
+
+type Config struct {
+	// RPID is the relying party ID: the domain of the website, e.g. "example.com".
+	RPID string
+	// RPName is the human-palatable name of the relying party, e.g. "Example".
+	RPName string
+	// Origins are the origins from which the ceremonies are allowed, e.g. "https://example.com".
+	Origins []string
+	// Timeout is the time the user has to complete a ceremony.
+	// default: DefaultTimeout
+	Timeout time.Duration
+	// UserVerification
+	// default: UserVerificationPreferred
+	UserVerification UserVerificationRequirement
+}
+
+type RelyingParty struct {
+	id               string
+	name             string
+	origins          []string
+	timeout          time.Duration
+	userVerification UserVerificationRequirement
+}
+
+func NewRelyingParty(config Config) (*RelyingParty, error) {
+	if config.RPID == "" {
+		return nil, ErrRelyingPartyIDIsEmpty
+	}
+	if len(config.Origins) == 0 {
+		return nil, ErrOriginsAreEmpty
+	}
+	if config.RPName == "" {
+		config.RPName = config.RPID
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.UserVerification == "" {
+		config.UserVerification = UserVerificationPreferred
+	}
+
+	return &RelyingParty{
+		id:               config.RPID,
+		name:             config.RPName,
+		origins:          append([]string(nil), config.Origins...),
+		timeout:          config.Timeout,
+		userVerification: config.UserVerification,
+	}, nil
+}
+
+// User is the account for which a credential is registered.
+type User struct {
+	AccountID   uuid.UUID
+	Name        string
+	DisplayName string
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameters struct {
+	Type      string        `json:"type"`
+	Algorithm COSEAlgorithm `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string                      `json:"residentKey"`
+	UserVerification UserVerificationRequirement `json:"userVerification"`
+}
+
+// CredentialCreationOptions is the JSON serialization of PublicKeyCredentialCreationOptions.
+// See https://www.w3.org/TR/webauthn-3/#dictdef-publickeycredentialcreationoptionsjson
+type CredentialCreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// CredentialRequestOptions is the JSON serialization of PublicKeyCredentialRequestOptions.
+// See https://www.w3.org/TR/webauthn-3/#dictdef-publickeycredentialrequestoptionsjson
+type CredentialRequestOptions struct {
+	Challenge        string                      `json:"challenge"`
+	Timeout          int64                       `json:"timeout"`
+	RPID             string                      `json:"rpId"`
+	AllowCredentials []CredentialDescriptor      `json:"allowCredentials"`
+	UserVerification UserVerificationRequirement `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON serialization of the response of navigator.credentials.create().
+// See https://www.w3.org/TR/webauthn-3/#dictdef-registrationresponsejson
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AuthenticationResponse is the JSON serialization of the response of navigator.credentials.get().
+// See https://www.w3.org/TR/webauthn-3/#dictdef-authenticationresponsejson
+type AuthenticationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// BeginRegistration returns the options to register a new credential for user. existingCredentials are the
+// credentials already registered for the user, so the authenticator doesn't register a second credential.
+// options.Challenge must be stored until FinishRegistration is called.
+func (rp *RelyingParty) BeginRegistration(user User, existingCredentials []Credential) (options CredentialCreationOptions) {
+	pubKeyCredParams := make([]CredentialParameters, len(SupportedAlgorithms))
+	for i, algorithm := range SupportedAlgorithms {
+		pubKeyCredParams[i] = CredentialParameters{Type: credentialTypePublicKey, Algorithm: algorithm}
+	}
+
+	return CredentialCreationOptions{
+		Challenge: newChallenge(),
+		RP: RelyingPartyEntity{
+			ID:   rp.id,
+			Name: rp.name,
+		},
+		User: UserEntity{
+			ID:          encodeBase64(user.AccountID.Bytes()),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		PubKeyCredParams:   pubKeyCredParams,
+		Timeout:            rp.timeout.Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(existingCredentials),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: rp.userVerification,
+		},
+		Attestation: "none",
+	}
+}
+
+// BeginLogin returns the options to authenticate with one of the given credentials. If credentials is
+// empty, the user will be able to choose any discoverable credential (passkey) registered for rp.
+// options.Challenge must be stored until FinishLogin is called.
+func (rp *RelyingParty) BeginLogin(credentials []Credential) (options CredentialRequestOptions) {
+	return CredentialRequestOptions{
+		Challenge:        newChallenge(),
+		Timeout:          rp.timeout.Milliseconds(),
+		RPID:             rp.id,
+		AllowCredentials: credentialDescriptors(credentials),
+		UserVerification: rp.userVerification,
+	}
+}
+
+func credentialDescriptors(credentials []Credential) []CredentialDescriptor {
+	descriptors := make([]CredentialDescriptor, len(credentials))
+	for i, credential := range credentials {
+		descriptors[i] = CredentialDescriptor{
+			Type:       credentialTypePublicKey,
+			ID:         encodeBase64(credential.ID),
+			Transports: credential.Transports,
+		}
+	}
+	return descriptors
+}
+
+func newChallenge() string {
+	return encodeBase64(crypto.RandBytes(challengeSize))
+}
+
+func encodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeBase64 decodes base64url data, with or without padding, as WebAuthn uses base64url without padding
+// but some libraries add it.
+func decodeBase64(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+}
@@ -23,6 +23,8 @@ func (updater *Updater) RunInBackground(ctx context.Context) {
 	var err error
 	var manifest ChannelManifest
 
+	go updater.WatchHealth(ctx)
+
 	for {
 		// sleep for autoupdateInterval + 60 seconds jitter to avoid DDoSing the server
 		waitFor := rand.Int64N(60) + updater.autoupdateInterval
@@ -9,6 +9,15 @@ type ChannelManifest struct {
 	Name    string `json:"name"`
 	Channel string `json:"channel"`
 	Version string `json:"version"`
+	// RolloutPercentage is the percentage (0-100) of installations that should update to Version.
+	// Each installation is assigned a stable bucket so increasing the percentage only adds installations
+	// to the rollout. If nil, all installations update.
+	RolloutPercentage *uint8 `json:"rollout_percentage,omitempty"`
+	// MinimumVersion is the minimum version that installations are allowed to run. Installations with
+	// an older version update regardless of the rollout percentage.
+	MinimumVersion string `json:"minimum_version,omitempty"`
+	// Forced makes all installations update regardless of the rollout percentage.
+	Forced bool `json:"forced,omitempty"`
 }
 
 func (manifest ChannelManifest) ToJson() (manifestJSON []byte, err error) {
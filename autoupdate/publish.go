@@ -0,0 +1,222 @@
+package autoupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/semver"
+	"github.com/bloom42/stdx-go/storage"
+)
+
+// Releases are stored with the same layout as they are served:
+// [prefix]/[channel].json
+// [prefix]/[version]/release.json
+// [prefix]/[version]/[files]
+
+var (
+	ErrReleaseIsYanked      = errors.New("autoupdate: release is yanked")
+	ErrReleaseAlreadyExists = errors.New("autoupdate: release already exists")
+	ErrFileNotInManifest    = errors.New("autoupdate: file is not in the release manifest")
+)
+
+// PublishRelease uploads the files of a release created by CreateRelease and its release manifest to
+// [prefix]/[version]/. The release manifest is uploaded last so that the release is never visible
+// without its files. Published releases are immutable because their files are served with a long
+// cache lifetime. It does not update any channel, see PromoteRelease.
+func PublishRelease(ctx context.Context, store storage.Storage, prefix string, release Release, files []string) (err error) {
+	manifest := release.ReleaseManifest
+	if !semver.IsValid(manifest.Version) {
+		err = fmt.Errorf("autoupdate.PublishRelease: version (%s) is not a valid semantic version string", manifest.Version)
+		return
+	}
+
+	releaseManifestKey := path.Join(prefix, manifest.Version, ReleaseManifestFilename)
+	if _, sizeErr := store.GetObjectSize(ctx, releaseManifestKey); sizeErr == nil {
+		err = fmt.Errorf("autoupdate.PublishRelease: %w: %s", ErrReleaseAlreadyExists, manifest.Version)
+		return
+	}
+
+	for _, file := range files {
+		filename := filepath.Base(file)
+		inManifest := slices.ContainsFunc(manifest.Files, func(releaseFile ReleaseFile) bool { return releaseFile.Filename == filename }) ||
+			slices.ContainsFunc(manifest.Patches, func(patch ReleasePatch) bool { return patch.Filename == filename })
+		if !inManifest {
+			err = fmt.Errorf("autoupdate.PublishRelease: %w: %s", ErrFileNotInManifest, filename)
+			return
+		}
+
+		err = uploadFile(ctx, store, path.Join(prefix, manifest.Version, filename), file)
+		if err != nil {
+			return
+		}
+	}
+
+	err = putJSON(ctx, store, releaseManifestKey, manifest)
+	if err != nil {
+		err = fmt.Errorf("autoupdate.PublishRelease: %w", err)
+		return
+	}
+
+	return
+}
+
+// PromoteRelease points the channel of channelManifest to its version, which must be a published and
+// not yanked release.
+func PromoteRelease(ctx context.Context, store storage.Storage, prefix string, channelManifest ChannelManifest) (err error) {
+	if channelManifest.Channel == "" || strings.ContainsAny(channelManifest.Channel, "/\\") || strings.Contains(channelManifest.Channel, "..") {
+		err = fmt.Errorf("autoupdate.PromoteRelease: channel (%s) is not valid", channelManifest.Channel)
+		return
+	}
+
+	if channelManifest.MinimumVersion != "" && !semver.IsValid(channelManifest.MinimumVersion) {
+		err = fmt.Errorf("autoupdate.PromoteRelease: minimum version (%s) is not a valid semantic version string", channelManifest.MinimumVersion)
+		return
+	}
+
+	if channelManifest.RolloutPercentage != nil && *channelManifest.RolloutPercentage > 100 {
+		err = fmt.Errorf("autoupdate.PromoteRelease: rollout percentage (%d) is not valid", *channelManifest.RolloutPercentage)
+		return
+	}
+
+	releaseManifest, err := GetReleaseManifest(ctx, store, prefix, channelManifest.Version)
+	if err != nil {
+		return
+	}
+
+	if releaseManifest.Yanked {
+		err = fmt.Errorf("autoupdate.PromoteRelease: %w: %s", ErrReleaseIsYanked, channelManifest.Version)
+		return
+	}
+
+	if channelManifest.Name == "" {
+		channelManifest.Name = releaseManifest.Name
+	}
+
+	err = putJSON(ctx, store, path.Join(prefix, channelManifest.Channel+".json"), channelManifest)
+	if err != nil {
+		err = fmt.Errorf("autoupdate.PromoteRelease: %w", err)
+		return
+	}
+
+	return
+}
+
+// YankRelease marks a release as yanked. Updaters refuse to install yanked releases and yanked releases
+// can't be promoted. The files of the release are kept so installations can still be inspected.
+// Channels that point to the release should be promoted to another release.
+func YankRelease(ctx context.Context, store storage.Storage, prefix string, version string) (err error) {
+	releaseManifest, err := GetReleaseManifest(ctx, store, prefix, version)
+	if err != nil {
+		return
+	}
+
+	releaseManifest.Yanked = true
+	err = putJSON(ctx, store, path.Join(prefix, version, ReleaseManifestFilename), releaseManifest)
+	if err != nil {
+		err = fmt.Errorf("autoupdate.YankRelease: %w", err)
+		return
+	}
+
+	return
+}
+
+// GetChannelManifest returns the manifest of the given channel
+func GetChannelManifest(ctx context.Context, store storage.Storage, prefix string, channel string) (manifest ChannelManifest, err error) {
+	err = getJSON(ctx, store, path.Join(prefix, channel+".json"), &manifest)
+	if err != nil {
+		err = fmt.Errorf("autoupdate.GetChannelManifest: %w", err)
+		return
+	}
+
+	return
+}
+
+// GetReleaseManifest returns the manifest of the release of the given version
+func GetReleaseManifest(ctx context.Context, store storage.Storage, prefix string, version string) (manifest ReleaseManifest, err error) {
+	if !semver.IsValid(version) {
+		err = fmt.Errorf("autoupdate.GetReleaseManifest: version (%s) is not a valid semantic version string", version)
+		return
+	}
+
+	err = getJSON(ctx, store, path.Join(prefix, version, ReleaseManifestFilename), &manifest)
+	if err != nil {
+		err = fmt.Errorf("autoupdate.GetReleaseManifest: %w", err)
+		return
+	}
+
+	return
+}
+
+func uploadFile(ctx context.Context, store storage.Storage, key string, file string) (err error) {
+	fileHandle, err := os.Open(file)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: opening file (%s): %w", file, err)
+		return
+	}
+	defer fileHandle.Close()
+
+	fileInfo, err := fileHandle.Stat()
+	if err != nil {
+		err = fmt.Errorf("autoupdate: getting file info (%s): %w", file, err)
+		return
+	}
+
+	err = store.PutObject(ctx, key, fileInfo.Size(), fileHandle, nil)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: uploading file (%s): %w", file, err)
+		return
+	}
+
+	return
+}
+
+func putJSON(ctx context.Context, store storage.Storage, key string, data any) (err error) {
+	dataJSON, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("encoding %s: %w", key, err)
+		return
+	}
+
+	err = store.PutObject(ctx, key, int64(len(dataJSON)), bytes.NewReader(dataJSON), &storage.PutObjectOptions{
+		ContentType: httpx.MediaTypeJson,
+	})
+	if err != nil {
+		err = fmt.Errorf("writing %s: %w", key, err)
+		return
+	}
+
+	return
+}
+
+func getJSON(ctx context.Context, store storage.Storage, key string, data any) (err error) {
+	object, err := store.GetObject(ctx, key, nil)
+	if err != nil {
+		err = fmt.Errorf("reading %s: %w", key, err)
+		return
+	}
+	defer object.Close()
+
+	dataJSON, err := io.ReadAll(object)
+	if err != nil {
+		err = fmt.Errorf("reading %s: %w", key, err)
+		return
+	}
+
+	err = json.Unmarshal(dataJSON, data)
+	if err != nil {
+		err = fmt.Errorf("decoding %s: %w", key, err)
+		return
+	}
+
+	return
+}
@@ -1,12 +1,22 @@
 package autoupdate
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/bloom42/stdx-go/bsdiff"
 	"github.com/bloom42/stdx-go/byteshex"
 	"github.com/bloom42/stdx-go/filex"
 )
@@ -21,18 +31,45 @@ type CreateReleaseInput struct {
 	// PrivateKeyPrivateKey is the base64 encoded privateKey, encrypted with password
 	PrivateKey         string
 	PrivateKeyPassword string
+	// Deltas are the binary patches to create, usually from the executables of the previous N versions
+	// to the executables of this release
+	Deltas []CreateDeltaInput
+	// PatchesDir is the directory where the patches are written.
+	// default: the directory of the first file of Files
+	PatchesDir string
+}
+
+type CreateDeltaInput struct {
+	// FromVersion is the version of OldExecutable. e.g. 1.1.51
+	FromVersion string
+	OS          string
+	Arch        string
+	// OldExecutable is the path of the executable of FromVersion
+	OldExecutable string
+	// NewExecutable is the path of the executable of this release, as contained in the archive
+	// of this release for OS and Arch. CreateRelease returns an error if they are not equal, as the
+	// patched executable could never be verified by the updaters.
+	// default: the executable extracted from the archive
+	NewExecutable string
 }
 
 type Release struct {
 	Name            string
 	ChannelManifest ChannelManifest
 	ReleaseManifest ReleaseManifest
+	// Patches are the paths of the patches created by CreateRelease
+	Patches []string
 }
 
 type ReleaseManifest struct {
 	Name    string        `json:"name"`
 	Version string        `json:"version"`
 	Files   []ReleaseFile `json:"files"`
+	// Patches are binary patches from previous versions. They are optional: the updater falls back to
+	// the full archive if no patch matches the installed version or if a patch can't be applied.
+	Patches []ReleasePatch `json:"patches,omitempty"`
+	// Yanked releases are not installed by updaters. See YankRelease
+	Yanked bool `json:"yanked,omitempty"`
 }
 
 type ReleaseFile struct {
@@ -41,6 +78,29 @@ type ReleaseFile struct {
 	Signature []byte         `json:"signature"`
 }
 
+// ReleasePatch is a binary patch (see the bsdiff package) that transforms the executable of FromVersion
+// into the executable of the release.
+type ReleasePatch struct {
+	Filename    string `json:"file"`
+	FromVersion string `json:"from_version"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	// Sha256 and Signature are the hash and signature of the patch file
+	Sha256    byteshex.Bytes `json:"sha256"`
+	Signature []byte         `json:"signature"`
+	// SourceSha256 is the hash of the executable of FromVersion
+	SourceSha256 byteshex.Bytes `json:"source_sha256"`
+	// TargetSha256 and TargetSignature are the hash and signature of the patched executable
+	TargetSha256    byteshex.Bytes `json:"target_sha256"`
+	TargetSignature []byte         `json:"target_signature"`
+}
+
+// PatchFilename returns the filename of the patch from fromVersion to version
+// e.g. myapp_1.1.52_linux_amd64_from_1.1.51.patch
+func PatchFilename(name, version, goos, goarch, fromVersion string) string {
+	return fmt.Sprintf("%s_%s_%s_%s_from_%s.patch", name, version, goos, goarch, fromVersion)
+}
+
 func (manifest ReleaseManifest) ToJson() (manifestJSON []byte, err error) {
 	manifestJSON, err = json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
@@ -93,15 +153,190 @@ func CreateRelease(ctx context.Context, info CreateReleaseInput) (release Releas
 		signInput[index] = fileSignInput
 	}
 
+	patches := make([]ReleasePatch, len(info.Deltas))
+	if len(info.Deltas) != 0 {
+		patchesDir := info.PatchesDir
+		if patchesDir == "" && len(info.Files) != 0 {
+			patchesDir = filepath.Dir(info.Files[0])
+		}
+
+		for index, delta := range info.Deltas {
+			var patch []byte
+			var newExecutable []byte
+
+			patches[index], patch, newExecutable, err = createPatch(info.Name, info.Version, info.Files, delta)
+			if err != nil {
+				return
+			}
+
+			patchPath := filepath.Join(patchesDir, patches[index].Filename)
+			err = os.WriteFile(patchPath, patch, 0644)
+			if err != nil {
+				err = fmt.Errorf("autoupdate: writing patch (%s): %w", patchPath, err)
+				return
+			}
+			release.Patches = append(release.Patches, patchPath)
+
+			// the patch and the patched executable are signed with the files to decrypt the private key only once
+			signInput = append(signInput,
+				SignInput{Filename: patches[index].Filename, Reader: bytes.NewReader(patch)},
+				SignInput{Filename: patches[index].Filename, Reader: bytes.NewReader(newExecutable)},
+			)
+		}
+	}
+
 	signatures, err := SignMany(info.PrivateKey, info.PrivateKeyPassword, signInput)
 	if err != nil {
 		return
 	}
 
+	patchesSignatures := signatures[len(info.Files):]
+	for index := range patches {
+		patches[index].Sha256 = patchesSignatures[2*index].Sha256
+		patches[index].Signature = patchesSignatures[2*index].Signature
+		patches[index].TargetSha256 = patchesSignatures[2*index+1].Sha256
+		patches[index].TargetSignature = patchesSignatures[2*index+1].Signature
+	}
+
 	release.ReleaseManifest = ReleaseManifest{
 		Name:    info.Name,
 		Version: info.Version,
-		Files:   signatures,
+		Files:   signatures[:len(info.Files)],
+		Patches: patches,
+	}
+
+	return
+}
+
+func createPatch(name, version string, files []string, delta CreateDeltaInput) (releasePatch ReleasePatch, patch, newExecutable []byte, err error) {
+	if delta.FromVersion == "" || delta.OS == "" || delta.Arch == "" {
+		err = errors.New("autoupdate: FromVersion, OS and Arch are required to create a patch")
+		return
+	}
+
+	oldExecutable, err := os.ReadFile(delta.OldExecutable)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: reading old executable (%s): %w", delta.OldExecutable, err)
+		return
+	}
+
+	// updaters verify the patched executable against the executable of the archive, which is the one
+	// installed when falling back to the full download
+	archiveFilename := fmt.Sprintf("%s_%s_%s_%s", name, version, delta.OS, delta.Arch)
+	archiveIndex := slices.IndexFunc(files, func(file string) bool {
+		return archiveFilenameWithoutExtension(filepath.Base(file)) == archiveFilename
+	})
+	if archiveIndex < 0 {
+		err = fmt.Errorf("autoupdate: no archive found in the files of the release for the patch from %s (%s/%s)", delta.FromVersion, delta.OS, delta.Arch)
+		return
+	}
+	archivedExecutable, err := readArchivedExecutable(files[archiveIndex])
+	if err != nil {
+		return
+	}
+
+	if delta.NewExecutable == "" {
+		newExecutable = archivedExecutable
+	} else {
+		newExecutable, err = os.ReadFile(delta.NewExecutable)
+		if err != nil {
+			err = fmt.Errorf("autoupdate: reading new executable (%s): %w", delta.NewExecutable, err)
+			return
+		}
+		if !bytes.Equal(newExecutable, archivedExecutable) {
+			err = fmt.Errorf("autoupdate: new executable (%s) is not the executable of the archive %s", delta.NewExecutable, files[archiveIndex])
+			return
+		}
+	}
+
+	patch, err = bsdiff.Diff(oldExecutable, newExecutable)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: creating patch from %s: %w", delta.FromVersion, err)
+		return
+	}
+
+	sourceHash := sha256.Sum256(oldExecutable)
+	releasePatch = ReleasePatch{
+		Filename:     PatchFilename(name, version, delta.OS, delta.Arch, delta.FromVersion),
+		FromVersion:  delta.FromVersion,
+		OS:           delta.OS,
+		Arch:         delta.Arch,
+		SourceSha256: byteshex.Bytes(sourceHash[:]),
+	}
+
+	return
+}
+
+// archiveFilenameWithoutExtension removes the .tar.gz or .zip extension of filename
+func archiveFilenameWithoutExtension(filename string) string {
+	for _, extension := range []string{".tar.gz", ".zip"} {
+		if strings.HasSuffix(filename, extension) {
+			return strings.TrimSuffix(filename, extension)
+		}
+	}
+	return filename
+}
+
+// readArchivedExecutable returns the executable contained in a .tar.gz or .zip archive, which is extracted
+// the same way as by the updaters.
+func readArchivedExecutable(archivePath string) (executable []byte, err error) {
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: reading archive (%s): %w", archivePath, err)
+		return
+	}
+
+	var executableReader io.Reader
+	if strings.HasSuffix(archivePath, ".tar.gz") {
+		var gzipReader *gzip.Reader
+		gzipReader, err = gzip.NewReader(bytes.NewReader(archive))
+		if err != nil {
+			err = fmt.Errorf("autoupdate: reading archive (%s): %w", archivePath, err)
+			return
+		}
+		defer gzipReader.Close()
+
+		tarReader := tar.NewReader(gzipReader)
+		var header *tar.Header
+		header, err = tarReader.Next()
+		if err != nil {
+			err = fmt.Errorf("autoupdate: reading archive (%s): %w", archivePath, err)
+			return
+		}
+		if header.Typeflag != tar.TypeReg {
+			err = fmt.Errorf("autoupdate: reading archive (%s): %s is not a regular file", archivePath, header.Name)
+			return
+		}
+		executableReader = tarReader
+	} else if strings.HasSuffix(archivePath, ".zip") {
+		var zipReader *zip.Reader
+		zipReader, err = zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			err = fmt.Errorf("autoupdate: reading archive (%s): %w", archivePath, err)
+			return
+		}
+		if len(zipReader.File) != 1 {
+			err = fmt.Errorf("autoupdate: zip archive contains more than 1 file (%s)", archivePath)
+			return
+		}
+
+		var zippedFile io.ReadCloser
+		zippedFile, err = zipReader.File[0].Open()
+		if err != nil {
+			err = fmt.Errorf("autoupdate: reading archive (%s): %w", archivePath, err)
+			return
+		}
+		defer zippedFile.Close()
+		executableReader = zippedFile
+	} else {
+		err = fmt.Errorf("autoupdate: unsupported archive format: %s", archivePath)
+		return
+	}
+
+	executable, err = io.ReadAll(executableReader)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: extracting executable from archive (%s): %w", archivePath, err)
+		return
 	}
 
 	return
@@ -0,0 +1,403 @@
+package autoupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bloom42/stdx-go/log/slogx"
+)
+
+const (
+	stateFilename              = "state.json"
+	previousExecutableFilename = "previous_executable"
+	// maxRolledBackVersions is the number of rolled back versions remembered to not install them again
+	maxRolledBackVersions = 20
+)
+
+var ErrNoPreviousVersion = errors.New("autoupdate: no previous version to roll back to")
+
+// state is persisted in the StateDir to survive restarts
+type state struct {
+	InstallID           string     `json:"install_id,omitempty"`
+	InstalledVersion    string     `json:"installed_version,omitempty"`
+	PreviousVersion     string     `json:"previous_version,omitempty"`
+	HealthCheckPending  bool       `json:"health_check_pending,omitempty"`
+	HealthCheckDeadline *time.Time `json:"health_check_deadline,omitempty"`
+	RolledBackVersions  []string   `json:"rolled_back_versions,omitempty"`
+}
+
+// getStateDir returns the StateDir, resolving the default one on first use so that the updater works
+// without a config directory (e.g. in containers) as long as the state is not needed.
+// It must be called with stateMutex held.
+func (updater *Updater) getStateDir() (stateDir string, err error) {
+	if updater.stateDir == "" {
+		updater.stateDir, err = defaultStateDir()
+	}
+	return updater.stateDir, err
+}
+
+// executablePath returns the path of the executable to update
+func (updater *Updater) executablePath() (execPath string, err error) {
+	if updater.execPath != "" {
+		return updater.execPath, nil
+	}
+
+	execPath, err = os.Executable()
+	if err != nil {
+		err = fmt.Errorf("autoupdate: getting current executable path: %w", err)
+		return
+	}
+	return
+}
+
+func defaultStateDir() (stateDir string, err error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		err = fmt.Errorf("autoupdate: getting default StateDir: %w", err)
+		return
+	}
+
+	execPath, err := os.Executable()
+	if err != nil {
+		err = fmt.Errorf("autoupdate: getting default StateDir: getting current executable path: %w", err)
+		return
+	}
+
+	executableName := strings.TrimSuffix(filepath.Base(execPath), ".exe")
+	stateDir = filepath.Join(configDir, executableName, "autoupdate")
+	return
+}
+
+// ConfirmHealthy confirms that the current version works after an update, which cancels the automatic
+// rollback. It should be called once the application has started and is healthy.
+func (updater *Updater) ConfirmHealthy() (err error) {
+	updater.stateMutex.Lock()
+	defer updater.stateMutex.Unlock()
+
+	defer updater.healthConfirmedOnce.Do(func() {
+		close(updater.healthConfirmed)
+	})
+
+	if updater.healthCheckTimeout == 0 {
+		return
+	}
+
+	state, err := updater.loadState()
+	if err != nil {
+		return
+	}
+
+	if state.HealthCheckPending && state.InstalledVersion == updater.currentVersion {
+		state.HealthCheckPending = false
+		state.HealthCheckDeadline = nil
+		err = updater.saveState(state)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// WatchHealth restores the previous executable if the current version has just been installed and
+// doesn't call ConfirmHealthy within HealthCheckTimeout of its first start.
+// It is started by RunInBackground and returns when the health check is done or ctx is canceled.
+func (updater *Updater) WatchHealth(ctx context.Context) {
+	logger := slogx.FromCtx(ctx)
+
+	if updater.healthCheckTimeout == 0 {
+		return
+	}
+
+	deadline, pending, err := updater.startHealthCheck()
+	if err != nil {
+		logger.Warn("autoupdate: error starting health check", slogx.Err(err))
+		return
+	}
+	if !pending {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-updater.healthConfirmed:
+		return
+	case <-time.After(time.Until(deadline)):
+	}
+
+	logger.Warn("autoupdate: new version did not confirm that it is healthy. Rolling back",
+		slog.String("autoupdate_version", updater.currentVersion))
+	err = updater.rollback(true)
+	if err != nil {
+		logger.Error("autoupdate: error rolling back", slogx.Err(err))
+		return
+	}
+
+	if updater.verbose {
+		logger.Info("autoupdate: previous version successfully restored")
+	}
+}
+
+// Rollback restores the previous executable and marks the installed version as rolled back so it is
+// not installed again. The application should restart after a rollback.
+func (updater *Updater) Rollback() (err error) {
+	return updater.rollback(false)
+}
+
+func (updater *Updater) rollback(onlyIfHealthCheckPending bool) (err error) {
+	updater.updateInProgress.Lock()
+	defer updater.updateInProgress.Unlock()
+
+	updater.stateMutex.Lock()
+	defer updater.stateMutex.Unlock()
+
+	state, err := updater.loadState()
+	if err != nil {
+		return
+	}
+
+	// ConfirmHealthy may have been called since the deadline
+	if onlyIfHealthCheckPending && (!state.HealthCheckPending || state.InstalledVersion != updater.currentVersion) {
+		return
+	}
+
+	if state.PreviousVersion == "" {
+		return ErrNoPreviousVersion
+	}
+
+	execPath, err := updater.executablePath()
+	if err != nil {
+		return
+	}
+
+	err = copyFile(filepath.Join(updater.stateDir, previousExecutableFilename), execPath)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: restoring previous executable: %w", err)
+		return
+	}
+
+	state.RolledBackVersions = append(state.RolledBackVersions, state.InstalledVersion)
+	if len(state.RolledBackVersions) > maxRolledBackVersions {
+		state.RolledBackVersions = state.RolledBackVersions[len(state.RolledBackVersions)-maxRolledBackVersions:]
+	}
+	state.InstalledVersion = state.PreviousVersion
+	state.PreviousVersion = ""
+	state.HealthCheckPending = false
+	state.HealthCheckDeadline = nil
+	updater.latestVersionInstalled = state.InstalledVersion
+
+	err = updater.saveState(state)
+	if err != nil {
+		return
+	}
+
+	select {
+	case updater.RolledBack <- struct{}{}:
+	default:
+	}
+
+	return
+}
+
+// install replaces the executable with the new one, keeping a copy of the current executable to be
+// able to roll back.
+// The copy and the state are required only if automatic rollbacks are enabled (HealthCheckTimeout != 0).
+// Otherwise they are best-effort so that updates still work when the StateDir is not writable.
+func (updater *Updater) install(newExecutablePath, execPath, version string) (err error) {
+	updater.stateMutex.Lock()
+	defer updater.stateMutex.Unlock()
+
+	rollbackRequired := updater.healthCheckTimeout != 0
+
+	state, stateErr := updater.loadState()
+	previousExecutableErr := stateErr
+	if stateErr == nil {
+		previousExecutableErr = os.MkdirAll(updater.stateDir, 0700)
+		if previousExecutableErr == nil {
+			previousExecutableErr = copyFile(execPath, filepath.Join(updater.stateDir, previousExecutableFilename))
+		}
+	}
+	if rollbackRequired && stateErr != nil {
+		return stateErr
+	}
+	if rollbackRequired && previousExecutableErr != nil {
+		err = fmt.Errorf("autoupdate: keeping a copy of the current executable: %w", previousExecutableErr)
+		return
+	}
+
+	err = os.Rename(newExecutablePath, execPath)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: moving update to executable path: %w", err)
+		return
+	}
+
+	previousVersion := updater.latestVersionInstalled
+	updater.latestVersionInstalled = version
+	if stateErr != nil {
+		return nil
+	}
+
+	// without a copy of the previous executable, there is nothing to roll back to
+	state.PreviousVersion = ""
+	if previousExecutableErr == nil {
+		state.PreviousVersion = previousVersion
+	}
+	state.InstalledVersion = version
+	state.HealthCheckPending = rollbackRequired
+	state.HealthCheckDeadline = nil
+
+	err = updater.saveState(state)
+	if !rollbackRequired {
+		err = nil
+	}
+	return
+}
+
+// startHealthCheck returns the deadline of the health check of the current version, if any.
+// The deadline is set on the first start of the new version so restarts don't extend it.
+func (updater *Updater) startHealthCheck() (deadline time.Time, pending bool, err error) {
+	updater.stateMutex.Lock()
+	defer updater.stateMutex.Unlock()
+
+	state, err := updater.loadState()
+	if err != nil {
+		return
+	}
+
+	if !state.HealthCheckPending || state.InstalledVersion != updater.currentVersion {
+		return
+	}
+
+	if state.HealthCheckDeadline == nil {
+		newDeadline := time.Now().Add(time.Duration(updater.healthCheckTimeout) * time.Second)
+		state.HealthCheckDeadline = &newDeadline
+		err = updater.saveState(state)
+		if err != nil {
+			return
+		}
+	}
+
+	return *state.HealthCheckDeadline, true, nil
+}
+
+func (updater *Updater) versionRolledBack(version string) bool {
+	updater.stateMutex.Lock()
+	defer updater.stateMutex.Unlock()
+
+	state, err := updater.loadState()
+	if err != nil {
+		return false
+	}
+
+	for _, rolledBackVersion := range state.RolledBackVersions {
+		if rolledBackVersion == version {
+			return true
+		}
+	}
+	return false
+}
+
+// loadState must be called with stateMutex held
+func (updater *Updater) loadState() (state state, err error) {
+	stateDir, err := updater.getStateDir()
+	if err != nil {
+		return
+	}
+
+	stateJSON, err := os.ReadFile(filepath.Join(stateDir, stateFilename))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("autoupdate: reading state: %w", err)
+		return
+	}
+
+	err = json.Unmarshal(stateJSON, &state)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: decoding state: %w", err)
+		return
+	}
+
+	return
+}
+
+// saveState must be called with stateMutex held
+func (updater *Updater) saveState(state state) (err error) {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: encoding state: %w", err)
+		return
+	}
+
+	stateDir, err := updater.getStateDir()
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(stateDir, 0700)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: creating state directory: %w", err)
+		return
+	}
+
+	statePath := filepath.Join(stateDir, stateFilename)
+	err = os.WriteFile(statePath+".tmp", stateJSON, 0600)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: writing state: %w", err)
+		return
+	}
+
+	err = os.Rename(statePath+".tmp", statePath)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: writing state: %w", err)
+		return
+	}
+
+	return
+}
+
+// copyFile atomically copies src to dst, keeping the permissions of src
+func copyFile(src, dst string) (err error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer srcFile.Close()
+
+	srcFileInfo, err := srcFile.Stat()
+	if err != nil {
+		return
+	}
+
+	tmpDst := dst + ".tmp"
+	dstFile, err := os.OpenFile(tmpDst, updatedExecutableOpenFlags, srcFileInfo.Mode().Perm())
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmpDst)
+
+	_, err = io.Copy(dstFile, srcFile)
+	if err != nil {
+		dstFile.Close()
+		return
+	}
+
+	err = dstFile.Close()
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tmpDst, dst)
+}
@@ -0,0 +1,51 @@
+package autoupdate
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+// inRollout returns true if the installation is part of the rollout of the version of the manifest.
+func (updater *Updater) inRollout(manifest ChannelManifest) bool {
+	if manifest.RolloutPercentage == nil {
+		return true
+	}
+
+	return rolloutBucket(updater.getInstallID(), manifest) < uint64(*manifest.RolloutPercentage)
+}
+
+// rolloutBucket returns the bucket (0-99) of the installation for the given release.
+// The bucket is stable for a given installation and release, but differs between releases so that
+// the same installations are not always the first to update.
+func rolloutBucket(installID string, manifest ChannelManifest) uint64 {
+	hash := sha256.Sum256([]byte(installID + "\n" + manifest.Name + "\n" + manifest.Version))
+	return binary.BigEndian.Uint64(hash[:8]) % 100
+}
+
+// getInstallID returns the ID of the installation, generating and storing it in the state if needed.
+// If the ID can't be stored, it is only kept in memory.
+func (updater *Updater) getInstallID() string {
+	updater.stateMutex.Lock()
+	defer updater.stateMutex.Unlock()
+
+	if updater.installID != "" {
+		return updater.installID
+	}
+
+	state, err := updater.loadState()
+	if err == nil && state.InstallID != "" {
+		updater.installID = state.InstallID
+		return updater.installID
+	}
+
+	updater.installID = hex.EncodeToString(crypto.RandBytes(16))
+	if err == nil {
+		state.InstallID = updater.installID
+		_ = updater.saveState(state)
+	}
+
+	return updater.installID
+}
@@ -0,0 +1,125 @@
+package autoupdate
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/log/slogx"
+	"github.com/bloom42/stdx-go/storage"
+)
+
+type ServerConfig struct {
+	Storage storage.Storage
+	// Prefix is prepended to the path of the requests to get the storage key of the objects.
+	// e.g. with the "releases" prefix, /myapp/stable.json is served from releases/myapp/stable.json
+	Prefix string
+	// IsNotFound reports whether an error returned by Storage means that the object does not exist.
+	// default: errors.Is(err, fs.ErrNotExist)
+	IsNotFound func(err error) bool
+}
+
+// Server is an http.Handler that serves the channel manifests, release manifests and files of
+// releases published with PublishRelease and PromoteRelease.
+// Mount it with http.StripPrefix if it is not served at the root.
+type Server struct {
+	storage    storage.Storage
+	prefix     string
+	isNotFound func(err error) bool
+}
+
+// ensure that Server implements http.Handler
+var _ http.Handler = (*Server)(nil)
+
+func NewServer(config ServerConfig) (server *Server, err error) {
+	if config.Storage == nil {
+		err = errors.New("autoupdate: Storage is nil")
+		return
+	}
+
+	if config.IsNotFound == nil {
+		config.IsNotFound = func(err error) bool {
+			return errors.Is(err, fs.ErrNotExist)
+		}
+	}
+
+	server = &Server{
+		storage:    config.Storage,
+		prefix:     config.Prefix,
+		isNotFound: config.IsNotFound,
+	}
+	return
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	logger := slogx.FromCtx(ctx)
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		httpx.ServeError(w, "Method Not Allowed\n", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// path.Clean removes all the ".." elements of rooted paths
+	urlPath := path.Clean("/" + req.URL.Path)
+	if urlPath == "/" || strings.HasSuffix(req.URL.Path, "/") {
+		httpx.ServerErrorNotFound(w)
+		return
+	}
+	key := path.Join(server.prefix, urlPath[1:])
+
+	size, err := server.storage.GetObjectSize(ctx, key)
+	if err != nil {
+		server.handleStorageError(w, req, err)
+		return
+	}
+
+	var object io.ReadCloser
+	if req.Method == http.MethodGet {
+		object, err = server.storage.GetObject(ctx, key, nil)
+		if err != nil {
+			server.handleStorageError(w, req, err)
+			return
+		}
+		defer object.Close()
+	}
+
+	if strings.HasSuffix(key, ".json") {
+		// manifests are updated when releases are promoted or yanked
+		w.Header().Set(httpx.HeaderContentType, httpx.MediaTypeJson)
+		w.Header().Set(httpx.HeaderCacheControl, httpx.CacheControlDynamic)
+	} else {
+		// published releases are immutable
+		w.Header().Set(httpx.HeaderContentType, "application/octet-stream")
+		w.Header().Set(httpx.HeaderCacheControl, httpx.CacheControlImmutable)
+	}
+	w.Header().Set(httpx.HeaderContentLength, strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if object == nil {
+		return
+	}
+
+	_, err = io.Copy(w, object)
+	if err != nil {
+		logger.Debug("autoupdate.Server: error sending object", slog.String("key", key), slogx.Err(err))
+	}
+}
+
+func (server *Server) handleStorageError(w http.ResponseWriter, req *http.Request, err error) {
+	if server.isNotFound(err) {
+		httpx.ServerErrorNotFound(w)
+		return
+	}
+
+	slogx.FromCtx(req.Context()).Error("autoupdate.Server: error getting object from storage",
+		slog.String("path", req.URL.Path), slogx.Err(err))
+	httpx.ServerErrorInternal(w)
+}
@@ -0,0 +1,423 @@
+package autoupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/bsdiff"
+	"github.com/bloom42/stdx-go/storage"
+	"github.com/bloom42/stdx-go/storage/filesystem"
+)
+
+func TestServerEndToEnd(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: filepath.Join(dir, "storage")})
+
+	password := "correct horse battery staple"
+	privateKey, publicKey, err := GenerateSigningKeypair([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldExecutable := bytes.Repeat([]byte("version 1.0.0 of the executable\n"), 1000)
+	newExecutable := append(bytes.Clone(oldExecutable), []byte("new feature\n")...)
+
+	createAndPublish := func(version string, executable []byte, deltas []CreateDeltaInput) Release {
+		return createAndPublishTestRelease(t, store, dir, privateKey, password, version, executable, deltas)
+	}
+
+	release1 := createAndPublish("1.0.0", oldExecutable, nil)
+	err = PromoteRelease(ctx, store, "app", ChannelManifest{Channel: "stable", Version: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PublishRelease(ctx, store, "app", release1, nil)
+	if !errors.Is(err, ErrReleaseAlreadyExists) {
+		t.Errorf("publishing a release twice: expected ErrReleaseAlreadyExists, got: %v", err)
+	}
+
+	createAndPublish("1.1.0", newExecutable, []CreateDeltaInput{{
+		FromVersion:   "1.0.0",
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		OldExecutable: filepath.Join(dir, "1.0.0", "app"),
+	}})
+	rolloutPercentage := uint8(100)
+	err = PromoteRelease(ctx, store, "app", ChannelManifest{Channel: "stable", Version: "1.1.0", RolloutPercentage: &rolloutPercentage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServer(ServerConfig{Storage: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	updater, err := NewUpdater(Config{
+		PublicKey:      publicKey,
+		BaseURL:        httpServer.URL + "/app",
+		CurrentVersion: "1.0.0",
+		ReleaseChannel: "stable",
+		StateDir:       filepath.Join(dir, "state"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelManifest, err := updater.CheckUpdate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channelManifest.Version != "1.1.0" || channelManifest.Name != "app" {
+		t.Fatalf("unexpected channel manifest: %+v", channelManifest)
+	}
+	if !updater.UpdateAvailable(channelManifest) {
+		t.Error("update should be available")
+	}
+
+	releaseManifest, err := updater.fetchReleaseManifest(ctx, channelManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releaseManifest.Files) != 1 || len(releaseManifest.Patches) != 1 {
+		t.Fatalf("unexpected release manifest: %+v", releaseManifest)
+	}
+
+	execPath := filepath.Join(dir, "installed_app")
+	err = os.WriteFile(execPath, oldExecutable, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updater.updateWithPatch(ctx, channelManifest, releaseManifest, execPath, filepath.Join(dir, "app.update"))
+	if err != nil {
+		t.Fatalf("updateWithPatch: %v", err)
+	}
+	installedExecutable, err := os.ReadFile(execPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(installedExecutable, newExecutable) {
+		t.Error("patched executable is not equal to the new executable")
+	}
+
+	archive, err := updater.download(ctx, "1.1.0", releaseManifest.Files[0].Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Verify(publicKey, VerifyInput{
+		Reader:    bytes.NewReader(archive),
+		Sha256:    releaseManifest.Files[0].Sha256,
+		Signature: releaseManifest.Files[0].Signature,
+	})
+	if err != nil {
+		t.Errorf("verifying downloaded archive: %v", err)
+	}
+
+	requests := []struct {
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{http.MethodHead, "/app/stable.json", http.StatusOK},
+		{http.MethodGet, "/app/unknown.json", http.StatusNotFound},
+		{http.MethodGet, "/app/../../stable.json", http.StatusNotFound},
+		{http.MethodGet, "/", http.StatusNotFound},
+		{http.MethodPost, "/app/stable.json", http.StatusMethodNotAllowed},
+	}
+	for _, request := range requests {
+		req, _ := http.NewRequest(request.method, httpServer.URL+request.path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode != request.expectedStatus {
+			t.Errorf("%s %s: expected status %d, got %d", request.method, request.path, request.expectedStatus, res.StatusCode)
+		}
+	}
+
+	err = YankRelease(ctx, store, "app", "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = updater.fetchReleaseManifest(ctx, channelManifest)
+	if !errors.Is(err, ErrReleaseIsYanked) {
+		t.Errorf("fetching a yanked release: expected ErrReleaseIsYanked, got: %v", err)
+	}
+	err = PromoteRelease(ctx, store, "app", ChannelManifest{Channel: "stable", Version: "1.1.0"})
+	if !errors.Is(err, ErrReleaseIsYanked) {
+		t.Errorf("promoting a yanked release: expected ErrReleaseIsYanked, got: %v", err)
+	}
+	err = PromoteRelease(ctx, store, "app", ChannelManifest{Channel: "stable", Version: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	channelManifest, err = updater.CheckUpdate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channelManifest.Version != "1.0.0" {
+		t.Errorf("expected the channel to point to 1.0.0 after the yank, got: %s", channelManifest.Version)
+	}
+}
+
+// createAndPublishTestRelease creates a release of app with a .tar.gz archive containing executable for
+// the current platform, and publishes it to store.
+func createAndPublishTestRelease(t *testing.T, store storage.Storage, dir, privateKey, password, version string, executable []byte, deltas []CreateDeltaInput) Release {
+	t.Helper()
+	ctx := context.Background()
+
+	releaseDir := filepath.Join(dir, version)
+	err := os.MkdirAll(releaseDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executablePath := filepath.Join(releaseDir, "app")
+	err = os.WriteFile(executablePath, executable, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(releaseDir, fmt.Sprintf("app_%s_%s_%s.tar.gz", version, runtime.GOOS, runtime.GOARCH))
+	writeTestTarGzArchive(t, archivePath, executable)
+	for index := range deltas {
+		deltas[index].NewExecutable = executablePath
+	}
+
+	release, err := CreateRelease(ctx, CreateReleaseInput{
+		Name:               "app",
+		Version:            version,
+		Files:              []string{archivePath},
+		PrivateKey:         privateKey,
+		PrivateKeyPassword: password,
+		Deltas:             deltas,
+	})
+	if err != nil {
+		t.Fatalf("CreateRelease(%s): %v", version, err)
+	}
+
+	err = PublishRelease(ctx, store, "app", release, append([]string{archivePath}, release.Patches...))
+	if err != nil {
+		t.Fatalf("PublishRelease(%s): %v", version, err)
+	}
+
+	return release
+}
+
+func writeTestTarGzArchive(t *testing.T, path string, executable []byte) {
+	t.Helper()
+
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err := tarWriter.WriteHeader(&tar.Header{
+		Name:     "app",
+		Mode:     0755,
+		Size:     int64(len(executable)),
+		Typeflag: tar.TypeReg,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tarWriter.Write(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = errors.Join(tarWriter.Close(), gzipWriter.Close())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, archive.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateFallbackToArchive(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: filepath.Join(dir, "storage")})
+
+	password := "correct horse battery staple"
+	privateKey, publicKey, err := GenerateSigningKeypair([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldExecutable := bytes.Repeat([]byte("version 1.0.0 of the executable\n"), 1000)
+	newExecutable := append(bytes.Clone(oldExecutable), []byte("new feature\n")...)
+	createAndPublishTestRelease(t, store, dir, privateKey, password, "1.0.0", oldExecutable, nil)
+	release := createAndPublishTestRelease(t, store, dir, privateKey, password, "1.1.0", newExecutable, []CreateDeltaInput{{
+		FromVersion:   "1.0.0",
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		OldExecutable: filepath.Join(dir, "1.0.0", "app"),
+	}})
+
+	server, err := NewServer(ServerConfig{Storage: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	channelManifest := ChannelManifest{Name: "app", Channel: "stable", Version: "1.1.0"}
+	patchPath := filepath.Join(dir, "storage", "app", "1.1.0", release.ReleaseManifest.Patches[0].Filename)
+
+	tests := []struct {
+		name                string
+		installedExecutable []byte
+		prepare             func()
+	}{
+		{
+			name:                "wrong base executable",
+			installedExecutable: append([]byte("stripped "), oldExecutable...),
+			prepare:             func() {},
+		},
+		{
+			name:                "corrupted patch",
+			installedExecutable: oldExecutable,
+			prepare: func() {
+				patch, err := os.ReadFile(patchPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				patch[len(patch)/2] ^= 0xff
+				err = os.WriteFile(patchPath, patch, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test.prepare()
+
+		testDir := filepath.Join(dir, test.name)
+		execPath := filepath.Join(testDir, "installed_app")
+		err = os.MkdirAll(testDir, 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(execPath, test.installedExecutable, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		updater, err := NewUpdater(Config{
+			PublicKey:      publicKey,
+			BaseURL:        httpServer.URL + "/app",
+			CurrentVersion: "1.0.0",
+			ReleaseChannel: "stable",
+			StateDir:       filepath.Join(testDir, "state"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		updater.execPath = execPath
+
+		releaseManifest, err := updater.fetchReleaseManifest(ctx, channelManifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = updater.updateWithPatch(ctx, channelManifest, releaseManifest, execPath, filepath.Join(testDir, "app.update"))
+		if err == nil || errors.Is(err, errNoMatchingPatch) {
+			t.Fatalf("%s: expected the patch to fail, got: %v", test.name, err)
+		}
+
+		err = updater.Update(ctx, channelManifest)
+		if err != nil {
+			t.Fatalf("%s: Update: %v", test.name, err)
+		}
+		installedExecutable, err := os.ReadFile(execPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(installedExecutable, newExecutable) {
+			t.Errorf("%s: the executable of the archive should be installed", test.name)
+		}
+	}
+}
+
+func TestCreateReleaseNewExecutable(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	password := "correct horse battery staple"
+	privateKey, _, err := GenerateSigningKeypair([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldExecutablePath := filepath.Join(dir, "old_app")
+	otherExecutablePath := filepath.Join(dir, "other_app")
+	archivePath := filepath.Join(dir, fmt.Sprintf("app_1.1.0_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH))
+	oldExecutable := []byte("version 1.0.0 of the executable")
+	newExecutable := []byte("version 1.1.0 of the executable")
+	for path, content := range map[string][]byte{oldExecutablePath: oldExecutable, otherExecutablePath: []byte("another build")} {
+		err = os.WriteFile(path, content, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestTarGzArchive(t, archivePath, newExecutable)
+
+	createRelease := func(delta CreateDeltaInput) (Release, error) {
+		delta.FromVersion = "1.0.0"
+		delta.OldExecutable = oldExecutablePath
+		return CreateRelease(ctx, CreateReleaseInput{
+			Name:               "app",
+			Version:            "1.1.0",
+			Files:              []string{archivePath},
+			PrivateKey:         privateKey,
+			PrivateKeyPassword: password,
+			Deltas:             []CreateDeltaInput{delta},
+		})
+	}
+
+	_, err = createRelease(CreateDeltaInput{OS: runtime.GOOS, Arch: runtime.GOARCH, NewExecutable: otherExecutablePath})
+	if err == nil {
+		t.Error("expected an error when NewExecutable is not the executable of the archive")
+	}
+	_, err = createRelease(CreateDeltaInput{OS: "plan9", Arch: runtime.GOARCH})
+	if err == nil {
+		t.Error("expected an error when there is no archive for the platform of the patch")
+	}
+
+	// by default, the patch targets the executable of the archive
+	release, err := createRelease(CreateDeltaInput{OS: runtime.GOOS, Arch: runtime.GOARCH})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := os.ReadFile(release.Patches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchedExecutable, err := bsdiff.Patch(oldExecutable, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(patchedExecutable, newExecutable) {
+		t.Error("the patch should produce the executable of the archive")
+	}
+}
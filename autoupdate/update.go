@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,11 +18,14 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/bloom42/stdx-go/bsdiff"
 	"github.com/bloom42/stdx-go/httpx"
 	"github.com/bloom42/stdx-go/log/slogx"
 	"github.com/bloom42/stdx-go/semver"
 )
 
+var errNoMatchingPatch = errors.New("autoupdate: no patch matches the installed version")
+
 func (updater *Updater) CheckUpdate(ctx context.Context) (manifest ChannelManifest, err error) {
 	logger := slogx.FromCtx(ctx)
 
@@ -68,6 +72,16 @@ func (updater *Updater) CheckUpdate(ctx context.Context) (manifest ChannelManife
 		return
 	}
 
+	if manifest.MinimumVersion != "" && !semver.IsValid(manifest.MinimumVersion) {
+		err = fmt.Errorf("autoupdate.CheckUpdate: minimum version (%s) is not a valid semantic version string", manifest.MinimumVersion)
+		return
+	}
+
+	if manifest.RolloutPercentage != nil && *manifest.RolloutPercentage > 100 {
+		err = fmt.Errorf("autoupdate.CheckUpdate: rollout percentage (%d) is not valid", *manifest.RolloutPercentage)
+		return
+	}
+
 	updater.latestVersionAvailable = manifest.Version
 
 	return
@@ -91,14 +105,25 @@ func (updater *Updater) Update(ctx context.Context, channelManifest ChannelManif
 
 	destPath := filepath.Join(tmpDir, channelManifest.Name)
 
+	execPath, err := updater.executablePath()
+	if err != nil {
+		return
+	}
+
+	err = updater.updateWithPatch(ctx, channelManifest, releaseManifest, execPath, destPath)
+	if err == nil {
+		return
+	} else if !errors.Is(err, errNoMatchingPatch) {
+		slogx.FromCtx(ctx).Warn("autoupdate: applying patch failed. Falling back to the full download", slogx.Err(err))
+	}
+
 	platform := runtime.GOOS + "_" + runtime.GOARCH
 	updateFilename := fmt.Sprintf("%s_%s_%s_%s", channelManifest.Name, channelManifest.Version, runtime.GOOS, runtime.GOARCH)
 
 	artifactExists := false
 	var artifactToDownload ReleaseFile
 	for _, artifact := range releaseManifest.Files {
-		artifactExtension := filepath.Ext(artifact.Filename)
-		if updateFilename == strings.TrimSuffix(artifact.Filename, artifactExtension) {
+		if updateFilename == archiveFilenameWithoutExtension(artifact.Filename) {
 			artifactExists = true
 			artifactToDownload = artifact
 		}
@@ -108,23 +133,8 @@ func (updater *Updater) Update(ctx context.Context, channelManifest ChannelManif
 		return
 	}
 
-	artifactUrl := updater.baseUrl + "/" + channelManifest.Version + "/" + artifactToDownload.Filename
-
-	res, err := updater.httpClient.Get(artifactUrl)
-	if err != nil {
-		err = fmt.Errorf("autoupdate: fetching artifact: %w", err)
-		return
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		err = fmt.Errorf("autoupdate: Status code is not 200 when fetching artifact: %d", res.StatusCode)
-		return
-	}
-
-	artifactFile, err := io.ReadAll(res.Body)
+	artifactFile, err := updater.download(ctx, channelManifest.Version, artifactToDownload.Filename)
 	if err != nil {
-		err = fmt.Errorf("autoupdate: reading artifact's response: %d", res.StatusCode)
 		return
 	}
 
@@ -155,19 +165,123 @@ func (updater *Updater) Update(ctx context.Context, channelManifest ChannelManif
 		return
 	}
 
-	execPath, err := os.Executable()
+	err = updater.install(destPath, execPath, channelManifest.Version)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// updateWithPatch updates the executable with the patch from the installed version, if any.
+// It returns errNoMatchingPatch if the release has no patch for the installed version and platform.
+// The patched executable is verified against the signed hash of the full executable before being installed.
+func (updater *Updater) updateWithPatch(ctx context.Context, channelManifest ChannelManifest, releaseManifest ReleaseManifest, execPath, destPath string) (err error) {
+	var patchToApply *ReleasePatch
+	for index, patch := range releaseManifest.Patches {
+		if patch.FromVersion == updater.latestVersionInstalled && patch.OS == runtime.GOOS && patch.Arch == runtime.GOARCH {
+			patchToApply = &releaseManifest.Patches[index]
+			break
+		}
+	}
+	if patchToApply == nil {
+		return errNoMatchingPatch
+	}
+
+	execFileInfo, err := os.Stat(execPath)
 	if err != nil {
-		err = fmt.Errorf("autoupdate: getting current executable path: %w", err)
+		err = fmt.Errorf("autoupdate: getting current executable info: %w", err)
 		return
 	}
 
-	err = os.Rename(destPath, execPath)
+	currentExecutable, err := os.ReadFile(execPath)
 	if err != nil {
-		err = fmt.Errorf("autoupdate: moving update to executable path: %w", err)
+		err = fmt.Errorf("autoupdate: reading current executable: %w", err)
 		return
 	}
 
-	updater.latestVersionInstalled = channelManifest.Version
+	// the current executable may have been modified (e.g. stripped or repackaged), in which case
+	// downloading the patch is useless
+	currentExecutableHash := sha256.Sum256(currentExecutable)
+	if !bytes.Equal(currentExecutableHash[:], patchToApply.SourceSha256) {
+		err = errors.New("autoupdate: current executable does not match the source of the patch")
+		return
+	}
+
+	patch, err := updater.download(ctx, channelManifest.Version, patchToApply.Filename)
+	if err != nil {
+		return
+	}
+
+	// the patch is verified before being applied to not feed untrusted data to the patcher
+	err = Verify(updater.publicKey, VerifyInput{
+		Reader:    bytes.NewReader(patch),
+		Sha256:    patchToApply.Sha256,
+		Signature: patchToApply.Signature,
+	})
+	if err != nil {
+		err = fmt.Errorf("autoupdate: verifying patch signature: %w", err)
+		return
+	}
+
+	updatedExecutable, err := bsdiff.Patch(currentExecutable, patch)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: applying patch: %w", err)
+		return
+	}
+
+	err = Verify(updater.publicKey, VerifyInput{
+		Reader:    bytes.NewReader(updatedExecutable),
+		Sha256:    patchToApply.TargetSha256,
+		Signature: patchToApply.TargetSignature,
+	})
+	if err != nil {
+		err = fmt.Errorf("autoupdate: verifying patched executable: %w", err)
+		return
+	}
+
+	err = os.WriteFile(destPath, updatedExecutable, execFileInfo.Mode().Perm())
+	if err != nil {
+		err = fmt.Errorf("autoupdate: writing patched executable (%s): %w", destPath, err)
+		return
+	}
+
+	err = updater.install(destPath, execPath, channelManifest.Version)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// download downloads the given file of a release
+func (updater *Updater) download(ctx context.Context, version, filename string) (data []byte, err error) {
+	fileUrl := updater.baseUrl + "/" + version + "/" + filename
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileUrl, nil)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: creating HTTP request (%s): %w", filename, err)
+		return
+	}
+	req.Header.Add(httpx.HeaderUserAgent, updater.userAgent)
+
+	res, err := updater.httpClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: fetching file (%s): %w", filename, err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("autoupdate: Status code is not 200 when fetching file (%s): %d", filename, res.StatusCode)
+		return
+	}
+
+	data, err = io.ReadAll(res.Body)
+	if err != nil {
+		err = fmt.Errorf("autoupdate: reading response (%s): %w", filename, err)
+		return
+	}
 
 	return
 }
@@ -290,5 +404,10 @@ func (updater *Updater) fetchReleaseManifest(ctx context.Context, channelManifes
 		err = fmt.Errorf("autoupdate.fetchReleaseManifest: parsing release manifest: %w", err)
 		return
 	}
+
+	if releaseManifest.Yanked {
+		err = fmt.Errorf("autoupdate.fetchReleaseManifest: %w: %s", ErrReleaseIsYanked, releaseManifest.Version)
+		return
+	}
 	return
 }
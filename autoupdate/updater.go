@@ -22,6 +22,17 @@ type Config struct {
 	Verbose    bool
 	UserAgent  *string
 	HttpClient *http.Client
+	// StateDir is the directory where the updater stores its state and a copy of the previous executable.
+	// default: [os.UserConfigDir]/[executable name]/autoupdate
+	StateDir string
+	// InstallID is a stable identifier of the installation, used to assign the installation to a
+	// rollout bucket.
+	// default: a random ID generated on first use and stored in StateDir
+	InstallID string
+	// HealthCheckTimeout is the time, in seconds, that a new version has after its first start to call
+	// ConfirmHealthy. If it doesn't, the previous executable is restored.
+	// default: 0 (health checks and automatic rollbacks are disabled)
+	HealthCheckTimeout int64
 }
 
 type Updater struct {
@@ -36,8 +47,20 @@ type Updater struct {
 	latestVersionInstalled string
 	autoupdateInterval     int64
 	verbose                bool
+	// stateDir is resolved on first use if it is not configured, see getStateDir
+	stateDir string
+	// execPath is the path of the executable to update. default: os.Executable()
+	execPath            string
+	installID           string
+	healthCheckTimeout  int64
+	stateMutex          sync.Mutex
+	healthConfirmed     chan struct{}
+	healthConfirmedOnce sync.Once
 
 	Updated chan struct{}
+	// RolledBack receives a value when the previous executable has been restored because the new
+	// version didn't confirm that it is healthy in time. The application should restart.
+	RolledBack chan struct{}
 }
 
 func NewUpdater(config Config) (updater *Updater, err error) {
@@ -64,6 +87,11 @@ func NewUpdater(config Config) (updater *Updater, err error) {
 		config.Interval = 1800
 	}
 
+	if config.HealthCheckTimeout < 0 {
+		err = errors.New("autoupdate: HealthCheckTimeout is negative")
+		return
+	}
+
 	userAgent := DefaultUserAgent
 	if config.UserAgent != nil {
 		userAgent = *config.UserAgent
@@ -81,7 +109,14 @@ func NewUpdater(config Config) (updater *Updater, err error) {
 		latestVersionInstalled: config.CurrentVersion,
 		autoupdateInterval:     config.Interval,
 		verbose:                config.Verbose,
+		stateDir:               config.StateDir,
+		installID:              config.InstallID,
+		healthCheckTimeout:     config.HealthCheckTimeout,
+		stateMutex:             sync.Mutex{},
+		healthConfirmed:        make(chan struct{}),
+		healthConfirmedOnce:    sync.Once{},
 		Updated:                make(chan struct{}),
+		RolledBack:             make(chan struct{}, 1),
 	}
 	return
 }
@@ -90,7 +125,27 @@ func (updater *Updater) RestartRequired() bool {
 	return updater.latestVersionInstalled != updater.currentVersion
 }
 
-// UpdateAvailable returns true if the latest avaiable version is > to the latest install version
+// UpdateAvailable returns true if the latest avaiable version is > to the latest install version,
+// the installation is part of the rollout of this version and this version has not been rolled back.
 func (updater *Updater) UpdateAvailable(manifest ChannelManifest) bool {
-	return semver.Compare(manifest.Version, updater.latestVersionInstalled) > 0
+	if semver.Compare(manifest.Version, updater.latestVersionInstalled) <= 0 {
+		return false
+	}
+
+	if updater.versionRolledBack(manifest.Version) {
+		return false
+	}
+
+	return updater.UpdateRequired(manifest) || updater.inRollout(manifest)
+}
+
+// UpdateRequired returns true if the manifest forces the update or if the latest installed version
+// is older than the minimum version of the manifest.
+func (updater *Updater) UpdateRequired(manifest ChannelManifest) bool {
+	if semver.Compare(manifest.Version, updater.latestVersionInstalled) <= 0 {
+		return false
+	}
+
+	return manifest.Forced ||
+		(manifest.MinimumVersion != "" && semver.Compare(updater.latestVersionInstalled, manifest.MinimumVersion) < 0)
 }
@@ -0,0 +1,196 @@
+package autoupdate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestUpdater(t *testing.T, stateDir, execPath, currentVersion string, healthCheckTimeout int64) *Updater {
+	updater, err := NewUpdater(Config{
+		PublicKey:          "public key",
+		BaseURL:            "https://downloads.example.com/app",
+		CurrentVersion:     currentVersion,
+		StateDir:           stateDir,
+		InstallID:          "install",
+		HealthCheckTimeout: healthCheckTimeout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updater.execPath = execPath
+	return updater
+}
+
+func TestRolloutBucket(t *testing.T) {
+	manifest := ChannelManifest{Name: "app", Version: "1.1.0"}
+	nextManifest := ChannelManifest{Name: "app", Version: "1.2.0"}
+
+	buckets := make([]int, 100)
+	changedBuckets := 0
+	for i := range 10_000 {
+		installID := string(rune('a'+i%26)) + string(rune(i))
+		bucket := rolloutBucket(installID, manifest)
+		if bucket >= 100 {
+			t.Fatalf("bucket out of range: %d", bucket)
+		}
+		if rolloutBucket(installID, manifest) != bucket {
+			t.Fatalf("bucket of %q is not stable", installID)
+		}
+		if rolloutBucket(installID, nextManifest) != bucket {
+			changedBuckets += 1
+		}
+		buckets[bucket] += 1
+	}
+
+	for bucket, count := range buckets {
+		if count < 50 || count > 150 {
+			t.Errorf("bucket %d is not uniformly distributed: %d installations", bucket, count)
+		}
+	}
+	if changedBuckets < 9_000 {
+		t.Errorf("buckets should differ between releases: only %d changed", changedBuckets)
+	}
+}
+
+func TestUpdateAvailable(t *testing.T) {
+	updater := newTestUpdater(t, t.TempDir(), "", "1.0.0", 0)
+	bucket := uint8(rolloutBucket("install", ChannelManifest{Name: "app", Version: "1.1.0"}))
+	percentage := func(value uint8) *uint8 { return &value }
+
+	tests := []struct {
+		name             string
+		manifest         ChannelManifest
+		expectedRequired bool
+		expectedUpdate   bool
+	}{
+		{"same version", ChannelManifest{Version: "1.0.0", Forced: true}, false, false},
+		{"older version", ChannelManifest{Version: "0.9.0", MinimumVersion: "0.9.0"}, false, false},
+		{"no rollout", ChannelManifest{Version: "1.1.0"}, false, true},
+		{"out of rollout", ChannelManifest{Version: "1.1.0", RolloutPercentage: percentage(bucket)}, false, false},
+		{"in rollout", ChannelManifest{Version: "1.1.0", RolloutPercentage: percentage(bucket + 1)}, false, true},
+		{"forced", ChannelManifest{Version: "1.1.0", RolloutPercentage: percentage(0), Forced: true}, true, true},
+		{"below minimum version", ChannelManifest{Version: "1.1.0", RolloutPercentage: percentage(0), MinimumVersion: "1.0.1"}, true, true},
+		{"at minimum version", ChannelManifest{Version: "1.1.0", RolloutPercentage: percentage(0), MinimumVersion: "1.0.0"}, false, false},
+	}
+
+	for _, test := range tests {
+		test.manifest.Name = "app"
+		if required := updater.UpdateRequired(test.manifest); required != test.expectedRequired {
+			t.Errorf("%s: expected UpdateRequired to be %v", test.name, test.expectedRequired)
+		}
+		if available := updater.UpdateAvailable(test.manifest); available != test.expectedUpdate {
+			t.Errorf("%s: expected UpdateAvailable to be %v", test.name, test.expectedUpdate)
+		}
+	}
+}
+
+func TestInstallAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	stateDir := filepath.Join(dir, "state")
+	execPath := filepath.Join(dir, "app")
+	writeFile := func(path, content string) {
+		err := os.WriteFile(path, []byte(content), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertExecutable := func(expected string) {
+		t.Helper()
+		content, err := os.ReadFile(execPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("expected executable %q, got %q", expected, content)
+		}
+	}
+	writeFile(execPath, "1.0.0")
+
+	updater := newTestUpdater(t, stateDir, execPath, "1.0.0", 1)
+	if err := updater.Rollback(); !errors.Is(err, ErrNoPreviousVersion) {
+		t.Errorf("expected ErrNoPreviousVersion, got: %v", err)
+	}
+
+	// 1.1.0 is installed and confirms that it is healthy
+	writeFile(filepath.Join(dir, "update"), "1.1.0")
+	err := updater.install(filepath.Join(dir, "update"), execPath, "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertExecutable("1.1.0")
+
+	updater = newTestUpdater(t, stateDir, execPath, "1.1.0", 1)
+	err = updater.ConfirmHealthy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	updater.WatchHealth(ctx)
+	assertExecutable("1.1.0")
+
+	// 1.2.0 is installed but doesn't confirm that it is healthy in time
+	writeFile(filepath.Join(dir, "update"), "1.2.0")
+	err = updater.install(filepath.Join(dir, "update"), execPath, "1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertExecutable("1.2.0")
+
+	updater = newTestUpdater(t, stateDir, execPath, "1.2.0", 1)
+	updater.WatchHealth(ctx)
+	select {
+	case <-updater.RolledBack:
+	default:
+		t.Fatal("expected a rollback")
+	}
+	assertExecutable("1.1.0")
+
+	updater = newTestUpdater(t, stateDir, execPath, "1.1.0", 1)
+	if !updater.versionRolledBack("1.2.0") || updater.versionRolledBack("1.1.0") {
+		t.Error("only 1.2.0 should be marked as rolled back")
+	}
+	if updater.UpdateAvailable(ChannelManifest{Name: "app", Version: "1.2.0", Forced: true}) {
+		t.Error("a rolled back version should not be installed again")
+	}
+}
+
+func TestInstallWithoutStateDir(t *testing.T) {
+	t.Setenv("HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("AppData", "")
+
+	dir := t.TempDir()
+	execPath := filepath.Join(dir, "app")
+	newExecutablePath := filepath.Join(dir, "update")
+	for path, content := range map[string]string{execPath: "1.0.0", newExecutablePath: "1.1.0"} {
+		err := os.WriteFile(path, []byte(content), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rollbacks are disabled, so the updater works without a StateDir
+	updater := newTestUpdater(t, "", execPath, "1.0.0", 0)
+	err := updater.install(newExecutablePath, execPath, "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updater.RestartRequired() {
+		t.Error("a restart should be required")
+	}
+	if err = updater.ConfirmHealthy(); err != nil {
+		t.Errorf("ConfirmHealthy: %v", err)
+	}
+
+	// the StateDir is required for rollbacks
+	updater = newTestUpdater(t, "", execPath, "1.1.0", 1)
+	err = updater.install(newExecutablePath, execPath, "1.2.0")
+	if err == nil {
+		t.Error("expected an error when the StateDir is not available and rollbacks are enabled")
+	}
+}
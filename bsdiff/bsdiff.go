@@ -0,0 +1,268 @@
+// Package bsdiff creates and applies binary patches with the bsdiff algorithm of Colin Percival
+// (https://www.daemonology.net/bsdiff/), which produces small patches for executables.
+//
+// Patches are not compatible with the original bsdiff tool: they are compressed with DEFLATE instead
+// of bzip2, which is not available for compression in the standard library.
+//
+// Patch format:
+//
+//	magic "STDXBSD1" (8 bytes) || size of the new file (uint64, little-endian) || DEFLATE(records)
+//
+// where each record is:
+//
+//	diff length (uvarint) || extra length (uvarint) || seek in the old file (varint) || diff bytes || extra bytes
+package bsdiff
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	// MaxSize is the maximum size of the old and new files
+	MaxSize = math.MaxInt32 - 1
+
+	magic      = "STDXBSD1"
+	headerSize = len(magic) + 8
+)
+
+var (
+	ErrFileIsTooLarge  = errors.New("bsdiff: file is too large")
+	ErrPatchIsNotValid = errors.New("bsdiff: patch is not valid")
+)
+
+// Diff returns a patch that transforms oldData into newData.
+// It uses about 8 times the size of oldData of memory.
+func Diff(oldData, newData []byte) (patch []byte, err error) {
+	if len(oldData) > MaxSize || len(newData) > MaxSize {
+		return nil, ErrFileIsTooLarge
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(magic)
+	buffer.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(newData))))
+
+	compressor, err := flate.NewWriter(&buffer, flate.BestCompression)
+	if err != nil {
+		return
+	}
+	writer := recordWriter{writer: compressor}
+
+	suffixes := qsufsort(oldData)
+	oldSize := len(oldData)
+	newSize := len(newData)
+
+	var scan, pos, length int
+	var lastScan, lastPos, lastOffset int
+	for scan < newSize {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < newSize; scan += 1 {
+			pos, length = search(suffixes, oldData, newData[scan:], 0, oldSize)
+
+			for ; scsc < scan+length; scsc += 1 {
+				if scsc+lastOffset < oldSize && oldData[scsc+lastOffset] == newData[scsc] {
+					oldScore += 1
+				}
+			}
+
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+
+			if scan+lastOffset < oldSize && oldData[scan+lastOffset] == newData[scan] {
+				oldScore -= 1
+			}
+		}
+
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		// extend the match forward from the last match
+		var lengthForward int
+		for s, bestScore, i := 0, 0, 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if oldData[lastPos+i] == newData[lastScan+i] {
+				s += 1
+			}
+			i += 1
+			if s*2-i > bestScore*2-lengthForward {
+				bestScore = s
+				lengthForward = i
+			}
+		}
+
+		// extend the match backward from the new match
+		var lengthBackward int
+		if scan < newSize {
+			for s, bestScore, i := 0, 0, 1; scan >= lastScan+i && pos >= i; i += 1 {
+				if oldData[pos-i] == newData[scan-i] {
+					s += 1
+				}
+				if s*2-i > bestScore*2-lengthBackward {
+					bestScore = s
+					lengthBackward = i
+				}
+			}
+		}
+
+		// resolve the overlap between the forward and backward extensions
+		if lastScan+lengthForward > scan-lengthBackward {
+			overlap := (lastScan + lengthForward) - (scan - lengthBackward)
+			s, bestScore, lengthSplit := 0, 0, 0
+			for i := 0; i < overlap; i += 1 {
+				if newData[lastScan+lengthForward-overlap+i] == oldData[lastPos+lengthForward-overlap+i] {
+					s += 1
+				}
+				if newData[scan-lengthBackward+i] == oldData[pos-lengthBackward+i] {
+					s -= 1
+				}
+				if s > bestScore {
+					bestScore = s
+					lengthSplit = i + 1
+				}
+			}
+			lengthForward += lengthSplit - overlap
+			lengthBackward -= lengthSplit
+		}
+
+		diff := make([]byte, lengthForward)
+		for i := range diff {
+			diff[i] = newData[lastScan+i] - oldData[lastPos+i]
+		}
+		extra := newData[lastScan+lengthForward : scan-lengthBackward]
+		seek := (pos - lengthBackward) - (lastPos + lengthForward)
+
+		err = writer.writeRecord(diff, extra, seek)
+		if err != nil {
+			return
+		}
+
+		lastScan = scan - lengthBackward
+		lastPos = pos - lengthBackward
+		lastOffset = pos - scan
+	}
+
+	err = compressor.Close()
+	if err != nil {
+		return
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Patch applies a patch created by Diff to oldData and returns the new data.
+func Patch(oldData, patch []byte) (newData []byte, err error) {
+	if len(patch) < headerSize || string(patch[:len(magic)]) != magic {
+		return nil, ErrPatchIsNotValid
+	}
+	newSize := binary.LittleEndian.Uint64(patch[len(magic):headerSize])
+	if newSize > MaxSize {
+		return nil, ErrFileIsTooLarge
+	}
+
+	reader := bufio.NewReader(flate.NewReader(bytes.NewReader(patch[headerSize:])))
+	newData = make([]byte, newSize)
+	oldSize := int64(len(oldData))
+	var newPos, oldPos int64
+
+	for newPos < int64(newSize) {
+		var diffLength, extraLength uint64
+		var seek int64
+		diffLength, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, ErrPatchIsNotValid
+		}
+		extraLength, err = binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, ErrPatchIsNotValid
+		}
+		seek, err = binary.ReadVarint(reader)
+		if err != nil {
+			return nil, ErrPatchIsNotValid
+		}
+
+		if diffLength > newSize-uint64(newPos) {
+			return nil, ErrPatchIsNotValid
+		}
+		_, err = io.ReadFull(reader, newData[newPos:newPos+int64(diffLength)])
+		if err != nil {
+			return nil, ErrPatchIsNotValid
+		}
+		for i := int64(0); i < int64(diffLength); i += 1 {
+			if oldPos+i >= 0 && oldPos+i < oldSize {
+				newData[newPos+i] += oldData[oldPos+i]
+			}
+		}
+		newPos += int64(diffLength)
+		oldPos += int64(diffLength)
+
+		if extraLength > newSize-uint64(newPos) {
+			return nil, ErrPatchIsNotValid
+		}
+		_, err = io.ReadFull(reader, newData[newPos:newPos+int64(extraLength)])
+		if err != nil {
+			return nil, ErrPatchIsNotValid
+		}
+		newPos += int64(extraLength)
+		oldPos += seek
+	}
+
+	return newData, nil
+}
+
+// search returns the position and length of the longest match of data in oldData, using the suffix
+// array of oldData.
+func search(suffixes []int32, oldData, data []byte, start, end int) (pos, length int) {
+	for end-start >= 2 {
+		middle := start + (end-start)/2
+		suffix := oldData[suffixes[middle]:]
+		compareLength := min(len(suffix), len(data))
+		if bytes.Compare(suffix[:compareLength], data[:compareLength]) < 0 {
+			start = middle
+		} else {
+			end = middle
+		}
+	}
+
+	startLength := matchLength(oldData[suffixes[start]:], data)
+	endLength := matchLength(oldData[suffixes[end]:], data)
+	if startLength > endLength {
+		return int(suffixes[start]), startLength
+	}
+	return int(suffixes[end]), endLength
+}
+
+func matchLength(a, b []byte) (length int) {
+	for length < len(a) && length < len(b) && a[length] == b[length] {
+		length += 1
+	}
+	return
+}
+
+type recordWriter struct {
+	writer io.Writer
+	buffer [3 * binary.MaxVarintLen64]byte
+}
+
+func (writer *recordWriter) writeRecord(diff, extra []byte, seek int) (err error) {
+	header := binary.AppendUvarint(writer.buffer[:0], uint64(len(diff)))
+	header = binary.AppendUvarint(header, uint64(len(extra)))
+	header = binary.AppendVarint(header, int64(seek))
+
+	_, err = writer.writer.Write(header)
+	if err != nil {
+		return
+	}
+	_, err = writer.writer.Write(diff)
+	if err != nil {
+		return
+	}
+	_, err = writer.writer.Write(extra)
+	return
+}
@@ -0,0 +1,109 @@
+package bsdiff
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestDiffPatch(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+
+	randomBytes := func(size int) []byte {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(random.UintN(256))
+		}
+		return data
+	}
+
+	old := randomBytes(100_000)
+	// similar to a new version of an executable: some bytes changed, some inserted and some removed
+	modified := bytes.Clone(old)
+	for range 500 {
+		modified[random.IntN(len(modified))] += 1
+	}
+	modified = append(modified[:20_000], append(randomBytes(1_000), modified[20_000:]...)...)
+	modified = append(modified[:60_000], modified[65_000:]...)
+
+	tests := []struct {
+		name    string
+		oldData []byte
+		newData []byte
+	}{
+		{"empty", nil, nil},
+		{"empty old", nil, []byte("hello world")},
+		{"empty new", []byte("hello world"), nil},
+		{"same", old, old},
+		{"small", []byte("hello world"), []byte("hello wonderful world")},
+		{"repetitive", bytes.Repeat([]byte("ab"), 1000), bytes.Repeat([]byte("abc"), 1000)},
+		{"modified", old, modified},
+		{"unrelated", randomBytes(10_000), randomBytes(12_000)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := Diff(test.oldData, test.newData)
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+
+			newData, err := Patch(test.oldData, patch)
+			if err != nil {
+				t.Fatalf("Patch: %v", err)
+			}
+			if !bytes.Equal(newData, test.newData) {
+				t.Fatal("patched data is not equal to the new data")
+			}
+		})
+	}
+
+	patch, err := Diff(old, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) > len(modified)/10 {
+		t.Errorf("patch is too large: %d bytes for %d bytes of data", len(patch), len(modified))
+	}
+}
+
+func TestPatchNotValid(t *testing.T) {
+	old := bytes.Repeat([]byte("0123456789"), 1000)
+	new := append(bytes.Clone(old[:5000]), []byte("some new data")...)
+	patch, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Patch(old, patch[:headerSize-1])
+	if err != ErrPatchIsNotValid {
+		t.Errorf("truncated header: expected ErrPatchIsNotValid, got %v", err)
+	}
+
+	_, err = Patch(old, patch[:len(patch)-4])
+	if err != ErrPatchIsNotValid {
+		t.Errorf("truncated patch: expected ErrPatchIsNotValid, got %v", err)
+	}
+
+	badMagic := bytes.Clone(patch)
+	badMagic[0] ^= 1
+	_, err = Patch(old, badMagic)
+	if err != ErrPatchIsNotValid {
+		t.Errorf("bad magic: expected ErrPatchIsNotValid, got %v", err)
+	}
+
+	tooLarge := bytes.Clone(patch)
+	tooLarge[len(magic)+7] = 0xff
+	_, err = Patch(old, tooLarge)
+	if err != ErrFileIsTooLarge {
+		t.Errorf("new size: expected ErrFileIsTooLarge, got %v", err)
+	}
+
+	// corrupted patches must never panic
+	random := rand.New(rand.NewPCG(3, 4))
+	for range 1000 {
+		corrupted := bytes.Clone(patch)
+		corrupted[headerSize+random.IntN(len(corrupted)-headerSize)] = byte(random.UintN(256))
+		_, _ = Patch(old, corrupted)
+	}
+}
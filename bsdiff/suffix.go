@@ -0,0 +1,142 @@
+package bsdiff
+
+// qsufsort computes the suffix array of data with the Larsson-Sadakane algorithm, as done by bsdiff.
+// The returned array has len(data)+1 entries, the first one being the empty suffix.
+// It uses 8 bytes of memory per byte of data.
+func qsufsort(data []byte) []int32 {
+	size := int32(len(data))
+	suffixes := make([]int32, size+1)
+	ranks := make([]int32, size+1)
+
+	var buckets [256]int32
+	for _, c := range data {
+		buckets[c] += 1
+	}
+	for i := 1; i < 256; i += 1 {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i -= 1 {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, c := range data {
+		buckets[c] += 1
+		suffixes[buckets[c]] = int32(i)
+	}
+	suffixes[0] = size
+	for i, c := range data {
+		ranks[i] = buckets[c]
+	}
+	ranks[size] = 0
+	for i := 1; i < 256; i += 1 {
+		if buckets[i] == buckets[i-1]+1 {
+			suffixes[buckets[i]] = -1
+		}
+	}
+	suffixes[0] = -1
+
+	for h := int32(1); suffixes[0] != -(size + 1); h += h {
+		length := int32(0)
+		i := int32(0)
+		for i < size+1 {
+			if suffixes[i] < 0 {
+				length -= suffixes[i]
+				i -= suffixes[i]
+			} else {
+				if length != 0 {
+					suffixes[i-length] = -length
+				}
+				length = ranks[suffixes[i]] + 1 - i
+				split(suffixes, ranks, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			suffixes[i-length] = -length
+		}
+	}
+
+	for i := int32(0); i < size+1; i += 1 {
+		suffixes[ranks[i]] = i
+	}
+
+	return suffixes
+}
+
+func split(suffixes, ranks []int32, start, length, h int32) {
+	if length < 16 {
+		var j int32
+		for k := start; k < start+length; k += j {
+			j = 1
+			x := ranks[suffixes[k]+h]
+			for i := int32(1); k+i < start+length; i += 1 {
+				if ranks[suffixes[k+i]+h] < x {
+					x = ranks[suffixes[k+i]+h]
+					j = 0
+				}
+				if ranks[suffixes[k+i]+h] == x {
+					suffixes[k+j], suffixes[k+i] = suffixes[k+i], suffixes[k+j]
+					j += 1
+				}
+			}
+			for i := int32(0); i < j; i += 1 {
+				ranks[suffixes[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				suffixes[k] = -1
+			}
+		}
+		return
+	}
+
+	x := ranks[suffixes[start+length/2]+h]
+	var jj, kk int32
+	for i := start; i < start+length; i += 1 {
+		if ranks[suffixes[i]+h] < x {
+			jj += 1
+		}
+		if ranks[suffixes[i]+h] == x {
+			kk += 1
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, int32(0), int32(0)
+	for i < jj {
+		if ranks[suffixes[i]+h] < x {
+			i += 1
+		} else if ranks[suffixes[i]+h] == x {
+			suffixes[i], suffixes[jj+j] = suffixes[jj+j], suffixes[i]
+			j += 1
+		} else {
+			suffixes[i], suffixes[kk+k] = suffixes[kk+k], suffixes[i]
+			k += 1
+		}
+	}
+	for jj+j < kk {
+		if ranks[suffixes[jj+j]+h] == x {
+			j += 1
+		} else {
+			suffixes[jj+j], suffixes[kk+k] = suffixes[kk+k], suffixes[jj+j]
+			k += 1
+		}
+	}
+
+	if jj > start {
+		split(suffixes, ranks, start, jj-start, h)
+	}
+
+	for i := int32(0); i < kk-jj; i += 1 {
+		ranks[suffixes[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		suffixes[jj] = -1
+	}
+
+	if start+length > kk {
+		split(suffixes, ranks, kk, start+length-kk, h)
+	}
+}
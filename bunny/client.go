@@ -21,7 +21,7 @@ type Client struct {
 
 func NewClient(acountApiKey, streamApiKey string, httpClient *http.Client) *Client {
 	if httpClient == nil {
-		httpClient = httpx.DefaultClient()
+		httpClient = httpx.NewClient(httpx.ClientConfig{})
 	}
 
 	return &Client{
@@ -19,7 +19,7 @@ type Client struct {
 
 func NewClient(apiToken string, httpClient *http.Client) *Client {
 	if httpClient == nil {
-		httpClient = httpx.DefaultClient()
+		httpClient = httpx.NewClient(httpx.ClientConfig{})
 	}
 
 	return &Client{
@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"errors"
+
+	"github.com/bloom42/stdx-go/crypto/xchacha20sha256"
+)
+
+const (
+	// AeadKeySize is the size in bytes of the keys used by Encrypt and Decrypt
+	AeadKeySize = xchacha20sha256.KeySize
+	// AeadOverhead is the difference in bytes between a ciphertext produced by Encrypt and its plaintext
+	AeadOverhead = xchacha20sha256.NonceSize + xchacha20sha256.TagSize
+)
+
+var (
+	ErrAeadKeySizeIsNotValid    = errors.New("crypto: AEAD key must be 32 bytes")
+	ErrAeadCiphertextIsNotValid = errors.New("crypto: ciphertext is not valid")
+)
+
+// Encrypt encrypts and authenticates plaintext, and authenticates additionalData with the XChaCha20-SHA256
+// AEAD. A random nonce is prepended to the returned ciphertext, so the same key can safely be used to
+// encrypt a large number of messages.
+//
+// The format of ciphertext is: nonce (24 bytes) || encrypted plaintext || tag (32 bytes).
+func Encrypt(key, plaintext, additionalData []byte) (ciphertext []byte, err error) {
+	if len(key) != AeadKeySize {
+		return nil, ErrAeadKeySizeIsNotValid
+	}
+
+	cipher, err := xchacha20sha256.New(key)
+	if err != nil {
+		return
+	}
+
+	nonce := RandBytes(xchacha20sha256.NonceSize)
+	ciphertext = make([]byte, 0, len(plaintext)+AeadOverhead)
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = cipher.Seal(ciphertext, nonce, plaintext, additionalData)
+	return ciphertext, nil
+}
+
+// Decrypt decrypts and verifies a ciphertext produced by Encrypt. It returns ErrAeadCiphertextIsNotValid if
+// ciphertext, additionalData or key doesn't match the ones used by Encrypt.
+func Decrypt(key, ciphertext, additionalData []byte) (plaintext []byte, err error) {
+	if len(key) != AeadKeySize {
+		return nil, ErrAeadKeySizeIsNotValid
+	}
+	if len(ciphertext) < AeadOverhead {
+		return nil, ErrAeadCiphertextIsNotValid
+	}
+
+	cipher, err := xchacha20sha256.New(key)
+	if err != nil {
+		return
+	}
+
+	nonce := ciphertext[:xchacha20sha256.NonceSize]
+	plaintext, err = cipher.Open(nil, nonce, ciphertext[xchacha20sha256.NonceSize:], additionalData)
+	if err != nil {
+		return nil, ErrAeadCiphertextIsNotValid
+	}
+
+	return plaintext, nil
+}
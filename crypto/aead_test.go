@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto/xchacha20sha256"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := RandBytes(AeadKeySize)
+
+	for _, message := range [][]byte{nil, []byte("Hello World"), RandBytes(4096)} {
+		ciphertext, err := Encrypt(key, message, []byte("ad"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ciphertext) != len(message)+AeadOverhead {
+			t.Errorf("ciphertext size = %d, want %d", len(ciphertext), len(message)+AeadOverhead)
+		}
+
+		plaintext, err := Decrypt(key, ciphertext, []byte("ad"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Errorf("plaintext = %x, want %x", plaintext, message)
+		}
+	}
+}
+
+func TestEncryptFormat(t *testing.T) {
+	key := RandBytes(AeadKeySize)
+	message := []byte("Hello World")
+
+	ciphertext, err := Encrypt(key, message, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nonce || encrypted plaintext || tag
+	cipher, err := xchacha20sha256.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := ciphertext[:xchacha20sha256.NonceSize]
+	expected := cipher.Seal(bytes.Clone(nonce), nonce, message, []byte("ad"))
+	if !bytes.Equal(ciphertext, expected) {
+		t.Errorf("ciphertext = %x, want %x", ciphertext, expected)
+	}
+
+	// the nonce is random, so the same message never produces the same ciphertext
+	otherCiphertext, err := Encrypt(key, message, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ciphertext[:xchacha20sha256.NonceSize], otherCiphertext[:xchacha20sha256.NonceSize]) {
+		t.Error("nonces must be random")
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	key := RandBytes(AeadKeySize)
+	ciphertext, err := Encrypt(key, []byte("Hello World"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(index int) []byte {
+		tampered := bytes.Clone(ciphertext)
+		tampered[index] ^= 1
+		return tampered
+	}
+
+	tests := []struct {
+		name           string
+		key            []byte
+		ciphertext     []byte
+		additionalData []byte
+		expectedErr    error
+	}{
+		{"wrong key", RandBytes(AeadKeySize), ciphertext, []byte("ad"), ErrAeadCiphertextIsNotValid},
+		{"short key", key[:16], ciphertext, []byte("ad"), ErrAeadKeySizeIsNotValid},
+		{"wrong additional data", key, ciphertext, []byte("other ad"), ErrAeadCiphertextIsNotValid},
+		{"missing additional data", key, ciphertext, nil, ErrAeadCiphertextIsNotValid},
+		{"tampered nonce", key, tamper(0), []byte("ad"), ErrAeadCiphertextIsNotValid},
+		{"tampered message", key, tamper(xchacha20sha256.NonceSize), []byte("ad"), ErrAeadCiphertextIsNotValid},
+		{"tampered tag", key, tamper(len(ciphertext) - 1), []byte("ad"), ErrAeadCiphertextIsNotValid},
+		{"truncated", key, ciphertext[:AeadOverhead-1], []byte("ad"), ErrAeadCiphertextIsNotValid},
+		{"empty", key, nil, []byte("ad"), ErrAeadCiphertextIsNotValid},
+	}
+
+	for _, test := range tests {
+		_, err := Decrypt(test.key, test.ciphertext, test.additionalData)
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.expectedErr)
+		}
+	}
+
+	_, err = Encrypt(key[:16], []byte("Hello World"), nil)
+	if !errors.Is(err, ErrAeadKeySizeIsNotValid) {
+		t.Errorf("short key: err = %v, want %v", err, ErrAeadKeySizeIsNotValid)
+	}
+}
@@ -55,6 +55,8 @@ func (publicKey Curve25519PublicKey) Encrypt(fromPrivateKey Curve25519PrivateKey
 
 // EncryptEphemeral generates an ephemeral Curve25519KeyPair and `Encrypt` message using the public key,
 // the ephemeral privateKey and `blake2b(size=AEADNonceSize, message=ephemeralPublicKey || publicKey)` as nonce
+//
+// New code should use the standard HPKE implementation of the crypto/hpke package instead.
 func (publicKey Curve25519PublicKey) EncryptEphemeral(message []byte) (ciphertext []byte, ephemeralPublicKey Curve25519PublicKey, err error) {
 	ephemeralPublicKey, ephemeralPrivateKey, err := GenerateCurve25519KeyPair()
 	defer Zeroize(ephemeralPrivateKey)
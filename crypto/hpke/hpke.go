@@ -0,0 +1,354 @@
+// Package hpke implements Hybrid Public Key Encryption (RFC 9180) with the DHKEM(X25519, HKDF-SHA256)
+// KEM, the HKDF-SHA256 KDF and the ChaCha20-Poly1305 AEAD, in the base and auth modes.
+//
+// It is interoperable with the other implementations of RFC 9180 that support this ciphersuite, and
+// should be preferred over crypto.Curve25519PublicKey.EncryptEphemeral.
+//
+// The sender sets up a SenderContext with the public key of the recipient and sends the encapsulated key
+// (enc) along with the ciphertexts. The recipient sets up a RecipientContext with enc and its private key.
+// Messages must be opened in the order they were sealed. Seal and Open can be used for single messages.
+//
+// See https://www.rfc-editor.org/rfc/rfc9180.html
+package hpke
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Algorithm identifiers.
+// See https://www.rfc-editor.org/rfc/rfc9180.html#section-7
+const (
+	KEMX25519HKDFSHA256  uint16 = 0x0020
+	KDFHKDFSHA256        uint16 = 0x0001
+	AEADChaCha20Poly1305 uint16 = 0x0003
+)
+
+type Mode uint8
+
+const (
+	ModeBase Mode = 0x00
+	ModeAuth Mode = 0x02
+)
+
+const (
+	// EncapsulatedKeySize is the size in bytes of the encapsulated key (enc)
+	EncapsulatedKeySize = curve25519.PointSize
+	// Overhead is the number of bytes added to each sealed message
+	Overhead = chacha20poly1305.Overhead
+
+	nSecret = sha256.Size
+	nH      = sha256.Size
+	nK      = chacha20poly1305.KeySize
+	nN      = chacha20poly1305.NonceSize
+)
+
+var (
+	ErrPublicKeyIsNotValid       = errors.New("hpke: public key is not valid")
+	ErrPrivateKeyIsNotValid      = errors.New("hpke: private key is not valid")
+	ErrEncapsulatedKeyIsNotValid = errors.New("hpke: encapsulated key is not valid")
+	ErrOpen                      = errors.New("hpke: error decrypting ciphertext")
+	ErrMessageLimitReached       = errors.New("hpke: message limit reached")
+	ErrExportLengthIsNotValid    = errors.New("hpke: export length is not valid")
+)
+
+var (
+	versionLabel = []byte("HPKE-v1")
+	kemSuiteID   = binary.BigEndian.AppendUint16([]byte("KEM"), KEMX25519HKDFSHA256)
+	hpkeSuiteID  = binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(
+		binary.BigEndian.AppendUint16([]byte("HPKE"), KEMX25519HKDFSHA256), KDFHKDFSHA256), AEADChaCha20Poly1305)
+)
+
+// context is the encryption context shared by the sender and the recipient.
+type context struct {
+	aead           cipher.AEAD
+	baseNonce      []byte
+	sequenceNumber uint64
+	exporterSecret []byte
+}
+
+// SenderContext seals messages for a recipient.
+type SenderContext struct {
+	context
+}
+
+// RecipientContext opens the messages of a sender.
+type RecipientContext struct {
+	context
+}
+
+// SetupBaseSender sets up a context to encrypt messages for the owner of recipientPublicKey.
+// info is application-supplied information, that must be the same for the recipient.
+func SetupBaseSender(recipientPublicKey crypto.Curve25519PublicKey, info []byte) (enc []byte, sender *SenderContext, err error) {
+	ephemeralPrivateKey := crypto.RandBytes(crypto.Curve25519PrivateKeySize)
+	defer crypto.Zeroize(ephemeralPrivateKey)
+	return setupSender(ModeBase, recipientPublicKey, info, ephemeralPrivateKey, nil)
+}
+
+// SetupAuthSender sets up a context to encrypt messages for the owner of recipientPublicKey. The
+// recipient can verify that the messages were sent by the owner of senderPrivateKey.
+func SetupAuthSender(recipientPublicKey crypto.Curve25519PublicKey, info []byte, senderPrivateKey crypto.Curve25519PrivateKey) (enc []byte, sender *SenderContext, err error) {
+	if len(senderPrivateKey) != crypto.Curve25519PrivateKeySize {
+		return nil, nil, ErrPrivateKeyIsNotValid
+	}
+
+	ephemeralPrivateKey := crypto.RandBytes(crypto.Curve25519PrivateKeySize)
+	defer crypto.Zeroize(ephemeralPrivateKey)
+	return setupSender(ModeAuth, recipientPublicKey, info, ephemeralPrivateKey, senderPrivateKey)
+}
+
+// SetupBaseRecipient sets up a context to decrypt the messages sent with the encapsulated key enc.
+func SetupBaseRecipient(enc []byte, recipientPrivateKey crypto.Curve25519PrivateKey, info []byte) (*RecipientContext, error) {
+	return setupRecipient(ModeBase, enc, recipientPrivateKey, info, nil)
+}
+
+// SetupAuthRecipient sets up a context to decrypt the messages sent with the encapsulated key enc by the
+// owner of senderPublicKey.
+func SetupAuthRecipient(enc []byte, recipientPrivateKey crypto.Curve25519PrivateKey, info []byte, senderPublicKey crypto.Curve25519PublicKey) (*RecipientContext, error) {
+	if len(senderPublicKey) != crypto.Curve25519PublicKeySize {
+		return nil, ErrPublicKeyIsNotValid
+	}
+	return setupRecipient(ModeAuth, enc, recipientPrivateKey, info, senderPublicKey)
+}
+
+// Seal encrypts a single message for the owner of recipientPublicKey, in the base mode.
+func Seal(recipientPublicKey crypto.Curve25519PublicKey, info, additionalData, plaintext []byte) (enc, ciphertext []byte, err error) {
+	enc, sender, err := SetupBaseSender(recipientPublicKey, info)
+	if err != nil {
+		return
+	}
+
+	ciphertext, err = sender.Seal(additionalData, plaintext)
+	return
+}
+
+// Open decrypts a single message encrypted with Seal.
+func Open(enc []byte, recipientPrivateKey crypto.Curve25519PrivateKey, info, additionalData, ciphertext []byte) (plaintext []byte, err error) {
+	recipient, err := SetupBaseRecipient(enc, recipientPrivateKey, info)
+	if err != nil {
+		return
+	}
+
+	return recipient.Open(additionalData, ciphertext)
+}
+
+// DeriveKeyPair deterministically derives a key pair from the input keying material ikm, which must have
+// at least 32 bytes of entropy.
+func DeriveKeyPair(ikm []byte) (publicKey crypto.Curve25519PublicKey, privateKey crypto.Curve25519PrivateKey, err error) {
+	dkpPrk := labeledExtract(kemSuiteID, nil, "dkp_prk", ikm)
+	privateKey = labeledExpand(kemSuiteID, dkpPrk, "sk", nil, crypto.Curve25519PrivateKeySize)
+
+	publicKey, err = privateKey.Public()
+	if err != nil {
+		return nil, nil, ErrPrivateKeyIsNotValid
+	}
+	return publicKey, privateKey, nil
+}
+
+// Seal encrypts and authenticates plaintext and additionalData.
+func (sender *SenderContext) Seal(additionalData, plaintext []byte) (ciphertext []byte, err error) {
+	nonce, err := sender.nextNonce()
+	if err != nil {
+		return
+	}
+
+	return sender.aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts and authenticates ciphertext and additionalData.
+func (recipient *RecipientContext) Open(additionalData, ciphertext []byte) (plaintext []byte, err error) {
+	if recipient.sequenceNumber == math.MaxUint64 {
+		return nil, ErrMessageLimitReached
+	}
+
+	nonce := recipient.computeNonce()
+	plaintext, err = recipient.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrOpen
+	}
+
+	// the sequence number is incremented only on success, so a forged message doesn't desynchronize
+	// the recipient from the sender
+	recipient.sequenceNumber += 1
+	return plaintext, nil
+}
+
+// Export derives a secret of length bytes from the context and exporterContext.
+// The sender and the recipient export the same secrets.
+func (ctx *context) Export(exporterContext []byte, length int) ([]byte, error) {
+	if length < 0 || length > 255*nH {
+		return nil, ErrExportLengthIsNotValid
+	}
+
+	return labeledExpand(hpkeSuiteID, ctx.exporterSecret, "sec", exporterContext, length), nil
+}
+
+func (ctx *context) nextNonce() ([]byte, error) {
+	if ctx.sequenceNumber == math.MaxUint64 {
+		return nil, ErrMessageLimitReached
+	}
+
+	nonce := ctx.computeNonce()
+	ctx.sequenceNumber += 1
+	return nonce, nil
+}
+
+// computeNonce returns the base nonce XORed with the big endian sequence number.
+func (ctx *context) computeNonce() []byte {
+	nonce := make([]byte, nN)
+	binary.BigEndian.PutUint64(nonce[nN-8:], ctx.sequenceNumber)
+	for i := range nonce {
+		nonce[i] ^= ctx.baseNonce[i]
+	}
+	return nonce
+}
+
+func setupSender(mode Mode, recipientPublicKey crypto.Curve25519PublicKey, info []byte,
+	ephemeralPrivateKey, senderPrivateKey crypto.Curve25519PrivateKey) (enc []byte, sender *SenderContext, err error) {
+	if len(recipientPublicKey) != crypto.Curve25519PublicKeySize {
+		return nil, nil, ErrPublicKeyIsNotValid
+	}
+
+	ephemeralPublicKey, err := ephemeralPrivateKey.Public()
+	if err != nil {
+		return nil, nil, ErrPrivateKeyIsNotValid
+	}
+
+	dh, err := ephemeralPrivateKey.KeyExchange(recipientPublicKey)
+	if err != nil {
+		return nil, nil, ErrPublicKeyIsNotValid
+	}
+	kemContext := append(append([]byte{}, ephemeralPublicKey...), recipientPublicKey...)
+
+	if mode == ModeAuth {
+		var senderPublicKey crypto.Curve25519PublicKey
+		senderPublicKey, err = senderPrivateKey.Public()
+		if err != nil {
+			return nil, nil, ErrPrivateKeyIsNotValid
+		}
+		var staticDH []byte
+		staticDH, err = senderPrivateKey.KeyExchange(recipientPublicKey)
+		if err != nil {
+			return nil, nil, ErrPublicKeyIsNotValid
+		}
+		dh = append(dh, staticDH...)
+		kemContext = append(kemContext, senderPublicKey...)
+	}
+
+	sharedSecret := extractAndExpand(dh, kemContext)
+	defer crypto.Zeroize(sharedSecret)
+	crypto.Zeroize(dh)
+
+	ctx, err := keySchedule(mode, sharedSecret, info)
+	if err != nil {
+		return
+	}
+
+	return ephemeralPublicKey, &SenderContext{context: ctx}, nil
+}
+
+func setupRecipient(mode Mode, enc []byte, recipientPrivateKey crypto.Curve25519PrivateKey, info []byte,
+	senderPublicKey crypto.Curve25519PublicKey) (*RecipientContext, error) {
+	if len(enc) != EncapsulatedKeySize {
+		return nil, ErrEncapsulatedKeyIsNotValid
+	}
+	if len(recipientPrivateKey) != crypto.Curve25519PrivateKeySize {
+		return nil, ErrPrivateKeyIsNotValid
+	}
+
+	recipientPublicKey, err := recipientPrivateKey.Public()
+	if err != nil {
+		return nil, ErrPrivateKeyIsNotValid
+	}
+
+	dh, err := recipientPrivateKey.KeyExchange(enc)
+	if err != nil {
+		return nil, ErrEncapsulatedKeyIsNotValid
+	}
+	kemContext := append(append([]byte{}, enc...), recipientPublicKey...)
+
+	if mode == ModeAuth {
+		var staticDH []byte
+		staticDH, err = recipientPrivateKey.KeyExchange(senderPublicKey)
+		if err != nil {
+			return nil, ErrPublicKeyIsNotValid
+		}
+		dh = append(dh, staticDH...)
+		kemContext = append(kemContext, senderPublicKey...)
+	}
+
+	sharedSecret := extractAndExpand(dh, kemContext)
+	defer crypto.Zeroize(sharedSecret)
+	crypto.Zeroize(dh)
+
+	ctx, err := keySchedule(mode, sharedSecret, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecipientContext{context: ctx}, nil
+}
+
+// extractAndExpand derives the shared secret of the KEM.
+// See https://www.rfc-editor.org/rfc/rfc9180.html#section-4.1
+func extractAndExpand(dh, kemContext []byte) []byte {
+	eaePrk := labeledExtract(kemSuiteID, nil, "eae_prk", dh)
+	return labeledExpand(kemSuiteID, eaePrk, "shared_secret", kemContext, nSecret)
+}
+
+// keySchedule derives the encryption context from the shared secret.
+// See https://www.rfc-editor.org/rfc/rfc9180.html#section-5.1
+func keySchedule(mode Mode, sharedSecret, info []byte) (ctx context, err error) {
+	// the psk and psk_id are empty in the base and auth modes
+	pskIDHash := labeledExtract(hpkeSuiteID, nil, "psk_id_hash", nil)
+	infoHash := labeledExtract(hpkeSuiteID, nil, "info_hash", info)
+	keyScheduleContext := append(append([]byte{byte(mode)}, pskIDHash...), infoHash...)
+
+	secret := labeledExtract(hpkeSuiteID, sharedSecret, "secret", nil)
+	defer crypto.Zeroize(secret)
+
+	key := labeledExpand(hpkeSuiteID, secret, "key", keyScheduleContext, nK)
+	defer crypto.Zeroize(key)
+
+	ctx.aead, err = chacha20poly1305.New(key)
+	if err != nil {
+		return
+	}
+	ctx.baseNonce = labeledExpand(hpkeSuiteID, secret, "base_nonce", keyScheduleContext, nN)
+	ctx.exporterSecret = labeledExpand(hpkeSuiteID, secret, "exp", keyScheduleContext, nH)
+	ctx.sequenceNumber = 0
+	return ctx, nil
+}
+
+func labeledExtract(suiteID, salt []byte, label string, ikm []byte) []byte {
+	labeledIKM := make([]byte, 0, len(versionLabel)+len(suiteID)+len(label)+len(ikm))
+	labeledIKM = append(labeledIKM, versionLabel...)
+	labeledIKM = append(labeledIKM, suiteID...)
+	labeledIKM = append(labeledIKM, label...)
+	labeledIKM = append(labeledIKM, ikm...)
+
+	return hkdf.Extract(sha256.New, labeledIKM, salt)
+}
+
+func labeledExpand(suiteID, prk []byte, label string, info []byte, length int) []byte {
+	labeledInfo := make([]byte, 0, 2+len(versionLabel)+len(suiteID)+len(label)+len(info))
+	labeledInfo = binary.BigEndian.AppendUint16(labeledInfo, uint16(length))
+	labeledInfo = append(labeledInfo, versionLabel...)
+	labeledInfo = append(labeledInfo, suiteID...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+
+	out := make([]byte, length)
+	// we can ignore the error as length is always <= 255 * nH
+	_, _ = io.ReadFull(hkdf.Expand(sha256.New, prk, labeledInfo), out)
+	return out
+}
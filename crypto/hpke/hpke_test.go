@@ -0,0 +1,256 @@
+package hpke
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+// testVector is a test vector of RFC 9180 Appendix A.2 (DHKEM(X25519, HKDF-SHA256), HKDF-SHA256,
+// ChaCha20Poly1305).
+//
+// testdata/rfc9180.json contains the vectors of the base (A.2.1) and auth (A.2.3) modes, with all their
+// encryptions and exports, as published in the test-vectors.json file of the CFRG HPKE draft repository
+// (commit 5f503c5) from which the RFC appendix is generated. The PSK modes are not implemented.
+type testVector struct {
+	Mode           Mode   `json:"mode"`
+	KEM            uint16 `json:"kem_id"`
+	KDF            uint16 `json:"kdf_id"`
+	AEAD           uint16 `json:"aead_id"`
+	Info           string `json:"info"`
+	IkmE           string `json:"ikmE"`
+	PkEm           string `json:"pkEm"`
+	SkEm           string `json:"skEm"`
+	IkmR           string `json:"ikmR"`
+	PkRm           string `json:"pkRm"`
+	SkRm           string `json:"skRm"`
+	IkmS           string `json:"ikmS"`
+	PkSm           string `json:"pkSm"`
+	SkSm           string `json:"skSm"`
+	Enc            string `json:"enc"`
+	BaseNonce      string `json:"base_nonce"`
+	ExporterSecret string `json:"exporter_secret"`
+	Encryptions    []struct {
+		Aad string `json:"aad"`
+		Pt  string `json:"pt"`
+		Ct  string `json:"ct"`
+	} `json:"encryptions"`
+	Exports []struct {
+		Context string `json:"exporter_context"`
+		L       int    `json:"L"`
+		Value   string `json:"exported_value"`
+	} `json:"exports"`
+}
+
+func mustDecodeHex(t *testing.T, data string) []byte {
+	t.Helper()
+	ret, err := hex.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestVectors(t *testing.T) {
+	vectorsJSON, err := os.ReadFile("testdata/rfc9180.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []testVector
+	err = json.Unmarshal(vectorsJSON, &vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modes := map[Mode]bool{}
+	for _, vector := range vectors {
+		modes[vector.Mode] = true
+		if vector.KEM != KEMX25519HKDFSHA256 || vector.KDF != KDFHKDFSHA256 || vector.AEAD != AEADChaCha20Poly1305 {
+			t.Fatalf("unexpected ciphersuite: %04x %04x %04x", vector.KEM, vector.KDF, vector.AEAD)
+		}
+
+		ephemeralPublicKey, ephemeralPrivateKey, err := DeriveKeyPair(mustDecodeHex(t, vector.IkmE))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ephemeralPrivateKey, mustDecodeHex(t, vector.SkEm)) || !bytes.Equal(ephemeralPublicKey, mustDecodeHex(t, vector.PkEm)) {
+			t.Errorf("DeriveKeyPair(ikmE) = %x, %x", ephemeralPublicKey, ephemeralPrivateKey)
+		}
+		recipientPublicKey, recipientPrivateKey, err := DeriveKeyPair(mustDecodeHex(t, vector.IkmR))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(recipientPrivateKey, mustDecodeHex(t, vector.SkRm)) || !bytes.Equal(recipientPublicKey, mustDecodeHex(t, vector.PkRm)) {
+			t.Errorf("DeriveKeyPair(ikmR) = %x, %x", recipientPublicKey, recipientPrivateKey)
+		}
+
+		var senderPublicKey crypto.Curve25519PublicKey
+		var senderPrivateKey crypto.Curve25519PrivateKey
+		if vector.Mode == ModeAuth {
+			senderPublicKey, senderPrivateKey, err = DeriveKeyPair(mustDecodeHex(t, vector.IkmS))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(senderPrivateKey, mustDecodeHex(t, vector.SkSm)) || !bytes.Equal(senderPublicKey, mustDecodeHex(t, vector.PkSm)) {
+				t.Errorf("DeriveKeyPair(ikmS) = %x, %x", senderPublicKey, senderPrivateKey)
+			}
+		}
+
+		info := mustDecodeHex(t, vector.Info)
+		enc, sender, err := setupSender(vector.Mode, recipientPublicKey, info, ephemeralPrivateKey, senderPrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, mustDecodeHex(t, vector.Enc)) {
+			t.Errorf("enc = %x, want %s", enc, vector.Enc)
+		}
+		if !bytes.Equal(sender.baseNonce, mustDecodeHex(t, vector.BaseNonce)) {
+			t.Errorf("base nonce = %x, want %s", sender.baseNonce, vector.BaseNonce)
+		}
+		if !bytes.Equal(sender.exporterSecret, mustDecodeHex(t, vector.ExporterSecret)) {
+			t.Errorf("exporter secret = %x, want %s", sender.exporterSecret, vector.ExporterSecret)
+		}
+
+		recipient, err := setupRecipient(vector.Mode, enc, recipientPrivateKey, info, senderPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, encryption := range vector.Encryptions {
+			additionalData := mustDecodeHex(t, encryption.Aad)
+			plaintext := mustDecodeHex(t, encryption.Pt)
+			ciphertext, err := sender.Seal(additionalData, plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ciphertext, mustDecodeHex(t, encryption.Ct)) {
+				t.Errorf("ciphertext = %x, want %s", ciphertext, encryption.Ct)
+			}
+			decrypted, err := recipient.Open(additionalData, ciphertext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("plaintext = %x, want %x", decrypted, plaintext)
+			}
+		}
+
+		for _, export := range vector.Exports {
+			value, err := sender.Export(mustDecodeHex(t, export.Context), export.L)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(value, mustDecodeHex(t, export.Value)) {
+				t.Errorf("exported value = %x, want %s", value, export.Value)
+			}
+		}
+	}
+
+	if !modes[ModeBase] || !modes[ModeAuth] {
+		t.Errorf("the vectors must cover the base and auth modes: %v", modes)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateCurve25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := []byte("stdx-go test")
+	message := []byte("Hello World")
+
+	enc, ciphertext, err := Seal(publicKey, info, nil, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertext) != len(message)+Overhead {
+		t.Errorf("ciphertext size = %d, want %d", len(ciphertext), len(message)+Overhead)
+	}
+
+	plaintext, err := Open(enc, privateKey, info, nil, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, message) {
+		t.Errorf("plaintext = %s, want %s", plaintext, message)
+	}
+
+	_, err = Open(enc, privateKey, []byte("other info"), nil, ciphertext)
+	if !errors.Is(err, ErrOpen) {
+		t.Errorf("wrong info: err = %v, want %v", err, ErrOpen)
+	}
+	_, err = Open(enc, privateKey, info, []byte("aad"), ciphertext)
+	if !errors.Is(err, ErrOpen) {
+		t.Errorf("wrong additional data: err = %v, want %v", err, ErrOpen)
+	}
+	_, err = Open(enc[:10], privateKey, info, nil, ciphertext)
+	if !errors.Is(err, ErrEncapsulatedKeyIsNotValid) {
+		t.Errorf("short enc: err = %v, want %v", err, ErrEncapsulatedKeyIsNotValid)
+	}
+	// low order point
+	_, err = Open(make([]byte, EncapsulatedKeySize), privateKey, info, nil, ciphertext)
+	if !errors.Is(err, ErrEncapsulatedKeyIsNotValid) {
+		t.Errorf("low order enc: err = %v, want %v", err, ErrEncapsulatedKeyIsNotValid)
+	}
+}
+
+func TestAuthMode(t *testing.T) {
+	recipientPublicKey, recipientPrivateKey, _ := crypto.GenerateCurve25519KeyPair()
+	senderPublicKey, senderPrivateKey, _ := crypto.GenerateCurve25519KeyPair()
+	otherPublicKey, _, _ := crypto.GenerateCurve25519KeyPair()
+	info := []byte("stdx-go test")
+
+	enc, sender, err := SetupAuthSender(recipientPublicKey, info, senderPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertexts := make([][]byte, 3)
+	for i := range ciphertexts {
+		ciphertexts[i], err = sender.Seal(nil, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recipient, err := SetupAuthRecipient(enc, recipientPrivateKey, info, senderPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// messages must be opened in order
+	_, err = recipient.Open(nil, ciphertexts[1])
+	if !errors.Is(err, ErrOpen) {
+		t.Errorf("out of order: err = %v, want %v", err, ErrOpen)
+	}
+	for i, ciphertext := range ciphertexts {
+		plaintext, err := recipient.Open(nil, ciphertext)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !bytes.Equal(plaintext, []byte{byte(i)}) {
+			t.Errorf("message %d: plaintext = %x", i, plaintext)
+		}
+	}
+
+	senderSecret, _ := sender.Export([]byte("context"), 32)
+	recipientSecret, _ := recipient.Export([]byte("context"), 32)
+	if !bytes.Equal(senderSecret, recipientSecret) {
+		t.Error("exported secrets are not equal")
+	}
+
+	// the message can't be opened as if it was sent by another sender or in the base mode
+	otherSender, _ := SetupAuthRecipient(enc, recipientPrivateKey, info, otherPublicKey)
+	_, err = otherSender.Open(nil, ciphertexts[0])
+	if !errors.Is(err, ErrOpen) {
+		t.Errorf("wrong sender: err = %v, want %v", err, ErrOpen)
+	}
+	baseRecipient, _ := SetupBaseRecipient(enc, recipientPrivateKey, info)
+	_, err = baseRecipient.Open(nil, ciphertexts[0])
+	if !errors.Is(err, ErrOpen) {
+		t.Errorf("base mode: err = %v, want %v", err, ErrOpen)
+	}
+}
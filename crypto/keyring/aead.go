@@ -0,0 +1,222 @@
+package keyring
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/blake3"
+	"github.com/bloom42/stdx-go/crypto/chacha12blake3"
+	"github.com/bloom42/stdx-go/crypto/chacha20blake3"
+	"github.com/bloom42/stdx-go/crypto/xchacha20sha256"
+)
+
+const (
+	formatVersion1 = 1
+
+	// HeaderSize is the size in bytes of the header of ciphertexts and MACs: version (1) || key ID (4)
+	HeaderSize = 1 + 4
+	// NonceSize is the size in bytes of the random nonce of ciphertexts
+	NonceSize = 32
+	// Overhead is the difference in bytes between a ciphertext and its plaintext
+	Overhead = HeaderSize + NonceSize + 32
+
+	messageKeyContext = "stdx-go/crypto/keyring v1 message key"
+)
+
+// Encrypt encrypts plaintext with the primary key for name.
+// additionalData is authenticated but not encrypted, and must be provided again to Decrypt.
+//
+// The ciphertext has the following format: version (1) || key ID (4) || nonce (32) || encrypted data || tag.
+func (keyring *Keyring) Encrypt(name string, plaintext, additionalData []byte) (ciphertext []byte, err error) {
+	keyring.mutex.RLock()
+	key, err := keyring.primary(name)
+	keyring.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+
+	nonce := crypto.RandBytes(NonceSize)
+	return seal(key, nonce, plaintext, additionalData)
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt with any enabled key for name.
+func (keyring *Keyring) Decrypt(name string, ciphertext, additionalData []byte) (plaintext []byte, err error) {
+	keyID, err := KeyID(ciphertext)
+	if err != nil {
+		return
+	}
+	if len(ciphertext) < Overhead {
+		return nil, ErrCiphertextIsNotValid
+	}
+
+	keyring.mutex.RLock()
+	key, err := keyring.get(name, keyID)
+	keyring.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+
+	return open(key, ciphertext, additionalData)
+}
+
+// Rewrap decrypts ciphertext and encrypts it again with the primary key for name. It is used to migrate
+// data encrypted with old keys after a rotation. If the ciphertext was already produced by the primary key,
+// it is returned unchanged.
+func (keyring *Keyring) Rewrap(name string, ciphertext, additionalData []byte) (newCiphertext []byte, err error) {
+	keyID, err := KeyID(ciphertext)
+	if err != nil {
+		return
+	}
+
+	keyring.mutex.RLock()
+	primaryKey, err := keyring.primary(name)
+	keyring.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+
+	plaintext, err := keyring.Decrypt(name, ciphertext, additionalData)
+	if err != nil {
+		return
+	}
+	defer crypto.Zeroize(plaintext)
+
+	if keyID == primaryKey.ID {
+		return ciphertext, nil
+	}
+
+	return seal(primaryKey, crypto.RandBytes(NonceSize), plaintext, additionalData)
+}
+
+// KeyID returns the ID of the key that produced a ciphertext or a MAC, without verifying it.
+// It can be used to find the data that needs to be rewrapped.
+func KeyID(ciphertextOrMac []byte) (keyID uint32, err error) {
+	if len(ciphertextOrMac) < HeaderSize {
+		return 0, ErrCiphertextIsNotValid
+	}
+	if ciphertextOrMac[0] != formatVersion1 {
+		return 0, ErrFormatIsNotSupported
+	}
+
+	return binary.BigEndian.Uint32(ciphertextOrMac[1:HeaderSize]), nil
+}
+
+// Mac computes the MAC of data with the primary key for name, which must use the AlgorithmBlake2bMac
+// algorithm.
+//
+// The MAC has the following format: version (1) || key ID (4) || tag (32).
+func (keyring *Keyring) Mac(name string, data []byte) (mac []byte, err error) {
+	keyring.mutex.RLock()
+	key, err := keyring.primary(name)
+	keyring.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+
+	return computeMac(key, data)
+}
+
+// VerifyMac verifies in constant time a MAC produced by Mac with any enabled key for name.
+func (keyring *Keyring) VerifyMac(name string, data, mac []byte) (err error) {
+	keyID, err := KeyID(mac)
+	if err != nil {
+		return ErrMacIsNotValid
+	}
+	if len(mac) != HeaderSize+MacSize {
+		return ErrMacIsNotValid
+	}
+
+	keyring.mutex.RLock()
+	key, err := keyring.get(name, keyID)
+	keyring.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+
+	expectedMac, err := computeMac(key, data)
+	if err != nil {
+		return
+	}
+
+	if !crypto.ConstantTimeCompare(mac, expectedMac) {
+		return ErrMacIsNotValid
+	}
+
+	return nil
+}
+
+func header(keyID uint32) []byte {
+	ret := make([]byte, HeaderSize, Overhead)
+	ret[0] = formatVersion1
+	binary.BigEndian.PutUint32(ret[1:], keyID)
+	return ret
+}
+
+func seal(key Key, nonce, plaintext, additionalData []byte) (ciphertext []byte, err error) {
+	aead, err := newMessageCipher(key, nonce)
+	if err != nil {
+		return
+	}
+
+	ciphertext = append(header(key.ID), nonce...)
+	// the header is authenticated so a ciphertext can't be decrypted as if it was produced by another key
+	return aead.Seal(ciphertext, nonce[:aead.NonceSize()], plaintext, authenticatedData(ciphertext[:HeaderSize], additionalData)), nil
+}
+
+func open(key Key, ciphertext, additionalData []byte) (plaintext []byte, err error) {
+	nonce := ciphertext[HeaderSize : HeaderSize+NonceSize]
+	aead, err := newMessageCipher(key, nonce)
+	if err != nil {
+		return
+	}
+
+	plaintext, err = aead.Open(nil, nonce[:aead.NonceSize()], ciphertext[HeaderSize+NonceSize:], authenticatedData(ciphertext[:HeaderSize], additionalData))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+// newMessageCipher returns the AEAD used to encrypt a single message.
+// chacha20blake3 and chacha12blake3 only use 8 bytes of their nonce for the encryption, which is too
+// small to be drawn at random, so the key of each message is derived from the key of the keyring and the
+// random nonce of the message.
+func newMessageCipher(key Key, nonce []byte) (ret cipher.AEAD, err error) {
+	messageKey := make([]byte, SecretSize)
+	defer crypto.Zeroize(messageKey)
+	blake3.DeriveKey(messageKey, messageKeyContext, append(append(make([]byte, 0, SecretSize+NonceSize), key.secret...), nonce...))
+
+	switch key.Algorithm {
+	case AlgorithmChaCha20Blake3:
+		return chacha20blake3.New(messageKey)
+	case AlgorithmChaCha12Blake3:
+		return chacha12blake3.New(messageKey)
+	case AlgorithmXChaCha20Sha256:
+		return xchacha20sha256.New(messageKey)
+	default:
+		return nil, ErrAlgorithmIsNotAead
+	}
+}
+
+func computeMac(key Key, data []byte) (mac []byte, err error) {
+	if key.Algorithm != AlgorithmBlake2bMac {
+		return nil, ErrAlgorithmIsNotMac
+	}
+
+	mac = header(key.ID)
+	tag, err := crypto.Mac(key.secret, authenticatedData(mac, data), MacSize)
+	if err != nil {
+		return
+	}
+
+	return append(mac, tag...), nil
+}
+
+// authenticatedData returns header || data. As the header has a fixed size, the encoding is unambiguous.
+func authenticatedData(header, data []byte) []byte {
+	ret := make([]byte, 0, len(header)+len(data))
+	ret = append(ret, header...)
+	return append(ret, data...)
+}
@@ -0,0 +1,257 @@
+// Package keyring manages named, versioned keys so applications don't have to handle raw keys.
+//
+// Each key has a name (its purpose, e.g. "sessions" or "backups"), a version, an algorithm and a status.
+// For each name, at most one key is primary: it is used to encrypt and MAC new data, while the
+// decrypt-only keys are still used to decrypt and verify existing data. Disabled keys are kept in the
+// keyring but can't be used anymore.
+//
+// Ciphertexts and MACs embed the ID of the key that produced them, so the right key is picked
+// automatically. Rotating a key is a matter of adding a new primary key with Rotate: the previous primary
+// key becomes decrypt-only, and existing ciphertexts can be re-encrypted with Rewrap.
+//
+// Keyrings are stored encrypted with a key derived from a password (see MarshalEncrypted and LoadFromEnv).
+package keyring
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmChaCha20Blake3  Algorithm = "chacha20-blake3"
+	AlgorithmChaCha12Blake3  Algorithm = "chacha12-blake3"
+	AlgorithmXChaCha20Sha256 Algorithm = "xchacha20-sha256"
+	// AlgorithmBlake2bMac is the algorithm of crypto.Mac
+	AlgorithmBlake2bMac Algorithm = "blake2b-mac"
+)
+
+type Status string
+
+const (
+	// StatusPrimary keys are used to encrypt, decrypt, sign and verify
+	StatusPrimary Status = "primary"
+	// StatusDecryptOnly keys are used only to decrypt and verify
+	StatusDecryptOnly Status = "decrypt_only"
+	// StatusDisabled keys can't be used
+	StatusDisabled Status = "disabled"
+)
+
+const (
+	// SecretSize is the size in bytes of the secret of all the keys
+	SecretSize = crypto.KeySize256
+	// MacSize is the size in bytes of the MACs, without the header
+	MacSize = 32
+)
+
+var (
+	ErrKeyNotFound               = errors.New("keyring: key not found")
+	ErrPrimaryKeyNotFound        = errors.New("keyring: primary key not found")
+	ErrKeyIsDisabled             = errors.New("keyring: key is disabled")
+	ErrKeyNameIsNotValid         = errors.New("keyring: key name is not valid")
+	ErrAlgorithmIsNotValid       = errors.New("keyring: algorithm is not valid")
+	ErrStatusIsNotValid          = errors.New("keyring: status is not valid")
+	ErrAlgorithmIsNotAead        = errors.New("keyring: the algorithm of the key is not an AEAD")
+	ErrAlgorithmIsNotMac         = errors.New("keyring: the algorithm of the key is not a MAC")
+	ErrCiphertextIsNotValid      = errors.New("keyring: ciphertext is not valid")
+	ErrDecrypt                   = errors.New("keyring: error decrypting ciphertext")
+	ErrMacIsNotValid             = errors.New("keyring: MAC is not valid")
+	ErrKeyringIsNotValid         = errors.New("keyring: keyring is not valid")
+	ErrPasswordIsNotValid        = errors.New("keyring: password is not valid")
+	ErrFormatIsNotSupported      = errors.New("keyring: format is not supported")
+	ErrEnvironmentVarIsEmpty     = errors.New("keyring: environment variable is empty")
+	ErrPasswordParamsAreNotValid = errors.New("keyring: password derivation parameters are not valid")
+)
+
+// Key is the metadata of a key of a keyring. The secret of the key never leaves the keyring, except
+// when the keyring is serialized.
+type Key struct {
+	// ID is the unique identifier of the key in the keyring. It is embedded in ciphertexts and MACs.
+	ID uint32 `json:"id"`
+	// Name is the purpose of the key
+	Name string `json:"name"`
+	// Version is incremented each time a key with the same name is added
+	Version   uint32    `json:"version"`
+	Algorithm Algorithm `json:"algorithm"`
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+
+	secret []byte
+}
+
+// Keyring is a set of keys. It is safe for concurrent use.
+type Keyring struct {
+	mutex sync.RWMutex
+	// keys are sorted by ID
+	keys []Key
+	// lastKeyID is the highest ID ever given to a key of the keyring, so the IDs of the removed keys are
+	// not reused: a ciphertext produced by a removed key must not be decrypted by another key.
+	lastKeyID uint32
+}
+
+func New() *Keyring {
+	return &Keyring{
+		mutex: sync.RWMutex{},
+		keys:  make([]Key, 0),
+	}
+}
+
+// AddKey generates a new primary key for name. The previous primary key for name, if any, becomes
+// decrypt-only.
+func (keyring *Keyring) AddKey(name string, algorithm Algorithm) (key Key, err error) {
+	if name == "" || len(name) > 128 {
+		return key, ErrKeyNameIsNotValid
+	}
+	if !isValidAlgorithm(algorithm) {
+		return key, ErrAlgorithmIsNotValid
+	}
+
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+
+	key = Key{
+		ID:        keyring.lastKeyID + 1,
+		Name:      name,
+		Version:   1,
+		Algorithm: algorithm,
+		Status:    StatusPrimary,
+		CreatedAt: time.Now().UTC(),
+		secret:    crypto.RandBytes(SecretSize),
+	}
+	for i := range keyring.keys {
+		if keyring.keys[i].Name == name {
+			key.Version = max(key.Version, keyring.keys[i].Version+1)
+			if keyring.keys[i].Status == StatusPrimary {
+				keyring.keys[i].Status = StatusDecryptOnly
+			}
+		}
+	}
+
+	keyring.keys = append(keyring.keys, key)
+	keyring.lastKeyID = key.ID
+	return key, nil
+}
+
+// Rotate adds a new primary key for name, with the same algorithm as the current primary key.
+// The previous primary key becomes decrypt-only.
+func (keyring *Keyring) Rotate(name string) (key Key, err error) {
+	primaryKey, err := keyring.Primary(name)
+	if err != nil {
+		return
+	}
+
+	return keyring.AddKey(name, primaryKey.Algorithm)
+}
+
+// SetStatus changes the status of a key. If the key becomes primary, the previous primary key with the
+// same name becomes decrypt-only.
+func (keyring *Keyring) SetStatus(keyID uint32, status Status) error {
+	if status != StatusPrimary && status != StatusDecryptOnly && status != StatusDisabled {
+		return ErrStatusIsNotValid
+	}
+
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+
+	index := keyring.indexOf(keyID)
+	if index < 0 {
+		return ErrKeyNotFound
+	}
+
+	if status == StatusPrimary {
+		for i := range keyring.keys {
+			if keyring.keys[i].Name == keyring.keys[index].Name && keyring.keys[i].Status == StatusPrimary {
+				keyring.keys[i].Status = StatusDecryptOnly
+			}
+		}
+	}
+	keyring.keys[index].Status = status
+
+	return nil
+}
+
+// RemoveKey removes a key from the keyring. The data encrypted with the key can't be decrypted anymore.
+// The ID of the key is never given to another key.
+func (keyring *Keyring) RemoveKey(keyID uint32) error {
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+
+	index := keyring.indexOf(keyID)
+	if index < 0 {
+		return ErrKeyNotFound
+	}
+
+	keyring.keys = slices.Delete(keyring.keys, index, index+1)
+	return nil
+}
+
+// Keys returns the metadata of all the keys of the keyring, sorted by ID.
+func (keyring *Keyring) Keys() []Key {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	keys := make([]Key, len(keyring.keys))
+	for i, key := range keyring.keys {
+		key.secret = nil
+		keys[i] = key
+	}
+	return keys
+}
+
+// Primary returns the metadata of the primary key for name.
+func (keyring *Keyring) Primary(name string) (key Key, err error) {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+
+	key, err = keyring.primary(name)
+	key.secret = nil
+	return
+}
+
+// primary returns the primary key for name. The caller must hold the mutex.
+func (keyring *Keyring) primary(name string) (Key, error) {
+	for _, key := range keyring.keys {
+		if key.Name == name && key.Status == StatusPrimary {
+			return key, nil
+		}
+	}
+	return Key{}, ErrPrimaryKeyNotFound
+}
+
+// get returns the enabled key keyID, which must have the given name. The caller must hold the mutex.
+func (keyring *Keyring) get(name string, keyID uint32) (Key, error) {
+	index := keyring.indexOf(keyID)
+	if index < 0 || keyring.keys[index].Name != name {
+		return Key{}, ErrKeyNotFound
+	}
+
+	key := keyring.keys[index]
+	if key.Status == StatusDisabled {
+		return Key{}, ErrKeyIsDisabled
+	}
+	return key, nil
+}
+
+func (keyring *Keyring) indexOf(keyID uint32) int {
+	index, found := slices.BinarySearchFunc(keyring.keys, keyID, func(key Key, id uint32) int {
+		return int(int64(key.ID) - int64(id))
+	})
+	if !found {
+		return -1
+	}
+	return index
+}
+
+func isValidAlgorithm(algorithm Algorithm) bool {
+	switch algorithm {
+	case AlgorithmChaCha20Blake3, AlgorithmChaCha12Blake3, AlgorithmXChaCha20Sha256, AlgorithmBlake2bMac:
+		return true
+	default:
+		return false
+	}
+}
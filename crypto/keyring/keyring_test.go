@@ -0,0 +1,360 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+// testPasswordParams are the weakest parameters accepted, to keep the tests fast
+var testPasswordParams = crypto.DeriveKeyFromPasswordParams{
+	Memory:      minPasswordMemory,
+	Iterations:  minPasswordIterations,
+	Parallelism: 1,
+	KeySize:     crypto.KeySize256,
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmChaCha20Blake3, AlgorithmChaCha12Blake3, AlgorithmXChaCha20Sha256} {
+		keyring := New()
+		_, err := keyring.AddKey("data", algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := []byte("Hello World")
+		additionalData := []byte("account_123")
+
+		ciphertext1, err := keyring.Encrypt("data", message, additionalData)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		ciphertext2, _ := keyring.Encrypt("data", message, additionalData)
+		if bytes.Equal(ciphertext1, ciphertext2) {
+			t.Errorf("%s: 2 ciphertexts of the same message are equal", algorithm)
+		}
+		if len(ciphertext1) != len(message)+Overhead {
+			t.Errorf("%s: ciphertext size = %d, want %d", algorithm, len(ciphertext1), len(message)+Overhead)
+		}
+
+		plaintext, err := keyring.Decrypt("data", ciphertext1, additionalData)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Errorf("%s: plaintext = %s, want %s", algorithm, plaintext, message)
+		}
+
+		_, err = keyring.Decrypt("data", ciphertext1, []byte("account_456"))
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: wrong additional data: err = %v, want %v", algorithm, err, ErrDecrypt)
+		}
+		tampered := bytes.Clone(ciphertext1)
+		tampered[HeaderSize+NonceSize] ^= 1
+		_, err = keyring.Decrypt("data", tampered, additionalData)
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: tampered: err = %v, want %v", algorithm, err, ErrDecrypt)
+		}
+		_, err = keyring.Decrypt("data", ciphertext1[:Overhead-1], additionalData)
+		if !errors.Is(err, ErrCiphertextIsNotValid) {
+			t.Errorf("%s: short: err = %v, want %v", algorithm, err, ErrCiphertextIsNotValid)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	keyring := New()
+	oldKey, _ := keyring.AddKey("data", AlgorithmChaCha20Blake3)
+	otherKey, _ := keyring.AddKey("other", AlgorithmChaCha20Blake3)
+	message := []byte("Hello World")
+
+	oldCiphertext, err := keyring.Encrypt("data", message, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := keyring.Rotate("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newKey.Version != 2 || newKey.Status != StatusPrimary || newKey.ID == oldKey.ID || newKey.ID == otherKey.ID {
+		t.Errorf("new key = %+v", newKey)
+	}
+	keys := keyring.Keys()
+	if len(keys) != 3 || keys[0].Status != StatusDecryptOnly || keys[1].Status != StatusPrimary {
+		t.Errorf("keys = %+v", keys)
+	}
+
+	newCiphertext, _ := keyring.Encrypt("data", message, nil)
+	if keyID, _ := KeyID(newCiphertext); keyID != newKey.ID {
+		t.Errorf("key ID of new ciphertext = %d, want %d", keyID, newKey.ID)
+	}
+	_, err = keyring.Decrypt("data", oldCiphertext, nil)
+	if err != nil {
+		t.Errorf("decrypting with the decrypt-only key: %v", err)
+	}
+
+	// keys are bound to their name
+	_, err = keyring.Decrypt("other", oldCiphertext, nil)
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("other name: err = %v, want %v", err, ErrKeyNotFound)
+	}
+
+	rewrapped, err := keyring.Rewrap("data", oldCiphertext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID, _ := KeyID(rewrapped); keyID != newKey.ID {
+		t.Errorf("key ID of rewrapped ciphertext = %d, want %d", keyID, newKey.ID)
+	}
+	same, _ := keyring.Rewrap("data", rewrapped, nil)
+	if !bytes.Equal(same, rewrapped) {
+		t.Error("rewrapping a ciphertext of the primary key changed it")
+	}
+
+	err = keyring.SetStatus(oldKey.ID, StatusDisabled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = keyring.Decrypt("data", oldCiphertext, nil)
+	if !errors.Is(err, ErrKeyIsDisabled) {
+		t.Errorf("disabled key: err = %v, want %v", err, ErrKeyIsDisabled)
+	}
+	plaintext, err := keyring.Decrypt("data", rewrapped, nil)
+	if err != nil || !bytes.Equal(plaintext, message) {
+		t.Errorf("decrypting rewrapped ciphertext: %s, %v", plaintext, err)
+	}
+
+	err = keyring.RemoveKey(oldKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = keyring.Decrypt("data", oldCiphertext, nil)
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("removed key: err = %v, want %v", err, ErrKeyNotFound)
+	}
+
+	// without primary key, new data can't be encrypted
+	err = keyring.SetStatus(otherKey.ID, StatusDecryptOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = keyring.Encrypt("other", message, nil)
+	if !errors.Is(err, ErrPrimaryKeyNotFound) {
+		t.Errorf("no primary key: err = %v, want %v", err, ErrPrimaryKeyNotFound)
+	}
+}
+
+func TestMac(t *testing.T) {
+	keyring := New()
+	_, _ = keyring.AddKey("mac", AlgorithmBlake2bMac)
+	_, _ = keyring.AddKey("data", AlgorithmChaCha20Blake3)
+	data := []byte("Hello World")
+
+	mac, err := keyring.Mac("mac", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mac) != HeaderSize+MacSize {
+		t.Errorf("MAC size = %d, want %d", len(mac), HeaderSize+MacSize)
+	}
+
+	_, err = keyring.Rotate("mac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = keyring.VerifyMac("mac", data, mac)
+	if err != nil {
+		t.Errorf("verifying with the decrypt-only key: %v", err)
+	}
+	err = keyring.VerifyMac("mac", []byte("Hello World!"), mac)
+	if !errors.Is(err, ErrMacIsNotValid) {
+		t.Errorf("wrong data: err = %v, want %v", err, ErrMacIsNotValid)
+	}
+	err = keyring.VerifyMac("mac", data, mac[:len(mac)-1])
+	if !errors.Is(err, ErrMacIsNotValid) {
+		t.Errorf("short MAC: err = %v, want %v", err, ErrMacIsNotValid)
+	}
+
+	_, err = keyring.Mac("data", data)
+	if !errors.Is(err, ErrAlgorithmIsNotMac) {
+		t.Errorf("MAC with AEAD key: err = %v, want %v", err, ErrAlgorithmIsNotMac)
+	}
+	_, err = keyring.Encrypt("mac", data, nil)
+	if !errors.Is(err, ErrAlgorithmIsNotAead) {
+		t.Errorf("encrypt with MAC key: err = %v, want %v", err, ErrAlgorithmIsNotAead)
+	}
+}
+
+func TestMarshalEncrypted(t *testing.T) {
+	keyring := New()
+	_, _ = keyring.AddKey("data", AlgorithmXChaCha20Sha256)
+	_, _ = keyring.Rotate("data")
+	_, _ = keyring.AddKey("mac", AlgorithmBlake2bMac)
+	password := []byte("correct horse battery staple")
+
+	ciphertext, _ := keyring.Encrypt("data", []byte("Hello World"), nil)
+	mac, _ := keyring.Mac("mac", []byte("Hello World"))
+
+	encrypted, err := keyring.MarshalEncrypted(password, &testPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = UnmarshalEncrypted(encrypted, []byte("wrong password"))
+	if !errors.Is(err, ErrPasswordIsNotValid) {
+		t.Errorf("wrong password: err = %v, want %v", err, ErrPasswordIsNotValid)
+	}
+	_, err = UnmarshalEncrypted("keyring.v2."+encrypted[len(EncryptedPrefix):], password)
+	if !errors.Is(err, ErrFormatIsNotSupported) {
+		t.Errorf("wrong prefix: err = %v, want %v", err, ErrFormatIsNotSupported)
+	}
+
+	t.Setenv("TEST_KEYRING", encrypted)
+	t.Setenv("TEST_KEYRING_PASSWORD", string(password))
+	loaded, err := LoadFromEnv("TEST_KEYRING", "TEST_KEYRING_PASSWORD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := keyring.Keys()
+	loadedKeys := loaded.Keys()
+	if len(loadedKeys) != len(keys) {
+		t.Fatalf("loaded keys = %+v, want %+v", loadedKeys, keys)
+	}
+	for i := range keys {
+		if loadedKeys[i].ID != keys[i].ID || loadedKeys[i].Name != keys[i].Name || loadedKeys[i].Version != keys[i].Version ||
+			loadedKeys[i].Algorithm != keys[i].Algorithm || loadedKeys[i].Status != keys[i].Status ||
+			!loadedKeys[i].CreatedAt.Equal(keys[i].CreatedAt) {
+			t.Errorf("loaded key = %+v, want %+v", loadedKeys[i], keys[i])
+		}
+	}
+
+	plaintext, err := loaded.Decrypt("data", ciphertext, nil)
+	if err != nil || string(plaintext) != "Hello World" {
+		t.Errorf("decrypting with the loaded keyring: %s, %v", plaintext, err)
+	}
+	err = loaded.VerifyMac("mac", []byte("Hello World"), mac)
+	if err != nil {
+		t.Errorf("verifying with the loaded keyring: %v", err)
+	}
+
+	_, err = LoadFromEnv("TEST_KEYRING", "TEST_KEYRING_PASSWORD")
+	if !errors.Is(err, ErrEnvironmentVarIsEmpty) {
+		t.Errorf("environment variables are not unset: err = %v", err)
+	}
+}
+
+func TestKeyIDsAreNotReused(t *testing.T) {
+	keyring := New()
+	_, _ = keyring.AddKey("data", AlgorithmChaCha20Blake3)
+	removedKey, _ := keyring.Rotate("data")
+	ciphertext, _ := keyring.Encrypt("data", []byte("Hello World"), nil)
+
+	err := keyring.RemoveKey(removedKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := keyring.AddKey("data", AlgorithmChaCha20Blake3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newKey.ID <= removedKey.ID {
+		t.Errorf("the ID of the removed key has been reused: %d", newKey.ID)
+	}
+
+	// the last key ID is kept when the keyring is serialized
+	err = keyring.RemoveKey(newKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := keyring.MarshalEncrypted([]byte("password"), &testPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := UnmarshalEncrypted(encrypted, []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedKey, err := loaded.AddKey("data", AlgorithmChaCha20Blake3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedKey.ID <= newKey.ID {
+		t.Errorf("the ID of a removed key has been reused after loading the keyring: %d", loadedKey.ID)
+	}
+	_, err = loaded.Decrypt("data", ciphertext, nil)
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("ciphertext of a removed key: err = %v, want %v", err, ErrKeyNotFound)
+	}
+
+	// the last key ID can't be lower than the IDs of the keys
+	loaded.lastKeyID = loadedKey.ID - 1
+	encrypted, err = loaded.MarshalEncrypted([]byte("password"), &testPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = UnmarshalEncrypted(encrypted, []byte("password"))
+	if !errors.Is(err, ErrKeyringIsNotValid) {
+		t.Errorf("last key ID lower than a key ID: err = %v, want %v", err, ErrKeyringIsNotValid)
+	}
+}
+
+func TestPasswordParamsLimits(t *testing.T) {
+	keyring := New()
+	_, _ = keyring.AddKey("data", AlgorithmChaCha20Blake3)
+	password := []byte("password")
+
+	encrypted, err := keyring.MarshalEncrypted(password, &testPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encrypted[len(EncryptedPrefix):])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params crypto.DeriveKeyFromPasswordParams
+		valid  bool
+	}{
+		{"test params", testPasswordParams, true},
+		{"maximum", crypto.DeriveKeyFromPasswordParams{Memory: 1024 * 1024, Iterations: 100, Parallelism: 16}, true},
+		{"too much memory", crypto.DeriveKeyFromPasswordParams{Memory: 1024*1024 + 1, Iterations: 2, Parallelism: 1}, false},
+		{"too little memory", crypto.DeriveKeyFromPasswordParams{Memory: 19*1024 - 1, Iterations: 2, Parallelism: 1}, false},
+		{"too many iterations", crypto.DeriveKeyFromPasswordParams{Memory: 19 * 1024, Iterations: 101, Parallelism: 1}, false},
+		{"too few iterations", crypto.DeriveKeyFromPasswordParams{Memory: 19 * 1024, Iterations: 1, Parallelism: 1}, false},
+		{"no iterations", crypto.DeriveKeyFromPasswordParams{Memory: 19 * 1024, Iterations: 0, Parallelism: 1}, false},
+		{"too much parallelism", crypto.DeriveKeyFromPasswordParams{Memory: 19 * 1024, Iterations: 2, Parallelism: 17}, false},
+		{"no parallelism", crypto.DeriveKeyFromPasswordParams{Memory: 19 * 1024, Iterations: 2, Parallelism: 0}, false},
+	}
+
+	for _, test := range tests {
+		if test.valid {
+			// deriving keys with the maximum parameters is too slow for the tests
+			if !isValidPasswordParams(test.params) {
+				t.Errorf("%s: the params should be valid", test.name)
+			}
+			continue
+		}
+
+		_, err = keyring.MarshalEncrypted(password, &test.params)
+		if !errors.Is(err, ErrPasswordParamsAreNotValid) {
+			t.Errorf("%s: MarshalEncrypted: err = %v, want %v", test.name, err, ErrPasswordParamsAreNotValid)
+		}
+
+		// the parameters are read from the header before any key is derived
+		tampered := bytes.Clone(data)
+		binary.BigEndian.PutUint32(tampered[saltSize:], test.params.Memory)
+		binary.BigEndian.PutUint32(tampered[saltSize+4:], test.params.Iterations)
+		tampered[saltSize+8] = test.params.Parallelism
+		_, err = UnmarshalEncrypted(EncryptedPrefix+base64.RawURLEncoding.EncodeToString(tampered), password)
+		if !errors.Is(err, ErrKeyringIsNotValid) {
+			t.Errorf("%s: UnmarshalEncrypted: err = %v, want %v", test.name, err, ErrKeyringIsNotValid)
+		}
+	}
+}
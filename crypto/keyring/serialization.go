@@ -0,0 +1,226 @@
+package keyring
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/chacha20blake3"
+)
+
+const (
+	// EncryptedPrefix is the prefix of encrypted keyrings
+	EncryptedPrefix = "keyring.v1."
+
+	saltSize = 32
+	// salt (32) || memory (4) || iterations (4) || parallelism (1) || nonce (32)
+	encryptedHeaderSize = saltSize + 4 + 4 + 1 + chacha20blake3.NonceSize
+
+	// limits of the password derivation parameters accepted by UnmarshalEncrypted. The minimums are the
+	// lowest parameters recommended by OWASP for Argon2id.
+	minPasswordMemory      = 19 * 1024   // KiB: 19 MiB
+	maxPasswordMemory      = 1024 * 1024 // KiB: 1 GiB
+	minPasswordIterations  = 2
+	maxPasswordIterations  = 100
+	maxPasswordParallelism = 16
+)
+
+type keyringJSON struct {
+	Keys      []keyJSON `json:"keys"`
+	LastKeyID uint32    `json:"last_key_id"`
+}
+
+type keyJSON struct {
+	ID        uint32    `json:"id"`
+	Name      string    `json:"name"`
+	Version   uint32    `json:"version"`
+	Algorithm Algorithm `json:"algorithm"`
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    []byte    `json:"secret"`
+}
+
+// MarshalEncrypted serializes the keyring and encrypts it with a key derived from password with
+// crypto.DeriveKeyFromPassword. The parameters of the derivation are stored in the output so they can be
+// changed over time.
+// If params is nil, crypto.DefaultDeriveKeyFromPasswordParams is used. params must be within the limits
+// accepted by UnmarshalEncrypted (between 19 MiB and 1 GiB of memory, between 2 and 100 iterations and a
+// parallelism between 1 and 16), otherwise ErrPasswordParamsAreNotValid is returned.
+//
+// The output is a printable string, so it can be stored in a file or an environment variable.
+func (keyring *Keyring) MarshalEncrypted(password []byte, params *crypto.DeriveKeyFromPasswordParams) (ret string, err error) {
+	if params == nil {
+		params = &crypto.DefaultDeriveKeyFromPasswordParams
+	}
+	if !isValidPasswordParams(*params) {
+		return "", ErrPasswordParamsAreNotValid
+	}
+
+	keyring.mutex.RLock()
+	serialized := keyringJSON{
+		Keys:      make([]keyJSON, len(keyring.keys)),
+		LastKeyID: keyring.lastKeyID,
+	}
+	for i, key := range keyring.keys {
+		serialized.Keys[i] = keyJSON{
+			ID:        key.ID,
+			Name:      key.Name,
+			Version:   key.Version,
+			Algorithm: key.Algorithm,
+			Status:    key.Status,
+			CreatedAt: key.CreatedAt,
+			Secret:    key.secret,
+		}
+	}
+	plaintext, err := json.Marshal(serialized)
+	keyring.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+	defer crypto.Zeroize(plaintext)
+
+	header := make([]byte, encryptedHeaderSize)
+	salt := header[:saltSize]
+	copy(salt, crypto.RandBytes(saltSize))
+	binary.BigEndian.PutUint32(header[saltSize:], params.Memory)
+	binary.BigEndian.PutUint32(header[saltSize+4:], params.Iterations)
+	header[saltSize+8] = params.Parallelism
+	nonce := header[saltSize+9:]
+	copy(nonce, crypto.RandBytes(chacha20blake3.NonceSize))
+
+	passwordParams := *params
+	passwordParams.KeySize = chacha20blake3.KeySize
+	cipher, err := newPasswordCipher(password, salt, passwordParams)
+	if err != nil {
+		return
+	}
+
+	data := cipher.Seal(header, nonce, plaintext, append([]byte(EncryptedPrefix), header...))
+	return EncryptedPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// UnmarshalEncrypted decrypts and deserializes a keyring produced by MarshalEncrypted.
+func UnmarshalEncrypted(encryptedKeyring string, password []byte) (keyring *Keyring, err error) {
+	encryptedKeyring = strings.TrimSpace(encryptedKeyring)
+	if !strings.HasPrefix(encryptedKeyring, EncryptedPrefix) {
+		return nil, ErrFormatIsNotSupported
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(encryptedKeyring, EncryptedPrefix))
+	if err != nil || len(data) < encryptedHeaderSize+chacha20blake3.TagSize {
+		return nil, ErrKeyringIsNotValid
+	}
+
+	header := data[:encryptedHeaderSize]
+	salt := header[:saltSize]
+	params := crypto.DeriveKeyFromPasswordParams{
+		Memory:      binary.BigEndian.Uint32(header[saltSize:]),
+		Iterations:  binary.BigEndian.Uint32(header[saltSize+4:]),
+		Parallelism: header[saltSize+8],
+		KeySize:     chacha20blake3.KeySize,
+	}
+	nonce := header[saltSize+9:]
+	if !isValidPasswordParams(params) {
+		return nil, ErrKeyringIsNotValid
+	}
+
+	cipher, err := newPasswordCipher(password, salt, params)
+	if err != nil {
+		return
+	}
+
+	plaintext, err := cipher.Open(nil, nonce, data[encryptedHeaderSize:], append([]byte(EncryptedPrefix), header...))
+	if err != nil {
+		return nil, ErrPasswordIsNotValid
+	}
+	defer crypto.Zeroize(plaintext)
+
+	var serialized keyringJSON
+	err = json.Unmarshal(plaintext, &serialized)
+	if err != nil {
+		return nil, ErrKeyringIsNotValid
+	}
+
+	keyring = New()
+	keyring.lastKeyID = serialized.LastKeyID
+	primaryKeys := make(map[string]bool, len(serialized.Keys))
+	for _, key := range serialized.Keys {
+		if key.Name == "" || len(key.Name) > 128 || !isValidAlgorithm(key.Algorithm) ||
+			len(key.Secret) != SecretSize || key.ID > serialized.LastKeyID || slices.ContainsFunc(keyring.keys, func(other Key) bool { return other.ID == key.ID }) {
+			return nil, ErrKeyringIsNotValid
+		}
+		switch key.Status {
+		case StatusPrimary:
+			if primaryKeys[key.Name] {
+				return nil, ErrKeyringIsNotValid
+			}
+			primaryKeys[key.Name] = true
+		case StatusDecryptOnly, StatusDisabled:
+		default:
+			return nil, ErrKeyringIsNotValid
+		}
+
+		keyring.keys = append(keyring.keys, Key{
+			ID:        key.ID,
+			Name:      key.Name,
+			Version:   key.Version,
+			Algorithm: key.Algorithm,
+			Status:    key.Status,
+			CreatedAt: key.CreatedAt,
+			secret:    key.Secret,
+		})
+	}
+	slices.SortFunc(keyring.keys, func(a, b Key) int {
+		return int(int64(a.ID) - int64(b.ID))
+	})
+
+	return keyring, nil
+}
+
+// LoadFromEnv loads the encrypted keyring stored in the environment variable keyringEnvVar, decrypted with
+// the password stored in the environment variable passwordEnvVar.
+// Both environment variables are unset once loaded, so they are not inherited by child processes.
+func LoadFromEnv(keyringEnvVar, passwordEnvVar string) (keyring *Keyring, err error) {
+	encryptedKeyring := os.Getenv(keyringEnvVar)
+	if encryptedKeyring == "" {
+		return nil, ErrEnvironmentVarIsEmpty
+	}
+	password := os.Getenv(passwordEnvVar)
+	if password == "" {
+		return nil, ErrEnvironmentVarIsEmpty
+	}
+
+	keyring, err = UnmarshalEncrypted(encryptedKeyring, []byte(password))
+	if err != nil {
+		return
+	}
+
+	os.Unsetenv(keyringEnvVar)
+	os.Unsetenv(passwordEnvVar)
+
+	return keyring, nil
+}
+
+// isValidPasswordParams returns true if params are within the limits of the password derivation
+// parameters, so a malicious keyring can't exhaust the resources of the machine, and keyrings can't be
+// encrypted with parameters too weak to slow down the brute-forcing of the password.
+func isValidPasswordParams(params crypto.DeriveKeyFromPasswordParams) bool {
+	return params.Memory >= minPasswordMemory && params.Memory <= maxPasswordMemory &&
+		params.Iterations >= minPasswordIterations && params.Iterations <= maxPasswordIterations &&
+		params.Parallelism >= 1 && params.Parallelism <= maxPasswordParallelism
+}
+
+func newPasswordCipher(password, salt []byte, params crypto.DeriveKeyFromPasswordParams) (*chacha20blake3.ChaCha20Blake3, error) {
+	key, err := crypto.DeriveKeyFromPassword(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Zeroize(key)
+
+	return chacha20blake3.New(key)
+}
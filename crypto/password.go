@@ -8,11 +8,13 @@ package crypto
 // random salts.
 
 import (
+	"bytes"
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/argon2"
 )
@@ -25,6 +27,15 @@ var (
 	// ErrIncompatiblePasswordHashVersion in returned by ComparePasswordAndHash if the
 	// provided hash was created using a different version of Argon2.
 	ErrIncompatiblePasswordHashVersion = errors.New("crypto: incompatible version of argon2")
+
+	// ErrPasswordPepperIsNotValid is returned by NewPasswordHasher if the pepper is not between
+	// PasswordPepperMinSize and PasswordPepperMaxSize bytes.
+	ErrPasswordPepperIsNotValid = errors.New("crypto: pepper must be between 32 and 64 bytes")
+)
+
+const (
+	PasswordPepperMinSize = KeySize256
+	PasswordPepperMaxSize = KeySize512
 )
 
 // DefaultHashPasswordParams provides some sane default parameters for hashing passwords.
@@ -144,3 +155,114 @@ func decodePasswordHash(hash string) (params *HashPasswordParams, salt, key []by
 
 	return params, salt, key, nil
 }
+
+// PasswordHashNeedsRehash returns true if the parameters encoded in hash are weaker than params, which
+// means that the password should be hashed again with params, typically after a successful login.
+// Invalid hashes always need to be rehashed.
+func PasswordHashNeedsRehash(hash string, params HashPasswordParams) bool {
+	hashParams, _, _, err := decodePasswordHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return hashParams.Memory < params.Memory ||
+		hashParams.Iterations < params.Iterations ||
+		hashParams.SaltLength < params.SaltLength ||
+		hashParams.KeyLength < params.KeyLength
+}
+
+// PasswordHasher hashes and verifies passwords with the given params, and an optional server-side pepper.
+//
+// The pepper is a secret key that is not stored alongside the hashes (e.g. in an environment variable),
+// so an attacker who only gets a copy of the database can't brute-force the hashes. When a pepper is used,
+// the password is first MACed with the pepper with crypto.Mac, then hashed with argon2id.
+// Note that all the hashes verified by a PasswordHasher with a pepper must have been created with the same
+// pepper.
+type PasswordHasher struct {
+	params HashPasswordParams
+	pepper []byte
+}
+
+// NewPasswordHasher returns a PasswordHasher which hashes passwords with params.
+// pepper is optional and can be nil.
+func NewPasswordHasher(params HashPasswordParams, pepper []byte) (*PasswordHasher, error) {
+	if pepper != nil && (len(pepper) < PasswordPepperMinSize || len(pepper) > PasswordPepperMaxSize) {
+		return nil, ErrPasswordPepperIsNotValid
+	}
+
+	return &PasswordHasher{
+		params: params,
+		pepper: bytes.Clone(pepper),
+	}, nil
+}
+
+// Hash returns a Argon2id hash of password. See HashPassword for the format of the hash.
+func (hasher *PasswordHasher) Hash(password []byte) (hash string, err error) {
+	password, err = hasher.pepperPassword(password)
+	if err != nil {
+		return
+	}
+
+	return HashPassword(password, hasher.params), nil
+}
+
+// Verify performs a constant-time comparison between password and hash.
+// If the password matches, needsRehash reports whether the parameters of hash are weaker than the
+// parameters of the hasher, in which case the password should be hashed again and the new hash stored.
+func (hasher *PasswordHasher) Verify(password []byte, hash string) (match bool, needsRehash bool) {
+	password, err := hasher.pepperPassword(password)
+	if err != nil {
+		return false, false
+	}
+
+	if !VerifyPasswordHash(password, hash) {
+		return false, false
+	}
+
+	return true, PasswordHashNeedsRehash(hash, hasher.params)
+}
+
+func (hasher *PasswordHasher) pepperPassword(password []byte) ([]byte, error) {
+	if hasher.pepper == nil {
+		return password, nil
+	}
+
+	return Mac(hasher.pepper, password, KeySize512)
+}
+
+// CalibrateHashPasswordParams benchmarks the host to find parameters for which hashing a password takes
+// about targetDuration, using at most maxMemory kibibytes of memory.
+//
+// Following RFC 9106, the memory is chosen first: it is the largest power of two fraction of maxMemory
+// for which a single iteration takes less than targetDuration. Then the number of iterations is increased
+// to reach targetDuration.
+// The parameters should be calibrated on the hosts that will verify the passwords, under a realistic load.
+func CalibrateHashPasswordParams(targetDuration time.Duration, maxMemory uint32) HashPasswordParams {
+	params := DefaultHashPasswordParams
+	params.Memory = maxMemory
+	params.Iterations = 1
+	// argon2 requires at least 8 KiB of memory per thread
+	minMemory := 8 * uint32(params.Parallelism)
+	params.Memory = max(params.Memory, minMemory)
+
+	password := RandBytes(KeySize256)
+	salt := RandBytes(uint64(params.SaltLength))
+	measure := func() time.Duration {
+		start := time.Now()
+		argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		return time.Since(start)
+	}
+
+	duration := measure()
+	for duration > targetDuration && params.Memory/2 >= minMemory {
+		params.Memory /= 2
+		duration = measure()
+	}
+
+	// the duration of argon2id is roughly linear in the number of iterations
+	if duration > 0 && duration < targetDuration {
+		params.Iterations = uint32(targetDuration / duration)
+	}
+
+	return params
+}
@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -40,3 +41,81 @@ func TestVerifyPasswordHash(t *testing.T) {
 		t.Error("expected password and hash to not match")
 	}
 }
+
+func TestPasswordHashNeedsRehash(t *testing.T) {
+	weakParams := DefaultHashPasswordParams
+	weakParams.Memory = 1024
+	weakParams.Iterations = 1
+	hash := HashPassword([]byte("pa$$word"), weakParams)
+
+	if PasswordHashNeedsRehash(hash, weakParams) {
+		t.Error("hash with the same params must not need rehash")
+	}
+	if !PasswordHashNeedsRehash(hash, DefaultHashPasswordParams) {
+		t.Error("hash with weaker params must need rehash")
+	}
+	if !PasswordHashNeedsRehash("not a hash", weakParams) {
+		t.Error("invalid hash must need rehash")
+	}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	weakParams := DefaultHashPasswordParams
+	weakParams.Memory = 1024
+	weakParams.Iterations = 1
+	strongParams := weakParams
+	strongParams.Iterations = 2
+	pepper := RandBytes(KeySize256)
+
+	weakHasher, err := NewPasswordHasher(weakParams, pepper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strongHasher, _ := NewPasswordHasher(strongParams, pepper)
+
+	hash, err := weakHasher.Hash([]byte("pa$$word"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, needsRehash := weakHasher.Verify([]byte("pa$$word"), hash)
+	if !match || needsRehash {
+		t.Errorf("weak hasher: match = %t, needsRehash = %t", match, needsRehash)
+	}
+	match, needsRehash = strongHasher.Verify([]byte("pa$$word"), hash)
+	if !match || !needsRehash {
+		t.Errorf("strong hasher: match = %t, needsRehash = %t", match, needsRehash)
+	}
+	match, _ = weakHasher.Verify([]byte("otherPa$$word"), hash)
+	if match {
+		t.Error("expected password and hash to not match")
+	}
+
+	// the hash can't be verified without the pepper
+	if VerifyPasswordHash([]byte("pa$$word"), hash) {
+		t.Error("peppered hash verified without pepper")
+	}
+	otherPepperHasher, _ := NewPasswordHasher(weakParams, RandBytes(KeySize256))
+	match, _ = otherPepperHasher.Verify([]byte("pa$$word"), hash)
+	if match {
+		t.Error("peppered hash verified with another pepper")
+	}
+
+	_, err = NewPasswordHasher(weakParams, RandBytes(16))
+	if err != ErrPasswordPepperIsNotValid {
+		t.Errorf("short pepper: err = %v, want %v", err, ErrPasswordPepperIsNotValid)
+	}
+}
+
+func TestCalibrateHashPasswordParams(t *testing.T) {
+	params := CalibrateHashPasswordParams(20*time.Millisecond, 4*1024)
+	if params.Memory > 4*1024 || params.Memory < 8*uint32(params.Parallelism) {
+		t.Errorf("memory = %d", params.Memory)
+	}
+	if params.Iterations < 1 {
+		t.Errorf("iterations = %d", params.Iterations)
+	}
+	if params.SaltLength != DefaultHashPasswordParams.SaltLength || params.KeyLength != DefaultHashPasswordParams.KeyLength {
+		t.Errorf("params = %+v", params)
+	}
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"errors"
+	"io"
+)
+
+// Decryptor decrypts a stream read from the underlying reader.
+// Read returns io.EOF only after the final chunk has been authenticated: a truncated stream returns
+// ErrDecrypt.
+type Decryptor struct {
+	src    io.Reader
+	cipher *streamCipher
+
+	// buffer holds one encrypted chunk and one extra byte, used to know if a chunk is the last one
+	buffer []byte
+	// plaintext is the remaining decrypted data of the current chunk
+	plaintext  []byte
+	chunkIndex uint64
+	// lookahead is true if the first byte of the next chunk has already been read in nextByte
+	lookahead bool
+	nextByte  byte
+	final     bool
+	err       error
+}
+
+// ensure that Decryptor implements the io.Reader interface
+var _ io.Reader = (*Decryptor)(nil)
+
+// NewDecryptor reads the header of the stream from src and returns a Decryptor.
+func NewDecryptor(src io.Reader, key []byte) (*Decryptor, error) {
+	header := make([]byte, HeaderSize)
+	_, err := io.ReadFull(src, header)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = ErrHeaderIsNotValid
+		}
+		return nil, err
+	}
+
+	cipher, err := newStreamCipher(key, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decryptor{
+		src:    src,
+		cipher: cipher,
+		buffer: make([]byte, cipher.chunkSize+Overhead+1),
+	}, nil
+}
+
+func (decryptor *Decryptor) Read(p []byte) (n int, err error) {
+	for len(decryptor.plaintext) == 0 {
+		if decryptor.err != nil {
+			return 0, decryptor.err
+		}
+		if decryptor.final {
+			decryptor.cipher.zeroize()
+			decryptor.err = io.EOF
+			return 0, io.EOF
+		}
+
+		err = decryptor.readChunk()
+		if err != nil {
+			decryptor.err = err
+			return 0, err
+		}
+	}
+
+	n = copy(p, decryptor.plaintext)
+	decryptor.plaintext = decryptor.plaintext[n:]
+	return n, nil
+}
+
+func (decryptor *Decryptor) readChunk() error {
+	encryptedChunkSize := decryptor.cipher.chunkSize + Overhead
+
+	start := 0
+	if decryptor.lookahead {
+		decryptor.buffer[0] = decryptor.nextByte
+		start = 1
+	}
+	read, err := io.ReadFull(decryptor.src, decryptor.buffer[start:])
+	read += start
+	switch {
+	case err == nil:
+		// the buffer is full: there is at least one more chunk after this one
+		decryptor.final = false
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		decryptor.final = true
+	default:
+		return err
+	}
+
+	if !decryptor.final && decryptor.chunkIndex == maxChunkIndex {
+		return ErrStreamIsTooLarge
+	}
+
+	chunk := decryptor.buffer[:min(read, encryptedChunkSize)]
+	// an empty final chunk is valid only if it's the only chunk of the stream
+	if decryptor.final && len(chunk) == Overhead && decryptor.chunkIndex != 0 {
+		return ErrDecrypt
+	}
+	decryptor.plaintext, err = decryptor.cipher.open(chunk[:0], decryptor.chunkIndex, decryptor.final, chunk)
+	if err != nil {
+		return err
+	}
+	decryptor.chunkIndex += 1
+
+	if !decryptor.final {
+		// the first byte of the next chunk is kept until the plaintext of this chunk has been read,
+		// as the plaintext is decrypted in place
+		decryptor.nextByte = decryptor.buffer[encryptedChunkSize]
+		decryptor.lookahead = true
+	}
+
+	return nil
+}
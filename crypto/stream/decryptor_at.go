@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"errors"
+	"io"
+)
+
+// DecryptorAt provides random access to the plaintext of a stream stored in an io.ReaderAt, such as a
+// file. Only the chunks that overlap the requested range are read and decrypted.
+//
+// DecryptorAt is safe for concurrent use.
+type DecryptorAt struct {
+	src           io.ReaderAt
+	cipher        *streamCipher
+	chunksCount   int64
+	plaintextSize int64
+}
+
+// ensure that DecryptorAt implements the io.ReaderAt interface
+var _ io.ReaderAt = (*DecryptorAt)(nil)
+
+// NewDecryptorAt reads the header of the stream of size bytes stored in src and returns a DecryptorAt.
+// The final chunk is decrypted to authenticate the size of the stream, so a truncated stream is
+// detected before any call to ReadAt.
+func NewDecryptorAt(src io.ReaderAt, size int64, key []byte) (*DecryptorAt, error) {
+	if size < HeaderSize+Overhead {
+		return nil, ErrSizeIsNotValid
+	}
+
+	header := make([]byte, HeaderSize)
+	_, err := src.ReadAt(header, 0)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = ErrHeaderIsNotValid
+		}
+		return nil, err
+	}
+
+	cipher, err := newStreamCipher(key, header)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedChunkSize := int64(cipher.chunkSize + Overhead)
+	encryptedSize := size - HeaderSize
+	chunksCount := (encryptedSize + encryptedChunkSize - 1) / encryptedChunkSize
+	lastChunkSize := encryptedSize - (chunksCount-1)*encryptedChunkSize
+	// an empty final chunk is valid only if it's the only chunk of the stream
+	if lastChunkSize == Overhead && chunksCount > 1 {
+		return nil, ErrSizeIsNotValid
+	}
+
+	decryptor := &DecryptorAt{
+		src:           src,
+		cipher:        cipher,
+		chunksCount:   chunksCount,
+		plaintextSize: encryptedSize - chunksCount*Overhead,
+	}
+
+	_, err = decryptor.readChunk(make([]byte, encryptedChunkSize), chunksCount-1)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptor, nil
+}
+
+// Size returns the size in bytes of the plaintext.
+func (decryptor *DecryptorAt) Size() int64 {
+	return decryptor.plaintextSize
+}
+
+// ReadAt implements io.ReaderAt. off is an offset in the plaintext.
+func (decryptor *DecryptorAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, ErrOffsetIsNotValid
+	}
+	if off >= decryptor.plaintextSize {
+		return 0, io.EOF
+	}
+
+	chunkSize := int64(decryptor.cipher.chunkSize)
+	buffer := make([]byte, chunkSize+Overhead)
+	for n < len(p) && off < decryptor.plaintextSize {
+		chunkIndex := off / chunkSize
+		plaintext, err := decryptor.readChunk(buffer, chunkIndex)
+		if err != nil {
+			return n, err
+		}
+
+		copied := copy(p[n:], plaintext[off-chunkIndex*chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readChunk reads and decrypts the chunk chunkIndex in buffer.
+func (decryptor *DecryptorAt) readChunk(buffer []byte, chunkIndex int64) (plaintext []byte, err error) {
+	encryptedChunkSize := int64(decryptor.cipher.chunkSize + Overhead)
+	final := chunkIndex == decryptor.chunksCount-1
+
+	chunk := buffer[:encryptedChunkSize]
+	if final {
+		chunk = buffer[:decryptor.plaintextSize-chunkIndex*int64(decryptor.cipher.chunkSize)+Overhead]
+	}
+
+	read, err := decryptor.src.ReadAt(chunk, HeaderSize+chunkIndex*encryptedChunkSize)
+	// ReadAt may return io.EOF when the end of the chunk is the end of src
+	if err != nil && !(errors.Is(err, io.EOF) && read == len(chunk)) {
+		if errors.Is(err, io.EOF) {
+			err = ErrDecrypt
+		}
+		return nil, err
+	}
+
+	return decryptor.cipher.open(chunk[:0], uint64(chunkIndex), final, chunk)
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"io"
+)
+
+type EncryptorOptions struct {
+	// ChunkSize is the size in bytes of the plaintext of each chunk.
+	// Bigger chunks have less overhead but random access with DecryptorAt has to decrypt more data.
+	// default: DefaultChunkSize
+	ChunkSize int
+}
+
+// Encryptor encrypts the data written to it and writes the encrypted stream to the underlying writer.
+// Close MUST be called to write the final chunk, otherwise the stream is truncated and can't be decrypted.
+type Encryptor struct {
+	dst        io.Writer
+	cipher     *streamCipher
+	buffer     []byte
+	chunkIndex uint64
+	err        error
+}
+
+// ensure that Encryptor implements the io.WriteCloser interface
+var _ io.WriteCloser = (*Encryptor)(nil)
+
+// NewEncryptor writes the header of the stream to dst and returns an Encryptor. options can be nil.
+func NewEncryptor(dst io.Writer, key []byte, options *EncryptorOptions) (*Encryptor, error) {
+	chunkSize := DefaultChunkSize
+	if options != nil && options.ChunkSize != 0 {
+		chunkSize = options.ChunkSize
+	}
+	err := validateChunkSize(chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	header := newHeader(chunkSize)
+	cipher, err := newStreamCipher(key, header)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dst.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encryptor{
+		dst:    dst,
+		cipher: cipher,
+		// one chunk of plaintext and the tag, as chunks are encrypted in place
+		buffer:     make([]byte, 0, chunkSize+Overhead),
+		chunkIndex: 0,
+		err:        nil,
+	}, nil
+}
+
+func (encryptor *Encryptor) Write(p []byte) (n int, err error) {
+	if encryptor.err != nil {
+		return 0, encryptor.err
+	}
+
+	chunkSize := encryptor.cipher.chunkSize
+	for len(p) > 0 {
+		// a full chunk is flushed only when more data is written, as the last chunk must be flagged
+		// as final when Close is called
+		if len(encryptor.buffer) == chunkSize {
+			err = encryptor.flushChunk(false)
+			if err != nil {
+				return
+			}
+		}
+
+		written := copy(encryptor.buffer[len(encryptor.buffer):chunkSize], p)
+		encryptor.buffer = encryptor.buffer[:len(encryptor.buffer)+written]
+		p = p[written:]
+		n += written
+	}
+
+	return n, nil
+}
+
+// Close encrypts and writes the final chunk. It doesn't close the underlying writer.
+func (encryptor *Encryptor) Close() error {
+	if encryptor.err != nil {
+		if encryptor.err == ErrClosed {
+			return nil
+		}
+		return encryptor.err
+	}
+
+	err := encryptor.flushChunk(true)
+	if err != nil {
+		return err
+	}
+
+	encryptor.cipher.zeroize()
+	encryptor.err = ErrClosed
+	return nil
+}
+
+func (encryptor *Encryptor) flushChunk(final bool) (err error) {
+	if !final && encryptor.chunkIndex == maxChunkIndex {
+		encryptor.err = ErrStreamIsTooLarge
+		return encryptor.err
+	}
+
+	chunk := encryptor.cipher.seal(encryptor.buffer[:0], encryptor.chunkIndex, final, encryptor.buffer)
+	_, err = encryptor.dst.Write(chunk)
+	if err != nil {
+		encryptor.err = err
+		return err
+	}
+
+	encryptor.chunkIndex += 1
+	encryptor.buffer = encryptor.buffer[:0]
+	return nil
+}
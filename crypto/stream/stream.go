@@ -0,0 +1,186 @@
+// Package stream implements streaming authenticated encryption (the STREAM construction) on top of
+// ChaCha20-BLAKE3, to encrypt data that doesn't fit in memory.
+//
+// The plaintext is split in chunks of fixed size that are encrypted independently. Each chunk has
+// its own nonce derived from the base nonce of the stream and the index of the chunk, and the last chunk
+// is flagged as final, so reordered, duplicated and truncated chunks are detected.
+//
+// # Format (version 1)
+//
+//	header: version (1 byte) || chunk size (4 bytes, big endian) || salt (32 bytes)
+//	chunks: ciphertext (chunk size bytes) || tag (32 bytes)
+//	        ...
+//	        ciphertext (0 to chunk size bytes) || tag (32 bytes)
+//
+// A key and a base nonce are derived from the key and the random salt of the header, so a key can
+// be used to encrypt many streams. The header is authenticated as the additional data of every chunk.
+//
+// The last chunk is never empty, unless the plaintext is empty, so the layout of the chunks only depends
+// on the size of the plaintext, which allows random access with DecryptorAt.
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/blake3"
+	"github.com/bloom42/stdx-go/crypto/chacha20blake3"
+)
+
+const (
+	Version1 = 1
+
+	KeySize = chacha20blake3.KeySize
+	// HeaderSize is the size in bytes of the header of a stream
+	HeaderSize = 1 + 4 + saltSize
+	// Overhead is the number of bytes added to each chunk
+	Overhead = chacha20blake3.TagSize
+
+	DefaultChunkSize = 64 * 1024
+	MinChunkSize     = 1024
+	MaxChunkSize     = 16 * 1024 * 1024
+
+	saltSize = 32
+
+	streamKeyContext = "stdx-go/crypto/stream v1 stream key and base nonce"
+
+	chunkNonceFinalFlagOffset = 8
+	maxChunkIndex             = math.MaxUint64
+)
+
+var (
+	ErrHeaderIsNotValid      = errors.New("stream: header is not valid")
+	ErrVersionIsNotSupported = errors.New("stream: version is not supported")
+	ErrChunkSizeIsNotValid   = errors.New("stream: chunk size is not valid")
+	ErrDecrypt               = errors.New("stream: error decrypting chunk: the data has been corrupted or truncated")
+	ErrClosed                = errors.New("stream: encryptor is closed")
+	ErrStreamIsTooLarge      = errors.New("stream: stream is too large")
+	ErrOffsetIsNotValid      = errors.New("stream: offset is not valid")
+	ErrSizeIsNotValid        = errors.New("stream: size is not valid")
+)
+
+// EncryptedSize returns the size of the encrypted stream of a plaintext of plaintextSize bytes.
+func EncryptedSize(plaintextSize int64, chunkSize int) int64 {
+	return HeaderSize + plaintextSize + chunksCount(plaintextSize, chunkSize)*Overhead
+}
+
+// chunksCount returns the number of chunks of a plaintext of plaintextSize bytes.
+func chunksCount(plaintextSize int64, chunkSize int) int64 {
+	if plaintextSize == 0 {
+		return 1
+	}
+	return (plaintextSize + int64(chunkSize) - 1) / int64(chunkSize)
+}
+
+func validateChunkSize(chunkSize int) error {
+	if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+		return ErrChunkSizeIsNotValid
+	}
+	return nil
+}
+
+// streamCipher encrypts and decrypts the chunks of a stream.
+type streamCipher struct {
+	aead      *chacha20blake3.ChaCha20Blake3
+	baseNonce [chacha20blake3.NonceSize]byte
+	header    []byte
+	chunkSize int
+}
+
+func newHeader(chunkSize int) []byte {
+	header := make([]byte, 0, HeaderSize)
+	header = append(header, Version1)
+	header = binary.BigEndian.AppendUint32(header, uint32(chunkSize))
+	header = append(header, crypto.RandBytes(saltSize)...)
+	return header
+}
+
+func parseHeader(header []byte) (chunkSize int, err error) {
+	if len(header) != HeaderSize {
+		return 0, ErrHeaderIsNotValid
+	}
+	if header[0] != Version1 {
+		return 0, ErrVersionIsNotSupported
+	}
+
+	chunkSize = int(binary.BigEndian.Uint32(header[1:5]))
+	err = validateChunkSize(chunkSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return chunkSize, nil
+}
+
+func newStreamCipher(key []byte, header []byte) (*streamCipher, error) {
+	chunkSize, err := parseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != KeySize {
+		return nil, chacha20blake3.ErrBadKeyLength
+	}
+
+	salt := header[HeaderSize-saltSize:]
+	keyMaterial := make([]byte, 0, KeySize+saltSize)
+	keyMaterial = append(keyMaterial, key...)
+	keyMaterial = append(keyMaterial, salt...)
+
+	var derived [KeySize + chacha20blake3.NonceSize]byte
+	blake3.DeriveKey(derived[:], streamKeyContext, keyMaterial)
+	defer crypto.Zeroize(derived[:])
+	defer crypto.Zeroize(keyMaterial)
+
+	aead, err := chacha20blake3.New(derived[:KeySize])
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &streamCipher{
+		aead:      aead,
+		header:    header,
+		chunkSize: chunkSize,
+	}
+	copy(ret.baseNonce[:], derived[KeySize:])
+	return ret, nil
+}
+
+// chunkNonce returns the nonce of the chunk: the base nonce XORed with the big endian index of the chunk
+// and the final flag.
+func (cipher *streamCipher) chunkNonce(index uint64, final bool) (nonce [chacha20blake3.NonceSize]byte) {
+	nonce = cipher.baseNonce
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], index)
+	for i := range counter {
+		nonce[i] ^= counter[i]
+	}
+	if final {
+		nonce[chunkNonceFinalFlagOffset] ^= 1
+	}
+	return
+}
+
+func (cipher *streamCipher) seal(dst []byte, index uint64, final bool, plaintext []byte) []byte {
+	nonce := cipher.chunkNonce(index, final)
+	return cipher.aead.Seal(dst, nonce[:], plaintext, cipher.header)
+}
+
+func (cipher *streamCipher) open(dst []byte, index uint64, final bool, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < Overhead {
+		return nil, ErrDecrypt
+	}
+
+	nonce := cipher.chunkNonce(index, final)
+	plaintext, err := cipher.aead.Open(dst, nonce[:], ciphertext, cipher.header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func (cipher *streamCipher) zeroize() {
+	cipher.aead.Zeroize()
+	crypto.Zeroize(cipher.baseNonce[:])
+}
@@ -0,0 +1,223 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+func encrypt(t *testing.T, key, plaintext []byte, chunkSize int) []byte {
+	t.Helper()
+
+	var ciphertext bytes.Buffer
+	encryptor, err := NewEncryptor(&ciphertext, key, &EncryptorOptions{ChunkSize: chunkSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// write in small, unaligned pieces to exercise buffering
+	for data := plaintext; len(data) > 0; {
+		size := min(len(data), 1000)
+		_, err = encryptor.Write(data[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = data[size:]
+	}
+	err = encryptor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ciphertext.Bytes()
+}
+
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	decryptor, err := NewDecryptor(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(decryptor)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := crypto.RandBytes(KeySize)
+
+	for _, size := range []int{0, 1, MinChunkSize - 1, MinChunkSize, MinChunkSize + 1, 3 * MinChunkSize, 10*MinChunkSize + 7} {
+		plaintext := crypto.RandBytes(uint64(size))
+		ciphertext := encrypt(t, key, plaintext, MinChunkSize)
+
+		if int64(len(ciphertext)) != EncryptedSize(int64(size), MinChunkSize) {
+			t.Errorf("size %d: encrypted size = %d, want %d", size, len(ciphertext), EncryptedSize(int64(size), MinChunkSize))
+		}
+
+		decrypted, err := decrypt(key, ciphertext)
+		if err != nil {
+			t.Errorf("size %d: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("size %d: decrypted plaintext doesn't match", size)
+		}
+
+		decryptorAt, err := NewDecryptorAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), key)
+		if err != nil {
+			t.Errorf("size %d: NewDecryptorAt: %v", size, err)
+			continue
+		}
+		if decryptorAt.Size() != int64(size) {
+			t.Errorf("size %d: DecryptorAt.Size() = %d", size, decryptorAt.Size())
+		}
+		decrypted, err = io.ReadAll(io.NewSectionReader(decryptorAt, 0, decryptorAt.Size()))
+		if err != nil {
+			t.Errorf("size %d: DecryptorAt: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("size %d: DecryptorAt: decrypted plaintext doesn't match", size)
+		}
+	}
+}
+
+func TestRandomAccess(t *testing.T) {
+	key := crypto.RandBytes(KeySize)
+	plaintext := crypto.RandBytes(5*MinChunkSize + 100)
+	ciphertext := encrypt(t, key, plaintext, MinChunkSize)
+
+	decryptor, err := NewDecryptorAt(bytes.NewReader(ciphertext), int64(len(ciphertext)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset int64
+		size   int
+	}{
+		{0, 10},
+		{MinChunkSize - 5, 10},
+		{2*MinChunkSize + 3, 2 * MinChunkSize},
+		{5 * MinChunkSize, 100},
+	}
+	for _, test := range tests {
+		buffer := make([]byte, test.size)
+		n, err := decryptor.ReadAt(buffer, test.offset)
+		if err != nil {
+			t.Errorf("offset %d: %v", test.offset, err)
+		}
+		if !bytes.Equal(buffer[:n], plaintext[test.offset:test.offset+int64(test.size)]) {
+			t.Errorf("offset %d: plaintext doesn't match", test.offset)
+		}
+	}
+
+	// read past the end
+	buffer := make([]byte, 200)
+	n, err := decryptor.ReadAt(buffer, 5*MinChunkSize)
+	if n != 100 || !errors.Is(err, io.EOF) {
+		t.Errorf("read past the end: n = %d, err = %v", n, err)
+	}
+	_, err = decryptor.ReadAt(buffer, int64(len(plaintext)))
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("read at the end: err = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestTruncation(t *testing.T) {
+	key := crypto.RandBytes(KeySize)
+	plaintext := crypto.RandBytes(3 * MinChunkSize)
+	ciphertext := encrypt(t, key, plaintext, MinChunkSize)
+	encryptedChunkSize := MinChunkSize + Overhead
+
+	truncations := []int{
+		// at a chunk boundary: the last remaining chunk is not flagged as final
+		HeaderSize + 2*encryptedChunkSize,
+		HeaderSize + encryptedChunkSize,
+		// in the middle of a chunk
+		len(ciphertext) - 1,
+		HeaderSize + encryptedChunkSize + 10,
+	}
+	for _, size := range truncations {
+		_, err := decrypt(key, ciphertext[:size])
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("truncated to %d bytes: err = %v, want %v", size, err, ErrDecrypt)
+		}
+
+		_, err = NewDecryptorAt(bytes.NewReader(ciphertext[:size]), int64(size), key)
+		if err == nil {
+			t.Errorf("truncated to %d bytes: DecryptorAt: expected an error", size)
+		}
+	}
+
+	// data appended after the final chunk
+	_, err := decrypt(key, append(bytes.Clone(ciphertext), 0))
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("extended: err = %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestTampering(t *testing.T) {
+	key := crypto.RandBytes(KeySize)
+	plaintext := crypto.RandBytes(2*MinChunkSize + 10)
+	ciphertext := encrypt(t, key, plaintext, MinChunkSize)
+	encryptedChunkSize := MinChunkSize + Overhead
+
+	// swapped chunks
+	swapped := bytes.Clone(ciphertext)
+	copy(swapped[HeaderSize:], ciphertext[HeaderSize+encryptedChunkSize:HeaderSize+2*encryptedChunkSize])
+	copy(swapped[HeaderSize+encryptedChunkSize:], ciphertext[HeaderSize:HeaderSize+encryptedChunkSize])
+	_, err := decrypt(key, swapped)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("swapped chunks: err = %v, want %v", err, ErrDecrypt)
+	}
+
+	// modified ciphertext
+	modified := bytes.Clone(ciphertext)
+	modified[HeaderSize+encryptedChunkSize+5] ^= 1
+	_, err = decrypt(key, modified)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("modified chunk: err = %v, want %v", err, ErrDecrypt)
+	}
+
+	// modified salt
+	modified = bytes.Clone(ciphertext)
+	modified[HeaderSize-1] ^= 1
+	_, err = decrypt(key, modified)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("modified header: err = %v, want %v", err, ErrDecrypt)
+	}
+
+	// unknown version
+	modified = bytes.Clone(ciphertext)
+	modified[0] = 2
+	_, err = decrypt(key, modified)
+	if !errors.Is(err, ErrVersionIsNotSupported) {
+		t.Errorf("version: err = %v, want %v", err, ErrVersionIsNotSupported)
+	}
+
+	// wrong key
+	_, err = decrypt(crypto.RandBytes(KeySize), ciphertext)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong key: err = %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestEncryptorClosed(t *testing.T) {
+	encryptor, err := NewEncryptor(io.Discard, crypto.RandBytes(KeySize), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = encryptor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = encryptor.Write([]byte("hello"))
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("err = %v, want %v", err, ErrClosed)
+	}
+
+	_, err = NewEncryptor(io.Discard, crypto.RandBytes(KeySize), &EncryptorOptions{ChunkSize: MinChunkSize - 1})
+	if !errors.Is(err, ErrChunkSizeIsNotValid) {
+		t.Errorf("err = %v, want %v", err, ErrChunkSizeIsNotValid)
+	}
+}
@@ -0,0 +1,138 @@
+package token
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/blake3"
+	"github.com/bloom42/stdx-go/crypto/chacha20blake3"
+)
+
+const (
+	LocalKeySize = chacha20blake3.KeySize
+
+	localNonceSize  = chacha20blake3.NonceSize
+	localKeyContext = "stdx-go/crypto/token v1.local encryption key"
+)
+
+type LocalConfig struct {
+	// Keys provides the secret keys (LocalKeySize bytes) used to verify tokens.
+	Keys KeyProvider
+	// KeyID is the ID of the key used to issue tokens. It can be empty if tokens are only verified.
+	KeyID      string
+	Validation ValidationConfig
+}
+
+// Local issues and verifies local (encrypted) tokens.
+type Local struct {
+	keys       KeyProvider
+	keyID      string
+	validation ValidationConfig
+	now        func() time.Time
+}
+
+func NewLocal(config LocalConfig) (*Local, error) {
+	if config.Keys == nil {
+		return nil, ErrKeyProviderIsNil
+	}
+
+	return &Local{
+		keys:       config.Keys,
+		keyID:      config.KeyID,
+		validation: config.Validation,
+		now:        time.Now,
+	}, nil
+}
+
+// Issue encrypts claims into a new token with the key LocalConfig.KeyID.
+func (local *Local) Issue(claims ClaimsHolder) (token string, err error) {
+	if local.keyID == "" {
+		return "", ErrKeyIDIsEmpty
+	}
+	key, err := getKey(local.keys, local.keyID, LocalKeySize)
+	if err != nil {
+		return
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return
+	}
+
+	nonce := crypto.RandBytes(localNonceSize)
+	return encryptLocal(key, local.keyID, nonce, claimsJSON), nil
+}
+
+// Verify decrypts the token into claims and validates the registered claims.
+func (local *Local) Verify(token string, claims ClaimsHolder) (err error) {
+	parsed, err := parseToken(token, headerV1Local)
+	if err != nil {
+		return
+	}
+	if len(parsed.payload) < localNonceSize+chacha20blake3.TagSize {
+		return ErrTokenIsNotValid
+	}
+
+	key, err := getKey(local.keys, parsed.footer.KeyID, LocalKeySize)
+	if err != nil {
+		return
+	}
+
+	nonce := parsed.payload[:localNonceSize]
+	ciphertext := parsed.payload[localNonceSize:]
+	cipher := newLocalCipher(key, nonce)
+	defer cipher.Zeroize()
+
+	additionalData := pae([]byte(parsed.header), nonce, parsed.rawFooter)
+	claimsJSON, err := cipher.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return ErrTokenIsNotValid
+	}
+
+	return decodeClaims(claimsJSON, claims, local.validation, local.now())
+}
+
+func encryptLocal(key []byte, keyID string, nonce []byte, claimsJSON []byte) string {
+	footer := encodeFooter(keyID)
+	cipher := newLocalCipher(key, nonce)
+	defer cipher.Zeroize()
+
+	additionalData := pae([]byte(headerV1Local), nonce, footer)
+	payload := make([]byte, localNonceSize, localNonceSize+len(claimsJSON)+chacha20blake3.TagSize)
+	copy(payload, nonce)
+	payload = cipher.Seal(payload, nonce, claimsJSON, additionalData)
+
+	return encodeToken(headerV1Local, payload, footer)
+}
+
+// newLocalCipher returns a cipher with a key derived from the secret key and the nonce of the token.
+// ChaCha20-BLAKE3 only uses 8 bytes of its nonce for the keystream, so the nonce is also used to derive
+// a unique key for each token.
+func newLocalCipher(key, nonce []byte) *chacha20blake3.ChaCha20Blake3 {
+	keyMaterial := make([]byte, 0, len(key)+len(nonce))
+	keyMaterial = append(keyMaterial, key...)
+	keyMaterial = append(keyMaterial, nonce...)
+
+	var tokenKey [chacha20blake3.KeySize]byte
+	blake3.DeriveKey(tokenKey[:], localKeyContext, keyMaterial)
+
+	// we can ignore the error as the key is always of the right size
+	cipher, _ := chacha20blake3.New(tokenKey[:])
+
+	crypto.Zeroize(tokenKey[:])
+	crypto.Zeroize(keyMaterial)
+	return cipher
+}
+
+func getKey(keys KeyProvider, keyID string, keySize int) (key []byte, err error) {
+	key, err = keys.GetKey(keyID)
+	if err != nil {
+		return
+	}
+	if len(key) != keySize {
+		return nil, ErrKeyIsNotValid
+	}
+
+	return key, nil
+}
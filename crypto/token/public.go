@@ -0,0 +1,102 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+var ErrPrivateKeyIsMissing = errors.New("token: private key is missing")
+
+type PublicConfig struct {
+	// Keys provides the Ed25519 public keys used to verify tokens.
+	Keys KeyProvider
+	// PrivateKey is the key used to issue tokens. It can be nil if tokens are only verified.
+	PrivateKey crypto.Ed25519PrivateKey
+	// KeyID is the ID of PrivateKey, which is written in the footer of the tokens so verifiers can
+	// look up the corresponding public key.
+	KeyID      string
+	Validation ValidationConfig
+}
+
+// Public issues and verifies public (signed) tokens.
+type Public struct {
+	keys       KeyProvider
+	privateKey crypto.Ed25519PrivateKey
+	keyID      string
+	validation ValidationConfig
+	now        func() time.Time
+}
+
+func NewPublic(config PublicConfig) (*Public, error) {
+	if config.Keys == nil {
+		return nil, ErrKeyProviderIsNil
+	}
+	if config.PrivateKey != nil {
+		if len(config.PrivateKey) != crypto.Ed25519PrivateKeySize {
+			return nil, ErrKeyIsNotValid
+		}
+		if config.KeyID == "" {
+			return nil, ErrKeyIDIsEmpty
+		}
+	}
+
+	return &Public{
+		keys:       config.Keys,
+		privateKey: config.PrivateKey,
+		keyID:      config.KeyID,
+		validation: config.Validation,
+		now:        time.Now,
+	}, nil
+}
+
+// Issue signs claims into a new token with PublicConfig.PrivateKey.
+// The claims are NOT encrypted.
+func (public *Public) Issue(claims ClaimsHolder) (token string, err error) {
+	if public.privateKey == nil {
+		return "", ErrPrivateKeyIsMissing
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return
+	}
+
+	footer := encodeFooter(public.keyID)
+	signature, err := public.privateKey.Sign(nil, pae([]byte(headerV1Public), claimsJSON, footer), crypto.Ed25519SignerOpts)
+	if err != nil {
+		return
+	}
+
+	payload := append(claimsJSON, signature...)
+	return encodeToken(headerV1Public, payload, footer), nil
+}
+
+// Verify verifies the signature of the token, decodes it into claims and validates the registered claims.
+func (public *Public) Verify(token string, claims ClaimsHolder) (err error) {
+	parsed, err := parseToken(token, headerV1Public)
+	if err != nil {
+		return
+	}
+	if len(parsed.payload) < crypto.Ed25519SignatureSize {
+		return ErrTokenIsNotValid
+	}
+
+	publicKey, err := getKey(public.keys, parsed.footer.KeyID, crypto.Ed25519PublicKeySize)
+	if err != nil {
+		return
+	}
+
+	signatureStart := len(parsed.payload) - crypto.Ed25519SignatureSize
+	claimsJSON := parsed.payload[:signatureStart]
+	signature := parsed.payload[signatureStart:]
+
+	valid, err := crypto.Ed25519PublicKey(publicKey).Verify(pae([]byte(parsed.header), claimsJSON, parsed.rawFooter), signature)
+	if err != nil || !valid {
+		return ErrTokenIsNotValid
+	}
+
+	return decodeClaims(claimsJSON, claims, public.validation, public.now())
+}
@@ -0,0 +1,251 @@
+// Package token implements versioned, authenticated tokens carrying JSON claims. It is the successor of
+// the abandoned jst package.
+//
+// Tokens come in 2 modes:
+//   - local tokens are encrypted and authenticated with a secret key (ChaCha20-BLAKE3). Their claims
+//     can only be read by the holders of the key.
+//   - public tokens are signed with an Ed25519 private key. Their claims are NOT encrypted and can be
+//     read by anyone, but can only be verified with the public key.
+//
+// # Format (version 1)
+//
+//	v1.local.base64url(nonce || ciphertext || tag).base64url(footer)
+//	v1.public.base64url(claims || signature).base64url(footer)
+//
+// The footer is a JSON object that contains the ID of the key ("kid") used to issue the token so keys
+// can be rotated: the verifier looks up the key with its KeyProvider. The footer is not encrypted, but it
+// is authenticated together with the header ("v1.local." or "v1.public.") with a pre-authentication
+// encoding (PAE) which prevents canonicalization attacks.
+//
+// Local tokens use a random 32-byte nonce and a key derived from the secret key and the nonce, so a key
+// can safely be used to issue a very large number of tokens.
+package token
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	Version1 = "v1"
+
+	ModeLocal  = "local"
+	ModePublic = "public"
+
+	headerV1Local  = Version1 + "." + ModeLocal + "."
+	headerV1Public = Version1 + "." + ModePublic + "."
+)
+
+var (
+	ErrTokenIsNotValid       = errors.New("token: token is not valid")
+	ErrVersionIsNotSupported = errors.New("token: version is not supported")
+	ErrKeyNotFound           = errors.New("token: key not found")
+	ErrKeyIsNotValid         = errors.New("token: key is not valid")
+	ErrKeyIDIsEmpty          = errors.New("token: key ID is empty")
+	ErrKeyProviderIsNil      = errors.New("token: key provider is nil")
+	ErrTokenHasExpired       = errors.New("token: token has expired")
+	ErrTokenIsNotYetValid    = errors.New("token: token is not yet valid")
+	ErrIssuerIsNotValid      = errors.New("token: issuer is not valid")
+	ErrAudienceIsNotValid    = errors.New("token: audience is not valid")
+	ErrExpirationIsMissing   = errors.New("token: expiration is missing")
+)
+
+// Claims are the registered claims of a token. Custom claims types should embed Claims:
+//
+//	type SessionClaims struct {
+//		token.Claims
+//		SessionID uuid.UUID `json:"session_id"`
+//	}
+type Claims struct {
+	Issuer    string     `json:"iss,omitempty"`
+	Subject   string     `json:"sub,omitempty"`
+	Audience  string     `json:"aud,omitempty"`
+	ExpiresAt *time.Time `json:"exp,omitempty"`
+	NotBefore *time.Time `json:"nbf,omitempty"`
+	IssuedAt  *time.Time `json:"iat,omitempty"`
+	// TokenID is a unique identifier for the token, which can be used to prevent replays
+	TokenID string `json:"jti,omitempty"`
+}
+
+// ClaimsHolder is implemented by *Claims and by pointers to the structs that embed Claims.
+type ClaimsHolder interface {
+	registeredClaims() *Claims
+}
+
+func (claims *Claims) registeredClaims() *Claims {
+	return claims
+}
+
+// Footer is the unencrypted but authenticated last part of a token.
+type Footer struct {
+	KeyID string `json:"kid"`
+}
+
+// ValidationConfig configures the validation of the registered claims of the tokens.
+type ValidationConfig struct {
+	// Issuer, if not empty, must be equal to the "iss" claim of the tokens.
+	Issuer string
+	// Audience, if not empty, must be equal to the "aud" claim of the tokens.
+	Audience string
+	// RequireExpiration rejects the tokens without an "exp" claim.
+	RequireExpiration bool
+	// Leeway is the tolerance for the clock skew between the issuer and the verifier when validating
+	// the "exp" and "nbf" claims.
+	Leeway time.Duration
+}
+
+// Validate validates the registered claims at the time now.
+func (config ValidationConfig) Validate(claims *Claims, now time.Time) error {
+	if claims.ExpiresAt == nil {
+		if config.RequireExpiration {
+			return ErrExpirationIsMissing
+		}
+	} else if !now.Before(claims.ExpiresAt.Add(config.Leeway)) {
+		return ErrTokenHasExpired
+	}
+
+	if claims.NotBefore != nil && now.Add(config.Leeway).Before(*claims.NotBefore) {
+		return ErrTokenIsNotYetValid
+	}
+
+	if config.Issuer != "" && claims.Issuer != config.Issuer {
+		return ErrIssuerIsNotValid
+	}
+
+	if config.Audience != "" && claims.Audience != config.Audience {
+		return ErrAudienceIsNotValid
+	}
+
+	return nil
+}
+
+// KeyProvider provides the keys used to verify tokens, identified by the key ID of their footer: secret
+// keys for local tokens and Ed25519 public keys for public tokens.
+type KeyProvider interface {
+	GetKey(keyID string) (key []byte, err error)
+}
+
+// parsedToken is a token split in its parts, before verification.
+type parsedToken struct {
+	// header is the version and the mode, including the trailing '.'
+	header  string
+	payload []byte
+	footer  Footer
+	// rawFooter is the decoded footer, as authenticated
+	rawFooter []byte
+}
+
+// parseToken splits the token and decodes its payload and footer. expectedHeader is the version and mode
+// expected by the caller.
+func parseToken(token string, expectedHeader string) (parsed parsedToken, err error) {
+	if !strings.HasPrefix(token, Version1+".") {
+		if strings.Count(token, ".") == 3 {
+			err = ErrVersionIsNotSupported
+		} else {
+			err = ErrTokenIsNotValid
+		}
+		return
+	}
+
+	if !strings.HasPrefix(token, expectedHeader) {
+		err = ErrTokenIsNotValid
+		return
+	}
+	parsed.header = expectedHeader
+
+	encodedPayload, encodedFooter, found := strings.Cut(token[len(expectedHeader):], ".")
+	if !found || strings.Contains(encodedFooter, ".") {
+		err = ErrTokenIsNotValid
+		return
+	}
+
+	parsed.payload, err = base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		err = ErrTokenIsNotValid
+		return
+	}
+	parsed.rawFooter, err = base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		err = ErrTokenIsNotValid
+		return
+	}
+	err = json.Unmarshal(parsed.rawFooter, &parsed.footer)
+	if err != nil || parsed.footer.KeyID == "" {
+		err = ErrTokenIsNotValid
+		return
+	}
+
+	return parsed, nil
+}
+
+func encodeToken(header string, payload, footer []byte) string {
+	var token strings.Builder
+	token.Grow(len(header) + base64.RawURLEncoding.EncodedLen(len(payload)) + 1 +
+		base64.RawURLEncoding.EncodedLen(len(footer)))
+
+	token.WriteString(header)
+	token.WriteString(base64.RawURLEncoding.EncodeToString(payload))
+	token.WriteByte('.')
+	token.WriteString(base64.RawURLEncoding.EncodeToString(footer))
+	return token.String()
+}
+
+func encodeFooter(keyID string) []byte {
+	// Footer can always be encoded
+	footer, _ := json.Marshal(Footer{KeyID: keyID})
+	return footer
+}
+
+// pae is the pre-authentication encoding of pieces: the little endian number of pieces followed by the
+// little endian length and the content of each piece.
+func pae(pieces ...[]byte) []byte {
+	size := 8
+	for _, piece := range pieces {
+		size += 8 + len(piece)
+	}
+
+	ret := make([]byte, 0, size)
+	ret = binary.LittleEndian.AppendUint64(ret, uint64(len(pieces)))
+	for _, piece := range pieces {
+		ret = binary.LittleEndian.AppendUint64(ret, uint64(len(piece)))
+		ret = append(ret, piece...)
+	}
+	return ret
+}
+
+// decodeClaims decodes the claims JSON into claims and validates the registered claims.
+func decodeClaims(claimsJSON []byte, claims ClaimsHolder, validation ValidationConfig, now time.Time) error {
+	err := json.Unmarshal(claimsJSON, claims)
+	if err != nil {
+		return ErrTokenIsNotValid
+	}
+
+	return validation.Validate(claims.registeredClaims(), now)
+}
+
+// MemoryKeyProvider is a KeyProvider that holds the keys in memory.
+type MemoryKeyProvider struct {
+	keys map[string][]byte
+}
+
+// ensure that MemoryKeyProvider satisfies the KeyProvider interface
+var _ KeyProvider = (*MemoryKeyProvider)(nil)
+
+func NewMemoryKeyProvider(keys map[string][]byte) *MemoryKeyProvider {
+	return &MemoryKeyProvider{
+		keys: keys,
+	}
+}
+
+func (provider *MemoryKeyProvider) GetKey(keyID string) (key []byte, err error) {
+	key, exists := provider.keys[keyID]
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
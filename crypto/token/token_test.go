@@ -0,0 +1,264 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+type testClaims struct {
+	Claims
+	Role string `json:"role"`
+}
+
+const (
+	testKeyID = "key-2024"
+
+	vectorLocal = "v1.local.ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj-fDXFuPGo8GS3enp8tqZXmMZWLAkAj0DpN2uQ_yE63C4YgNE2o0qrG-MiJd4OUbzgbkKyea4cx9U7yl73B9iSUilvNThrvzpxyLM8EeOlJJAxbKlBBo8bb5jX71bbx7uVG0BT4PF2fPKmU3F3Wtc-EI9cYw-ipomqzNTU3mHQtx_sweCrSQi9XBDAsDFhNipBEk-NIOjHk.eyJraWQiOiJrZXktMjAyNCJ9"
+
+	vectorPublic = "v1.public.eyJpc3MiOiJzdGR4Iiwic3ViIjoiYWNjb3VudF8xMjMiLCJhdWQiOiJhcGkiLCJleHAiOiIyMTAwLTAxLTAxVDAwOjAwOjAwWiIsImlhdCI6IjIwMjQtMDEtMDFUMDA6MDA6MDBaIiwicm9sZSI6ImFkbWluIn1cjAOd2nul-TaDjX3n89QFsrbnqEtqW8vQ03oH7clAMtghDWbwt6iIPZGYpfoFcGp3EiWNsjRxMndGbZFsohgA.eyJraWQiOiJrZXktMjAyNCJ9"
+
+	vectorPublicKeyHex = "03a107bff3ce10be1d70dd18e74bc09967e4d6309ba50d5f1ddc8664125531b8"
+)
+
+// vectorKeyAndNonce returns the key 0x00..0x1f, used as the secret key of local tokens and the seed of the
+// Ed25519 private key of public tokens, and the nonce 0x20..0x3f
+func vectorKeyAndNonce() (key, nonce []byte) {
+	key = make([]byte, 32)
+	nonce = make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+		nonce[i] = byte(32 + i)
+	}
+	return
+}
+
+func vectorClaims() testClaims {
+	expiresAt := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	issuedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return testClaims{
+		Claims: Claims{
+			Issuer:    "stdx",
+			Subject:   "account_123",
+			Audience:  "api",
+			ExpiresAt: &expiresAt,
+			IssuedAt:  &issuedAt,
+		},
+		Role: "admin",
+	}
+}
+
+func newTestLocal(t *testing.T, validation ValidationConfig) *Local {
+	t.Helper()
+	key, _ := vectorKeyAndNonce()
+	local, err := NewLocal(LocalConfig{
+		Keys:       NewMemoryKeyProvider(map[string][]byte{testKeyID: key}),
+		KeyID:      testKeyID,
+		Validation: validation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return local
+}
+
+func newTestPublic(t *testing.T, validation ValidationConfig) *Public {
+	t.Helper()
+	seed, _ := vectorKeyAndNonce()
+	privateKey := crypto.Ed25519PrivateKey(ed25519.NewKeyFromSeed(seed))
+	public, err := NewPublic(PublicConfig{
+		Keys:       NewMemoryKeyProvider(map[string][]byte{testKeyID: privateKey.Public()}),
+		PrivateKey: privateKey,
+		KeyID:      testKeyID,
+		Validation: validation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public
+}
+
+func TestVectors(t *testing.T) {
+	key, nonce := vectorKeyAndNonce()
+	claims := vectorClaims()
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localToken := encryptLocal(key, testKeyID, nonce, claimsJSON)
+	if localToken != vectorLocal {
+		t.Errorf("local token:\ngot:  %s\nwant: %s", localToken, vectorLocal)
+	}
+
+	public := newTestPublic(t, ValidationConfig{})
+	publicToken, err := public.Issue(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicToken != vectorPublic {
+		t.Errorf("public token:\ngot:  %s\nwant: %s", publicToken, vectorPublic)
+	}
+
+	publicKey, _ := public.keys.GetKey(testKeyID)
+	if hexPublicKey := hex.EncodeToString(publicKey); hexPublicKey != vectorPublicKeyHex {
+		t.Errorf("public key: got %s, want %s", hexPublicKey, vectorPublicKeyHex)
+	}
+
+	validation := ValidationConfig{Issuer: "stdx", Audience: "api", RequireExpiration: true}
+	for _, test := range []struct {
+		token  string
+		verify func(string, ClaimsHolder) error
+	}{
+		{vectorLocal, newTestLocal(t, validation).Verify},
+		{vectorPublic, newTestPublic(t, validation).Verify},
+	} {
+		var decoded testClaims
+		err = test.verify(test.token, &decoded)
+		if err != nil {
+			t.Errorf("%s: %v", test.token[:10], err)
+			continue
+		}
+		if decoded.Subject != claims.Subject || decoded.Role != claims.Role || !decoded.ExpiresAt.Equal(*claims.ExpiresAt) {
+			t.Errorf("%s: decoded claims = %+v, want %+v", test.token[:10], decoded, claims)
+		}
+	}
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	local := newTestLocal(t, ValidationConfig{})
+	claims := vectorClaims()
+
+	token1, err := local.Issue(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, err := local.Issue(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token1 == token2 {
+		t.Error("2 tokens with the same claims are equal")
+	}
+	if strings.Contains(token1, "admin") || !strings.HasPrefix(token1, "v1.local.") {
+		t.Errorf("token is not encrypted: %s", token1)
+	}
+
+	var decoded testClaims
+	err = local.Verify(token1, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Role != claims.Role {
+		t.Errorf("role = %s, want %s", decoded.Role, claims.Role)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := crypto.RandBytes(LocalKeySize)
+	newKey := crypto.RandBytes(LocalKeySize)
+	claims := vectorClaims()
+
+	oldLocal, _ := NewLocal(LocalConfig{
+		Keys:  NewMemoryKeyProvider(map[string][]byte{"old": oldKey}),
+		KeyID: "old",
+	})
+	oldToken, err := oldLocal.Issue(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := NewMemoryKeyProvider(map[string][]byte{"old": oldKey, "new": newKey})
+	newLocal, _ := NewLocal(LocalConfig{Keys: keys, KeyID: "new"})
+	var decoded testClaims
+	err = newLocal.Verify(oldToken, &decoded)
+	if err != nil {
+		t.Errorf("token issued with the old key: %v", err)
+	}
+
+	// once the old key is removed, its tokens are rejected
+	retiredLocal, _ := NewLocal(LocalConfig{Keys: NewMemoryKeyProvider(map[string][]byte{"new": newKey}), KeyID: "new"})
+	err = retiredLocal.Verify(oldToken, &decoded)
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("retired key: err = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	local := newTestLocal(t, ValidationConfig{})
+	public := newTestPublic(t, ValidationConfig{})
+
+	tamperedLocal := []byte(vectorLocal)
+	tamperedLocal[len("v1.local.")+50] ^= 1
+	tamperedPublic := strings.Replace(vectorPublic, "v1.public.eyJpc3MiOiJzdGR4", "v1.public.eyJpc3MiOiJzdGR5", 1)
+	// footer {"kid":"key-2025"}, which is not the authenticated footer
+	otherFooter := "eyJraWQiOiJrZXktMjAyNSJ9"
+
+	tests := []struct {
+		name   string
+		token  string
+		verify func(string, ClaimsHolder) error
+		err    error
+	}{
+		{"tampered local", string(tamperedLocal), local.Verify, ErrTokenIsNotValid},
+		{"tampered public", tamperedPublic, public.Verify, ErrTokenIsNotValid},
+		{"local as public", vectorLocal, public.Verify, ErrTokenIsNotValid},
+		{"public as local", vectorPublic, local.Verify, ErrTokenIsNotValid},
+		{"unknown version", strings.Replace(vectorLocal, "v1.", "v2.", 1), local.Verify, ErrVersionIsNotSupported},
+		{"missing footer", vectorLocal[:strings.LastIndexByte(vectorLocal, '.')], local.Verify, ErrTokenIsNotValid},
+		{"unknown key", vectorLocal[:strings.LastIndexByte(vectorLocal, '.')+1] + otherFooter, local.Verify, ErrKeyNotFound},
+		{"empty", "", local.Verify, ErrTokenIsNotValid},
+	}
+
+	for _, test := range tests {
+		var claims testClaims
+		err := test.verify(test.token, &claims)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		claims     Claims
+		validation ValidationConfig
+		err        error
+	}{
+		{"valid", Claims{ExpiresAt: &future, NotBefore: &past}, ValidationConfig{}, nil},
+		{"expired", Claims{ExpiresAt: &past}, ValidationConfig{}, ErrTokenHasExpired},
+		{"expired within leeway", Claims{ExpiresAt: &past}, ValidationConfig{Leeway: 2 * time.Hour}, nil},
+		{"not yet valid", Claims{NotBefore: &future}, ValidationConfig{}, ErrTokenIsNotYetValid},
+		{"missing expiration", Claims{}, ValidationConfig{RequireExpiration: true}, ErrExpirationIsMissing},
+		{"wrong issuer", Claims{Issuer: "other"}, ValidationConfig{Issuer: "stdx"}, ErrIssuerIsNotValid},
+		{"wrong audience", Claims{Audience: "other"}, ValidationConfig{Audience: "api"}, ErrAudienceIsNotValid},
+		{"audience", Claims{Audience: "api"}, ValidationConfig{Audience: "api"}, nil},
+	}
+
+	for _, test := range tests {
+		err := test.validation.Validate(&test.claims, now)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	// the validation is applied by Verify
+	local := newTestLocal(t, ValidationConfig{})
+	local.now = func() time.Time { return time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC) }
+	var claims testClaims
+	err := local.Verify(vectorLocal, &claims)
+	if !errors.Is(err, ErrTokenHasExpired) {
+		t.Errorf("Verify: err = %v, want %v", err, ErrTokenHasExpired)
+	}
+}
@@ -1,6 +1,9 @@
 package db
 
-import "strings"
+import (
+	"database/sql"
+	"strings"
+)
 
 const (
 	ErrAlreadyExists = "duplicate key value violates unique constraint"
@@ -9,3 +12,15 @@ const (
 func IsErrAlreadyExists(err error) bool {
 	return strings.Contains(err.Error(), ErrAlreadyExists)
 }
+
+// CheckRowsAffected returns notFoundErr if the query that returned res didn't affect any row.
+func CheckRowsAffected(res sql.Result, notFoundErr error) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFoundErr
+	}
+	return nil
+}
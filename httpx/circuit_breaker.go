@@ -0,0 +1,148 @@
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrCircuitBreakerIsOpen = errors.New("httpx: circuit breaker is open")
+
+type CircuitBreakerTransportConfig struct {
+	// FailureThreshold is the number of consecutive failed requests to a host after which the circuit
+	// breaker of the host is opened.
+	// default: 5
+	FailureThreshold uint
+	// OpenDuration is the duration during which the requests to a host are rejected once its circuit breaker
+	// is opened. After it, one request is allowed to probe the host: the circuit breaker is closed if it
+	// succeeds, and opened again otherwise.
+	// default: 30s
+	OpenDuration time.Duration
+	// IsFailure reports whether a request failed.
+	// default: network errors and 5xx status codes
+	IsFailure func(res *http.Response, err error) bool
+	// MaxHosts is the maximum number of failing hosts whose state is kept. When it is reached, the state of
+	// the hosts whose circuit breaker is not open is dropped. The requests to new hosts are not protected
+	// by the circuit breaker while the state of MaxHosts open circuit breakers is kept.
+	// default: 1000
+	MaxHosts int
+}
+
+// CircuitBreakerTransport stops sending requests to the hosts that keep failing, and fails fast with
+// ErrCircuitBreakerIsOpen instead, to give them time to recover.
+type CircuitBreakerTransport struct {
+	next   http.RoundTripper
+	config CircuitBreakerTransportConfig
+
+	mutex sync.Mutex
+	// hosts contains the state of the hosts whose last request failed: the state of a host is dropped
+	// once a request to it succeeds, so that hosts is bounded by the number of failing hosts.
+	hosts map[string]*circuitBreaker
+}
+
+// ensure that CircuitBreakerTransport implements http.RoundTripper
+var _ http.RoundTripper = (*CircuitBreakerTransport)(nil)
+
+type circuitBreaker struct {
+	failures uint
+	// openedAt is zero when the circuit breaker is closed
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreakerTransport(next http.RoundTripper, config CircuitBreakerTransportConfig) *CircuitBreakerTransport {
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenDuration == 0 {
+		config.OpenDuration = 30 * time.Second
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isFailedRequest
+	}
+	if config.MaxHosts <= 0 {
+		config.MaxHosts = 1000
+	}
+
+	return &CircuitBreakerTransport{
+		next:   next,
+		config: config,
+		mutex:  sync.Mutex{},
+		hosts:  make(map[string]*circuitBreaker),
+	}
+}
+
+func (transport *CircuitBreakerTransport) RoundTrip(req *http.Request) (res *http.Response, err error) {
+	host := req.URL.Host
+
+	transport.mutex.Lock()
+	breaker := transport.hosts[host]
+	if breaker == nil {
+		breaker = &circuitBreaker{}
+		if len(transport.hosts) >= transport.config.MaxHosts {
+			transport.removeClosedBreakers()
+		}
+		if len(transport.hosts) < transport.config.MaxHosts {
+			transport.hosts[host] = breaker
+		}
+	}
+	probe := false
+	if !breaker.openedAt.IsZero() {
+		if breaker.probing || time.Since(breaker.openedAt) < transport.config.OpenDuration {
+			transport.mutex.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrCircuitBreakerIsOpen, host)
+		}
+		breaker.probing = true
+		probe = true
+	}
+	transport.mutex.Unlock()
+
+	res, err = transport.next.RoundTrip(req)
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	if probe {
+		breaker.probing = false
+	}
+	if req.Context().Err() != nil {
+		// the request has been canceled by the caller
+		return
+	}
+
+	if transport.config.IsFailure(res, err) {
+		breaker.failures += 1
+		if probe || breaker.failures >= transport.config.FailureThreshold {
+			breaker.openedAt = time.Now()
+		}
+	} else {
+		breaker.failures = 0
+		breaker.openedAt = time.Time{}
+		if transport.hosts[host] == breaker {
+			delete(transport.hosts, host)
+		}
+	}
+
+	return
+}
+
+// removeClosedBreakers drops the state of the hosts whose circuit breaker is not open (including the ones
+// whose OpenDuration has elapsed, which are closed again). The caller must hold the mutex.
+func (transport *CircuitBreakerTransport) removeClosedBreakers() {
+	for host, breaker := range transport.hosts {
+		if breaker.probing {
+			continue
+		}
+		if breaker.openedAt.IsZero() || time.Since(breaker.openedAt) >= transport.config.OpenDuration {
+			delete(transport.hosts, host)
+		}
+	}
+}
+
+func isFailedRequest(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrResponseBodyTooLarge)
+	}
+	return res.StatusCode >= 500
+}
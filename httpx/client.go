@@ -1,14 +1,27 @@
 package httpx
 
 import (
+	"errors"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"time"
+
+	"github.com/bloom42/stdx-go/log/slogx"
 )
 
+var ErrResponseBodyTooLarge = errors.New("httpx: response body is too large")
+
 // DefaultClient returns an HTTP client with sane defaults
 func DefaultClient() *http.Client {
-	transport := &http.Transport{
+	return &http.Client{
+		Transport: defaultTransport(),
+	}
+}
+
+func defaultTransport() *http.Transport {
+	return &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout:   10 * time.Second,
 			KeepAlive: 60 * time.Second,
@@ -17,8 +30,151 @@ func DefaultClient() *http.Client {
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
+}
+
+type ClientConfig struct {
+	// Transport is the http.RoundTripper that sends the requests.
+	// default: the transport of DefaultClient
+	Transport http.RoundTripper
+	// Timeout is the time limit of a request, retries included. See http.Client.Timeout.
+	// default: 0 (no timeout)
+	Timeout time.Duration
+	Retry   RetryTransportConfig
+	// DisableRetries disables the RetryTransport.
+	DisableRetries bool
+	CircuitBreaker CircuitBreakerTransportConfig
+	// DisableCircuitBreaker disables the CircuitBreakerTransport.
+	DisableCircuitBreaker bool
+	// Hooks are called before and after each attempt of a request. See LoggingClientHooks.
+	Hooks ClientHooks
+	// MaxResponseBodySize is the maximum size in bytes of the bodies of the responses. Reading more returns
+	// ErrResponseBodyTooLarge.
+	// default: 0 (no limit)
+	MaxResponseBodySize int64
+}
+
+// NewClient returns an HTTP client that retries the failed idempotent requests (see RetryTransport), fails
+// fast when a host is down (see CircuitBreakerTransport), calls config.Hooks for each attempt and limits the
+// size of the bodies of the responses.
+func NewClient(config ClientConfig) *http.Client {
+	transport := config.Transport
+	if transport == nil {
+		transport = defaultTransport()
+	}
+
+	if config.MaxResponseBodySize > 0 {
+		transport = &maxResponseBodySizeTransport{next: transport, maxSize: config.MaxResponseBodySize}
+	}
+	if config.Hooks.OnRequest != nil || config.Hooks.OnResponse != nil {
+		transport = &hooksTransport{next: transport, hooks: config.Hooks}
+	}
+	if !config.DisableCircuitBreaker {
+		transport = NewCircuitBreakerTransport(transport, config.CircuitBreaker)
+	}
+	if !config.DisableRetries {
+		transport = NewRetryTransport(transport, config.Retry)
+	}
 
 	return &http.Client{
 		Transport: transport,
+		Timeout:   config.Timeout,
+	}
+}
+
+// ClientHooks are called for each attempt of the requests of a client created with NewClient.
+type ClientHooks struct {
+	// OnRequest is called before sending a request.
+	OnRequest func(req *http.Request)
+	// OnResponse is called when the headers of the response have been received, or when the request failed.
+	OnResponse func(req *http.Request, res *http.Response, err error, duration time.Duration)
+}
+
+// LoggingClientHooks returns ClientHooks that log the requests with the logger of their context (see
+// slogx.FromCtx): successful requests at the Debug level, and failed requests and 5xx responses at the
+// Warn level.
+func LoggingClientHooks() ClientHooks {
+	return ClientHooks{
+		OnResponse: func(req *http.Request, res *http.Response, err error, duration time.Duration) {
+			ctx := req.Context()
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("url", req.URL.Redacted()),
+				slog.Duration("duration", duration),
+			}
+			level := slog.LevelDebug
+			if err != nil {
+				level = slog.LevelWarn
+				attrs = append(attrs, slogx.Err(err))
+			} else {
+				if res.StatusCode >= 500 {
+					level = slog.LevelWarn
+				}
+				attrs = append(attrs, slog.Int("status", res.StatusCode))
+			}
+
+			slogx.FromCtx(ctx).LogAttrs(ctx, level, "http client request", attrs...)
+		},
+	}
+}
+
+type hooksTransport struct {
+	next  http.RoundTripper
+	hooks ClientHooks
+}
+
+func (transport *hooksTransport) RoundTrip(req *http.Request) (res *http.Response, err error) {
+	if transport.hooks.OnRequest != nil {
+		transport.hooks.OnRequest(req)
+	}
+
+	start := time.Now()
+	res, err = transport.next.RoundTrip(req)
+
+	if transport.hooks.OnResponse != nil {
+		transport.hooks.OnResponse(req, res, err, time.Since(start))
+	}
+	return
+}
+
+// maxResponseBodySizeTransport limits the size of the bodies of the responses.
+type maxResponseBodySizeTransport struct {
+	next    http.RoundTripper
+	maxSize int64
+}
+
+func (transport *maxResponseBodySizeTransport) RoundTrip(req *http.Request) (res *http.Response, err error) {
+	res, err = transport.next.RoundTrip(req)
+	if err != nil {
+		return
+	}
+
+	if res.ContentLength > transport.maxSize {
+		res.Body.Close()
+		return nil, ErrResponseBodyTooLarge
+	}
+	res.Body = &limitedBody{ReadCloser: res.Body, remaining: transport.maxSize}
+	return
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (body *limitedBody) Read(data []byte) (n int, err error) {
+	if body.remaining < 0 {
+		return 0, ErrResponseBodyTooLarge
+	}
+
+	// read one more byte to detect bodies that are too large
+	if int64(len(data)) > body.remaining+1 {
+		data = data[:body.remaining+1]
+	}
+	n, err = body.ReadCloser.Read(data)
+	body.remaining -= int64(n)
+	if body.remaining < 0 {
+		n += int(body.remaining)
+		err = ErrResponseBodyTooLarge
 	}
+	return
 }
@@ -0,0 +1,234 @@
+package httpx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var requests atomic.Int64
+	failures := int64(2)
+	retryAfter := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if requests.Add(1) <= failures {
+			w.Header().Set(HeaderRetryAfter, retryAfter)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{
+		Retry:                 RetryTransportConfig{Delay: time.Millisecond},
+		DisableCircuitBreaker: true,
+	})
+
+	send := func(method string, header http.Header) *http.Response {
+		requests.Store(0)
+		req, _ := http.NewRequest(method, server.URL, strings.NewReader("hello"))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		return res
+	}
+
+	res := send(http.MethodPut, nil)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "hello" || requests.Load() != 3 {
+		t.Errorf("PUT: unexpected response: %d %q after %d requests", res.StatusCode, body, requests.Load())
+	}
+
+	res = send(http.MethodPost, nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || requests.Load() != 1 {
+		t.Errorf("POST should not be retried: %d after %d requests", res.StatusCode, requests.Load())
+	}
+
+	res = send(http.MethodPost, http.Header{HeaderIdempotencyKey: {"key"}})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || requests.Load() != 3 {
+		t.Errorf("POST with an idempotency key: %d after %d requests", res.StatusCode, requests.Load())
+	}
+
+	failures = 10
+	res = send(http.MethodGet, nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || requests.Load() != 3 {
+		t.Errorf("GET: expected the last response after 3 attempts: %d after %d requests", res.StatusCode, requests.Load())
+	}
+
+	retryAfter = "3600"
+	res = send(http.MethodGet, nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || requests.Load() != 1 {
+		t.Errorf("GET with a long Retry-After should not be retried: %d after %d requests", res.StatusCode, requests.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value         string
+		expected      time.Duration
+		expectedFound bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 00:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, test := range tests {
+		retryAfter, found := parseRetryAfter(test.value, now)
+		if retryAfter != test.expected || found != test.expectedFound {
+			t.Errorf("%q: expected (%s, %v), got (%s, %v)", test.value, test.expected, test.expectedFound, retryAfter, found)
+		}
+	}
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var requests atomic.Int64
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{
+		DisableRetries: true,
+		CircuitBreaker: CircuitBreakerTransportConfig{FailureThreshold: 3, OpenDuration: 50 * time.Millisecond},
+	})
+
+	get := func() error {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	}
+
+	for range 3 {
+		if err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := get()
+	if !errors.Is(err, ErrCircuitBreakerIsOpen) || requests.Load() != 3 {
+		t.Fatalf("expected ErrCircuitBreakerIsOpen after 3 requests, got: %v after %d requests", err, requests.Load())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	healthy.Store(true)
+	if err = get(); err != nil {
+		t.Errorf("probe request: %v", err)
+	}
+	if err = get(); err != nil {
+		t.Errorf("circuit breaker should be closed: %v", err)
+	}
+}
+
+func TestMaxResponseBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/chunked" {
+			w.Write([]byte("0123456789"))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{MaxResponseBodySize: 10})
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || string(body) != "0123456789" {
+		t.Errorf("body at the limit: unexpected body %q, err: %v", body, err)
+	}
+
+	res, err = client.Get(server.URL + "/chunked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	if !errors.Is(err, ErrResponseBodyTooLarge) {
+		t.Errorf("chunked body over the limit: expected ErrResponseBodyTooLarge, got: %v", err)
+	}
+}
+
+func TestCircuitBreakerTransportHosts(t *testing.T) {
+	failingHosts := map[string]bool{}
+	var next roundTripperFunc = func(req *http.Request) (*http.Response, error) {
+		if failingHosts[req.URL.Host] {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}
+	transport := NewCircuitBreakerTransport(next, CircuitBreakerTransportConfig{
+		FailureThreshold: 1,
+		OpenDuration:     time.Hour,
+		MaxHosts:         2,
+	})
+	get := func(host string) error {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+		res, err := transport.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	// the state of healthy hosts is not kept
+	for i := range 10 {
+		if err := get("healthy" + string(rune('0'+i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(transport.hosts) != 0 {
+		t.Errorf("the state of %d healthy hosts is kept", len(transport.hosts))
+	}
+
+	failingHosts["a"], failingHosts["b"], failingHosts["c"] = true, true, true
+	for _, host := range []string{"a", "b", "c"} {
+		get(host)
+	}
+	if len(transport.hosts) != 2 {
+		t.Errorf("the state of %d hosts is kept, want 2", len(transport.hosts))
+	}
+	if err := get("a"); !errors.Is(err, ErrCircuitBreakerIsOpen) {
+		t.Errorf("a: expected ErrCircuitBreakerIsOpen, got: %v", err)
+	}
+	// the state of c could not be kept, so its requests are sent
+	if err := get("c"); errors.Is(err, ErrCircuitBreakerIsOpen) {
+		t.Errorf("c: the circuit breaker should not be open")
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
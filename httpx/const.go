@@ -24,6 +24,12 @@ const (
 	HeaderRange                   = "Range"
 	HeaderAcceptLanguage          = "Accept-Language"
 	HeaderAcceptRanges            = "Accept-Ranges"
+	HeaderWWWAuthenticate         = "WWW-Authenticate"
+	HeaderAcceptEncoding          = "Accept-Encoding"
+	HeaderVary                    = "Vary"
+	HeaderRetryAfter              = "Retry-After"
+	HeaderAge                     = "Age"
+	HeaderXForwardedFor           = "X-Forwarded-For"
 )
 
 // https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cache-Control
@@ -0,0 +1,237 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/blake3"
+	"github.com/bloom42/stdx-go/crypto/chacha20blake3"
+)
+
+const (
+	// CookieKeySize is the size in bytes of the keys of a CookieCodec
+	CookieKeySize = chacha20blake3.KeySize
+	// DefaultCookieMaxAge is the default maximum age of the cookies of a CookieCodec
+	DefaultCookieMaxAge = 30 * 24 * time.Hour
+	// maxCookieSize is the maximum size of a cookie supported by all the browsers
+	maxCookieSize = 4096
+
+	cookieFormatVersion1 = 1
+	// cookie header: version (1) || key ID (4) || nonce (32)
+	cookieHeaderSize    = 1 + 4 + chacha20blake3.NonceSize
+	cookieKeyIDContext  = "stdx-go/httpx cookie key ID"
+	cookieSubKeyContext = "stdx-go/httpx cookie encryption key"
+)
+
+var (
+	ErrCookieKeyIsNotValid = errors.New("httpx: cookie key must be 32 bytes")
+	ErrCookieIsNotValid    = errors.New("httpx: cookie is not valid")
+	ErrCookieIsExpired     = errors.New("httpx: cookie is expired")
+	ErrCookieIsTooLarge    = errors.New("httpx: cookie is too large")
+)
+
+type CookieCodecConfig struct {
+	// Keys are the keys used to encrypt and authenticate the cookies. The first key is used to encode new
+	// cookies, and all the keys are used to decode cookies, so keys can be rotated by prepending a new key
+	// and removing the oldest one after MaxAge.
+	// Each key must be CookieKeySize random bytes (e.g. crypto.RandBytes(httpx.CookieKeySize)).
+	Keys [][]byte
+	// MaxAge is the maximum age of the cookies. Older cookies are rejected by Decode.
+	// default: DefaultCookieMaxAge
+	MaxAge time.Duration
+	// Path is the path of the cookies.
+	// default: "/"
+	Path   string
+	Domain string
+	// SameSite is the SameSite attribute of the cookies.
+	// default: http.SameSiteLaxMode
+	SameSite http.SameSite
+	// Insecure allows the cookies to be sent over HTTP connections. It should only be used for local
+	// development.
+	Insecure bool
+}
+
+// CookieCodec encodes values in cookies that are encrypted and authenticated with ChaCha20-BLAKE3, so
+// they can't be read or tampered with by clients. The age of the cookies is authenticated too.
+//
+// ChaCha20-BLAKE3 only uses 8 bytes of its nonce for ChaCha20, which is not enough for random nonces, so
+// each cookie is encrypted with a key derived from the key and its whole 32-byte random nonce.
+//
+// Cookies are HttpOnly, Secure (unless config.Insecure is set) and have the SameSite=Lax attribute by
+// default.
+type CookieCodec struct {
+	config CookieCodecConfig
+	keys   []cookieKey
+}
+
+type cookieKey struct {
+	id  [4]byte
+	key []byte
+}
+
+// cipher returns the cipher of the cookies encrypted with nonce: ChaCha20-BLAKE3 with the subkey
+// BLAKE3-derive-key(key || nonce).
+func (key cookieKey) cipher(nonce []byte) cipher.AEAD {
+	keyMaterial := make([]byte, 0, CookieKeySize+len(nonce))
+	keyMaterial = append(keyMaterial, key.key...)
+	keyMaterial = append(keyMaterial, nonce...)
+
+	var subKey [CookieKeySize]byte
+	blake3.DeriveKey(subKey[:], cookieSubKeyContext, keyMaterial)
+	// the size of subKey is valid
+	cipher, _ := chacha20blake3.New(subKey[:])
+	crypto.Zeroize(subKey[:])
+	crypto.Zeroize(keyMaterial)
+	return cipher
+}
+
+func NewCookieCodec(config CookieCodecConfig) (codec *CookieCodec, err error) {
+	if len(config.Keys) == 0 {
+		return nil, ErrCookieKeyIsNotValid
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultCookieMaxAge
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+
+	keys := make([]cookieKey, len(config.Keys))
+	for index, key := range config.Keys {
+		if len(key) != CookieKeySize {
+			return nil, ErrCookieKeyIsNotValid
+		}
+
+		var keyID [32]byte
+		blake3.DeriveKey(keyID[:], cookieKeyIDContext, key)
+		keys[index].id = [4]byte(keyID[:4])
+		keys[index].key = bytes.Clone(key)
+	}
+
+	codec = &CookieCodec{
+		config: config,
+		keys:   keys,
+	}
+	return codec, nil
+}
+
+// Encode encrypts value for the cookie name, which is authenticated so that the value of a cookie can't
+// be used for another cookie.
+//
+// The encoded value has the following format:
+// base64url(version (1) || key ID (4) || nonce (32) || encrypt(issued at (8) || value) || tag (32))
+// where encrypt uses a key derived from the key and the nonce.
+func (codec *CookieCodec) Encode(name string, value []byte) (encoded string, err error) {
+	key := codec.keys[0]
+
+	header := make([]byte, cookieHeaderSize, cookieHeaderSize+8+len(value)+chacha20blake3.TagSize)
+	header[0] = cookieFormatVersion1
+	copy(header[1:5], key.id[:])
+	copy(header[5:], crypto.RandBytes(chacha20blake3.NonceSize))
+
+	plaintext := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(plaintext, uint64(time.Now().Unix()))
+	plaintext = append(plaintext, value...)
+
+	data := key.cipher(header[5:]).Seal(header, header[5:], plaintext, cookieAdditionalData(name, header))
+	encoded = base64.RawURLEncoding.EncodeToString(data)
+	if len(name)+len(encoded) > maxCookieSize {
+		return "", ErrCookieIsTooLarge
+	}
+
+	return encoded, nil
+}
+
+// Decode decrypts and verifies a value produced by Encode for the cookie name.
+func (codec *CookieCodec) Decode(name, encoded string) (value []byte, err error) {
+	if len(encoded) > maxCookieSize {
+		return nil, ErrCookieIsNotValid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(data) < cookieHeaderSize+8+chacha20blake3.TagSize || data[0] != cookieFormatVersion1 {
+		return nil, ErrCookieIsNotValid
+	}
+
+	header := data[:cookieHeaderSize]
+	var key *cookieKey
+	for index := range codec.keys {
+		if [4]byte(header[1:5]) == codec.keys[index].id {
+			key = &codec.keys[index]
+			break
+		}
+	}
+	if key == nil {
+		return nil, ErrCookieIsNotValid
+	}
+
+	plaintext, err := key.cipher(header[5:]).Open(nil, header[5:], data[cookieHeaderSize:], cookieAdditionalData(name, header))
+	if err != nil {
+		return nil, ErrCookieIsNotValid
+	}
+
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(plaintext[:8])), 0)
+	if time.Since(issuedAt) > codec.config.MaxAge {
+		return nil, ErrCookieIsExpired
+	}
+
+	return plaintext[8:], nil
+}
+
+// SetCookie encodes value and sets it in the cookie name of the response.
+func (codec *CookieCodec) SetCookie(w http.ResponseWriter, name string, value []byte) (err error) {
+	encoded, err := codec.Encode(name, value)
+	if err != nil {
+		return
+	}
+
+	cookie := codec.newCookie(name, encoded)
+	cookie.MaxAge = int(codec.config.MaxAge.Seconds())
+	http.SetCookie(w, cookie)
+	return
+}
+
+// Cookie returns the decoded value of the cookie name of the request. It returns http.ErrNoCookie if the
+// request has no such cookie.
+func (codec *CookieCodec) Cookie(req *http.Request, name string) (value []byte, err error) {
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return
+	}
+
+	return codec.Decode(name, cookie.Value)
+}
+
+// DeleteCookie deletes the cookie name in the client.
+func (codec *CookieCodec) DeleteCookie(w http.ResponseWriter, name string) {
+	cookie := codec.newCookie(name, "")
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+func (codec *CookieCodec) newCookie(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     codec.config.Path,
+		Domain:   codec.config.Domain,
+		Secure:   !codec.config.Insecure,
+		HttpOnly: true,
+		SameSite: codec.config.SameSite,
+	}
+}
+
+func cookieAdditionalData(name string, header []byte) []byte {
+	additionalData := make([]byte, 0, len(header)+len(name))
+	additionalData = append(additionalData, header...)
+	additionalData = append(additionalData, name...)
+	return additionalData
+}
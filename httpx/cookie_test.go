@@ -0,0 +1,135 @@
+package httpx
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/chacha20blake3"
+)
+
+func TestCookieCodec(t *testing.T) {
+	oldKey := crypto.RandBytes(CookieKeySize)
+	newKey := crypto.RandBytes(CookieKeySize)
+
+	oldCodec, err := NewCookieCodec(CookieCodecConfig{Keys: [][]byte{oldKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := NewCookieCodec(CookieCodecConfig{Keys: [][]byte{newKey, oldKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := []byte("hello world")
+	encoded, err := codec.Encode("session", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Decode("session", encoded)
+	if err != nil || !bytes.Equal(decoded, value) {
+		t.Errorf("Decode: expected %q, got %q (err: %v)", value, decoded, err)
+	}
+
+	// the value of a cookie can't be used for another cookie
+	_, err = codec.Decode("other", encoded)
+	if !errors.Is(err, ErrCookieIsNotValid) {
+		t.Errorf("Decode with another name: expected ErrCookieIsNotValid, got: %v", err)
+	}
+
+	// cookies encoded with the old key can still be decoded after a rotation
+	encodedWithOldKey, err := oldCodec.Encode("session", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = codec.Decode("session", encodedWithOldKey)
+	if err != nil || !bytes.Equal(decoded, value) {
+		t.Errorf("Decode with the old key: expected %q, got %q (err: %v)", value, decoded, err)
+	}
+	_, err = oldCodec.Decode("session", encoded)
+	if !errors.Is(err, ErrCookieIsNotValid) {
+		t.Errorf("Decode with an unknown key: expected ErrCookieIsNotValid, got: %v", err)
+	}
+
+	tampered := []byte(encoded)
+	tampered[len(tampered)/2] ^= 1
+	_, err = codec.Decode("session", string(tampered))
+	if !errors.Is(err, ErrCookieIsNotValid) {
+		t.Errorf("Decode of a tampered cookie: expected ErrCookieIsNotValid, got: %v", err)
+	}
+
+	codec.config.MaxAge = -time.Second
+	_, err = codec.Decode("session", encoded)
+	if !errors.Is(err, ErrCookieIsExpired) {
+		t.Errorf("Decode of an expired cookie: expected ErrCookieIsExpired, got: %v", err)
+	}
+
+	_, err = NewCookieCodec(CookieCodecConfig{Keys: [][]byte{[]byte("short")}})
+	if !errors.Is(err, ErrCookieKeyIsNotValid) {
+		t.Errorf("NewCookieCodec with a short key: expected ErrCookieKeyIsNotValid, got: %v", err)
+	}
+}
+
+// ChaCha20-BLAKE3 only uses the first 8 bytes of the nonce for ChaCha20, so the cookies whose nonces share
+// these bytes must still be encrypted with different keystreams
+func TestCookieCodecNonces(t *testing.T) {
+	codec, err := NewCookieCodec(CookieCodecConfig{Keys: [][]byte{crypto.RandBytes(CookieKeySize)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := codec.keys[0]
+
+	plaintext := make([]byte, 64)
+	nonce1 := make([]byte, chacha20blake3.NonceSize)
+	nonce2 := make([]byte, chacha20blake3.NonceSize)
+	nonce2[chacha20blake3.NonceSize-1] = 1
+
+	ciphertext1 := key.cipher(nonce1).Seal(nil, nonce1, plaintext, nil)
+	ciphertext2 := key.cipher(nonce2).Seal(nil, nonce2, plaintext, nil)
+	if bytes.Equal(ciphertext1[:len(plaintext)], ciphertext2[:len(plaintext)]) {
+		t.Error("cookies with nonces that differ after the 8th byte are encrypted with the same keystream")
+	}
+
+	_, err = key.cipher(nonce1).Open(nil, nonce1, ciphertext2, nil)
+	if err == nil {
+		t.Error("a cookie should not be decrypted with the key of another nonce")
+	}
+}
+
+func TestCookieCodecSetCookie(t *testing.T) {
+	codec, err := NewCookieCodec(CookieCodecConfig{Keys: [][]byte{crypto.RandBytes(CookieKeySize)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	err = codec.SetCookie(res, "session", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected 1 cookie, got %d", len(cookies))
+	}
+	cookie := cookies[0]
+	if !cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" ||
+		cookie.MaxAge != int(DefaultCookieMaxAge.Seconds()) {
+		t.Errorf("cookie has not the secure defaults: %+v", cookie)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	value, err := codec.Cookie(req, "session")
+	if err != nil || string(value) != "hello" {
+		t.Errorf("Cookie: expected %q, got %q (err: %v)", "hello", value, err)
+	}
+
+	_, err = codec.Encode("session", make([]byte, maxCookieSize))
+	if !errors.Is(err, ErrCookieIsTooLarge) {
+		t.Errorf("Encode of a large value: expected ErrCookieIsTooLarge, got: %v", err)
+	}
+}
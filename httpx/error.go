@@ -15,6 +15,10 @@ func ServerErrorInternal(res http.ResponseWriter) {
 	ServeError(res, "Internal Error\n", http.StatusInternalServerError)
 }
 
+func ServerErrorUnauthorized(res http.ResponseWriter) {
+	ServeError(res, "Unauthorized\n", http.StatusUnauthorized)
+}
+
 // TODO: Do we force close the TCP connection?
 // https://stackoverflow.com/questions/72368886/is-there-a-way-to-drop-an-http-connection-in-golang-without-sending-anything-to
 // https://www.bentasker.co.uk/posts/blog/software-development/golang-net-http-net-http-2-does-not-reliably-close-failed-connections-allowing-attempted-reuse.html
@@ -7,6 +7,8 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// Routes routes requests to chi routers by exact or wildcard host. See Router for host patterns, dynamic
+// hosts and per-host middlewares.
 type Routes map[string]chi.Router
 
 var _ chi.Routes = Routes{}
@@ -1,6 +1,12 @@
 package hostrouter
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
 
 func Test_getWildcardHost(t *testing.T) {
 	type args struct {
@@ -23,3 +29,159 @@ func Test_getWildcardHost(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter(t *testing.T) {
+	var providerLookups atomic.Int64
+	provider := NewCachedHostProvider(HostProviderFunc(func(ctx context.Context, host string) (http.Handler, error) {
+		providerLookups.Add(1)
+		if host == "shop.customer.com" {
+			return testHostHandler("customer"), nil
+		}
+		return nil, nil
+	}), CachedHostProviderConfig{})
+	defer provider.Stop()
+
+	router := NewRouter(RouterConfig{
+		Provider: provider,
+		Fallback: testHostHandler("fallback"),
+	})
+	router.Map("example.com", testHostHandler("exact"), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Middleware", "example.com")
+			next.ServeHTTP(w, req)
+		})
+	})
+	router.Map("*.static.example.com", testHostHandler("wildcard"))
+	router.Map("{tenant}.example.com", testHostHandler("tenant"))
+	router.Map("{region:eu|us}-{tenant}.api.example.com", testHostHandler("api"))
+
+	tests := []struct {
+		host               string
+		expectedBody       string
+		expectedMiddleware string
+	}{
+		{"example.com", "exact  ", "example.com"},
+		{"Example.com:8080", "exact  ", "example.com"},
+		{"cdn.static.example.com", "wildcard  ", ""},
+		{"acme.example.com", "tenant acme ", ""},
+		{"acme.example.com.", "tenant acme ", ""},
+		{"eu-acme.api.example.com", "api acme eu", ""},
+		{"asia-acme.api.example.com", "fallback  ", ""},
+		{"a.b.example.com", "fallback  ", ""},
+		{"shop.customer.com", "customer  ", ""},
+		{"shop.customer.com", "customer  ", ""},
+		{"unknown.com", "fallback  ", ""},
+		{"unknown.com", "fallback  ", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = test.host
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		if res.Body.String() != test.expectedBody {
+			t.Errorf("%s: expected %q, got %q", test.host, test.expectedBody, res.Body.String())
+		}
+		if middleware := res.Header().Get("X-Middleware"); middleware != test.expectedMiddleware {
+			t.Errorf("%s: expected middleware %q, got %q", test.host, test.expectedMiddleware, middleware)
+		}
+	}
+
+	// each of the 4 hosts that are not mapped is looked up once
+	if providerLookups.Load() != 4 {
+		t.Errorf("expected 4 provider lookups, got %d", providerLookups.Load())
+	}
+
+	router.Unmap("{tenant}.example.com")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "acme.example.com"
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	if res.Body.String() != "fallback  " {
+		t.Errorf("unmapped pattern: expected the fallback, got %q", res.Body.String())
+	}
+}
+
+func TestCompileHostPattern(t *testing.T) {
+	pattern, err := compileHostPattern("{id:[0-9]{4}}.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pattern.regexp.MatchString("1234.example.com") || pattern.regexp.MatchString("123.example.com") {
+		t.Errorf("unexpected regexp: %s", pattern.regexp)
+	}
+
+	for _, invalidPattern := range []string{"{tenant.example.com", "{}.example.com", "{tenant:(a|b)}.example.com", "{tenant:[}.example.com"} {
+		if _, err = compileHostPattern(invalidPattern); err == nil {
+			t.Errorf("%s: expected an error", invalidPattern)
+		}
+	}
+}
+
+func TestLowercaseHostPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"Example.COM", "example.com"},
+		{"{Tenant}.Example.com", "{Tenant}.example.com"},
+		{"{code:\\D{2}}-App.Example.com", "{code:\\D{2}}-app.example.com"},
+		{"{Tenant.Example.com", "{Tenant.Example.com"},
+	}
+
+	for _, test := range tests {
+		if lowercasePattern := lowercaseHostPattern(test.pattern); lowercasePattern != test.expected {
+			t.Errorf("lowercaseHostPattern(%q) = %q, want %q", test.pattern, lowercasePattern, test.expected)
+		}
+	}
+
+	// the regexp of the parameter must not be lowercased: \D matches non-digits while \d matches digits
+	router := NewRouter(RouterConfig{})
+	router.Map("{code:\\D+}.Example.COM", testHostHandler("code"))
+	for host, expectedStatus := range map[string]int{"abc.example.com": http.StatusOK, "123.example.com": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		if res.Code != expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", host, expectedStatus, res.Code)
+		}
+	}
+}
+
+func TestCachedHostProviderCanceledContext(t *testing.T) {
+	lookupStarted := make(chan struct{})
+	releaseLookup := make(chan struct{})
+	provider := NewCachedHostProvider(HostProviderFunc(func(ctx context.Context, host string) (http.Handler, error) {
+		close(lookupStarted)
+		<-releaseLookup
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return testHostHandler("customer"), nil
+	}), CachedHostProviderConfig{})
+	defer provider.Stop()
+
+	// the lookup is shared with the other requests for the same host, so it must complete even if the
+	// request that started it is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-lookupStarted
+		cancel()
+		close(releaseLookup)
+	}()
+	handler, err := provider.Handler(ctx, "shop.customer.com")
+	if err != nil {
+		t.Fatalf("lookup failed with the canceled context: %v", err)
+	}
+	if handler == nil {
+		t.Error("expected the handler of the host")
+	}
+}
+
+func testHostHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(name + " " + Param(req.Context(), "tenant") + " " + Param(req.Context(), "region")))
+	})
+}
@@ -0,0 +1,117 @@
+package hostrouter
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/bloom42/stdx-go/memorycache"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultCachedHostProviderTTL         = time.Minute
+	DefaultCachedHostProviderNegativeTTL = 10 * time.Second
+	DefaultCachedHostProviderCapacity    = 10_000
+)
+
+// HostProvider looks up the handlers of hosts at request time (e.g. the custom domains of customers stored
+// in a database).
+type HostProvider interface {
+	// Handler returns the handler of host, or nil if the host is not known. host is lowercase and has no
+	// port.
+	Handler(ctx context.Context, host string) (http.Handler, error)
+}
+
+// HostProviderFunc is an adapter to use ordinary functions as HostProviders.
+type HostProviderFunc func(ctx context.Context, host string) (http.Handler, error)
+
+func (fn HostProviderFunc) Handler(ctx context.Context, host string) (http.Handler, error) {
+	return fn(ctx, host)
+}
+
+type CachedHostProviderConfig struct {
+	// TTL is the duration for which the handlers of the known hosts are cached.
+	// default: DefaultCachedHostProviderTTL
+	TTL time.Duration
+	// NegativeTTL is the duration for which the unknown hosts are cached, so that requests for random hosts
+	// don't all hit the underlying provider.
+	// default: DefaultCachedHostProviderNegativeTTL
+	NegativeTTL time.Duration
+	// Capacity is the maximum number of hosts in the cache.
+	// default: DefaultCachedHostProviderCapacity
+	Capacity uint64
+}
+
+// CachedHostProvider caches the results of a HostProvider in memory. Concurrent lookups of the same host
+// are deduplicated, and errors are not cached.
+type CachedHostProvider struct {
+	provider    HostProvider
+	config      CachedHostProviderConfig
+	cache       *memorycache.Cache[string, http.Handler]
+	lookupGroup singleflight.Group
+}
+
+var _ HostProvider = (*CachedHostProvider)(nil)
+
+func NewCachedHostProvider(provider HostProvider, config CachedHostProviderConfig) *CachedHostProvider {
+	if config.TTL == 0 {
+		config.TTL = DefaultCachedHostProviderTTL
+	}
+	if config.NegativeTTL == 0 {
+		config.NegativeTTL = DefaultCachedHostProviderNegativeTTL
+	}
+	if config.Capacity == 0 {
+		config.Capacity = DefaultCachedHostProviderCapacity
+	}
+
+	cache := memorycache.New(
+		memorycache.WithCapacity[string, http.Handler](config.Capacity),
+		// entries must expire even if they are frequently used, so that changes are picked up
+		memorycache.WithDisableTouchOnHit[string, http.Handler](),
+	)
+
+	return &CachedHostProvider{
+		provider: provider,
+		config:   config,
+		cache:    cache,
+	}
+}
+
+func (cachedProvider *CachedHostProvider) Handler(ctx context.Context, host string) (http.Handler, error) {
+	if item := cachedProvider.cache.Get(host); item != nil {
+		return item.Value(), nil
+	}
+
+	// the lookup is shared by concurrent requests, so it must not be canceled with the context of the
+	// first request
+	result, err, _ := cachedProvider.lookupGroup.Do(host, func() (any, error) {
+		handler, err := cachedProvider.provider.Handler(context.WithoutCancel(ctx), host)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl := cachedProvider.config.TTL
+		if handler == nil {
+			ttl = cachedProvider.config.NegativeTTL
+		}
+		cachedProvider.cache.Set(host, handler, ttl)
+		return handler, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	handler, _ := result.(http.Handler)
+	return handler, nil
+}
+
+// Invalidate removes host from the cache, e.g. after its configuration has been updated.
+func (cachedProvider *CachedHostProvider) Invalidate(host string) {
+	cachedProvider.cache.Delete(normalizeHost(host))
+}
+
+// Stop stops the goroutine that removes the expired entries from the cache.
+func (cachedProvider *CachedHostProvider) Stop() {
+	cachedProvider.cache.Stop()
+}
@@ -0,0 +1,279 @@
+package hostrouter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/log/slogx"
+)
+
+type paramsContextKey struct{}
+
+type RouterConfig struct {
+	// Provider, if not nil, is used to look up the handlers of the hosts that are not mapped with
+	// Router.Map, at request time.
+	Provider HostProvider
+	// Fallback, if not nil, serves the requests for the hosts that are not mapped and that are not found
+	// by Provider.
+	// default: a 404 Not Found error
+	Fallback http.Handler
+}
+
+// Router routes requests based on their host, which can be matched:
+//   - exactly (e.g. example.com);
+//   - with a wildcard for the first label (e.g. *.example.com);
+//   - with a pattern (e.g. {tenant}.example.com or {tenant:[a-z]+}-app.example.com). The values captured
+//     by the pattern are available with Param;
+//   - at request time by a HostProvider (e.g. for the custom domains of customers).
+//
+// Hosts are matched in this order, and patterns in the order they have been mapped.
+// The port of the host is ignored. Like Routes, the host is read from the X-Forwarded-Host and Forwarded
+// headers if they are present, so they need to be set by a trusted reverse proxy.
+type Router struct {
+	config RouterConfig
+
+	mutex    sync.RWMutex
+	hosts    map[string]http.Handler
+	patterns []hostPattern
+}
+
+type hostPattern struct {
+	pattern    string
+	regexp     *regexp.Regexp
+	paramNames []string
+	handler    http.Handler
+}
+
+var _ http.Handler = (*Router)(nil)
+
+func NewRouter(config RouterConfig) *Router {
+	return &Router{
+		config: config,
+		hosts:  map[string]http.Handler{},
+	}
+}
+
+// Map routes the requests for host to handler, wrapped with middlewares which are applied in order, only
+// for this host. host can be an exact host, a wildcard host or a pattern (see Router).
+// Hosts are case-insensitive: the regexps of the parameters of patterns are matched against the lowercase
+// host, so they should only match lowercase characters.
+// Map panics if host is not a valid pattern.
+func (router *Router) Map(host string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) {
+	host = lowercaseHostPattern(host)
+	for i := len(middlewares) - 1; i >= 0; i -= 1 {
+		handler = middlewares[i](handler)
+	}
+
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	if !strings.Contains(host, "{") {
+		router.hosts[host] = handler
+		return
+	}
+
+	pattern, err := compileHostPattern(host)
+	if err != nil {
+		panic(err)
+	}
+	pattern.handler = handler
+
+	for index := range router.patterns {
+		if router.patterns[index].pattern == host {
+			router.patterns[index] = pattern
+			return
+		}
+	}
+	router.patterns = append(router.patterns, pattern)
+}
+
+// Unmap removes the handler of host, which must be the same value as the one passed to Map.
+func (router *Router) Unmap(host string) {
+	host = lowercaseHostPattern(host)
+
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	delete(router.hosts, host)
+	for index := range router.patterns {
+		if router.patterns[index].pattern == host {
+			router.patterns = append(router.patterns[:index], router.patterns[index+1:]...)
+			return
+		}
+	}
+}
+
+func (router *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := normalizeHost(requestHost(req))
+
+	handler, params := router.match(host)
+	if params != nil {
+		req = req.WithContext(context.WithValue(req.Context(), paramsContextKey{}, params))
+	}
+
+	if handler == nil && router.config.Provider != nil {
+		var err error
+		handler, err = router.config.Provider.Handler(req.Context(), host)
+		if err != nil {
+			slogx.FromCtx(req.Context()).Error("hostrouter: looking up host", slog.String("host", host), slogx.Err(err))
+			httpx.ServerErrorInternal(w)
+			return
+		}
+	}
+
+	if handler == nil {
+		handler = router.config.Fallback
+	}
+	if handler == nil {
+		httpx.ServerErrorNotFound(w)
+		return
+	}
+
+	handler.ServeHTTP(w, req)
+}
+
+func (router *Router) match(host string) (handler http.Handler, params map[string]string) {
+	router.mutex.RLock()
+	defer router.mutex.RUnlock()
+
+	if handler = router.hosts[host]; handler != nil {
+		return
+	}
+	if handler = router.hosts[getWildcardHost(host)]; handler != nil {
+		return
+	}
+
+	for _, pattern := range router.patterns {
+		matches := pattern.regexp.FindStringSubmatch(host)
+		if matches == nil {
+			continue
+		}
+		params = make(map[string]string, len(pattern.paramNames))
+		for index, name := range pattern.paramNames {
+			params[name] = matches[index+1]
+		}
+		return pattern.handler, params
+	}
+
+	return nil, nil
+}
+
+// Param returns the value captured by the parameter name of the host pattern that matched the request, or
+// an empty string if there is no such parameter.
+func Param(ctx context.Context, name string) string {
+	params, _ := ctx.Value(paramsContextKey{}).(map[string]string)
+	return params[name]
+}
+
+// compileHostPattern compiles a pattern where each {name} parameter matches a part of a label, and each
+// {name:regexp} parameter matches regexp, which can't contain capturing groups.
+func compileHostPattern(pattern string) (hostPattern hostPattern, err error) {
+	hostPattern.pattern = pattern
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	remaining := pattern
+	for remaining != "" {
+		start := strings.IndexByte(remaining, '{')
+		if start < 0 {
+			expr.WriteString(regexp.QuoteMeta(remaining))
+			break
+		}
+		// the regexp of a parameter can contain braces, e.g. {id:[0-9]{4}}
+		end := -1
+		depth := 0
+		for index := start; index < len(remaining) && end < 0; index += 1 {
+			switch remaining[index] {
+			case '{':
+				depth += 1
+			case '}':
+				depth -= 1
+				if depth == 0 {
+					end = index
+				}
+			}
+		}
+		if end < 0 {
+			err = fmt.Errorf("hostrouter: unclosed parameter in pattern %q", pattern)
+			return
+		}
+
+		expr.WriteString(regexp.QuoteMeta(remaining[:start]))
+		name, paramExpr, hasExpr := strings.Cut(remaining[start+1:end], ":")
+		if name == "" {
+			err = fmt.Errorf("hostrouter: empty parameter name in pattern %q", pattern)
+			return
+		}
+		if !hasExpr {
+			paramExpr = "[^.]+"
+		}
+		expr.WriteString("(" + paramExpr + ")")
+		hostPattern.paramNames = append(hostPattern.paramNames, name)
+
+		remaining = remaining[end+1:]
+	}
+	expr.WriteString("$")
+
+	hostPattern.regexp, err = regexp.Compile(expr.String())
+	if err != nil {
+		err = fmt.Errorf("hostrouter: compiling pattern %q: %w", pattern, err)
+		return
+	}
+	if hostPattern.regexp.NumSubexp() != len(hostPattern.paramNames) {
+		err = fmt.Errorf("hostrouter: the parameters of pattern %q can't contain capturing groups", pattern)
+		return
+	}
+
+	return
+}
+
+// lowercaseHostPattern lowercases the parts of pattern that are outside of parameters, so that the names
+// and the regexps of the parameters (e.g. {id:\w+}) are not modified.
+func lowercaseHostPattern(pattern string) string {
+	var lowercasePattern strings.Builder
+	lowercasePattern.Grow(len(pattern))
+
+	depth := 0
+	literalStart := 0
+	for index := 0; index < len(pattern); index += 1 {
+		switch pattern[index] {
+		case '{':
+			if depth == 0 {
+				lowercasePattern.WriteString(strings.ToLower(pattern[literalStart:index]))
+				literalStart = index
+			}
+			depth += 1
+		case '}':
+			if depth > 0 {
+				depth -= 1
+				if depth == 0 {
+					lowercasePattern.WriteString(pattern[literalStart : index+1])
+					literalStart = index + 1
+				}
+			}
+		}
+	}
+	// an unclosed parameter is kept as is, and rejected by compileHostPattern
+	if depth == 0 {
+		lowercasePattern.WriteString(strings.ToLower(pattern[literalStart:]))
+	} else {
+		lowercasePattern.WriteString(pattern[literalStart:])
+	}
+
+	return lowercasePattern.String()
+}
+
+// normalizeHost lowercases host and removes its port and trailing dot.
+func normalizeHost(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,299 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bloom42/stdx-go/log/slogx"
+	"github.com/bloom42/stdx-go/schema"
+	"github.com/bloom42/stdx-go/validate"
+)
+
+// DefaultMaxRequestBodySize is the default maximum size of the request bodies decoded by DecodeJSON and
+// JSONHandler.
+const DefaultMaxRequestBodySize = 1 << 20 // 1 MiB
+
+const (
+	MediaTypeForm          = "application/x-www-form-urlencoded"
+	MediaTypeMultipartForm = "multipart/form-data"
+)
+
+// the decoder is safe for concurrent use and caches the metadata of the decoded types
+var schemaDecoder = newSchemaDecoder()
+
+func newSchemaDecoder() *schema.Decoder {
+	decoder := schema.NewDecoder()
+	// query strings and forms often contain extra parameters (e.g. utm_source or csrf_token)
+	decoder.IgnoreUnknownKeys(true)
+	return decoder
+}
+
+type JSONHandlerConfig struct {
+	// MaxBodySize is the maximum size in bytes of the request bodies.
+	// default: DefaultMaxRequestBodySize
+	MaxBodySize int64
+	// StatusCode is the status code of the successful responses.
+	// default: http.StatusOK
+	StatusCode int
+}
+
+// JSONHandler adapts fn to an http.Handler that decodes the request into a value of type Input, validates
+// it with the validate package, calls fn and encodes its result in JSON.
+//
+// The input is decoded from the query string for GET, HEAD and DELETE requests (see DecodeQuery), from
+// the form for form requests (see DecodeForm), and from the JSON body otherwise (see DecodeJSON).
+//
+// If fn returns a *Problem, it is served with ServeProblem. Other errors are logged and served as a 500
+// Internal Server Error problem, without their message which may contain sensitive details.
+func JSONHandler[Input, Output any](config JSONHandlerConfig, fn func(ctx context.Context, input Input) (Output, error)) http.Handler {
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultMaxRequestBodySize
+	}
+	if config.StatusCode == 0 {
+		config.StatusCode = http.StatusOK
+	}
+
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		var input Input
+		var err error
+
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			err = DecodeQuery(req, &input)
+		default:
+			if isFormRequest(req) {
+				req.Body = http.MaxBytesReader(w, req.Body, config.MaxBodySize)
+				err = DecodeForm(req, &input)
+			} else {
+				err = DecodeJSON(w, req, &input, config.MaxBodySize)
+			}
+		}
+		if err == nil {
+			err = Validate(input)
+		}
+		if err != nil {
+			serveHandlerError(w, req, err)
+			return
+		}
+
+		output, err := fn(ctx, input)
+		if err != nil {
+			serveHandlerError(w, req, err)
+			return
+		}
+
+		ServeJSON(w, output, config.StatusCode)
+	}
+	return http.HandlerFunc(handler)
+}
+
+// ServeJSON encodes data in JSON and writes it with the given status code.
+func ServeJSON(w http.ResponseWriter, data any, statusCode int) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		ServeProblem(w, NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+
+	w.Header().Set(HeaderContentType, MediaTypeJson)
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// DecodeJSON decodes the JSON body of req into dst. The body must not be larger than maxBodySize bytes
+// (DefaultMaxRequestBodySize if maxBodySize is 0), must contain a single JSON value and must not contain
+// fields that are not in dst.
+//
+// The returned errors are *Problem errors that can be served with ServeProblem.
+func DecodeJSON(w http.ResponseWriter, req *http.Request, dst any, maxBodySize int64) error {
+	if maxBodySize == 0 {
+		maxBodySize = DefaultMaxRequestBodySize
+	}
+
+	contentType := req.Header.Get(HeaderContentType)
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != MediaTypeJson && !strings.HasSuffix(mediaType, "+json")) {
+			return NewProblem(http.StatusUnsupportedMediaType, "Content-Type must be "+MediaTypeJson)
+		}
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil {
+		// the body must contain a single JSON value
+		if decoder.Decode(&struct{}{}) != io.EOF {
+			err = errors.New("trailing data")
+		}
+	}
+	if err != nil {
+		return jsonDecodingProblem(err)
+	}
+
+	return nil
+}
+
+// DecodeQuery decodes the query string of req into dst, which must be a pointer to a struct, with the
+// schema package. Unknown parameters are ignored.
+//
+// The returned errors are *Problem errors that can be served with ServeProblem.
+func DecodeQuery(req *http.Request, dst any) error {
+	return decodeSchema(dst, req.URL.Query())
+}
+
+// DecodeForm decodes the form of req (see http.Request.ParseForm) into dst, which must be a pointer to a
+// struct, with the schema package. Unknown fields are ignored.
+//
+// The returned errors are *Problem errors that can be served with ServeProblem.
+func DecodeForm(req *http.Request, dst any) error {
+	var err error
+	if strings.HasPrefix(req.Header.Get(HeaderContentType), MediaTypeMultipartForm) {
+		err = req.ParseMultipartForm(DefaultMaxRequestBodySize)
+	} else {
+		err = req.ParseForm()
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return NewProblem(http.StatusRequestEntityTooLarge, "request body is too large")
+		}
+		return NewProblem(http.StatusBadRequest, "form is not valid")
+	}
+
+	return decodeSchema(dst, req.Form)
+}
+
+// Validate validates input with the validate package if it is a struct or a pointer to a struct.
+// The returned errors are *Problem errors with the details of the invalid fields.
+func Validate(input any) error {
+	value := reflect.ValueOf(input)
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	_, err := validate.ValidateStruct(input)
+	if err == nil {
+		return nil
+	}
+
+	problem := NewProblem(http.StatusUnprocessableEntity, "request is not valid")
+	problem.Errors = appendValidationErrors(problem.Errors, err)
+	sortProblemFieldErrors(problem.Errors)
+	return problem
+}
+
+func appendValidationErrors(fieldErrors []ProblemFieldError, err error) []ProblemFieldError {
+	switch err := err.(type) {
+	case validate.Errors:
+		for _, nestedErr := range err {
+			fieldErrors = appendValidationErrors(fieldErrors, nestedErr)
+		}
+	case validate.Error:
+		fieldErrors = append(fieldErrors, ProblemFieldError{
+			Field:  strings.Join(append(err.Path, err.Name), "."),
+			Detail: err.Err.Error(),
+		})
+	default:
+		fieldErrors = append(fieldErrors, ProblemFieldError{Detail: err.Error()})
+	}
+	return fieldErrors
+}
+
+func decodeSchema(dst any, values map[string][]string) error {
+	err := schemaDecoder.Decode(dst, values)
+	if err == nil {
+		return nil
+	}
+
+	problem := NewProblem(http.StatusBadRequest, "request is not valid")
+	var multiErr schema.MultiError
+	if !errors.As(err, &multiErr) {
+		problem.Detail = err.Error()
+		return problem
+	}
+
+	for key, fieldErr := range multiErr {
+		detail := "value is not valid"
+		var emptyErr schema.EmptyFieldError
+		if errors.As(fieldErr, &emptyErr) {
+			detail = "value is required"
+		}
+		problem.Errors = append(problem.Errors, ProblemFieldError{Field: key, Detail: detail})
+	}
+	sortProblemFieldErrors(problem.Errors)
+	return problem
+}
+
+func jsonDecodingProblem(err error) *Problem {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return NewProblem(http.StatusRequestEntityTooLarge, "request body is too large")
+	case errors.Is(err, io.EOF):
+		return NewProblem(http.StatusBadRequest, "request body is empty")
+	case errors.As(err, &syntaxErr):
+		return NewProblem(http.StatusBadRequest, fmt.Sprintf("request body contains malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewProblem(http.StatusBadRequest, "request body contains malformed JSON")
+	case errors.As(err, &typeErr):
+		problem := NewProblem(http.StatusBadRequest, "request body is not valid")
+		problem.Errors = []ProblemFieldError{{
+			Field:  typeErr.Field,
+			Detail: "value must be of type " + typeErr.Type.String(),
+		}}
+		return problem
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json doesn't export a type for this error
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		problem := NewProblem(http.StatusBadRequest, "request body is not valid")
+		problem.Errors = []ProblemFieldError{{Field: field, Detail: "field is unknown"}}
+		return problem
+	default:
+		return NewProblem(http.StatusBadRequest, "request body is not valid: "+err.Error())
+	}
+}
+
+func serveHandlerError(w http.ResponseWriter, req *http.Request, err error) {
+	var problem *Problem
+	if !errors.As(err, &problem) {
+		slogx.FromCtx(req.Context()).Error("httpx.JSONHandler: handler returned an error", slogx.Err(err))
+		problem = NewProblem(http.StatusInternalServerError, "")
+	}
+	if problem.Instance == "" {
+		problemWithInstance := *problem
+		problemWithInstance.Instance = req.URL.Path
+		problem = &problemWithInstance
+	}
+	ServeProblem(w, problem)
+}
+
+func isFormRequest(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(HeaderContentType))
+	return mediaType == MediaTypeForm || mediaType == MediaTypeMultipartForm
+}
+
+func sortProblemFieldErrors(fieldErrors []ProblemFieldError) {
+	sort.SliceStable(fieldErrors, func(i, j int) bool {
+		return fieldErrors[i].Field < fieldErrors[j].Field
+	})
+}
@@ -0,0 +1,126 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testJSONInput struct {
+	Name  string `json:"name" schema:"name" valid:"required"`
+	Email string `json:"email" schema:"email" valid:"email"`
+	Age   int    `json:"age" schema:"age"`
+}
+
+type testJSONOutput struct {
+	Greeting string `json:"greeting"`
+}
+
+var errTestNotFound = &Problem{Status: http.StatusNotFound, Detail: "user not found"}
+
+func TestJSONHandler(t *testing.T) {
+	handler := JSONHandler(JSONHandlerConfig{MaxBodySize: 128}, func(ctx context.Context, input testJSONInput) (testJSONOutput, error) {
+		switch input.Name {
+		case "nobody":
+			return testJSONOutput{}, errTestNotFound
+		case "crash":
+			return testJSONOutput{}, errors.New("database password is hunter2")
+		}
+		return testJSONOutput{Greeting: "hello " + input.Name}, nil
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedFields []string
+	}{
+		{"valid JSON", http.MethodPost, "/", MediaTypeJson, `{"name":"ada","email":"ada@example.com"}`, http.StatusOK, nil},
+		{"query", http.MethodGet, "/?name=ada&utm_source=test", "", "", http.StatusOK, nil},
+		{"form", http.MethodPost, "/", MediaTypeForm, "name=ada&csrf_token=x", http.StatusOK, nil},
+		{"unknown field", http.MethodPost, "/", MediaTypeJson, `{"name":"ada","admin":true}`, http.StatusBadRequest, []string{"admin"}},
+		{"wrong type", http.MethodPost, "/", MediaTypeJson, `{"name":"ada","age":"old"}`, http.StatusBadRequest, []string{"age"}},
+		{"malformed", http.MethodPost, "/", MediaTypeJson, `{"name":`, http.StatusBadRequest, nil},
+		{"trailing data", http.MethodPost, "/", MediaTypeJson, `{"name":"ada"} {}`, http.StatusBadRequest, nil},
+		{"empty body", http.MethodPost, "/", MediaTypeJson, "", http.StatusBadRequest, nil},
+		{"too large", http.MethodPost, "/", MediaTypeJson, `{"name":"` + strings.Repeat("a", 200) + `"}`, http.StatusRequestEntityTooLarge, nil},
+		{"unsupported media type", http.MethodPost, "/", MediaTypeXml, "<name>ada</name>", http.StatusUnsupportedMediaType, nil},
+		{"not valid", http.MethodPost, "/", MediaTypeJson, `{"email":"nope"}`, http.StatusUnprocessableEntity, []string{"email", "name"}},
+		{"query conversion", http.MethodGet, "/?name=ada&age=old", "", "", http.StatusBadRequest, []string{"age"}},
+		{"problem", http.MethodPost, "/", MediaTypeJson, `{"name":"nobody"}`, http.StatusNotFound, nil},
+		{"internal error", http.MethodPost, "/", MediaTypeJson, `{"name":"crash"}`, http.StatusInternalServerError, nil},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set(HeaderContentType, test.contentType)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		if res.Code != test.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.expectedStatus, res.Code, res.Body.String())
+			continue
+		}
+
+		if res.Code == http.StatusOK {
+			var output testJSONOutput
+			err := json.Unmarshal(res.Body.Bytes(), &output)
+			if err != nil || output.Greeting != "hello ada" {
+				t.Errorf("%s: unexpected response: %s", test.name, res.Body.String())
+			}
+			continue
+		}
+
+		if contentType := res.Header().Get(HeaderContentType); contentType != MediaTypeProblemJson {
+			t.Errorf("%s: expected Content-Type %s, got %s", test.name, MediaTypeProblemJson, contentType)
+		}
+		var problem Problem
+		err := json.Unmarshal(res.Body.Bytes(), &problem)
+		if err != nil {
+			t.Errorf("%s: decoding problem: %v", test.name, err)
+			continue
+		}
+		if problem.Status != test.expectedStatus || problem.Title != http.StatusText(test.expectedStatus) || problem.Instance != "/" {
+			t.Errorf("%s: unexpected problem: %+v", test.name, problem)
+		}
+		if strings.Contains(problem.Detail, "hunter2") {
+			t.Errorf("%s: the details of internal errors must not be served", test.name)
+		}
+		fields := make([]string, 0, len(problem.Errors))
+		for _, fieldErr := range problem.Errors {
+			fields = append(fields, fieldErr.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(test.expectedFields, ",") {
+			t.Errorf("%s: expected field errors %v, got %+v", test.name, test.expectedFields, problem.Errors)
+		}
+	}
+
+	if errTestNotFound.Instance != "" || errTestNotFound.Title != "" {
+		t.Errorf("shared problem should not be modified: %+v", errTestNotFound)
+	}
+}
+
+func TestDecodeForm(t *testing.T) {
+	form := url.Values{"name": {"ada"}, "age": {"36"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(HeaderContentType, MediaTypeForm)
+
+	var input testJSONInput
+	err := DecodeForm(req, &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.Name != "ada" || input.Age != 36 {
+		t.Errorf("unexpected input: %+v", input)
+	}
+}
@@ -0,0 +1,192 @@
+package middlewarex
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"time"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/log/slogx"
+)
+
+type AccessLogConfig struct {
+	// TrustedProxies are the networks of the reverse proxies allowed to set the X-Forwarded-For header.
+	// See ClientIP.
+	TrustedProxies []netip.Prefix
+	// SampleRate is the fraction, between 0 and 1, of the requests that are logged. Requests that
+	// failed with a 5xx status code are always logged. A negative value logs only these requests, and
+	// values greater than 1 are clamped to 1.
+	// default: 1
+	SampleRate float64
+	// SkipPaths are the patterns (see path.Match) of the paths of the requests that are not logged.
+	// e.g. /health or /assets/*
+	SkipPaths []string
+	// Skip, if not nil, is called to decide if a request should not be logged.
+	Skip func(req *http.Request) bool
+}
+
+// AccessLog logs one record for each completed request with the logger of the context of the request
+// (see slogx.FromCtx), with its status, size and duration and the IP address of the client.
+// It should be used after SetLogger, which adds the method, path and ID of the request to the logger.
+func AccessLog(config AccessLogConfig) func(next http.Handler) http.Handler {
+	if config.SampleRate == 0 {
+		config.SampleRate = 1
+	}
+	config.SampleRate = min(max(config.SampleRate, 0), 1)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if config.Skip != nil && config.Skip(req) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			for _, skipPath := range config.SkipPaths {
+				if matched, _ := path.Match(skipPath, req.URL.Path); matched {
+					next.ServeHTTP(w, req)
+					return
+				}
+			}
+
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: w}
+
+			defer func() {
+				rvr := recover()
+				if rvr != nil && !recorder.wroteHeader {
+					// the panic is handled by an outer middleware such as Recoverer
+					recorder.status = http.StatusInternalServerError
+				}
+
+				logAccess(config, req, recorder, time.Since(start))
+
+				if rvr != nil {
+					panic(rvr)
+				}
+			}()
+
+			next.ServeHTTP(recorder, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func logAccess(config AccessLogConfig, req *http.Request, recorder *responseRecorder, duration time.Duration) {
+	status := recorder.status
+	if status == 0 {
+		// nothing has been written
+		status = http.StatusOK
+	}
+
+	level := slog.LevelInfo
+	if status >= 500 {
+		level = slog.LevelError
+	} else if config.SampleRate < 1 && rand.Float64() >= config.SampleRate {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 8)
+	attrs = append(attrs,
+		slog.Int("status", status),
+		slog.Int64("bytes", recorder.bytes),
+		slog.Duration("duration", duration),
+		slog.String("remote_ip", ClientIP(req, config.TrustedProxies).String()),
+		slog.String("user_agent", req.UserAgent()),
+		slog.String("proto", req.Proto),
+	)
+	if proxyAddress, found := proxyAddr(req); found {
+		attrs = append(attrs, slog.String("proxy_addr", proxyAddress))
+	}
+	if referer := req.Header.Get(httpx.HeaderReferer); referer != "" {
+		attrs = append(attrs, slog.String("referer", referer))
+	}
+	if config.SampleRate < 1 {
+		attrs = append(attrs, slog.Float64("sample_rate", config.SampleRate))
+	}
+
+	ctx := req.Context()
+	slogx.FromCtx(ctx).LogAttrs(ctx, level, "http request", attrs...)
+}
+
+// responseRecorder records the status code and the number of bytes of a response.
+// It forwards http.Flusher, http.Hijacker and io.ReaderFrom to the underlying http.ResponseWriter,
+// which is also available to http.ResponseController with Unwrap.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// ensure that responseRecorder implements the optional interfaces of http.ResponseWriter
+var (
+	_ http.Flusher  = (*responseRecorder)(nil)
+	_ http.Hijacker = (*responseRecorder)(nil)
+	_ io.ReaderFrom = (*responseRecorder)(nil)
+)
+
+func (recorder *responseRecorder) WriteHeader(statusCode int) {
+	// informational responses (e.g. 103 Early Hints) are followed by the final response
+	if !recorder.wroteHeader && (statusCode >= 200 || statusCode == http.StatusSwitchingProtocols) {
+		recorder.status = statusCode
+		recorder.wroteHeader = true
+	}
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (n int, err error) {
+	recorder.markHeaderWritten()
+	n, err = recorder.ResponseWriter.Write(data)
+	recorder.bytes += int64(n)
+	return
+}
+
+func (recorder *responseRecorder) ReadFrom(reader io.Reader) (n int64, err error) {
+	recorder.markHeaderWritten()
+	if readerFrom, ok := recorder.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(reader)
+	} else {
+		// hide ReadFrom from io.Copy to avoid an infinite recursion
+		n, err = io.Copy(struct{ io.Writer }{recorder.ResponseWriter}, reader)
+	}
+	recorder.bytes += n
+	return
+}
+
+func (recorder *responseRecorder) Flush() {
+	recorder.markHeaderWritten()
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *responseRecorder) Hijack() (conn net.Conn, readWriter *bufio.ReadWriter, err error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, readWriter, err = hijacker.Hijack()
+	if err == nil && !recorder.wroteHeader {
+		// the connection is handed over to another protocol
+		recorder.status = http.StatusSwitchingProtocols
+		recorder.wroteHeader = true
+	}
+	return
+}
+
+func (recorder *responseRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+func (recorder *responseRecorder) markHeaderWritten() {
+	if !recorder.wroteHeader {
+		recorder.status = http.StatusOK
+		recorder.wroteHeader = true
+	}
+}
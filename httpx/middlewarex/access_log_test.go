@@ -0,0 +1,156 @@
+package middlewarex
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/log/slogx"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+
+	tests := []struct {
+		remoteAddr    string
+		forwardedFor  []string
+		expectedIP    string
+		expectInvalid bool
+	}{
+		{remoteAddr: "1.2.3.4:1234", expectedIP: "1.2.3.4"},
+		// X-Forwarded-For is ignored if the peer is not a trusted proxy
+		{remoteAddr: "1.2.3.4:1234", forwardedFor: []string{"5.6.7.8"}, expectedIP: "1.2.3.4"},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"5.6.7.8"}, expectedIP: "5.6.7.8"},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"6.6.6.6, 5.6.7.8, 10.0.0.2"}, expectedIP: "5.6.7.8"},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"6.6.6.6", "5.6.7.8"}, expectedIP: "5.6.7.8"},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"not an ip, 5.6.7.8"}, expectedIP: "5.6.7.8"},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"5.6.7.8, not an ip"}, expectedIP: "10.0.0.1"},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: []string{"10.0.0.3"}, expectedIP: "10.0.0.3"},
+		{remoteAddr: "[::1]:1234", forwardedFor: []string{"2001:db8::1"}, expectedIP: "2001:db8::1"},
+		{remoteAddr: "[::ffff:1.2.3.4]:1234", expectedIP: "1.2.3.4"},
+		{remoteAddr: "@", expectInvalid: true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		for _, forwardedFor := range test.forwardedFor {
+			req.Header.Add(httpx.HeaderXForwardedFor, forwardedFor)
+		}
+
+		clientIP := ClientIP(req, trustedProxies)
+		if test.expectInvalid {
+			if clientIP.IsValid() {
+				t.Errorf("%s: expected an invalid IP, got %s", test.remoteAddr, clientIP)
+			}
+			continue
+		}
+		if clientIP.String() != test.expectedIP {
+			t.Errorf("%s %v: expected %s, got %s", test.remoteAddr, test.forwardedFor, test.expectedIP, clientIP)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/flush", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("ResponseWriter should implement http.Flusher")
+		}
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flushing: %v", err)
+		}
+		w.Write([]byte("world!"))
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	handler := Recoverer(SetLogger(logger)(AccessLog(AccessLogConfig{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		SkipPaths:      []string{"/health"},
+	})(mux)))
+
+	serve := func(path string) (record map[string]any) {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(httpx.HeaderXForwardedFor, "1.2.3.4")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if logs.Len() == 0 {
+			return nil
+		}
+		err := json.Unmarshal(logs.Bytes(), &record)
+		if err != nil {
+			t.Fatalf("%s: decoding log record: %v", path, err)
+		}
+		return record
+	}
+
+	record := serve("/created")
+	if record["status"] != float64(http.StatusCreated) || record["bytes"] != float64(5) || record["remote_ip"] != "1.2.3.4" {
+		t.Errorf("/created: unexpected record: %v", record)
+	}
+	if _, hasDuration := record["duration"]; !hasDuration {
+		t.Errorf("/created: record has no duration: %v", record)
+	}
+
+	record = serve("/flush")
+	if record["status"] != float64(http.StatusOK) || record["bytes"] != float64(6) {
+		t.Errorf("/flush: unexpected record: %v", record)
+	}
+
+	record = serve("/health")
+	if record != nil {
+		t.Errorf("/health: should not be logged: %v", record)
+	}
+
+	record = serve("/panic")
+	if record["status"] != float64(http.StatusInternalServerError) || record["level"] != "ERROR" {
+		t.Errorf("/panic: unexpected record: %v", record)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	// a negative sample rate logs only the failed requests
+	for _, sampleRate := range []float64{0.000001, -1} {
+		var logs bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&logs, nil))
+		statusCode := http.StatusOK
+		handler := AccessLog(AccessLogConfig{SampleRate: sampleRate})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(statusCode)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(slogx.ToCtx(req.Context(), logger))
+		for range 100 {
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		if logs.Len() != 0 {
+			t.Errorf("%v: successful requests should have been sampled out: %s", sampleRate, logs.String())
+		}
+
+		statusCode = http.StatusBadGateway
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if logs.Len() == 0 {
+			t.Errorf("%v: failed requests should always be logged", sampleRate)
+		}
+	}
+}
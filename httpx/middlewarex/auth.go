@@ -0,0 +1,232 @@
+package middlewarex
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bloom42/stdx-go/auth"
+	"github.com/bloom42/stdx-go/db"
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/log/slogx"
+)
+
+// DefaultSessionCookieName is the default name of the session cookie. The __Host- prefix requires the cookie
+// to be Secure, to have Path=/ and no Domain, so it can't be set or overwritten by a subdomain.
+const DefaultSessionCookieName = "__Host-session"
+
+// DefaultSessionRefreshInterval is the default minimum duration between 2 refreshes of a session.
+const DefaultSessionRefreshInterval = 24 * time.Hour
+
+type authContextKey struct{}
+
+// AuthCtxKey is the key that holds the *AuthInfo of authenticated requests in a request context.
+var AuthCtxKey = authContextKey{}
+
+// AuthInfo describes how a request has been authenticated. Exactly one of Session and ApiKey is not nil.
+type AuthInfo struct {
+	Account auth.Account
+	Session *auth.Session
+	ApiKey  *auth.ApiKey
+}
+
+type AuthConfig struct {
+	DB db.Queryer
+	// SessionCookieName is the name of the session cookie.
+	// default: DefaultSessionCookieName
+	SessionCookieName string
+	// SessionRefreshInterval is the minimum duration between 2 refreshes of a session. When a request is
+	// authenticated with a session that has not been refreshed for SessionRefreshInterval, the session is
+	// refreshed with auth.RefreshSession and the new token is sent in the session cookie.
+	// default: DefaultSessionRefreshInterval
+	SessionRefreshInterval time.Duration
+}
+
+// Auth authenticates requests with either an API key sent in the "Authorization: Bearer <token>" header
+// or a session token sent in the session cookie, and injects an *AuthInfo in the context of the request.
+//
+// Requests without credentials are passed to the next handler unauthenticated: use RequireAuth to reject them.
+// Requests with invalid credentials are rejected with a 401 status code.
+func Auth(config AuthConfig) func(next http.Handler) http.Handler {
+	if config.SessionCookieName == "" {
+		config.SessionCookieName = DefaultSessionCookieName
+	}
+	if config.SessionRefreshInterval == 0 {
+		config.SessionRefreshInterval = DefaultSessionRefreshInterval
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			var authInfo *AuthInfo
+			var err error
+
+			if apiKeyToken, found := bearerToken(req); found {
+				authInfo, err = authenticateApiKey(ctx, config.DB, apiKeyToken)
+			} else if sessionCookie, cookieErr := req.Cookie(config.SessionCookieName); cookieErr == nil {
+				authInfo, err = authenticateSession(ctx, w, config, sessionCookie.Value)
+			} else {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if err != nil {
+				if !isAuthError(err) {
+					slogx.FromCtx(ctx).Error("middlewarex.Auth: authenticating request", slogx.Err(err))
+					httpx.ServerErrorInternal(w)
+					return
+				}
+				serveUnauthorized(w)
+				return
+			}
+
+			ctx = context.WithValue(ctx, AuthCtxKey, authInfo)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// AuthFromCtx returns the *AuthInfo of the request, or nil if the request is not authenticated.
+func AuthFromCtx(ctx context.Context) *AuthInfo {
+	authInfo, _ := ctx.Value(AuthCtxKey).(*AuthInfo)
+	return authInfo
+}
+
+// RequireAuth rejects unauthenticated requests with a 401 status code. It must be used after Auth.
+func RequireAuth(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		if AuthFromCtx(req.Context()) == nil {
+			serveUnauthorized(w)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// RequireApiKeyScopes rejects requests authenticated with an API key that has not been granted all the given
+// scopes with a 403 status code, and unauthenticated requests with a 401 status code.
+// Requests authenticated with a session are allowed, as sessions act on behalf of the account with
+// all its permissions. It must be used after Auth.
+func RequireApiKeyScopes(scopes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			authInfo := AuthFromCtx(req.Context())
+			if authInfo == nil {
+				serveUnauthorized(w)
+				return
+			}
+
+			if authInfo.ApiKey != nil {
+				for _, scope := range scopes {
+					if !authInfo.ApiKey.HasScope(scope) {
+						httpx.ServeError(w, "Forbidden\n", http.StatusForbidden)
+						return
+					}
+				}
+			}
+
+			next.ServeHTTP(w, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// SetSessionCookie sends token in a secure session cookie that expires at expiresAt.
+func SetSessionCookie(w http.ResponseWriter, cookieName string, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie asks the client to delete the session cookie.
+func ClearSessionCookie(w http.ResponseWriter, cookieName string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func authenticateApiKey(ctx context.Context, db db.Queryer, token string) (*AuthInfo, error) {
+	apiKey, err := auth.GetApiKeyByToken(ctx, db, token)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := auth.GetAccount(ctx, db, apiKey.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthInfo{Account: account, ApiKey: &apiKey}, nil
+}
+
+func authenticateSession(ctx context.Context, w http.ResponseWriter, config AuthConfig, token string) (*AuthInfo, error) {
+	session, err := auth.GetSessionByToken(ctx, config.DB, token)
+	if err != nil {
+		if isAuthError(err) {
+			ClearSessionCookie(w, config.SessionCookieName)
+		}
+		return nil, err
+	}
+
+	account, err := auth.GetAccount(ctx, config.DB, session.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// sliding expiration: refresh the session if it has not been refreshed recently. A failed refresh
+	// doesn't fail the request as the current token is still valid.
+	if time.Since(session.UpdatedAt) >= config.SessionRefreshInterval {
+		newToken, err := auth.RefreshSession(ctx, config.DB, token)
+		if err == nil {
+			SetSessionCookie(w, config.SessionCookieName, newToken, time.Now().Add(auth.SessionDuration))
+		} else if !errors.Is(err, auth.ErrTokenIsNotValid) && !errors.Is(err, auth.ErrSessionNotFound) {
+			slogx.FromCtx(ctx).Warn("middlewarex.Auth: refreshing session", slogx.Err(err),
+				slog.String("session.id", session.ID.String()))
+		}
+	}
+
+	return &AuthInfo{Account: account, Session: &session}, nil
+}
+
+// bearerToken returns the token of the "Authorization: Bearer <token>" header.
+func bearerToken(req *http.Request) (token string, found bool) {
+	authorization := req.Header.Get(httpx.HeaderAuthorization)
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(authorization[7:]), true
+}
+
+// isAuthError returns true if err is caused by invalid credentials, and false if it is an internal error.
+func isAuthError(err error) bool {
+	return errors.Is(err, auth.ErrTokenIsNotValid) ||
+		errors.Is(err, auth.ErrSessionNotFound) ||
+		errors.Is(err, auth.ErrSessionExpired) ||
+		errors.Is(err, auth.ErrApiKeyNotFound) ||
+		errors.Is(err, auth.ErrApiKeyExpired) ||
+		errors.Is(err, auth.ErrApiKeyRevoked) ||
+		errors.Is(err, auth.ErrAccountNotFound)
+}
+
+func serveUnauthorized(w http.ResponseWriter) {
+	w.Header().Set(httpx.HeaderWWWAuthenticate, "Bearer")
+	httpx.ServerErrorUnauthorized(w)
+}
@@ -0,0 +1,350 @@
+package middlewarex
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/auth"
+	"github.com/bloom42/stdx-go/db"
+	"github.com/bloom42/stdx-go/uuid"
+)
+
+// authDB is an in-memory db.Queryer that implements the queries of the auth package used to create and
+// authenticate accounts, sessions and API keys.
+type authDB struct {
+	mutex    sync.Mutex
+	accounts map[uuid.UUID]*auth.Account
+	sessions map[uuid.UUID]*auth.Session
+	apiKeys  map[uuid.UUID]*auth.ApiKey
+}
+
+// ensure that authDB satisfies the db.Queryer interface
+var _ db.Queryer = (*authDB)(nil)
+
+func newAuthDB() *authDB {
+	return &authDB{
+		accounts: map[uuid.UUID]*auth.Account{},
+		sessions: map[uuid.UUID]*auth.Session{},
+		apiKeys:  map[uuid.UUID]*auth.ApiKey{},
+	}
+}
+
+var errAuthDBQueryIsNotSupported = errors.New("authDB: query is not supported")
+
+func (authDB *authDB) Get(ctx context.Context, dest any, query string, args ...any) error {
+	authDB.mutex.Lock()
+	defer authDB.mutex.Unlock()
+
+	id := args[0].(uuid.UUID)
+	var found bool
+
+	switch strings.Join(strings.Fields(query), " ") {
+	case "SELECT * FROM auth_accounts WHERE id = $1":
+		var account *auth.Account
+		if account, found = authDB.accounts[id]; found {
+			*dest.(*auth.Account) = *account
+		}
+	case "SELECT * FROM auth_sessions WHERE id = $1":
+		var session *auth.Session
+		if session, found = authDB.sessions[id]; found {
+			*dest.(*auth.Session) = *session
+		}
+	case "SELECT * FROM auth_api_keys WHERE id = $1":
+		var apiKey *auth.ApiKey
+		if apiKey, found = authDB.apiKeys[id]; found {
+			*dest.(*auth.ApiKey) = *apiKey
+		}
+	default:
+		return errAuthDBQueryIsNotSupported
+	}
+
+	if !found {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (authDB *authDB) Select(ctx context.Context, dest any, query string, args ...any) error {
+	return errAuthDBQueryIsNotSupported
+}
+
+func (authDB *authDB) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, errAuthDBQueryIsNotSupported
+}
+
+func (authDB *authDB) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	authDB.mutex.Lock()
+	defer authDB.mutex.Unlock()
+
+	query = strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO auth_accounts "):
+		authDB.accounts[args[0].(uuid.UUID)] = &auth.Account{
+			ID:           args[0].(uuid.UUID),
+			CreatedAt:    args[1].(time.Time),
+			UpdatedAt:    args[2].(time.Time),
+			PasswordHash: args[3].(string),
+		}
+	case strings.HasPrefix(query, "INSERT INTO auth_sessions "):
+		authDB.sessions[args[0].(uuid.UUID)] = &auth.Session{
+			ID:        args[0].(uuid.UUID),
+			CreatedAt: args[1].(time.Time),
+			UpdatedAt: args[2].(time.Time),
+			ExpiresAt: args[3].(time.Time),
+			TokenHash: args[4].([]byte),
+			AccountID: args[5].(uuid.UUID),
+		}
+	case strings.HasPrefix(query, "INSERT INTO auth_api_keys "):
+		authDB.apiKeys[args[0].(uuid.UUID)] = &auth.ApiKey{
+			ID:        args[0].(uuid.UUID),
+			CreatedAt: args[1].(time.Time),
+			UpdatedAt: args[2].(time.Time),
+			Name:      args[3].(string),
+			ExpiresAt: args[4].(*time.Time),
+			RevokedAt: args[5].(*time.Time),
+			TokenHash: args[6].([]byte),
+			Scopes:    slices.Clone(args[7].(auth.ApiKeyScopes)),
+			AccountID: args[8].(uuid.UUID),
+		}
+	case strings.HasPrefix(query, "UPDATE auth_sessions SET updated_at = $1, expires_at = $2, token_hash = $3, previous_token_hash = $4 WHERE id = $5 AND token_hash = $4"):
+		session, found := authDB.sessions[args[4].(uuid.UUID)]
+		if !found || !slices.Equal(session.TokenHash, args[3].([]byte)) {
+			return driver.RowsAffected(0), nil
+		}
+		session.UpdatedAt = args[0].(time.Time)
+		session.ExpiresAt = args[1].(time.Time)
+		session.TokenHash = args[2].([]byte)
+		session.PreviousTokenHash = args[3].([]byte)
+	default:
+		return nil, errAuthDBQueryIsNotSupported
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (authDB *authDB) Rebind(query string) string {
+	return query
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		authorization string
+		token         string
+		found         bool
+	}{
+		{"", "", false},
+		{"Basic dXNlcjpwYXNz", "", false},
+		{"Bearer apikey_abc", "apikey_abc", true},
+		{"bearer apikey_abc ", "apikey_abc", true},
+		{"Bearer", "", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", tt.authorization)
+
+		token, found := bearerToken(req)
+		if token != tt.token || found != tt.found {
+			t.Errorf("bearerToken(%q) = (%q, %v), want (%q, %v)", tt.authorization, token, found, tt.token, tt.found)
+		}
+	}
+}
+
+func TestRequireApiKeyScopes(t *testing.T) {
+	handler := RequireApiKeyScopes("projects:read")(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		authInfo   *AuthInfo
+		statusCode int
+	}{
+		{"unauthenticated", nil, http.StatusUnauthorized},
+		{"session", &AuthInfo{Session: &auth.Session{}}, http.StatusNoContent},
+		{"API key without scope", &AuthInfo{ApiKey: &auth.ApiKey{Scopes: auth.ApiKeyScopes{"projects:write"}}}, http.StatusForbidden},
+		{"API key with scope", &AuthInfo{ApiKey: &auth.ApiKey{Scopes: auth.ApiKeyScopes{"projects:read"}}}, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authInfo != nil {
+				req = req.WithContext(context.WithValue(req.Context(), AuthCtxKey, tt.authInfo))
+			}
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+			if res.Code != tt.statusCode {
+				t.Errorf("status code = %d, want %d", res.Code, tt.statusCode)
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	database := newAuthDB()
+
+	accountID := uuid.NewV7()
+	err := auth.CreateAccount(ctx, database, accountID, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSession := func(updatedAt, expiresAt time.Time) string {
+		token, err := auth.CreateSession(ctx, database, accountID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, err := auth.GetSessionByToken(ctx, database, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		database.sessions[session.ID].UpdatedAt = updatedAt
+		database.sessions[session.ID].ExpiresAt = expiresAt
+		return token
+	}
+	newApiKey := func() (auth.ApiKey, string) {
+		apiKey, token, err := auth.CreateApiKey(ctx, database, auth.CreateApiKeyInput{
+			AccountID: accountID,
+			Name:      "CI",
+			Scopes:    []string{"projects:read"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return apiKey, token
+	}
+
+	now := time.Now()
+	sessionToken := newSession(now, now.Add(time.Hour))
+	staleSessionToken := newSession(now.Add(-DefaultSessionRefreshInterval), now.Add(time.Hour))
+	expiredSessionToken := newSession(now.Add(-time.Hour), now.Add(-time.Second))
+	apiKey, apiKeyToken := newApiKey()
+	revokedApiKey, revokedApiKeyToken := newApiKey()
+	revokedAt := now.Add(-time.Second)
+	database.apiKeys[revokedApiKey.ID].RevokedAt = &revokedAt
+
+	var authInfo *AuthInfo
+	handler := Auth(AuthConfig{DB: database})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authInfo = AuthFromCtx(req.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		sessionCookie string
+		statusCode    int
+		// authenticatedWith is "session", "api key" or "" for unauthenticated requests
+		authenticatedWith string
+		// sessionCookieSet is true if the session cookie must be set (refreshed or cleared) by the response
+		sessionCookieSet bool
+	}{
+		{"no credentials", "", "", http.StatusNoContent, "", false},
+		{"valid session", "", sessionToken, http.StatusNoContent, "session", false},
+		{"stale session", "", staleSessionToken, http.StatusNoContent, "session", true},
+		{"invalid session", "", "session_invalid", http.StatusUnauthorized, "", true},
+		{"expired session", "", expiredSessionToken, http.StatusUnauthorized, "", true},
+		{"valid API key", "Bearer " + apiKeyToken, "", http.StatusNoContent, "api key", false},
+		{"API key and session", "Bearer " + apiKeyToken, expiredSessionToken, http.StatusNoContent, "api key", false},
+		{"invalid API key", "Bearer apikey_invalid", "", http.StatusUnauthorized, "", false},
+		{"session token as API key", "Bearer " + sessionToken, "", http.StatusUnauthorized, "", false},
+		{"revoked API key", "Bearer " + revokedApiKeyToken, "", http.StatusUnauthorized, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authInfo = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.sessionCookie != "" {
+				req.AddCookie(&http.Cookie{Name: DefaultSessionCookieName, Value: tt.sessionCookie})
+			}
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+			if res.Code != tt.statusCode {
+				t.Errorf("status code = %d, want %d", res.Code, tt.statusCode)
+			}
+			if tt.statusCode == http.StatusUnauthorized && res.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want %q", res.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+
+			sessionCookieSet := slices.ContainsFunc(res.Result().Cookies(), func(cookie *http.Cookie) bool {
+				return cookie.Name == DefaultSessionCookieName
+			})
+			if sessionCookieSet != tt.sessionCookieSet {
+				t.Errorf("session cookie set = %v, want %v", sessionCookieSet, tt.sessionCookieSet)
+			}
+
+			switch tt.authenticatedWith {
+			case "":
+				if authInfo != nil {
+					t.Errorf("the request should not be authenticated: %+v", authInfo)
+				}
+			case "session":
+				if authInfo == nil || authInfo.Session == nil || authInfo.ApiKey != nil {
+					t.Fatalf("the request should be authenticated with a session: %+v", authInfo)
+				}
+				if !authInfo.Session.AccountID.Equal(accountID) || !authInfo.Account.ID.Equal(accountID) {
+					t.Errorf("unexpected account: %s", authInfo.Account.ID)
+				}
+			case "api key":
+				if authInfo == nil || authInfo.ApiKey == nil || authInfo.Session != nil {
+					t.Fatalf("the request should be authenticated with an API key: %+v", authInfo)
+				}
+				if !authInfo.ApiKey.ID.Equal(apiKey.ID) || !authInfo.Account.ID.Equal(accountID) ||
+					!authInfo.ApiKey.HasScope("projects:read") {
+					t.Errorf("unexpected API key: %+v", authInfo.ApiKey)
+				}
+			}
+		})
+	}
+
+	// the refreshed token of a stale session authenticates the next requests
+	staleSessionToken = newSession(now.Add(-DefaultSessionRefreshInterval), now.Add(time.Hour))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultSessionCookieName, Value: staleSessionToken})
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == staleSessionToken || cookies[0].Value == "" {
+		t.Fatalf("the session should be refreshed: %v", cookies)
+	}
+	if _, err = auth.GetSessionByToken(ctx, database, cookies[0].Value); err != nil {
+		t.Errorf("refreshed token: %v", err)
+	}
+
+	// database errors are not reported as authentication errors
+	handler = Auth(AuthConfig{DB: &failingDB{}})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKeyToken)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("database error: status code = %d, want %d", res.Code, http.StatusInternalServerError)
+	}
+}
+
+// failingDB is a db.Queryer whose queries always fail.
+type failingDB struct {
+	authDB
+}
+
+func (*failingDB) Get(ctx context.Context, dest any, query string, args ...any) error {
+	return errors.New("connection refused")
+}
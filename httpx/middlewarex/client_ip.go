@@ -0,0 +1,86 @@
+package middlewarex
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/proxyproto"
+)
+
+type connContextKey struct{}
+
+// ConnContext stores the connection of requests in their context. Use it as http.Server.ConnContext
+// so that AccessLog can log the address of the proxy that sent a PROXY protocol header.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// ClientIP returns the IP address of the client of the request, or an invalid address if it can't be
+// determined (e.g. for requests received on a unix socket).
+//
+// The address of the peer is used, which is the source address of the PROXY protocol header when the
+// server listens with proxyproto. If the peer is a trusted proxy, the X-Forwarded-For header is read
+// from right to left and the first address that is not a trusted proxy is returned.
+func ClientIP(req *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	clientIP := addrPort.Addr().Unmap()
+
+	if !isTrustedProxy(clientIP, trustedProxies) {
+		return clientIP
+	}
+
+	forwardedFor := req.Header.Values(httpx.HeaderXForwardedFor)
+	for i := len(forwardedFor) - 1; i >= 0; i -= 1 {
+		addresses := strings.Split(forwardedFor[i], ",")
+		for j := len(addresses) - 1; j >= 0; j -= 1 {
+			forwardedIP, err := netip.ParseAddr(strings.TrimSpace(addresses[j]))
+			if err != nil {
+				// the header can't be trusted past this point
+				return clientIP
+			}
+			clientIP = forwardedIP.Unmap()
+			if !isTrustedProxy(clientIP, trustedProxies) {
+				return clientIP
+			}
+		}
+	}
+
+	return clientIP
+}
+
+func isTrustedProxy(ip netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, trustedProxy := range trustedProxies {
+		if trustedProxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyAddr returns the address of the proxy that sent the PROXY protocol header of the connection of
+// the request, if any. The connection must have been stored in the context with ConnContext.
+func proxyAddr(req *http.Request) (addr string, found bool) {
+	conn, ok := req.Context().Value(connContextKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+
+	if tlsConn, isTlsConn := conn.(*tls.Conn); isTlsConn {
+		conn = tlsConn.NetConn()
+	}
+
+	proxyConn, isProxyConn := conn.(*proxyproto.Conn)
+	if !isProxyConn || proxyConn.ProxyHeader() == nil {
+		return
+	}
+
+	return proxyConn.Raw().RemoteAddr().String(), true
+}
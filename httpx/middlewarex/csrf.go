@@ -0,0 +1,254 @@
+package middlewarex
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/log/slogx"
+)
+
+const (
+	// DefaultCSRFCookieName is the default name of the CSRF cookie. The __Host- prefix requires the cookie to
+	// be Secure, to have Path=/ and no Domain, so it can't be set or overwritten by a subdomain.
+	// It is not used with a CookieCodec, which sets the Path and Domain of its cookies.
+	DefaultCSRFCookieName = "__Host-csrf"
+	// DefaultCSRFHeaderName is the default name of the header that carries the CSRF token.
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+	// DefaultCSRFFormField is the default name of the form field that carries the CSRF token.
+	DefaultCSRFFormField = "csrf_token"
+
+	HeaderOrigin       = "Origin"
+	HeaderSecFetchSite = "Sec-Fetch-Site"
+
+	csrfTokenSize = 32
+)
+
+type csrfContextKey struct{}
+
+type csrfContext struct {
+	token     []byte
+	formField string
+}
+
+type CSRFConfig struct {
+	// CookieName is the name of the cookie that holds the CSRF token.
+	// default: DefaultCSRFCookieName, or "csrf" if CookieCodec or Insecure is set
+	CookieName string
+	// HeaderName is the name of the header that carries the CSRF token of the requests.
+	// default: DefaultCSRFHeaderName
+	HeaderName string
+	// FormField is the name of the form field that carries the CSRF token of the requests, when they don't
+	// have the HeaderName header.
+	// default: DefaultCSRFFormField
+	FormField string
+	// TrustedOrigins are the origins, other than the origin of the server, that are allowed to send
+	// requests. e.g. https://app.example.com
+	TrustedOrigins []string
+	// CookieCodec, if not nil, is used to encrypt and authenticate the CSRF cookie, so that an attacker
+	// that can write cookies for the domain (e.g. from a subdomain) can't forge one.
+	CookieCodec *httpx.CookieCodec
+	// Insecure allows the CSRF cookie to be sent over HTTP connections, and the requests from http:// origins
+	// that are not received over TLS. It should only be used for local development.
+	Insecure bool
+	// Skip, if not nil, is called to decide if a request should not be protected (e.g. for webhooks).
+	Skip func(req *http.Request) bool
+	// ErrorHandler, if not nil, is called to respond to the rejected requests.
+	// default: a 403 Forbidden error
+	ErrorHandler http.Handler
+}
+
+// CSRF protects against Cross-Site Request Forgery attacks.
+//
+// Requests with an unsafe method (all but GET, HEAD, OPTIONS and TRACE) are rejected if:
+//   - their Sec-Fetch-Site header is not same-origin or none, or their Origin header is not the origin of
+//     the server, unless the origin is one of config.TrustedOrigins;
+//   - or the CSRF token of their HeaderName header or FormField form field doesn't match the token of the
+//     CSRF cookie (double-submit cookie pattern).
+//
+// The CSRF cookie is created on the first request. Use CSRFToken or CSRFTemplateField to send the token
+// in the pages of the application.
+func CSRF(config CSRFConfig) func(next http.Handler) http.Handler {
+	if config.CookieName == "" {
+		config.CookieName = DefaultCSRFCookieName
+		if config.CookieCodec != nil || config.Insecure {
+			config.CookieName = "csrf"
+		}
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = DefaultCSRFHeaderName
+	}
+	if config.FormField == "" {
+		config.FormField = DefaultCSRFFormField
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if config.Skip != nil && config.Skip(req) {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			ctx := req.Context()
+			logger := slogx.FromCtx(ctx)
+
+			token, err := readCSRFCookie(config, req)
+			if err != nil {
+				token = crypto.RandBytes(csrfTokenSize)
+				err = setCSRFCookie(config, w, token)
+				if err != nil {
+					logger.Error("middlewarex.CSRF: setting CSRF cookie", slogx.Err(err))
+					httpx.ServerErrorInternal(w)
+					return
+				}
+			}
+
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				reason := verifyCSRFRequest(config, req, token)
+				if reason != "" {
+					logger.Warn("middlewarex.CSRF: request rejected", slog.String("reason", reason))
+					if config.ErrorHandler != nil {
+						config.ErrorHandler.ServeHTTP(w, req)
+					} else {
+						httpx.ServeError(w, "Forbidden\n", http.StatusForbidden)
+					}
+					return
+				}
+			}
+
+			ctx = context.WithValue(ctx, csrfContextKey{}, &csrfContext{token: token, formField: config.FormField})
+			next.ServeHTTP(w, req.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// CSRFToken returns the CSRF token to send with the unsafe requests, or an empty string if the CSRF
+// middleware has not been used. The token is masked with a different random value on each call to
+// protect it from compression side-channel attacks (BREACH).
+func CSRFToken(ctx context.Context) string {
+	csrfCtx, ok := ctx.Value(csrfContextKey{}).(*csrfContext)
+	if !ok {
+		return ""
+	}
+
+	mask := crypto.RandBytes(csrfTokenSize)
+	maskedToken := make([]byte, 2*csrfTokenSize)
+	copy(maskedToken, mask)
+	subtle.XORBytes(maskedToken[csrfTokenSize:], mask, csrfCtx.token)
+	return base64.RawURLEncoding.EncodeToString(maskedToken)
+}
+
+// CSRFTemplateField returns a hidden input with the CSRF token, to be used in HTML forms.
+// e.g. template.FuncMap{"csrfField": func() template.HTML { return middlewarex.CSRFTemplateField(ctx) }}
+func CSRFTemplateField(ctx context.Context) template.HTML {
+	csrfCtx, ok := ctx.Value(csrfContextKey{}).(*csrfContext)
+	if !ok {
+		return ""
+	}
+
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(csrfCtx.formField) +
+		`" value="` + CSRFToken(ctx) + `">`)
+}
+
+// verifyCSRFRequest returns the reason why the request is rejected, or an empty string if it is allowed.
+func verifyCSRFRequest(config CSRFConfig, req *http.Request, cookieToken []byte) (reason string) {
+	origin := req.Header.Get(HeaderOrigin)
+
+	switch req.Header.Get(HeaderSecFetchSite) {
+	case "", "same-origin", "none":
+		if origin != "" && !isCSRFTrustedOrigin(config, req, origin) {
+			return "origin is not trusted: " + origin
+		}
+	default:
+		// same-site or cross-site requests are allowed only from trusted origins
+		if !slices.Contains(config.TrustedOrigins, origin) {
+			return "cross-site request from an untrusted origin: " + origin
+		}
+	}
+
+	requestToken := req.Header.Get(config.HeaderName)
+	if requestToken == "" {
+		requestToken = req.PostFormValue(config.FormField)
+	}
+	if requestToken == "" {
+		return "CSRF token is missing"
+	}
+
+	maskedToken, err := base64.RawURLEncoding.DecodeString(requestToken)
+	if err != nil || len(maskedToken) != 2*csrfTokenSize {
+		return "CSRF token is not valid"
+	}
+	token := make([]byte, csrfTokenSize)
+	subtle.XORBytes(token, maskedToken[:csrfTokenSize], maskedToken[csrfTokenSize:])
+	if subtle.ConstantTimeCompare(token, cookieToken) != 1 {
+		return "CSRF token does not match"
+	}
+
+	return ""
+}
+
+func isCSRFTrustedOrigin(config CSRFConfig, req *http.Request, origin string) bool {
+	if slices.Contains(config.TrustedOrigins, origin) {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	// the scheme of the request can't be known behind a proxy that terminates TLS, so http:// origins are
+	// only trusted in insecure mode, otherwise a page served over HTTP could forge requests to the server
+	switch originURL.Scheme {
+	case "https":
+	case "http":
+		if !config.Insecure || req.TLS != nil {
+			return false
+		}
+	default:
+		return false
+	}
+	return originURL.Host == req.Host
+}
+
+func readCSRFCookie(config CSRFConfig, req *http.Request) (token []byte, err error) {
+	if config.CookieCodec != nil {
+		token, err = config.CookieCodec.Cookie(req, config.CookieName)
+	} else {
+		var cookie *http.Cookie
+		cookie, err = req.Cookie(config.CookieName)
+		if err != nil {
+			return
+		}
+		token, err = base64.RawURLEncoding.DecodeString(cookie.Value)
+	}
+	if err == nil && len(token) != csrfTokenSize {
+		err = httpx.ErrCookieIsNotValid
+	}
+	return
+}
+
+func setCSRFCookie(config CSRFConfig, w http.ResponseWriter, token []byte) error {
+	if config.CookieCodec != nil {
+		return config.CookieCodec.SetCookie(w, config.CookieName, token)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     config.CookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(token),
+		Path:     "/",
+		Secure:   !config.Insecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
@@ -0,0 +1,180 @@
+package middlewarex
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/httpx"
+)
+
+func TestCSRF(t *testing.T) {
+	codec, err := httpx.NewCookieCodec(httpx.CookieCodecConfig{Keys: [][]byte{crypto.RandBytes(httpx.CookieKeySize)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var token string
+	handler := CSRF(CSRFConfig{
+		CookieCodec:    codec,
+		TrustedOrigins: []string{"https://app.example.com"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token = CSRFToken(req.Context())
+		field := CSRFTemplateField(req.Context())
+		if !strings.HasPrefix(string(field), `<input type="hidden" name="csrf_token" value="`) {
+			t.Errorf("unexpected template field: %s", field)
+		}
+	}))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	cookies := res.Result().Cookies()
+	// the __Host- prefix is not used as the Path and Domain of the cookie are set by the codec
+	if res.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != "csrf" || token == "" {
+		t.Fatalf("GET: unexpected response: %d %v", res.Code, cookies)
+	}
+	cookie := cookies[0]
+
+	tests := []struct {
+		name           string
+		header         http.Header
+		form           url.Values
+		withoutCookie  bool
+		expectedStatus int
+	}{
+		{name: "header token", header: http.Header{DefaultCSRFHeaderName: {token}}, expectedStatus: http.StatusOK},
+		{name: "form token", form: url.Values{DefaultCSRFFormField: {token}}, expectedStatus: http.StatusOK},
+		{name: "missing token", expectedStatus: http.StatusForbidden},
+		{name: "invalid token", header: http.Header{DefaultCSRFHeaderName: {"invalid"}}, expectedStatus: http.StatusForbidden},
+		{name: "missing cookie", header: http.Header{DefaultCSRFHeaderName: {token}}, withoutCookie: true, expectedStatus: http.StatusForbidden},
+		{
+			name:           "same origin",
+			header:         http.Header{DefaultCSRFHeaderName: {token}, HeaderOrigin: {"https://example.com"}, HeaderSecFetchSite: {"same-origin"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "cross-site",
+			header:         http.Header{DefaultCSRFHeaderName: {token}, HeaderOrigin: {"https://evil.com"}, HeaderSecFetchSite: {"cross-site"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "same host over HTTP",
+			header:         http.Header{DefaultCSRFHeaderName: {token}, HeaderOrigin: {"http://example.com"}, HeaderSecFetchSite: {"same-origin"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "untrusted origin",
+			header:         http.Header{DefaultCSRFHeaderName: {token}, HeaderOrigin: {"https://evil.com"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "trusted origin",
+			header:         http.Header{DefaultCSRFHeaderName: {token}, HeaderOrigin: {"https://app.example.com"}, HeaderSecFetchSite: {"same-site"}},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "https://example.com/", strings.NewReader(test.form.Encode()))
+		if test.form != nil {
+			req.Header.Set(httpx.HeaderContentType, "application/x-www-form-urlencoded")
+		}
+		for key, values := range test.header {
+			req.Header.Set(key, values[0])
+		}
+		if !test.withoutCookie {
+			req.AddCookie(cookie)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != test.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expectedStatus, res.Code)
+		}
+	}
+
+	if CSRFToken(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != "" || CSRFTemplateField(t.Context()) != template.HTML("") {
+		t.Error("CSRFToken should be empty without the CSRF middleware")
+	}
+}
+
+func TestCSRFCookie(t *testing.T) {
+	codec, err := httpx.NewCookieCodec(httpx.CookieCodecConfig{
+		Keys:   [][]byte{crypto.RandBytes(httpx.CookieKeySize)},
+		Domain: "example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		config         CSRFConfig
+		expectedName   string
+		expectedDomain string
+		expectedSecure bool
+	}{
+		{"default", CSRFConfig{}, DefaultCSRFCookieName, "", true},
+		{"insecure", CSRFConfig{Insecure: true}, "csrf", "", false},
+		{"cookie codec", CSRFConfig{CookieCodec: codec}, "csrf", "example.com", true},
+		{"custom name", CSRFConfig{CookieName: "__Host-token", Insecure: true}, "__Host-token", "", false},
+	}
+
+	for _, test := range tests {
+		handler := CSRF(test.config)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+
+		cookies := res.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Errorf("%s: expected 1 cookie, got %d", test.name, len(cookies))
+			continue
+		}
+		cookie := cookies[0]
+		if cookie.Name != test.expectedName || cookie.Domain != test.expectedDomain || cookie.Secure != test.expectedSecure ||
+			cookie.Path != "/" {
+			t.Errorf("%s: unexpected cookie: %s", test.name, cookie)
+		}
+	}
+}
+
+func TestIsCSRFTrustedOrigin(t *testing.T) {
+	trustedOrigins := []string{"https://app.example.com", "http://localhost:3000"}
+
+	tests := []struct {
+		origin   string
+		insecure bool
+		tls      bool
+		expected bool
+	}{
+		{"https://example.com", false, false, true},
+		{"https://example.com", false, true, true},
+		{"http://example.com", false, false, false},
+		{"http://example.com", false, true, false},
+		{"http://example.com", true, false, true},
+		{"http://example.com", true, true, false},
+		{"ftp://example.com", true, false, false},
+		{"https://example.com:8443", false, false, false},
+		{"https://sub.example.com", false, false, false},
+		{"https://app.example.com", false, false, true},
+		{"http://app.example.com", false, false, false},
+		{"http://localhost:3000", false, true, true},
+		{"null", false, false, false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "https://example.com/", nil)
+		if !test.tls {
+			req.TLS = nil
+		}
+		config := CSRFConfig{TrustedOrigins: trustedOrigins, Insecure: test.insecure}
+		if trusted := isCSRFTrustedOrigin(config, req, test.origin); trusted != test.expected {
+			t.Errorf("isCSRFTrustedOrigin(%q, insecure: %v, tls: %v) = %v, want %v", test.origin, test.insecure, test.tls,
+				trusted, test.expected)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+CREATE TABLE rate_limits (
+  key TEXT PRIMARY KEY,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  time TIMESTAMP WITH TIME ZONE,
+  count DOUBLE PRECISION NOT NULL,
+  previous_count DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX index_rate_limits_on_expires_at ON rate_limits (expires_at);
@@ -0,0 +1,286 @@
+package middlewarex
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/log/slogx"
+)
+
+// Headers sent by RateLimit.
+// See https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+)
+
+type RateLimitAlgorithm int
+
+const (
+	// RateLimitTokenBucket allows bursts of up to RateLimitPolicy.Requests requests, and refills the
+	// bucket continuously at a rate of RateLimitPolicy.Requests per RateLimitPolicy.Period.
+	RateLimitTokenBucket RateLimitAlgorithm = iota
+	// RateLimitSlidingWindow allows RateLimitPolicy.Requests requests in any window of RateLimitPolicy.Period.
+	// The number of requests of the window is approximated from the counters of the current and the
+	// previous fixed windows, weighted by their overlap with the sliding window.
+	RateLimitSlidingWindow
+)
+
+// RateLimitPolicy is a quota of Requests requests per Period.
+type RateLimitPolicy struct {
+	Algorithm RateLimitAlgorithm
+	Requests  int64
+	Period    time.Duration
+}
+
+// RateLimitResult is the state of a quota after a request.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// ResetAfter is the duration until the quota is reset.
+	ResetAfter time.Duration
+	// RetryAfter is the duration after which the next request will be allowed. It is 0 if Remaining > 0.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore stores the state of the quotas. Allow must be atomic: concurrent calls with the same key
+// must not be able to consume more than the quota.
+type RateLimitStore interface {
+	// Allow consumes one request of the quota of key, if any is left.
+	Allow(ctx context.Context, key string, policy RateLimitPolicy) (result RateLimitResult, err error)
+}
+
+// RateLimitKeyFunc returns the key of the quota consumed by a request. Requests with an empty key are not
+// rate limited.
+type RateLimitKeyFunc func(req *http.Request) string
+
+type RateLimitConfig struct {
+	Store  RateLimitStore
+	Policy RateLimitPolicy
+	// Name is prefixed to the keys of the quotas so that multiple rate limiters can share the same store.
+	// e.g. "login"
+	Name string
+	// KeyFunc returns the key of the quota consumed by a request.
+	// default: RateLimitByIP(nil)
+	KeyFunc RateLimitKeyFunc
+	// FailClosed rejects requests with a 500 status code when the store returns an error. Otherwise,
+	// errors are logged and requests are allowed.
+	FailClosed bool
+	// OnLimited, if not nil, is called to respond to the requests that exceeded their quota, after the
+	// RateLimit-* and Retry-After headers have been set.
+	// default: a 429 Too Many Requests error
+	OnLimited http.Handler
+}
+
+// RateLimit limits the number of requests that each key (see RateLimitKeyFunc) can make with
+// config.Policy, and rejects the requests that exceed their quota with a 429 status code.
+// The RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers are sent with
+// all the rate limited responses, and the Retry-After header with the rejected ones.
+//
+// It panics if config.Store is nil or if config.Policy is not valid.
+func RateLimit(config RateLimitConfig) func(next http.Handler) http.Handler {
+	if config.Store == nil {
+		panic("middlewarex.RateLimit: Store is nil")
+	}
+	if config.Policy.Requests <= 0 || config.Policy.Period <= 0 {
+		panic("middlewarex.RateLimit: Policy.Requests and Policy.Period must be greater than 0")
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = RateLimitByIP(nil)
+	}
+	policyHeader := fmt.Sprintf("%d;w=%d", config.Policy.Requests, durationToSeconds(config.Policy.Period))
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+
+			key := config.KeyFunc(req)
+			if key == "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if config.Name != "" {
+				key = config.Name + ":" + key
+			}
+
+			result, err := config.Store.Allow(ctx, key, config.Policy)
+			if err != nil {
+				slogx.FromCtx(ctx).Error("middlewarex.RateLimit: checking quota", slogx.Err(err))
+				if config.FailClosed {
+					httpx.ServerErrorInternal(w)
+					return
+				}
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			headers := w.Header()
+			headers.Set(HeaderRateLimitLimit, strconv.FormatInt(result.Limit, 10))
+			headers.Set(HeaderRateLimitRemaining, strconv.FormatInt(result.Remaining, 10))
+			headers.Set(HeaderRateLimitReset, strconv.FormatInt(durationToSeconds(result.ResetAfter), 10))
+			headers.Set(HeaderRateLimitPolicy, policyHeader)
+
+			if !result.Allowed {
+				headers.Set(httpx.HeaderRetryAfter, strconv.FormatInt(max(durationToSeconds(result.RetryAfter), 1), 10))
+				if config.OnLimited != nil {
+					config.OnLimited.ServeHTTP(w, req)
+				} else {
+					httpx.ServeError(w, "Too Many Requests\n", http.StatusTooManyRequests)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RateLimitByIP uses the IP address of the client (see ClientIP) as the key of the quotas.
+func RateLimitByIP(trustedProxies []netip.Prefix) RateLimitKeyFunc {
+	return func(req *http.Request) string {
+		clientIP := ClientIP(req, trustedProxies)
+		if !clientIP.IsValid() {
+			return ""
+		}
+		return clientIP.String()
+	}
+}
+
+// RateLimitByIPPrefix uses the network of the IP address of the client (see ClientIP) as the key of the
+// quotas, so that a client can't bypass the limits by rotating through the many addresses that it owns.
+// e.g. RateLimitByIPPrefix(32, 64, nil) to limit single IPv4 addresses and /64 IPv6 networks.
+func RateLimitByIPPrefix(ipv4PrefixLength, ipv6PrefixLength int, trustedProxies []netip.Prefix) RateLimitKeyFunc {
+	return func(req *http.Request) string {
+		clientIP := ClientIP(req, trustedProxies)
+		if !clientIP.IsValid() {
+			return ""
+		}
+
+		prefixLength := ipv6PrefixLength
+		if clientIP.Is4() {
+			prefixLength = ipv4PrefixLength
+		}
+		prefix, err := clientIP.Prefix(prefixLength)
+		if err != nil {
+			return clientIP.String()
+		}
+		return prefix.String()
+	}
+}
+
+// RateLimitByHeader uses the value of a header (e.g. an API key) as the key of the quotas. Requests without
+// this header are not rate limited.
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(req *http.Request) string {
+		return req.Header.Get(name)
+	}
+}
+
+// rateLimitState is the state of a quota, stored by the RateLimitStores.
+type rateLimitState struct {
+	// Time is the time of the last refill of the bucket for RateLimitTokenBucket, and the start of the
+	// current window for RateLimitSlidingWindow. It is zero for a new quota.
+	Time time.Time
+	// Count is the number of tokens left in the bucket for RateLimitTokenBucket, and the number of
+	// requests of the current window for RateLimitSlidingWindow.
+	Count float64
+	// PreviousCount is the number of requests of the previous window for RateLimitSlidingWindow.
+	PreviousCount float64
+}
+
+// expiresAt returns the time after which the state is equivalent to the state of a new quota.
+func (state *rateLimitState) expiresAt(policy RateLimitPolicy) time.Time {
+	return state.Time.Add(2 * policy.Period)
+}
+
+// take consumes one request of the quota at now, if any is left, and updates state.
+func (policy RateLimitPolicy) take(state *rateLimitState, now time.Time) (result RateLimitResult) {
+	if policy.Algorithm == RateLimitSlidingWindow {
+		return policy.takeSlidingWindow(state, now)
+	}
+	return policy.takeTokenBucket(state, now)
+}
+
+func (policy RateLimitPolicy) takeTokenBucket(state *rateLimitState, now time.Time) (result RateLimitResult) {
+	limit := float64(policy.Requests)
+	// tokens per second
+	rate := limit / policy.Period.Seconds()
+
+	if state.Time.IsZero() {
+		state.Count = limit
+		state.Time = now
+	}
+	if elapsed := now.Sub(state.Time).Seconds(); elapsed > 0 {
+		state.Count = min(limit, state.Count+elapsed*rate)
+		state.Time = now
+	}
+
+	result.Limit = policy.Requests
+	if state.Count >= 1 {
+		state.Count -= 1
+		result.Allowed = true
+	}
+	result.Remaining = int64(state.Count)
+	if result.Remaining == 0 {
+		result.RetryAfter = secondsToDuration((1 - state.Count) / rate)
+	}
+	result.ResetAfter = secondsToDuration((limit - state.Count) / rate)
+	return
+}
+
+func (policy RateLimitPolicy) takeSlidingWindow(state *rateLimitState, now time.Time) (result RateLimitResult) {
+	limit := float64(policy.Requests)
+	period := policy.Period.Seconds()
+
+	elapsed := now.Sub(state.Time)
+	if state.Time.IsZero() || elapsed >= 2*policy.Period {
+		state.Time = now
+		state.Count = 0
+		state.PreviousCount = 0
+	} else if elapsed >= policy.Period {
+		state.Time = state.Time.Add(policy.Period)
+		state.PreviousCount = state.Count
+		state.Count = 0
+	}
+	elapsedInWindow := max(now.Sub(state.Time).Seconds(), 0)
+
+	estimate := state.PreviousCount*(1-elapsedInWindow/period) + state.Count
+	result.Limit = policy.Requests
+	if estimate+1 <= limit {
+		state.Count += 1
+		estimate += 1
+		result.Allowed = true
+	}
+	result.Remaining = max(int64(math.Floor(limit-estimate)), 0)
+	result.ResetAfter = secondsToDuration(period - elapsedInWindow)
+
+	if result.Remaining == 0 {
+		// the time after which PreviousCount*(1-elapsed/period) + Count + 1 <= limit
+		if state.Count+1 <= limit {
+			result.RetryAfter = secondsToDuration(period*(1-(limit-1-state.Count)/state.PreviousCount) - elapsedInWindow)
+		} else {
+			// the current window becomes the previous one
+			result.RetryAfter = secondsToDuration(period - elapsedInWindow + period*(1-(limit-1)/state.Count))
+		}
+	}
+	return
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return max(time.Duration(seconds*float64(time.Second)), 0)
+}
+
+// durationToSeconds returns the number of seconds of duration, rounded up.
+func durationToSeconds(duration time.Duration) int64 {
+	return int64(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,65 @@
+package middlewarex
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bloom42/stdx-go/memorycache"
+)
+
+// DefaultMemoryRateLimitStoreCapacity is the default maximum number of quotas of a MemoryRateLimitStore.
+const DefaultMemoryRateLimitStoreCapacity = 100_000
+
+type MemoryRateLimitStoreConfig struct {
+	// Capacity is the maximum number of quotas kept in memory. When it is reached, the least recently used
+	// quota is evicted, which resets it.
+	// default: DefaultMemoryRateLimitStoreCapacity
+	Capacity uint64
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps the quotas in memory. The quotas are not shared
+// between the replicas of a service: use PostgresRateLimitStore for that.
+type MemoryRateLimitStore struct {
+	cache *memorycache.Cache[string, *memoryRateLimitEntry]
+}
+
+// ensure that MemoryRateLimitStore implements RateLimitStore
+var _ RateLimitStore = (*MemoryRateLimitStore)(nil)
+
+type memoryRateLimitEntry struct {
+	mutex sync.Mutex
+	state rateLimitState
+}
+
+func NewMemoryRateLimitStore(config MemoryRateLimitStoreConfig) *MemoryRateLimitStore {
+	if config.Capacity == 0 {
+		config.Capacity = DefaultMemoryRateLimitStoreCapacity
+	}
+
+	cache := memorycache.New(
+		memorycache.WithCapacity[string, *memoryRateLimitEntry](config.Capacity),
+	)
+
+	return &MemoryRateLimitStore{
+		cache: cache,
+	}
+}
+
+func (store *MemoryRateLimitStore) Allow(ctx context.Context, key string, policy RateLimitPolicy) (result RateLimitResult, err error) {
+	// the quota is back to its initial state after 2 periods without requests
+	ttl := 2 * policy.Period
+	item, _ := store.cache.GetOrSet(key, &memoryRateLimitEntry{}, memorycache.WithTTL[string, *memoryRateLimitEntry](ttl))
+	entry := item.Value()
+
+	entry.mutex.Lock()
+	result = policy.take(&entry.state, time.Now())
+	entry.mutex.Unlock()
+
+	return
+}
+
+// Stop stops the goroutine that deletes the expired quotas.
+func (store *MemoryRateLimitStore) Stop() {
+	store.cache.Stop()
+}
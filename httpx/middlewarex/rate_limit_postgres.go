@@ -0,0 +1,92 @@
+package middlewarex
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/bloom42/stdx-go/db"
+)
+
+// RateLimitMigrationsFS contains the SQL migrations (migrations/*.up.sql and migrations/*.down.sql) that
+// create the rate_limits table used by PostgresRateLimitStore. They are compatible with migrate.Load.
+//
+//go:embed migrations/*.sql
+var RateLimitMigrationsFS embed.FS
+
+// PostgresRateLimitStore is a RateLimitStore that keeps the quotas in the rate_limits table of a Postgres
+// database (see RateLimitMigrationsFS), so they are shared by all the replicas of a service.
+// The time of the database is used so that the replicas don't need synchronized clocks.
+//
+// Expired quotas are not deleted automatically: call DeleteExpired periodically.
+type PostgresRateLimitStore struct {
+	db db.DB
+}
+
+// ensure that PostgresRateLimitStore implements RateLimitStore
+var _ RateLimitStore = (*PostgresRateLimitStore)(nil)
+
+type postgresRateLimitRow struct {
+	Time          *time.Time `db:"time"`
+	Count         float64    `db:"count"`
+	PreviousCount float64    `db:"previous_count"`
+	Now           time.Time  `db:"now"`
+}
+
+func NewPostgresRateLimitStore(db db.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{
+		db: db,
+	}
+}
+
+func (store *PostgresRateLimitStore) Allow(ctx context.Context, key string, policy RateLimitPolicy) (result RateLimitResult, err error) {
+	err = store.db.Transaction(ctx, func(tx db.Tx) error {
+		var row postgresRateLimitRow
+		// the row is created if needed and locked until the end of the transaction
+		query := `INSERT INTO rate_limits (key, expires_at, time, count, previous_count)
+			VALUES ($1, now(), NULL, 0, 0)
+			ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+			RETURNING time, count, previous_count, now() AS now`
+		txErr := tx.Get(ctx, &row, query, key)
+		if txErr != nil {
+			return fmt.Errorf("locking quota: %w", txErr)
+		}
+
+		var state rateLimitState
+		if row.Time != nil {
+			state = rateLimitState{
+				Time:          *row.Time,
+				Count:         row.Count,
+				PreviousCount: row.PreviousCount,
+			}
+		}
+		result = policy.take(&state, row.Now)
+
+		query = `UPDATE rate_limits SET expires_at = $2, time = $3, count = $4, previous_count = $5
+			WHERE key = $1`
+		_, txErr = tx.Exec(ctx, query, key, state.expiresAt(policy), state.Time, state.Count, state.PreviousCount)
+		if txErr != nil {
+			return fmt.Errorf("updating quota: %w", txErr)
+		}
+
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("middlewarex.PostgresRateLimitStore.Allow: %w", err)
+		return
+	}
+
+	return
+}
+
+// DeleteExpired deletes the quotas that are back to their initial state.
+func (store *PostgresRateLimitStore) DeleteExpired(ctx context.Context) (err error) {
+	_, err = store.db.Exec(ctx, "DELETE FROM rate_limits WHERE expires_at < now()")
+	if err != nil {
+		err = fmt.Errorf("middlewarex.PostgresRateLimitStore.DeleteExpired: %w", err)
+		return
+	}
+
+	return
+}
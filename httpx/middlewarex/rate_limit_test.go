@@ -0,0 +1,159 @@
+package middlewarex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/httpx"
+)
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	policy := RateLimitPolicy{Algorithm: RateLimitTokenBucket, Requests: 10, Period: 10 * time.Second}
+	var state rateLimitState
+	now := time.Now()
+
+	for i := range 10 {
+		result := policy.take(&state, now)
+		if !result.Allowed || result.Remaining != int64(9-i) {
+			t.Fatalf("request %d: unexpected result: %+v", i, result)
+		}
+	}
+
+	result := policy.take(&state, now)
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != time.Second || result.ResetAfter != 10*time.Second {
+		t.Fatalf("request over the limit: unexpected result: %+v", result)
+	}
+
+	// one token is refilled every second
+	result = policy.take(&state, now.Add(1500*time.Millisecond))
+	if !result.Allowed || result.Remaining != 0 || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("request after the refill: unexpected result: %+v", result)
+	}
+
+	// the bucket can't hold more than Requests tokens
+	result = policy.take(&state, now.Add(time.Hour))
+	if !result.Allowed || result.Remaining != 9 {
+		t.Errorf("request after an hour: unexpected result: %+v", result)
+	}
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	policy := RateLimitPolicy{Algorithm: RateLimitSlidingWindow, Requests: 10, Period: 10 * time.Second}
+	var state rateLimitState
+	now := time.Now()
+
+	for i := range 10 {
+		result := policy.take(&state, now)
+		if !result.Allowed || result.Remaining != int64(9-i) {
+			t.Fatalf("request %d: unexpected result: %+v", i, result)
+		}
+	}
+
+	result := policy.take(&state, now.Add(5*time.Second))
+	if result.Allowed || result.ResetAfter != 5*time.Second || result.RetryAfter != 6*time.Second {
+		t.Fatalf("request over the limit: unexpected result: %+v", result)
+	}
+
+	// 12s: the previous window (10 requests) overlaps 80% of the sliding window
+	for i := range 2 {
+		result = policy.take(&state, now.Add(12*time.Second))
+		if !result.Allowed || result.Remaining != int64(1-i) {
+			t.Fatalf("request %d in the next window: unexpected result: %+v", i, result)
+		}
+	}
+	result = policy.take(&state, now.Add(12*time.Second))
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("request over the limit in the next window: unexpected result: %+v", result)
+	}
+
+	// 15s: the previous window overlaps 50% of the sliding window
+	result = policy.take(&state, now.Add(15*time.Second))
+	if !result.Allowed || result.Remaining != 2 {
+		t.Errorf("request in the middle of the next window: unexpected result: %+v", result)
+	}
+
+	result = policy.take(&state, now.Add(time.Minute))
+	if !result.Allowed || result.Remaining != 9 {
+		t.Errorf("request after a minute: unexpected result: %+v", result)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	store := NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{})
+	defer store.Stop()
+
+	handler := RateLimit(RateLimitConfig{
+		Store:   store,
+		Policy:  RateLimitPolicy{Requests: 2, Period: time.Minute},
+		KeyFunc: RateLimitByIPPrefix(32, 64, nil),
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve("1.2.3.4:1234")
+	if res.Code != http.StatusOK || res.Header().Get(HeaderRateLimitRemaining) != "1" ||
+		res.Header().Get(HeaderRateLimitLimit) != "2" || res.Header().Get(HeaderRateLimitPolicy) != "2;w=60" {
+		t.Errorf("first request: unexpected response: %d %v", res.Code, res.Header())
+	}
+	serve("1.2.3.4:1234")
+	res = serve("1.2.3.4:1234")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get(httpx.HeaderRetryAfter) != "30" {
+		t.Errorf("third request: unexpected response: %d %v", res.Code, res.Header())
+	}
+
+	// addresses of the same /64 network share the same quota
+	serve("[2001:db8::1]:1234")
+	serve("[2001:db8::2]:1234")
+	res = serve("[2001:db8::3]:1234")
+	if res.Code != http.StatusTooManyRequests {
+		t.Errorf("IPv6: expected status %d, got %d", http.StatusTooManyRequests, res.Code)
+	}
+	res = serve("[2001:db8:1::1]:1234")
+	if res.Code != http.StatusOK {
+		t.Errorf("IPv6 in another network: expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	// requests without a key are not rate limited
+	res = serve("@")
+	if res.Code != http.StatusOK || res.Header().Get(HeaderRateLimitLimit) != "" {
+		t.Errorf("request without a key: unexpected response: %d %v", res.Code, res.Header())
+	}
+}
+
+func TestMemoryRateLimitStoreConcurrency(t *testing.T) {
+	store := NewMemoryRateLimitStore(MemoryRateLimitStoreConfig{})
+	defer store.Stop()
+	policy := RateLimitPolicy{Algorithm: RateLimitSlidingWindow, Requests: 50, Period: time.Minute}
+
+	var allowed atomic.Int64
+	var waitGroup sync.WaitGroup
+	for range 200 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			result, err := store.Allow(context.Background(), "key", policy)
+			if err != nil {
+				t.Error(err)
+			}
+			if result.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	if allowed.Load() != 50 {
+		t.Errorf("expected 50 allowed requests, got %d", allowed.Load())
+	}
+}
@@ -0,0 +1,440 @@
+package middlewarex
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/memorycache"
+	"github.com/bloom42/stdx-go/xxh3"
+)
+
+// HeaderSurrogateKey is the response header that lists, separated by spaces, the surrogate keys of a
+// response, which can be used to purge it from a ResponseCache. It is not sent to the clients.
+const HeaderSurrogateKey = "Surrogate-Key"
+
+const (
+	// DefaultResponseCacheCapacity is the default maximum number of responses of a ResponseCache.
+	DefaultResponseCacheCapacity = 10_000
+	// DefaultResponseCachingMaxBodySize is the default maximum size of the responses buffered by ResponseCaching.
+	DefaultResponseCachingMaxBodySize = 1 << 20
+	// DefaultResponseCachingTTL is the default duration for which responses without a max-age or s-maxage
+	// Cache-Control directive are cached.
+	DefaultResponseCachingTTL = time.Minute
+)
+
+type ResponseCacheConfig struct {
+	// Capacity is the maximum number of responses kept in memory. When it is reached, the least recently
+	// used response is evicted.
+	// default: DefaultResponseCacheCapacity
+	Capacity uint64
+}
+
+// ResponseCache stores the responses cached by ResponseCaching in memory, and allows to purge them by
+// surrogate key (see HeaderSurrogateKey).
+type ResponseCache struct {
+	cache *memorycache.Cache[string, *cachedResponse]
+
+	mutex sync.Mutex
+	// surrogateKeys maps the surrogate keys to the keys of the cached responses
+	surrogateKeys map[string]map[string]struct{}
+}
+
+type cachedResponse struct {
+	status        int
+	header        http.Header
+	body          []byte
+	createdAt     time.Time
+	surrogateKeys []string
+}
+
+func NewResponseCache(config ResponseCacheConfig) *ResponseCache {
+	if config.Capacity == 0 {
+		config.Capacity = DefaultResponseCacheCapacity
+	}
+
+	responseCache := &ResponseCache{
+		cache: memorycache.New(
+			memorycache.WithCapacity[string, *cachedResponse](config.Capacity),
+			// cached responses must expire even if they are requested frequently
+			memorycache.WithDisableTouchOnHit[string, *cachedResponse](),
+		),
+		mutex:         sync.Mutex{},
+		surrogateKeys: make(map[string]map[string]struct{}),
+	}
+	responseCache.cache.OnEviction(responseCache.onEviction)
+
+	return responseCache
+}
+
+// Purge deletes the responses with any of the given surrogate keys.
+func (responseCache *ResponseCache) Purge(surrogateKeys ...string) {
+	responseCache.mutex.Lock()
+	defer responseCache.mutex.Unlock()
+
+	for _, surrogateKey := range surrogateKeys {
+		for key := range responseCache.surrogateKeys[surrogateKey] {
+			responseCache.cache.Delete(key)
+		}
+		delete(responseCache.surrogateKeys, surrogateKey)
+	}
+}
+
+// PurgeAll deletes all the responses.
+func (responseCache *ResponseCache) PurgeAll() {
+	responseCache.mutex.Lock()
+	defer responseCache.mutex.Unlock()
+
+	responseCache.cache.DeleteAll()
+	clear(responseCache.surrogateKeys)
+}
+
+// Stop stops the goroutine that deletes the expired responses.
+func (responseCache *ResponseCache) Stop() {
+	responseCache.cache.Stop()
+}
+
+func (responseCache *ResponseCache) get(key string) *cachedResponse {
+	item := responseCache.cache.Get(key)
+	if item == nil {
+		return nil
+	}
+	return item.Value()
+}
+
+func (responseCache *ResponseCache) set(key string, response *cachedResponse, ttl time.Duration) {
+	responseCache.mutex.Lock()
+	defer responseCache.mutex.Unlock()
+
+	responseCache.cache.Set(key, response, ttl)
+	for _, surrogateKey := range response.surrogateKeys {
+		if responseCache.surrogateKeys[surrogateKey] == nil {
+			responseCache.surrogateKeys[surrogateKey] = make(map[string]struct{})
+		}
+		responseCache.surrogateKeys[surrogateKey][key] = struct{}{}
+	}
+}
+
+func (responseCache *ResponseCache) onEviction(_ context.Context, _ memorycache.EvictionReason, item *memorycache.Item[string, *cachedResponse]) {
+	responseCache.mutex.Lock()
+	defer responseCache.mutex.Unlock()
+
+	key := item.Key()
+	if responseCache.cache.Has(key) {
+		// the response has been replaced
+		return
+	}
+	for _, surrogateKey := range item.Value().surrogateKeys {
+		delete(responseCache.surrogateKeys[surrogateKey], key)
+		if len(responseCache.surrogateKeys[surrogateKey]) == 0 {
+			delete(responseCache.surrogateKeys, surrogateKey)
+		}
+	}
+}
+
+type ResponseCachingConfig struct {
+	// Cache, if not nil, stores the successful responses to GET requests, which are then served from
+	// memory to the subsequent GET and HEAD requests until they expire.
+	Cache *ResponseCache
+	// VaryHeaders are the request headers whose values are part of the key of the cached responses
+	// (e.g. Accept-Encoding or Accept-Language), in addition to the method, path and query of the requests.
+	// Responses with a Vary header that lists other headers are not cached.
+	VaryHeaders []string
+	// TTL is the duration for which responses are cached when their Cache-Control header has no max-age or
+	// s-maxage directive.
+	// default: DefaultResponseCachingTTL
+	TTL time.Duration
+	// MaxBodySize is the maximum size in bytes of the responses that are buffered. Larger responses are
+	// streamed to the client, without ETag and without being cached.
+	// default: DefaultResponseCachingMaxBodySize
+	MaxBodySize int64
+}
+
+// ResponseCaching buffers the successful responses to GET requests to add a strong ETag header (the
+// XXH3-128 hash of the body) if they don't have one, and answers the requests whose If-None-Match header
+// matches the ETag with a 304 Not Modified status code.
+//
+// If config.Cache is not nil, responses are also cached in memory, unless:
+//   - their Cache-Control header has the no-store, no-cache or private directive;
+//   - they set cookies;
+//   - the request has an Authorization header and their Cache-Control header has not the public directive;
+//   - the request has a Cookie header, their Cache-Control header has not the public directive and Cookie
+//     is not one of config.VaryHeaders.
+func ResponseCaching(config ResponseCachingConfig) func(next http.Handler) http.Handler {
+	if config.TTL == 0 {
+		config.TTL = DefaultResponseCachingTTL
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultResponseCachingMaxBodySize
+	}
+	for index, header := range config.VaryHeaders {
+		config.VaryHeaders[index] = http.CanonicalHeaderKey(header)
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			cacheKey := ""
+			if config.Cache != nil {
+				cacheKey = responseCacheKey(req, config.VaryHeaders)
+				if response := config.Cache.get(cacheKey); response != nil {
+					w.Header().Set(httpx.HeaderAge, strconv.FormatInt(int64(time.Since(response.createdAt).Seconds()), 10))
+					writeBufferedResponse(w, req, response)
+					return
+				}
+			}
+
+			if req.Method == http.MethodHead {
+				// the body of the response is not available to compute its ETag
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			// the headers set by the outer middlewares (e.g. X-Request-ID) are specific to the request, so only
+			// the headers set by the handler are cached
+			headerBeforeHandler := w.Header().Clone()
+			buffer := &bufferedResponseWriter{ResponseWriter: w, maxSize: config.MaxBodySize}
+			next.ServeHTTP(buffer, req)
+			if buffer.streaming {
+				return
+			}
+
+			status := buffer.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			header := w.Header()
+			surrogateKeys := strings.Fields(header.Get(HeaderSurrogateKey))
+			header.Del(HeaderSurrogateKey)
+			if status == http.StatusOK && header.Get(httpx.HeaderETag) == "" {
+				hash := xxh3.Hash128(buffer.body.Bytes()).Bytes()
+				header.Set(httpx.HeaderETag, `"`+base64.RawURLEncoding.EncodeToString(hash[:])+`"`)
+			}
+
+			response := &cachedResponse{
+				status:        status,
+				header:        header,
+				body:          buffer.body.Bytes(),
+				createdAt:     time.Now(),
+				surrogateKeys: surrogateKeys,
+			}
+			if cacheKey != "" && status == http.StatusOK {
+				if ttl, cacheable := responseCacheTTL(req, header, config); cacheable {
+					response.header = handlerHeader(headerBeforeHandler, header)
+					config.Cache.set(cacheKey, response, ttl)
+				}
+			}
+
+			writeBufferedResponse(w, req, response)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func responseCacheKey(req *http.Request, varyHeaders []string) string {
+	var key strings.Builder
+	// HEAD requests are served with the responses to GET requests
+	key.WriteString(http.MethodGet)
+	key.WriteByte(' ')
+	key.WriteString(req.Host)
+	key.WriteString(req.URL.Path)
+	if req.URL.RawQuery != "" {
+		key.WriteByte('?')
+		// the values are sorted by key
+		key.WriteString(req.URL.Query().Encode())
+	}
+	for _, header := range varyHeaders {
+		key.WriteByte('\n')
+		key.WriteString(header)
+		key.WriteByte(':')
+		key.WriteString(strings.Join(req.Header.Values(header), ","))
+	}
+	return key.String()
+}
+
+// responseCacheTTL returns the duration for which the response can be cached.
+func responseCacheTTL(req *http.Request, header http.Header, config ResponseCachingConfig) (ttl time.Duration, cacheable bool) {
+	if len(header.Values("Set-Cookie")) != 0 {
+		return
+	}
+	for _, vary := range header.Values(httpx.HeaderVary) {
+		for _, varyHeader := range strings.Split(vary, ",") {
+			varyHeader = http.CanonicalHeaderKey(strings.TrimSpace(varyHeader))
+			if varyHeader == "*" || !slices.Contains(config.VaryHeaders, varyHeader) {
+				return
+			}
+		}
+	}
+
+	ttl = config.TTL
+	public := false
+	sharedMaxAge := false
+	for _, cacheControl := range header.Values(httpx.HeaderCacheControl) {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(name) {
+			case "no-store", "no-cache", "private":
+				return 0, false
+			case "public":
+				public = true
+			case "max-age", "s-maxage":
+				seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+				if err != nil {
+					return 0, false
+				}
+				// s-maxage has precedence over max-age for shared caches
+				if !sharedMaxAge {
+					ttl = time.Duration(seconds) * time.Second
+				}
+				if strings.ToLower(name) == "s-maxage" {
+					sharedMaxAge = true
+				}
+			}
+		}
+	}
+
+	if req.Header.Get(httpx.HeaderAuthorization) != "" && !public {
+		return 0, false
+	}
+	// as with Authorization, the response may depend on the user (e.g. with a session cookie), unless the
+	// cookies are part of the cache key
+	if req.Header.Get("Cookie") != "" && !public && !slices.Contains(config.VaryHeaders, "Cookie") {
+		return 0, false
+	}
+	return ttl, ttl > 0
+}
+
+// handlerHeader returns the headers that have been added or modified between before and after. The
+// headers that have been deleted have a nil value.
+func handlerHeader(before, after http.Header) http.Header {
+	header := http.Header{}
+	for key, values := range after {
+		if !slices.Equal(before[key], values) {
+			header[key] = slices.Clone(values)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			header[key] = nil
+		}
+	}
+	return header
+}
+
+// writeBufferedResponse writes response, or a 304 Not Modified response if the If-None-Match header of
+// the request matches its ETag.
+func writeBufferedResponse(w http.ResponseWriter, req *http.Request, response *cachedResponse) {
+	header := w.Header()
+	for key, values := range response.header {
+		if values == nil {
+			header.Del(key)
+		} else {
+			header[key] = slices.Clone(values)
+		}
+	}
+
+	etag := header.Get(httpx.HeaderETag)
+	if response.status == http.StatusOK && etag != "" && etagMatches(req.Header.Get(httpx.HeaderIfNoneMatch), etag) {
+		header.Del(httpx.HeaderContentType)
+		header.Del(httpx.HeaderContentLength)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set(httpx.HeaderContentLength, strconv.Itoa(len(response.body)))
+	w.WriteHeader(response.status)
+	if req.Method != http.MethodHead {
+		w.Write(response.body)
+	}
+}
+
+// etagMatches reports whether the value of an If-None-Match header matches etag, with the weak comparison.
+func etagMatches(ifNoneMatch, etag string) bool {
+	ifNoneMatch = strings.TrimSpace(ifNoneMatch)
+	if ifNoneMatch == "" {
+		return false
+	}
+	if ifNoneMatch == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponseWriter buffers the body of a response, up to maxSize bytes. Larger responses, and
+// responses that are flushed, are streamed to the underlying http.ResponseWriter.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	maxSize   int64
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+// ensure that bufferedResponseWriter implements http.Flusher
+var _ http.Flusher = (*bufferedResponseWriter)(nil)
+
+func (buffer *bufferedResponseWriter) WriteHeader(statusCode int) {
+	if buffer.streaming || (statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols) {
+		// informational responses (e.g. 103 Early Hints) are sent right away
+		buffer.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if buffer.status == 0 {
+		buffer.status = statusCode
+	}
+}
+
+func (buffer *bufferedResponseWriter) Write(data []byte) (int, error) {
+	if buffer.status == 0 {
+		buffer.status = http.StatusOK
+	}
+	if !buffer.streaming && int64(buffer.body.Len()+len(data)) > buffer.maxSize {
+		buffer.startStreaming()
+	}
+	if buffer.streaming {
+		return buffer.ResponseWriter.Write(data)
+	}
+	return buffer.body.Write(data)
+}
+
+func (buffer *bufferedResponseWriter) Flush() {
+	if !buffer.streaming {
+		buffer.startStreaming()
+	}
+	if flusher, ok := buffer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (buffer *bufferedResponseWriter) Unwrap() http.ResponseWriter {
+	return buffer.ResponseWriter
+}
+
+func (buffer *bufferedResponseWriter) startStreaming() {
+	buffer.streaming = true
+	buffer.Header().Del(HeaderSurrogateKey)
+	if buffer.status == 0 {
+		buffer.status = http.StatusOK
+	}
+	buffer.ResponseWriter.WriteHeader(buffer.status)
+	buffer.ResponseWriter.Write(buffer.body.Bytes())
+	buffer.body = bytes.Buffer{}
+}
@@ -0,0 +1,170 @@
+package middlewarex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/stdx-go/httpx"
+)
+
+func TestResponseCaching(t *testing.T) {
+	cache := NewResponseCache(ResponseCacheConfig{})
+	defer cache.Stop()
+
+	calls := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/articles", func(w http.ResponseWriter, req *http.Request) {
+		calls[req.URL.Path] += 1
+		w.Header().Set(HeaderSurrogateKey, "articles article-1")
+		w.Header().Set(httpx.HeaderContentType, httpx.MediaTypeJson)
+		w.Write([]byte(`[{"id":1}]`))
+	})
+	mux.HandleFunc("/no-store", func(w http.ResponseWriter, req *http.Request) {
+		calls[req.URL.Path] += 1
+		w.Header().Set(httpx.HeaderCacheControl, httpx.CacheControlNoCache)
+		w.Write([]byte("private"))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, req *http.Request) {
+		calls[req.URL.Path] += 1
+		w.Write([]byte(strings.Repeat("a", 100)))
+	})
+	handler := ResponseCaching(ResponseCachingConfig{Cache: cache, MaxBodySize: 64})(mux)
+
+	serve := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for key, values := range header {
+			req.Header.Set(key, values[0])
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve(http.MethodGet, "/articles?b=2&a=1", nil)
+	etag := res.Header().Get(httpx.HeaderETag)
+	if res.Code != http.StatusOK || etag == "" || res.Header().Get(HeaderSurrogateKey) != "" || res.Body.String() != `[{"id":1}]` {
+		t.Fatalf("/articles: unexpected response: %d %v %q", res.Code, res.Header(), res.Body.String())
+	}
+
+	// the query parameters are normalized
+	res = serve(http.MethodGet, "/articles?a=1&b=2", nil)
+	if res.Code != http.StatusOK || calls["/articles"] != 1 || res.Header().Get(httpx.HeaderAge) == "" ||
+		res.Header().Get(httpx.HeaderETag) != etag || res.Body.String() != `[{"id":1}]` {
+		t.Errorf("/articles from the cache: unexpected response: %d %v %q", res.Code, res.Header(), res.Body.String())
+	}
+
+	res = serve(http.MethodHead, "/articles?a=1&b=2", http.Header{httpx.HeaderIfNoneMatch: {`"other", ` + etag}})
+	if res.Code != http.StatusNotModified || res.Body.Len() != 0 || calls["/articles"] != 1 {
+		t.Errorf("/articles with If-None-Match: unexpected response: %d %q", res.Code, res.Body.String())
+	}
+
+	// responses of requests with an Authorization header are not cached without Cache-Control: public
+	serve(http.MethodGet, "/articles?a=2", http.Header{httpx.HeaderAuthorization: {"Bearer token"}})
+	serve(http.MethodGet, "/articles?a=2", nil)
+	if calls["/articles"] != 3 {
+		t.Errorf("/articles with an Authorization header: expected 3 calls, got %d", calls["/articles"])
+	}
+
+	cache.Purge("article-1")
+	res = serve(http.MethodGet, "/articles?a=1&b=2", nil)
+	if calls["/articles"] != 4 || res.Header().Get(httpx.HeaderAge) != "" {
+		t.Errorf("/articles after purge: expected 4 calls, got %d", calls["/articles"])
+	}
+
+	serve(http.MethodGet, "/no-store", nil)
+	res = serve(http.MethodGet, "/no-store", nil)
+	if calls["/no-store"] != 2 || res.Header().Get(httpx.HeaderETag) == "" {
+		t.Errorf("/no-store: unexpected response: %d calls, headers %v", calls["/no-store"], res.Header())
+	}
+
+	serve(http.MethodGet, "/large", nil)
+	res = serve(http.MethodGet, "/large", nil)
+	if calls["/large"] != 2 || res.Header().Get(httpx.HeaderETag) != "" || res.Body.Len() != 100 {
+		t.Errorf("/large: unexpected response: %d calls, headers %v, %d bytes", calls["/large"], res.Header(), res.Body.Len())
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	config := ResponseCachingConfig{TTL: DefaultResponseCachingTTL, VaryHeaders: []string{"Accept-Encoding"}}
+
+	tests := []struct {
+		cacheControl      string
+		vary              string
+		authorization     bool
+		cookie            bool
+		varyCookie        bool
+		expectedTTL       int
+		expectedCacheable bool
+	}{
+		{cacheControl: "", expectedTTL: 60, expectedCacheable: true},
+		{cacheControl: "public, max-age=30", expectedTTL: 30, expectedCacheable: true},
+		{cacheControl: "max-age=30, s-maxage=300", expectedTTL: 300, expectedCacheable: true},
+		{cacheControl: "s-maxage=300, max-age=30", expectedTTL: 300, expectedCacheable: true},
+		{cacheControl: "max-age=0"},
+		{cacheControl: "private, max-age=30"},
+		{cacheControl: "no-store"},
+		{vary: "Accept-Encoding", expectedTTL: 60, expectedCacheable: true},
+		{vary: "Accept-Encoding, Cookie"},
+		{vary: "*"},
+		{authorization: true},
+		{cacheControl: "public", authorization: true, expectedTTL: 60, expectedCacheable: true},
+		{cookie: true},
+		{cacheControl: "max-age=30", cookie: true},
+		{cacheControl: "public", cookie: true, expectedTTL: 60, expectedCacheable: true},
+		{cookie: true, varyCookie: true, expectedTTL: 60, expectedCacheable: true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.authorization {
+			req.Header.Set(httpx.HeaderAuthorization, "Bearer token")
+		}
+		if test.cookie {
+			req.Header.Set("Cookie", "session=token")
+		}
+		config := config
+		if test.varyCookie {
+			config.VaryHeaders = []string{"Accept-Encoding", "Cookie"}
+		}
+		header := http.Header{}
+		if test.cacheControl != "" {
+			header.Set(httpx.HeaderCacheControl, test.cacheControl)
+		}
+		if test.vary != "" {
+			header.Set(httpx.HeaderVary, test.vary)
+		}
+
+		ttl, cacheable := responseCacheTTL(req, header, config)
+		if int(ttl.Seconds()) != test.expectedTTL || cacheable != test.expectedCacheable {
+			t.Errorf("%+v: expected (%d, %v), got (%s, %v)", test, test.expectedTTL, test.expectedCacheable, ttl, cacheable)
+		}
+	}
+}
+
+func TestResponseCachingWithRequestID(t *testing.T) {
+	cache := NewResponseCache(ResponseCacheConfig{})
+	defer cache.Stop()
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(httpx.HeaderContentType, httpx.MediaTypeJson)
+		w.Write([]byte(`{}`))
+	})
+	handler = ResponseCaching(ResponseCachingConfig{Cache: cache})(handler)
+	handler = RequestID("X-Request-ID")(handler)
+
+	requestIDs := map[string]bool{}
+	for range 3 {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		requestIDs[res.Header().Get("X-Request-ID")] = true
+		if res.Header().Get(httpx.HeaderContentType) != httpx.MediaTypeJson || res.Header().Get(httpx.HeaderETag) == "" {
+			t.Errorf("the headers of the handler should be cached: %v", res.Header())
+		}
+	}
+	if len(requestIDs) != 3 {
+		t.Errorf("each response should have its own request ID: %v", requestIDs)
+	}
+}
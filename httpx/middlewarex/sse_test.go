@@ -0,0 +1,56 @@
+package middlewarex
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/httpx"
+	"github.com/bloom42/stdx-go/httpx/cors"
+)
+
+func TestSSEBehindMiddlewares(t *testing.T) {
+	cache := NewResponseCache(ResponseCacheConfig{})
+	defer cache.Stop()
+	broker := httpx.NewSSEBroker(httpx.SSEBrokerConfig{})
+	defer broker.Close()
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		broker.Serve(w, req, "events")
+	})
+	handler = ResponseCaching(ResponseCachingConfig{Cache: cache})(handler)
+	handler = AccessLog(AccessLogConfig{})(handler)
+	handler = cors.AllowAll().Handler(handler)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// a lost event fails the test instead of blocking it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	req.Header.Set(HeaderOrigin, "https://dashboard.example.com")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get(httpx.HeaderContentType) != httpx.MediaTypeEventStream || res.Header.Get(httpx.HeaderETag) != "" {
+		t.Errorf("unexpected headers: %v", res.Header)
+	}
+
+	// the client is subscribed once it has received the response headers
+	broker.Publish("events", httpx.SSEEvent{Data: "update"})
+	reader := bufio.NewReader(res.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "data: update\n" {
+			break
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// MediaTypeProblemJson is the media type of the problem details documents defined by RFC 9457.
+const MediaTypeProblemJson = "application/problem+json"
+
+// Problem is a problem details document, as defined by RFC 9457.
+// It implements the error interface so it can be returned by the handlers of JSONHandler to respond
+// with a specific status code.
+// See https://www.rfc-editor.org/rfc/rfc9457.html
+type Problem struct {
+	// Type is a URI reference that identifies the problem type.
+	// default: "about:blank"
+	Type string `json:"type,omitempty"`
+	// Title is a short, human-readable summary of the problem type.
+	// default: the status text of Status
+	Title string `json:"title,omitempty"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Detail is a human-readable explanation specific to this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI reference that identifies the specific occurrence of the problem.
+	Instance string `json:"instance,omitempty"`
+	// Errors is an extension member that lists the invalid fields of the request.
+	Errors []ProblemFieldError `json:"errors,omitempty"`
+}
+
+// ProblemFieldError describes why a field of a request is not valid.
+type ProblemFieldError struct {
+	// Field is the path of the field in the request, with the components separated by dots.
+	// e.g. address.city
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// NewProblem returns a Problem with the given status code and detail.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (problem *Problem) Error() string {
+	title := problem.Title
+	if title == "" {
+		title = http.StatusText(problem.Status)
+	}
+	if problem.Detail == "" {
+		return "httpx: " + title
+	}
+	return "httpx: " + title + ": " + problem.Detail
+}
+
+// ServeProblem writes sharedProblem as an application/problem+json response. sharedProblem is not modified
+// so it can be shared between requests.
+func ServeProblem(res http.ResponseWriter, sharedProblem *Problem) {
+	problem := *sharedProblem
+	if problem.Status == 0 {
+		problem.Status = http.StatusInternalServerError
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	body, err := json.Marshal(&problem)
+	if err != nil {
+		ServerErrorInternal(res)
+		return
+	}
+
+	res.Header().Del(HeaderETag)
+	res.Header().Set(HeaderCacheControl, CacheControlNoCache)
+	res.Header().Set(HeaderContentType, MediaTypeProblemJson)
+	res.Header().Set(HeaderContentLength, strconv.FormatInt(int64(len(body)), 10))
+	res.WriteHeader(problem.Status)
+	res.Write(body)
+}
@@ -0,0 +1,209 @@
+package httpx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bloom42/stdx-go/retry"
+)
+
+const (
+	HeaderIdempotencyKey  = "Idempotency-Key"
+	HeaderXIdempotencyKey = "X-Idempotency-Key"
+)
+
+// DefaultRetryableStatusCodes are the default status codes of the responses that are retried by RetryTransport.
+var DefaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// errDoNotRetry is returned by an attempt whose response should be returned as is.
+var errDoNotRetry = errors.New("httpx: do not retry")
+
+type RetryTransportConfig struct {
+	// MaxAttempts is the maximum number of attempts of a request, the first one included.
+	// default: 3
+	MaxAttempts uint
+	// Delay is the delay before the first retry. It is doubled for each subsequent retry and a random
+	// jitter of up to Delay is added.
+	// default: 200ms
+	Delay time.Duration
+	// MaxDelay is the maximum delay between 2 attempts, when the response has no Retry-After header.
+	// default: 10s
+	MaxDelay time.Duration
+	// MaxRetryAfter is the maximum delay requested with a Retry-After header that is honored. Responses with
+	// a longer delay are returned without being retried.
+	// default: 1 minute
+	MaxRetryAfter time.Duration
+	// RetryableStatusCodes are the status codes of the responses that are retried.
+	// default: DefaultRetryableStatusCodes
+	RetryableStatusCodes []int
+}
+
+// RetryTransport retries the requests that failed with a network error or a retryable status code, with an
+// exponential backoff (see retry.BackOffDelay), or after the delay of the Retry-After header of the response.
+//
+// Only the idempotent requests are retried: GET, HEAD, OPTIONS, TRACE, PUT and DELETE requests, and the
+// requests with an Idempotency-Key or X-Idempotency-Key header. Their body must be nil or rewindable
+// (http.Request.GetBody, which is set by http.NewRequest for the common readers).
+//
+// When all the attempts failed with a retryable status code, the last response is returned.
+type RetryTransport struct {
+	next   http.RoundTripper
+	config RetryTransportConfig
+}
+
+// ensure that RetryTransport implements http.RoundTripper
+var _ http.RoundTripper = (*RetryTransport)(nil)
+
+// retryableStatusError is returned by an attempt that received a response with a retryable status code.
+type retryableStatusError struct {
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (err *retryableStatusError) Error() string {
+	return "httpx: retryable status code: " + strconv.Itoa(err.statusCode)
+}
+
+func NewRetryTransport(next http.RoundTripper, config RetryTransportConfig) *RetryTransport {
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 3
+	}
+	if config.Delay == 0 {
+		config.Delay = 200 * time.Millisecond
+	}
+	if config.MaxDelay == 0 {
+		config.MaxDelay = 10 * time.Second
+	}
+	if config.MaxRetryAfter == 0 {
+		config.MaxRetryAfter = time.Minute
+	}
+	if config.RetryableStatusCodes == nil {
+		config.RetryableStatusCodes = DefaultRetryableStatusCodes
+	}
+
+	return &RetryTransport{
+		next:   next,
+		config: config,
+	}
+}
+
+func (transport *RetryTransport) RoundTrip(req *http.Request) (res *http.Response, err error) {
+	if transport.config.MaxAttempts < 2 || !isRetryableRequest(req) {
+		return transport.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	attempt := 0
+	backoff := retry.CombineDelay(retry.BackOffDelay, retry.RandomDelay)
+
+	err = retry.Do(func() error {
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(ctx)
+			if req.Body != nil && req.Body != http.NoBody {
+				body, bodyErr := req.GetBody()
+				if bodyErr != nil {
+					return retry.Unrecoverable(bodyErr)
+				}
+				attemptReq.Body = body
+			}
+		}
+		attempt += 1
+
+		if res != nil {
+			// the previous response is retried
+			discardBody(res)
+			res = nil
+		}
+
+		var attemptErr error
+		res, attemptErr = transport.next.RoundTrip(attemptReq)
+		if attemptErr != nil {
+			res = nil
+			if ctx.Err() != nil || errors.Is(attemptErr, ErrCircuitBreakerIsOpen) ||
+				errors.Is(attemptErr, ErrResponseBodyTooLarge) {
+				return retry.Unrecoverable(attemptErr)
+			}
+			return attemptErr
+		}
+
+		if !slices.Contains(transport.config.RetryableStatusCodes, res.StatusCode) {
+			return nil
+		}
+		retryAfter, hasRetryAfter := parseRetryAfter(res.Header.Get(HeaderRetryAfter), time.Now())
+		if hasRetryAfter && retryAfter > transport.config.MaxRetryAfter {
+			return retry.Unrecoverable(errDoNotRetry)
+		}
+		return &retryableStatusError{statusCode: res.StatusCode, retryAfter: retryAfter}
+	},
+		retry.Context(ctx),
+		retry.Attempts(transport.config.MaxAttempts),
+		retry.Delay(transport.config.Delay),
+		retry.MaxJitter(transport.config.Delay),
+		retry.LastErrorOnly(true),
+		retry.DelayType(func(n uint, err error, config *retry.Config) time.Duration {
+			delay := min(backoff(n, err, config), transport.config.MaxDelay)
+			var statusErr *retryableStatusError
+			if errors.As(err, &statusErr) {
+				delay = max(delay, statusErr.retryAfter)
+			}
+			return delay
+		}),
+	)
+	if err != nil {
+		var statusErr *retryableStatusError
+		if res != nil && (errors.As(err, &statusErr) || errors.Is(err, errDoNotRetry)) {
+			return res, nil
+		}
+		if res != nil {
+			discardBody(res)
+			res = nil
+		}
+		return
+	}
+
+	return
+}
+
+func isRetryableRequest(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(HeaderIdempotencyKey) != "" || req.Header.Get(HeaderXIdempotencyKey) != ""
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an
+// HTTP date.
+func parseRetryAfter(value string, now time.Time) (retryAfter time.Duration, found bool) {
+	if value == "" {
+		return
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return
+}
+
+// discardBody reads a bit of the body of the response so that the connection can be reused, and closes it.
+func discardBody(res *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	res.Body.Close()
+}
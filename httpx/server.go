@@ -0,0 +1,368 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bloom42/stdx-go/log/slogx"
+	"github.com/bloom42/stdx-go/proxyproto"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// DefaultHealthPath is the default path of the health endpoint of a Server.
+	DefaultHealthPath = "/healthz"
+	// DefaultReadinessPath is the default path of the readiness endpoint of a Server.
+	DefaultReadinessPath = "/readyz"
+	// DefaultShutdownTimeout is the default maximum duration of the graceful shutdown of a Server.
+	DefaultShutdownTimeout = 30 * time.Second
+
+	NetworkTCP  = "tcp"
+	NetworkUnix = "unix"
+)
+
+var (
+	ErrServerHandlerIsNil      = errors.New("httpx: server handler is nil")
+	ErrServerHasNoListener     = errors.New("httpx: server has no listener")
+	ErrServerTLSIsNotEnabled   = errors.New("httpx: a TLS listener requires TLSConfig or Autocert")
+	ErrServerNetworkIsNotValid = errors.New("httpx: listener network must be tcp or unix")
+	ErrServerIsAlreadyRunning  = errors.New("httpx: server is already running")
+)
+
+type ServerConfig struct {
+	Handler   http.Handler
+	Listeners []ListenerConfig
+	// TLSConfig is the TLS configuration of the TLS listeners. It is ignored if Autocert is set.
+	TLSConfig *tls.Config
+	// Autocert, if not nil, obtains and renews the certificates of the TLS listeners with ACME (e.g. Let's
+	// Encrypt). The ACME http-01 challenges are answered on the listeners without TLS.
+	Autocert *AutocertConfig
+	// ConnContext is used as http.Server.ConnContext. e.g. middlewarex.ConnContext
+	ConnContext func(ctx context.Context, conn net.Conn) context.Context
+
+	// ShutdownDelay is the duration between the start of the shutdown, when the health and readiness
+	// endpoints start to fail, and the closing of the listeners, so that load balancers can stop sending
+	// new requests to the server.
+	// default: 0
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is the maximum duration to wait for the in-flight requests to complete during
+	// shutdown. Connections are forcibly closed after it.
+	// default: DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+
+	// HealthPath is the path of the health endpoint, which responds with a 200 status code until the
+	// server starts to shut down, and a 503 status code after.
+	// default: DefaultHealthPath
+	HealthPath string
+	// ReadinessPath is the path of the readiness endpoint, which responds with a 200 status code when the
+	// server is ready to receive requests (see Server.SetReady), and a 503 status code otherwise.
+	// default: DefaultReadinessPath
+	ReadinessPath string
+
+	// default: 10s
+	ReadHeaderTimeout time.Duration
+	// default: 0 (no timeout)
+	ReadTimeout time.Duration
+	// default: 0 (no timeout)
+	WriteTimeout time.Duration
+	// default: 120s
+	IdleTimeout time.Duration
+	// default: http.DefaultMaxHeaderBytes
+	MaxHeaderBytes int
+}
+
+type ListenerConfig struct {
+	// Network is either NetworkTCP or NetworkUnix.
+	// default: NetworkTCP
+	Network string
+	// Address is the address to listen on for TCP listeners (e.g. :8080), or the path of the socket for unix
+	// listeners (e.g. /run/app/http.sock).
+	Address string
+	// ReusePort sets the SO_REUSEPORT option on TCP sockets, so that multiple processes can listen on the
+	// same port, e.g. for zero-downtime restarts.
+	ReusePort bool
+	// TLS serves HTTPS on the listener, with ServerConfig.TLSConfig or ServerConfig.Autocert.
+	TLS bool
+	// ProxyProtocol reads the PROXY protocol header sent by load balancers on the connections (see
+	// proxyproto), with ProxyProtocolPolicy.
+	ProxyProtocol bool
+	// default: proxyproto.USE
+	ProxyProtocolPolicy proxyproto.Policy
+}
+
+type AutocertConfig struct {
+	// Domains are the domains for which certificates can be obtained.
+	Domains []string
+	// Email is the contact email of the ACME account. Optional.
+	Email string
+	// Cache stores the certificates and the ACME account key. e.g. autocertpg.NewCache(db, key)
+	Cache autocert.Cache
+}
+
+// Server runs an http.Server on multiple listeners until its context is canceled, then shuts it down
+// gracefully.
+type Server struct {
+	config ServerConfig
+	// ready is set by the application with SetReady
+	ready        atomic.Bool
+	running      atomic.Bool
+	shuttingDown atomic.Bool
+
+	mutex sync.Mutex
+	addrs []net.Addr
+}
+
+func NewServer(config ServerConfig) (server *Server, err error) {
+	if config.Handler == nil {
+		return nil, ErrServerHandlerIsNil
+	}
+	if len(config.Listeners) == 0 {
+		return nil, ErrServerHasNoListener
+	}
+	for index := range config.Listeners {
+		listener := &config.Listeners[index]
+		if listener.Network == "" {
+			listener.Network = NetworkTCP
+		}
+		if listener.Network != NetworkTCP && listener.Network != NetworkUnix {
+			return nil, ErrServerNetworkIsNotValid
+		}
+		if listener.TLS && config.TLSConfig == nil && config.Autocert == nil {
+			return nil, ErrServerTLSIsNotEnabled
+		}
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if config.HealthPath == "" {
+		config.HealthPath = DefaultHealthPath
+	}
+	if config.ReadinessPath == "" {
+		config.ReadinessPath = DefaultReadinessPath
+	}
+	if config.ReadHeaderTimeout == 0 {
+		config.ReadHeaderTimeout = 10 * time.Second
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 120 * time.Second
+	}
+
+	server = &Server{
+		config: config,
+		mutex:  sync.Mutex{},
+	}
+	server.ready.Store(true)
+	return server, nil
+}
+
+// SetReady sets whether the application is ready to receive requests, e.g. to fail the readiness checks
+// while a dependency is unavailable. The server is ready by default.
+func (server *Server) SetReady(ready bool) {
+	server.ready.Store(ready)
+}
+
+// Addrs returns the addresses of the listeners of the running server.
+func (server *Server) Addrs() []net.Addr {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.addrs
+}
+
+// Run opens the listeners and serves the requests until ctx is canceled or a listener fails. Then it
+// shuts down the server gracefully: the health and readiness endpoints start to fail, the listeners are
+// closed after ShutdownDelay, and the in-flight requests are given ShutdownTimeout to complete.
+func (server *Server) Run(ctx context.Context) (err error) {
+	if !server.running.CompareAndSwap(false, true) {
+		return ErrServerIsAlreadyRunning
+	}
+	defer server.running.Store(false)
+	server.shuttingDown.Store(false)
+	logger := slogx.FromCtx(ctx)
+
+	tlsConfig := server.config.TLSConfig
+	handler := server.handler()
+	if server.config.Autocert != nil {
+		autocertManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(server.config.Autocert.Domains...),
+			Cache:      server.config.Autocert.Cache,
+			Email:      server.config.Autocert.Email,
+		}
+		tlsConfig = autocertManager.TLSConfig()
+		httpsHandler := handler
+		challengeHandler := autocertManager.HTTPHandler(handler)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.TLS == nil {
+				challengeHandler.ServeHTTP(w, req)
+			} else {
+				httpsHandler.ServeHTTP(w, req)
+			}
+		})
+	}
+
+	listeners, err := server.listen(ctx, tlsConfig)
+	if err != nil {
+		return
+	}
+
+	httpServer := &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: server.config.ReadHeaderTimeout,
+		ReadTimeout:       server.config.ReadTimeout,
+		WriteTimeout:      server.config.WriteTimeout,
+		IdleTimeout:       server.config.IdleTimeout,
+		MaxHeaderBytes:    server.config.MaxHeaderBytes,
+		ConnContext:       server.config.ConnContext,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		BaseContext: func(net.Listener) context.Context {
+			// requests are not canceled when the server starts to shut down
+			return context.WithoutCancel(ctx)
+		},
+	}
+
+	serveErrors := make(chan error, len(listeners))
+	var waitGroup sync.WaitGroup
+	for _, listener := range listeners {
+		logger.Info("httpx.Server: listening", slog.String("address", listener.Addr().String()))
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			serveErr := httpServer.Serve(listener)
+			if !errors.Is(serveErr, http.ErrServerClosed) {
+				serveErrors <- fmt.Errorf("httpx.Server: serving on %s: %w", listener.Addr(), serveErr)
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case err = <-serveErrors:
+	}
+
+	server.shuttingDown.Store(true)
+	logger.Info("httpx.Server: shutting down")
+	if err == nil && server.config.ShutdownDelay > 0 {
+		time.Sleep(server.config.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), server.config.ShutdownTimeout)
+	defer cancel()
+	shutdownErr := httpServer.Shutdown(shutdownCtx)
+	if shutdownErr != nil {
+		logger.Warn("httpx.Server: graceful shutdown timed out, closing connections", slogx.Err(shutdownErr))
+		httpServer.Close()
+	}
+	waitGroup.Wait()
+
+	server.mutex.Lock()
+	server.addrs = nil
+	server.mutex.Unlock()
+
+	return
+}
+
+// handler serves the health and readiness endpoints, and passes the other requests to config.Handler.
+func (server *Server) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case server.config.HealthPath:
+			server.serveCheck(w, !server.shuttingDown.Load())
+		case server.config.ReadinessPath:
+			server.serveCheck(w, server.ready.Load() && !server.shuttingDown.Load())
+		default:
+			server.config.Handler.ServeHTTP(w, req)
+		}
+	})
+}
+
+func (server *Server) serveCheck(w http.ResponseWriter, ok bool) {
+	if !ok {
+		ServeError(w, "Service Unavailable\n", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set(HeaderCacheControl, CacheControlNoCache)
+	w.Header().Set(HeaderContentType, MediaTypeTextUtf8)
+	w.Write([]byte("OK\n"))
+}
+
+// listen opens the listeners of the server. All the listeners are closed if one of them can't be opened.
+func (server *Server) listen(ctx context.Context, tlsConfig *tls.Config) (listeners []net.Listener, err error) {
+	listeners = make([]net.Listener, 0, len(server.config.Listeners))
+	addrs := make([]net.Addr, 0, len(server.config.Listeners))
+	defer func() {
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			listeners = nil
+		}
+	}()
+
+	for _, listenerConfig := range server.config.Listeners {
+		var listener net.Listener
+		switch {
+		case listenerConfig.Network == NetworkUnix:
+			err = removeStaleUnixSocket(listenerConfig.Address)
+			if err != nil {
+				return
+			}
+			listener, err = (&net.ListenConfig{}).Listen(ctx, NetworkUnix, listenerConfig.Address)
+		case listenerConfig.ReusePort:
+			listener, err = listenReusePort(ctx, listenerConfig.Network, listenerConfig.Address)
+		default:
+			listener, err = (&net.ListenConfig{}).Listen(ctx, listenerConfig.Network, listenerConfig.Address)
+		}
+		if err != nil {
+			err = fmt.Errorf("httpx.Server: listening on %s: %w", listenerConfig.Address, err)
+			return
+		}
+		addrs = append(addrs, listener.Addr())
+
+		if listenerConfig.ProxyProtocol {
+			policy := listenerConfig.ProxyProtocolPolicy
+			listener = &proxyproto.Listener{
+				Listener: listener,
+				ConnPolicy: func(proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+					return policy, nil
+				},
+			}
+		}
+		if listenerConfig.TLS {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	server.mutex.Lock()
+	server.addrs = addrs
+	server.mutex.Unlock()
+
+	return
+}
+
+// removeStaleUnixSocket removes the socket file left at path by a previous process, if any.
+func removeStaleUnixSocket(path string) error {
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("httpx.Server: checking unix socket %s: %w", path, err)
+	}
+	if fileInfo.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("httpx.Server: %s exists and is not a unix socket", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,14 @@
+//go:build !plan9 && !windows && !wasm
+
+package httpx
+
+import (
+	"context"
+	"net"
+
+	"github.com/bloom42/stdx-go/reuseport"
+)
+
+func listenReusePort(ctx context.Context, network, address string) (net.Listener, error) {
+	return reuseport.Listen(ctx, network, address)
+}
@@ -0,0 +1,13 @@
+//go:build plan9 || windows || wasm
+
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+func listenReusePort(ctx context.Context, network, address string) (net.Listener, error) {
+	return nil, errors.New("httpx: SO_REUSEPORT is not supported on this platform")
+}
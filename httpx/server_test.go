@@ -0,0 +1,127 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bloom42/stdx-go/proxyproto"
+)
+
+func TestServer(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "http.sock")
+	requestStarted := make(chan struct{})
+	server, err := NewServer(ServerConfig{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/slow" {
+				close(requestStarted)
+				time.Sleep(200 * time.Millisecond)
+			}
+			w.Write([]byte(req.RemoteAddr))
+		}),
+		Listeners: []ListenerConfig{
+			{Address: "127.0.0.1:0", ReusePort: true},
+			{Network: NetworkUnix, Address: socketPath},
+			{Address: "127.0.0.1:0", ProxyProtocol: true},
+		},
+		ShutdownDelay: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(ctx)
+	}()
+
+	var addrs []net.Addr
+	for range 100 {
+		if addrs = server.Addrs(); addrs != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(addrs) != 3 {
+		t.Fatalf("expected 3 addresses, got: %v", addrs)
+	}
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, NetworkUnix, socketPath)
+		},
+	}}
+	proxyClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addrs[2].String())
+			if err != nil {
+				return nil, err
+			}
+			header := proxyproto.HeaderProxyFromAddrs(1, &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1234}, addrs[2])
+			_, err = header.WriteTo(conn)
+			return conn, err
+		},
+	}}
+
+	get := func(client *http.Client, url string) (status int, body string) {
+		res, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(data)
+	}
+
+	if status, _ := get(http.DefaultClient, "http://"+addrs[0].String()+DefaultReadinessPath); status != http.StatusOK {
+		t.Errorf("readiness: expected status 200, got %d", status)
+	}
+	server.SetReady(false)
+	if status, _ := get(http.DefaultClient, "http://"+addrs[0].String()+DefaultReadinessPath); status != http.StatusServiceUnavailable {
+		t.Errorf("readiness when not ready: expected status 503, got %d", status)
+	}
+	server.SetReady(true)
+	if status, _ := get(unixClient, "http://unix/"); status != http.StatusOK {
+		t.Errorf("unix socket: expected status 200, got %d", status)
+	}
+	if _, remoteAddr := get(proxyClient, "http://proxy/"); remoteAddr != "1.2.3.4:1234" {
+		t.Errorf("PROXY protocol: expected remote address 1.2.3.4:1234, got %s", remoteAddr)
+	}
+
+	slowRequest := make(chan int, 1)
+	go func() {
+		status, _ := get(http.DefaultClient, "http://"+addrs[0].String()+"/slow")
+		slowRequest <- status
+	}()
+	<-requestStarted
+	cancel()
+
+	// during the shutdown delay, the listeners are still open but the checks fail
+	time.Sleep(20 * time.Millisecond)
+	if status, _ := get(unixClient, "http://unix"+DefaultHealthPath); status != http.StatusServiceUnavailable {
+		t.Errorf("health during shutdown: expected status 503, got %d", status)
+	}
+
+	if status := <-slowRequest; status != http.StatusOK {
+		t.Errorf("in-flight request: expected status 200, got %d", status)
+	}
+	if err = <-runErr; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+
+	_, err = net.Dial("tcp", addrs[0].String())
+	if err == nil {
+		t.Error("listener should be closed")
+	}
+	_, err = NewServer(ServerConfig{Handler: http.NotFoundHandler(), Listeners: []ListenerConfig{{Address: ":0", TLS: true}}})
+	if !errors.Is(err, ErrServerTLSIsNotEnabled) {
+		t.Errorf("TLS listener without TLS config: expected ErrServerTLSIsNotEnabled, got: %v", err)
+	}
+}
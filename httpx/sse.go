@@ -0,0 +1,269 @@
+package httpx
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MediaTypeEventStream = "text/event-stream"
+	HeaderLastEventID    = "Last-Event-ID"
+
+	// DefaultSSEHeartbeatInterval is the default interval between the heartbeats sent by SSEWriter, which
+	// is shorter than the idle timeout of most proxies and load balancers.
+	DefaultSSEHeartbeatInterval = 15 * time.Second
+)
+
+var (
+	ErrSSEIsNotSupported  = errors.New("httpx: the response writer does not support streaming")
+	ErrSSEEventIsNotValid = errors.New("httpx: SSE event ID and name must not contain line breaks")
+	ErrSSEWriterIsClosed  = errors.New("httpx: SSE writer is closed")
+)
+
+// SSEEvent is a Server-Sent Event.
+// See https://html.spec.whatwg.org/multipage/server-sent-events.html
+type SSEEvent struct {
+	// ID is sent back by the client in the Last-Event-ID header when it reconnects.
+	ID string
+	// Event is the type of the event. Clients receive events without a type as "message" events.
+	Event string
+	// Data is the payload of the event. It can contain multiple lines.
+	Data string
+	// Retry, if not 0, is the reconnection delay that the client should use.
+	Retry time.Duration
+}
+
+type SSEWriterConfig struct {
+	// Retry, if not 0, is sent to the client as the delay before reconnecting when the connection is lost.
+	Retry time.Duration
+	// HeartbeatInterval is the interval between the comments sent to keep the connection alive and to
+	// detect disconnected clients. A negative value disables heartbeats.
+	// default: DefaultSSEHeartbeatInterval
+	HeartbeatInterval time.Duration
+}
+
+// SSEWriter writes Server-Sent Events to a response. It is safe for concurrent use.
+//
+// The write deadline of the server (see ServerConfig.WriteTimeout) is disabled for the response, and
+// the events are flushed as soon as they are sent, through the http.ResponseWriter wrappers that support
+// http.ResponseController (e.g. the ones of middlewarex).
+type SSEWriter struct {
+	responseWriter     http.ResponseWriter
+	responseController *http.ResponseController
+	lastEventID        string
+
+	mutex  sync.Mutex
+	err    error
+	closed bool
+
+	stopHeartbeats     chan struct{}
+	heartbeatsStopped  chan struct{}
+	stopHeartbeatsOnce sync.Once
+}
+
+// NewSSEWriter writes the headers of an event stream response and starts sending heartbeats.
+// Close must be called before the handler returns.
+//
+// NewSSEWriter returns ErrSSEIsNotSupported if the response can't be flushed.
+func NewSSEWriter(w http.ResponseWriter, req *http.Request, config SSEWriterConfig) (writer *SSEWriter, err error) {
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = DefaultSSEHeartbeatInterval
+	}
+
+	responseController := http.NewResponseController(w)
+	// events can be sent for a long time, so the write deadline of the server doesn't apply
+	err = responseController.SetWriteDeadline(time.Time{})
+	if err != nil {
+		if !errors.Is(err, http.ErrNotSupported) {
+			return nil, err
+		}
+		err = nil
+	}
+
+	header := w.Header()
+	header.Del(HeaderContentLength)
+	header.Del(HeaderETag)
+	header.Set(HeaderContentType, MediaTypeEventStream)
+	header.Set(HeaderCacheControl, CacheControlNoCache)
+	// disable the buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	if req.ProtoMajor == 1 {
+		header.Set(HeaderConnection, "keep-alive")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	writer = &SSEWriter{
+		responseWriter:     w,
+		responseController: responseController,
+		lastEventID:        req.Header.Get(HeaderLastEventID),
+		stopHeartbeats:     make(chan struct{}),
+		heartbeatsStopped:  make(chan struct{}),
+	}
+
+	if config.Retry != 0 {
+		_, err = w.Write([]byte("retry: " + strconv.FormatInt(config.Retry.Milliseconds(), 10) + "\n\n"))
+	}
+	if err == nil {
+		err = responseController.Flush()
+	}
+	if err != nil {
+		if errors.Is(err, http.ErrNotSupported) {
+			err = ErrSSEIsNotSupported
+		}
+		return nil, err
+	}
+
+	if config.HeartbeatInterval > 0 {
+		go writer.sendHeartbeats(req, config.HeartbeatInterval)
+	} else {
+		close(writer.heartbeatsStopped)
+	}
+
+	return writer, nil
+}
+
+// LastEventID returns the value of the Last-Event-ID header of the request, which is the ID of the last
+// event received by the client before it reconnected, or an empty string.
+func (writer *SSEWriter) LastEventID() string {
+	return writer.lastEventID
+}
+
+// Send writes event and flushes it to the client. It returns the error of the first failed write, e.g.
+// when the client has disconnected.
+func (writer *SSEWriter) Send(event SSEEvent) error {
+	if strings.ContainsAny(event.ID, "\r\n\x00") || strings.ContainsAny(event.Event, "\r\n") {
+		return ErrSSEEventIsNotValid
+	}
+
+	var message strings.Builder
+	if event.ID != "" {
+		message.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Event != "" {
+		message.WriteString("event: " + event.Event + "\n")
+	}
+	if event.Retry != 0 {
+		message.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	// the spec accepts CRLF, LF and CR as line breaks
+	data := strings.ReplaceAll(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		message.WriteString("data: " + line + "\n")
+	}
+	message.WriteString("\n")
+
+	return writer.write(message.String())
+}
+
+// Close stops the heartbeats. The writer can't be used after Close.
+func (writer *SSEWriter) Close() {
+	writer.stopHeartbeatsOnce.Do(func() {
+		close(writer.stopHeartbeats)
+	})
+	<-writer.heartbeatsStopped
+
+	writer.mutex.Lock()
+	writer.closed = true
+	writer.mutex.Unlock()
+}
+
+func (writer *SSEWriter) write(message string) (err error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.closed {
+		return ErrSSEWriterIsClosed
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+
+	_, err = writer.responseWriter.Write([]byte(message))
+	if err == nil {
+		err = writer.responseController.Flush()
+	}
+	writer.err = err
+	return
+}
+
+func (writer *SSEWriter) sendHeartbeats(req *http.Request, interval time.Duration) {
+	defer close(writer.heartbeatsStopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-writer.stopHeartbeats:
+			return
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			// comments are ignored by clients
+			if writer.write(": heartbeat\n\n") != nil {
+				return
+			}
+		}
+	}
+}
+
+// SSEReplayBuffer keeps the last events of a stream so they can be sent again to the clients that
+// reconnect with a Last-Event-ID header. It is safe for concurrent use.
+type SSEReplayBuffer struct {
+	mutex  sync.Mutex
+	events []SSEEvent
+	// start is the index of the oldest event in events, which is used as a ring buffer once it is full
+	start int
+	size  int
+}
+
+func NewSSEReplayBuffer(size int) *SSEReplayBuffer {
+	size = max(size, 0)
+	return &SSEReplayBuffer{
+		events: make([]SSEEvent, 0, size),
+		size:   size,
+	}
+}
+
+// Add appends event to the buffer, dropping the oldest event if the buffer is full.
+func (buffer *SSEReplayBuffer) Add(event SSEEvent) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if buffer.size == 0 {
+		return
+	}
+	if len(buffer.events) < buffer.size {
+		buffer.events = append(buffer.events, event)
+		return
+	}
+	buffer.events[buffer.start] = event
+	buffer.start = (buffer.start + 1) % buffer.size
+}
+
+// Since returns the events that have been added after the event lastEventID. found is false if
+// lastEventID is not in the buffer (e.g. it has been dropped), in which case the client may have missed
+// events and should reload its state.
+func (buffer *SSEReplayBuffer) Since(lastEventID string) (events []SSEEvent, found bool) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	count := len(buffer.events)
+	for i := count - 1; i >= 0; i -= 1 {
+		if buffer.events[(buffer.start+i)%count].ID != lastEventID {
+			continue
+		}
+
+		events = make([]SSEEvent, 0, count-1-i)
+		for j := i + 1; j < count; j += 1 {
+			events = append(events, buffer.events[(buffer.start+j)%count])
+		}
+		return events, true
+	}
+
+	return nil, false
+}
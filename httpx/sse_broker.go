@@ -0,0 +1,355 @@
+package httpx
+
+import (
+	"container/list"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+)
+
+const (
+	DefaultSSEBrokerSubscriberBufferSize = 64
+	DefaultSSEBrokerReplayBufferSize     = 256
+	DefaultSSEBrokerTopicIdleTimeout     = 5 * time.Minute
+	DefaultSSEBrokerMaxIdleTopics        = 10_000
+
+	// SSEEventReset is the type of the event sent by SSEBroker.Serve to the clients that reconnect with a
+	// Last-Event-ID that is no longer in the replay buffer: they may have missed events and should reload
+	// their state.
+	SSEEventReset = "reset"
+)
+
+var (
+	ErrSSESubscriberIsTooSlow = errors.New("httpx: SSE subscriber is too slow")
+	ErrSSEBrokerIsClosed      = errors.New("httpx: SSE broker is closed")
+)
+
+type SSEBrokerConfig struct {
+	// SubscriberBufferSize is the number of events that can be queued for each subscriber. Subscribers
+	// whose queue is full are disconnected, so that a slow client can't slow down the publishers or use
+	// unbounded memory. Clients then reconnect and receive the events they missed from the replay buffer.
+	// default: DefaultSSEBrokerSubscriberBufferSize
+	SubscriberBufferSize int
+	// ReplayBufferSize is the number of events kept by each topic to be replayed to the clients that
+	// reconnect with a Last-Event-ID header. A negative value disables replay.
+	// default: DefaultSSEBrokerReplayBufferSize
+	ReplayBufferSize int
+	// TopicIdleTimeout is the duration after which a topic without subscribers nor published events is
+	// deleted with its replay buffer.
+	// default: DefaultSSEBrokerTopicIdleTimeout
+	TopicIdleTimeout time.Duration
+	// MaxIdleTopics is the maximum number of topics without subscribers. When it is reached, the topic
+	// that has been idle for the longest time is deleted, so that clients can't use unbounded memory by
+	// subscribing to random topics.
+	// default: DefaultSSEBrokerMaxIdleTopics
+	MaxIdleTopics int
+	// Writer is the configuration of the SSEWriters created by Serve.
+	Writer SSEWriterConfig
+}
+
+// SSEBroker fans out the events published to a topic to all the subscribers of the topic.
+// It is safe for concurrent use.
+//
+// Topics are created when they are first used. Topics without subscribers are kept, with their replay
+// buffer, for config.TopicIdleTimeout so that clients can reconnect, or until they are deleted with
+// DeleteTopic.
+type SSEBroker struct {
+	config SSEBrokerConfig
+	// instanceID prefixes the IDs of the events so that an ID sent by a client to another process, or after
+	// a restart, is not mistaken for the ID of another event
+	instanceID string
+
+	mutex  sync.Mutex
+	topics map[string]*sseBrokerTopic
+	// idleTopics are the topics without subscribers, from the most to the least recently active
+	idleTopics *list.List
+	closed     bool
+}
+
+type sseBrokerTopic struct {
+	name          string
+	nextID        uint64
+	replay        *SSEReplayBuffer
+	subscriptions map[*SSESubscription]struct{}
+	// idleElement is the element of the topic in SSEBroker.idleTopics, or nil if the topic has subscribers
+	idleElement *list.Element
+	idleSince   time.Time
+}
+
+// SSESubscription receives the events published to a topic.
+type SSESubscription struct {
+	broker *SSEBroker
+	topic  string
+	events chan SSEEvent
+	// err is set before events is closed
+	err error
+}
+
+func NewSSEBroker(config SSEBrokerConfig) *SSEBroker {
+	if config.SubscriberBufferSize == 0 {
+		config.SubscriberBufferSize = DefaultSSEBrokerSubscriberBufferSize
+	}
+	if config.ReplayBufferSize == 0 {
+		config.ReplayBufferSize = DefaultSSEBrokerReplayBufferSize
+	}
+	if config.TopicIdleTimeout == 0 {
+		config.TopicIdleTimeout = DefaultSSEBrokerTopicIdleTimeout
+	}
+	if config.MaxIdleTopics == 0 {
+		config.MaxIdleTopics = DefaultSSEBrokerMaxIdleTopics
+	}
+
+	return &SSEBroker{
+		config:     config,
+		instanceID: base64.RawURLEncoding.EncodeToString(crypto.RandBytes(6)),
+		topics:     map[string]*sseBrokerTopic{},
+		idleTopics: list.New(),
+	}
+}
+
+// Publish sends event to the subscribers of topic without blocking, and returns the ID of the event, which
+// is generated if event.ID is empty.
+func (broker *SSEBroker) Publish(topic string, event SSEEvent) (id string) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if broker.closed {
+		return ""
+	}
+
+	sseTopic := broker.getOrCreateTopic(topic)
+	sseTopic.nextID += 1
+	if event.ID == "" {
+		event.ID = broker.instanceID + "-" + strconv.FormatUint(sseTopic.nextID, 10)
+	}
+	sseTopic.replay.Add(event)
+	if sseTopic.idleElement != nil {
+		// the replay buffer has been updated
+		broker.markTopicIdle(sseTopic)
+	}
+
+	for subscription := range sseTopic.subscriptions {
+		select {
+		case subscription.events <- event:
+		default:
+			broker.removeSubscription(sseTopic, subscription, ErrSSESubscriberIsTooSlow)
+		}
+	}
+
+	return event.ID
+}
+
+// Subscribe subscribes to the events published to topic after the event lastEventID (which can be empty).
+// replay are the events that have been published after lastEventID, and that must be sent before the
+// events of the subscription. found is false if lastEventID is not empty and is no longer in the replay
+// buffer of the topic, in which case the client may have missed events.
+//
+// The subscription must be closed when it is no longer used.
+func (broker *SSEBroker) Subscribe(topic, lastEventID string) (subscription *SSESubscription, replay []SSEEvent, found bool) {
+	subscription = &SSESubscription{
+		broker: broker,
+		topic:  topic,
+		events: make(chan SSEEvent, broker.config.SubscriberBufferSize),
+	}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if broker.closed {
+		subscription.err = ErrSSEBrokerIsClosed
+		close(subscription.events)
+		return subscription, nil, lastEventID == ""
+	}
+
+	// the replay and the registration of the subscription are atomic so that no event is missed
+	sseTopic := broker.getOrCreateTopic(topic)
+	found = true
+	if lastEventID != "" {
+		replay, found = sseTopic.replay.Since(lastEventID)
+	}
+	sseTopic.subscriptions[subscription] = struct{}{}
+	if sseTopic.idleElement != nil {
+		broker.idleTopics.Remove(sseTopic.idleElement)
+		sseTopic.idleElement = nil
+	}
+
+	return subscription, replay, found
+}
+
+// Serve streams the events of topic to the client, starting with the events published after the
+// Last-Event-ID header of the request, until the client disconnects, the subscription is dropped because
+// the client is too slow, or the broker is closed. If the Last-Event-ID is no longer in the replay buffer,
+// an SSEEventReset event is sent first.
+//
+// It can be used behind the cors and middlewarex middlewares, e.g.
+//
+//	router.Get("/events/{topic}", func(w http.ResponseWriter, req *http.Request) {
+//		broker.Serve(w, req, chi.URLParam(req, "topic"))
+//	})
+func (broker *SSEBroker) Serve(w http.ResponseWriter, req *http.Request, topic string) (err error) {
+	// subscribe before the headers are sent, so that the events published once the client has received
+	// them are not missed
+	subscription, replay, found := broker.Subscribe(topic, req.Header.Get(HeaderLastEventID))
+	defer subscription.Close()
+
+	writer, err := NewSSEWriter(w, req, broker.config.Writer)
+	if err != nil {
+		return
+	}
+	defer writer.Close()
+
+	if !found {
+		err = writer.Send(SSEEvent{Event: SSEEventReset})
+		if err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		err = writer.Send(event)
+		if err != nil {
+			return
+		}
+	}
+
+	ctx := req.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-subscription.events:
+			if !ok {
+				return subscription.Err()
+			}
+			err = writer.Send(event)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// DeleteTopic closes the subscriptions of topic and deletes its replay buffer.
+func (broker *SSEBroker) DeleteTopic(topic string) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	sseTopic, ok := broker.topics[topic]
+	if !ok {
+		return
+	}
+	broker.deleteTopic(sseTopic)
+}
+
+// Close closes all the subscriptions, which ends the streams of Serve, e.g. before shutting down the
+// server which would otherwise wait for the streams to end.
+func (broker *SSEBroker) Close() {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	broker.closed = true
+	for _, sseTopic := range broker.topics {
+		for subscription := range sseTopic.subscriptions {
+			broker.removeSubscription(sseTopic, subscription, ErrSSEBrokerIsClosed)
+		}
+	}
+	broker.topics = map[string]*sseBrokerTopic{}
+	broker.idleTopics.Init()
+}
+
+// getOrCreateTopic must be called with the lock of the broker held. The topics that are created are idle.
+func (broker *SSEBroker) getOrCreateTopic(topic string) *sseBrokerTopic {
+	broker.deleteIdleTopics()
+
+	sseTopic, ok := broker.topics[topic]
+	if !ok {
+		if broker.idleTopics.Len() >= broker.config.MaxIdleTopics {
+			broker.deleteTopic(broker.idleTopics.Back().Value.(*sseBrokerTopic))
+		}
+		sseTopic = &sseBrokerTopic{
+			name:          topic,
+			replay:        NewSSEReplayBuffer(broker.config.ReplayBufferSize),
+			subscriptions: map[*SSESubscription]struct{}{},
+		}
+		broker.topics[topic] = sseTopic
+		broker.markTopicIdle(sseTopic)
+	}
+	return sseTopic
+}
+
+// markTopicIdle moves sseTopic to the front of the idle topics. It must be called with the lock of the
+// broker held.
+func (broker *SSEBroker) markTopicIdle(sseTopic *sseBrokerTopic) {
+	sseTopic.idleSince = time.Now()
+	if sseTopic.idleElement != nil {
+		broker.idleTopics.MoveToFront(sseTopic.idleElement)
+	} else {
+		sseTopic.idleElement = broker.idleTopics.PushFront(sseTopic)
+	}
+}
+
+// deleteIdleTopics deletes the topics that have been idle for longer than config.TopicIdleTimeout. It must
+// be called with the lock of the broker held.
+func (broker *SSEBroker) deleteIdleTopics() {
+	for element := broker.idleTopics.Back(); element != nil; element = broker.idleTopics.Back() {
+		sseTopic := element.Value.(*sseBrokerTopic)
+		if time.Since(sseTopic.idleSince) < broker.config.TopicIdleTimeout {
+			return
+		}
+		broker.deleteTopic(sseTopic)
+	}
+}
+
+// deleteTopic must be called with the lock of the broker held.
+func (broker *SSEBroker) deleteTopic(sseTopic *sseBrokerTopic) {
+	for subscription := range sseTopic.subscriptions {
+		broker.removeSubscription(sseTopic, subscription, nil)
+	}
+	if sseTopic.idleElement != nil {
+		broker.idleTopics.Remove(sseTopic.idleElement)
+		sseTopic.idleElement = nil
+	}
+	delete(broker.topics, sseTopic.name)
+}
+
+// removeSubscription must be called with the lock of the broker held.
+func (broker *SSEBroker) removeSubscription(sseTopic *sseBrokerTopic, subscription *SSESubscription, err error) {
+	if _, ok := sseTopic.subscriptions[subscription]; !ok {
+		return
+	}
+	delete(sseTopic.subscriptions, subscription)
+	subscription.err = err
+	close(subscription.events)
+	if len(sseTopic.subscriptions) == 0 {
+		broker.markTopicIdle(sseTopic)
+	}
+}
+
+// Events returns the channel of the events of the subscription. It is closed when the subscription is
+// closed or dropped, see Err.
+func (subscription *SSESubscription) Events() <-chan SSEEvent {
+	return subscription.events
+}
+
+// Err returns why the subscription has been dropped (ErrSSESubscriberIsTooSlow or ErrSSEBrokerIsClosed),
+// once the channel of Events is closed.
+func (subscription *SSESubscription) Err() error {
+	subscription.broker.mutex.Lock()
+	defer subscription.broker.mutex.Unlock()
+	return subscription.err
+}
+
+// Close unsubscribes from the topic. It is safe to call Close multiple times.
+func (subscription *SSESubscription) Close() {
+	broker := subscription.broker
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if sseTopic, ok := broker.topics[subscription.topic]; ok {
+		broker.removeSubscription(sseTopic, subscription, nil)
+	}
+}
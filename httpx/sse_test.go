@@ -0,0 +1,214 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEWriter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderLastEventID, "41")
+	res := httptest.NewRecorder()
+
+	writer, err := NewSSEWriter(res, req, SSEWriterConfig{Retry: 3 * time.Second, HeartbeatInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if writer.LastEventID() != "41" {
+		t.Errorf("expected Last-Event-ID 41, got %q", writer.LastEventID())
+	}
+
+	err = writer.Send(SSEEvent{ID: "42", Event: "update", Data: "line 1\r\nline 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Send(SSEEvent{Event: "bad\nevent"})
+	if !errors.Is(err, ErrSSEEventIsNotValid) {
+		t.Errorf("expected ErrSSEEventIsNotValid, got: %v", err)
+	}
+	writer.Close()
+	err = writer.Send(SSEEvent{Data: "closed"})
+	if !errors.Is(err, ErrSSEWriterIsClosed) {
+		t.Errorf("expected ErrSSEWriterIsClosed, got: %v", err)
+	}
+
+	if contentType := res.Header().Get(HeaderContentType); contentType != MediaTypeEventStream {
+		t.Errorf("unexpected Content-Type: %s", contentType)
+	}
+	expected := "retry: 3000\n\nid: 42\nevent: update\ndata: line 1\ndata: line 2\n\n"
+	if res.Body.String() != expected {
+		t.Errorf("expected body %q, got %q", expected, res.Body.String())
+	}
+}
+
+func TestSSEReplayBuffer(t *testing.T) {
+	buffer := NewSSEReplayBuffer(3)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		buffer.Add(SSEEvent{ID: id})
+	}
+
+	events, found := buffer.Since("3")
+	if !found || len(events) != 2 || events[0].ID != "4" || events[1].ID != "5" {
+		t.Errorf("since 3: unexpected events %v (found: %v)", events, found)
+	}
+	events, found = buffer.Since("5")
+	if !found || len(events) != 0 {
+		t.Errorf("since 5: unexpected events %v (found: %v)", events, found)
+	}
+	if _, found = buffer.Since("2"); found {
+		t.Error("event 2 should have been dropped")
+	}
+}
+
+func TestSSEBroker(t *testing.T) {
+	broker := NewSSEBroker(SSEBrokerConfig{
+		SubscriberBufferSize: 2,
+		Writer:               SSEWriterConfig{HeartbeatInterval: 10 * time.Millisecond},
+	})
+	defer broker.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		broker.Serve(w, req, req.URL.Path)
+	}))
+	defer server.Close()
+
+	firstID := broker.Publish("/dashboard", SSEEvent{Data: "first"})
+	broker.Publish("/dashboard", SSEEvent{Data: "second"})
+	broker.Publish("/other", SSEEvent{Data: "other"})
+
+	// a lost event fails the test instead of blocking it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/dashboard", nil)
+	req.Header.Set(HeaderLastEventID, firstID)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var data []string
+	heartbeat := false
+	reader := bufio.NewReader(res.Body)
+	for len(data) < 2 || !heartbeat {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data: ")))
+			if len(data) == 1 {
+				// the subscription is registered before the replayed events are sent
+				broker.Publish("/dashboard", SSEEvent{Data: "third"})
+			}
+		case strings.HasPrefix(line, ": heartbeat"):
+			heartbeat = true
+		}
+	}
+	if strings.Join(data, ",") != "second,third" {
+		t.Errorf("unexpected events: %v", data)
+	}
+
+	// the connection is closed when the broker is closed
+	broker.Close()
+	_, err = reader.ReadString(0)
+	if err == nil {
+		t.Error("expected the stream to end")
+	}
+}
+
+func TestSSEBrokerSlowSubscriber(t *testing.T) {
+	broker := NewSSEBroker(SSEBrokerConfig{SubscriberBufferSize: 1})
+	defer broker.Close()
+
+	subscription, _, _ := broker.Subscribe("topic", "")
+	defer subscription.Close()
+	broker.Publish("topic", SSEEvent{Data: "1"})
+	broker.Publish("topic", SSEEvent{Data: "2"})
+
+	<-subscription.Events()
+	if _, ok := <-subscription.Events(); ok {
+		t.Error("the slow subscription should have been dropped")
+	}
+	if !errors.Is(subscription.Err(), ErrSSESubscriberIsTooSlow) {
+		t.Errorf("expected ErrSSESubscriberIsTooSlow, got: %v", subscription.Err())
+	}
+
+	_, replay, found := broker.Subscribe("topic", "unknown")
+	if found || replay != nil {
+		t.Errorf("expected no replay for an unknown event ID, got: %v", replay)
+	}
+}
+
+func TestSSEBrokerReset(t *testing.T) {
+	broker := NewSSEBroker(SSEBrokerConfig{Writer: SSEWriterConfig{HeartbeatInterval: -1}})
+	defer broker.Close()
+	broker.Publish("topic", SSEEvent{Data: "1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	req.Header.Set(HeaderLastEventID, "unknown")
+	res := httptest.NewRecorder()
+
+	go func() {
+		// wait for the subscription before closing the stream
+		for {
+			broker.mutex.Lock()
+			sseTopic := broker.topics["topic"]
+			subscribed := sseTopic == nil || len(sseTopic.subscriptions) == 1
+			broker.mutex.Unlock()
+			if subscribed {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		broker.DeleteTopic("topic")
+	}()
+	err := broker.Serve(res, req, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "event: " + SSEEventReset + "\ndata: \n\n"
+	if res.Body.String() != expected {
+		t.Errorf("expected body %q, got %q", expected, res.Body.String())
+	}
+}
+
+func TestSSEBrokerIdleTopics(t *testing.T) {
+	broker := NewSSEBroker(SSEBrokerConfig{MaxIdleTopics: 2, TopicIdleTimeout: 50 * time.Millisecond})
+	defer broker.Close()
+
+	subscription, _, _ := broker.Subscribe("active", "")
+	defer subscription.Close()
+	for _, topic := range []string{"1", "2", "3"} {
+		broker.Publish(topic, SSEEvent{Data: topic})
+	}
+
+	broker.mutex.Lock()
+	_, idleTopicKept := broker.topics["1"]
+	topicCount := len(broker.topics)
+	broker.mutex.Unlock()
+	if idleTopicKept || topicCount != 3 {
+		t.Errorf("the oldest idle topic should have been deleted: %d topics", topicCount)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	broker.Publish("4", SSEEvent{Data: "4"})
+
+	broker.mutex.Lock()
+	topicCount = len(broker.topics)
+	_, activeTopicKept := broker.topics["active"]
+	broker.mutex.Unlock()
+	if topicCount != 2 || !activeTopicKept {
+		t.Errorf("expired idle topics should have been deleted: %d topics", topicCount)
+	}
+}
@@ -1,6 +1,8 @@
 package httpx
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -12,6 +14,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bloom42/stdx-go/crypto/blake3"
 )
@@ -22,13 +25,42 @@ var ErrInternalError = errors.New("Internal Server Error")
 var errFileIsMissing = func(file string) error { return fmt.Errorf("webappHandler: %s is missing", file) }
 
 type fileMetadata struct {
-	contentType string
-	etag        string
+	contentType  string
+	cacheControl string
+	modTime      time.Time
+	// representations of the file, ordered by preference. The last one is always the identity (not
+	// encoded) representation.
+	representations []fileRepresentation
+}
+
+// fileRepresentation is an encoding of a file, with its own ETag
+type fileRepresentation struct {
+	// contentEncoding is empty for the identity representation
+	contentEncoding string
+	// path of the representation in the fs.FS if data is nil
+	path string
+	// data is the content of the files compressed when loading the files
+	data []byte
+	etag string
 	// we store the contentLength as a string to avoid the conversion to string for each request
 	contentLength string
-	cacheControl  string
 }
 
+// contentEncodings are the supported encodings, by order of preference, with the extension of their
+// precompressed files
+var contentEncodings = []struct {
+	name      string
+	extension string
+}{
+	{name: "br", extension: ".br"},
+	{name: "zstd", extension: ".zst"},
+	{name: "gzip", extension: ".gz"},
+}
+
+// compressMinSize is the minimum size of files compressed by WebappHandler. Smaller files don't benefit
+// from compression.
+const compressMinSize = 1024
+
 type WebappHandlerConfig struct {
 	// default: index.html
 	NotFoundFile string
@@ -38,6 +70,10 @@ type WebappHandlerConfig struct {
 	NotFoundCacheControl string
 	// default: ".js", ".css", ".woff", ".woff2"
 	Cache []CacheRule
+	// Compress compresses compressible files with gzip when the handler is created, unless they
+	// already have a precompressed .gz sibling. Precompressed .br, .zst and .gz siblings are always used.
+	// default: false
+	Compress bool
 }
 
 type CacheRule struct {
@@ -50,6 +86,10 @@ type CacheRule struct {
 // if a file is not found, it will return notFoundFile (default: index.html) with the stauscode statusNotFound
 // WebappHandler sets the correct ETag header and cache the hash of files so that repeated requests
 // to files return only StatusNotModified responses
+// Files that have precompressed siblings (e.g. app.js.br, app.js.zst or app.js.gz) are served with the best
+// encoding accepted by the client, each encoding having its own ETag. Range, If-None-Match and
+// If-Modified-Since requests are supported. Files without modification time (e.g. embed.FS) use the time
+// at which the handler was created as modification time.
 // WebappHandler returns StatusMethodNotAllowed if the method is different than GET or HEAD
 func WebappHandler(folder fs.FS, config *WebappHandlerConfig) (handler func(w http.ResponseWriter, r *http.Request), err error) {
 	defaultConfig := defaultWebappHandlerConfig()
@@ -101,24 +141,42 @@ func WebappHandler(folder fs.FS, config *WebappHandlerConfig) (handler func(w ht
 			cacheControl = config.NotFoundCacheControl
 		}
 
-		w.Header().Set(HeaderETag, fileMetadata.etag)
-		w.Header().Set(HeaderContentLength, fileMetadata.contentLength)
-		w.Header().Set(HeaderContentType, fileMetadata.contentType)
-		w.Header().Set(HeaderCacheControl, cacheControl)
+		representation := fileMetadata.negotiateRepresentation(req.Header.Get(HeaderAcceptEncoding))
 
-		requestEtag := CleanIfNoneMatchHeader(req.Header.Get(HeaderIfNoneMatch))
-		if (fileExists || config.NotFoundStatus == http.StatusOK) && requestEtag == fileMetadata.etag {
-			w.WriteHeader(http.StatusNotModified)
-			return
+		if len(fileMetadata.representations) > 1 {
+			w.Header().Add(HeaderVary, HeaderAcceptEncoding)
+		}
+		if representation.contentEncoding != "" {
+			w.Header().Set(HeaderContentEncoding, representation.contentEncoding)
 		}
+		w.Header().Set(HeaderETag, representation.etag)
+		w.Header().Set(HeaderContentType, fileMetadata.contentType)
+		w.Header().Set(HeaderCacheControl, cacheControl)
 
-		w.WriteHeader(statusCode)
-		err = sendFile(folder, path, w)
+		content, err := representation.open(folder)
 		if err != nil {
+			w.Header().Del(HeaderContentEncoding)
 			w.Header().Set(HeaderCacheControl, CacheControlNoCache)
 			handleError(http.StatusInternalServerError, ErrInternalError.Error(), w)
 			return
 		}
+		defer content.Close()
+
+		if statusCode == http.StatusOK {
+			// http.ServeContent doesn't set the Content-Length of encoded content
+			if representation.contentEncoding != "" && req.Header.Get(HeaderRange) == "" {
+				w.Header().Set(HeaderContentLength, representation.contentLength)
+			}
+			// http.ServeContent handles conditional and range requests
+			http.ServeContent(w, req, "", fileMetadata.modTime, content)
+			return
+		}
+
+		w.Header().Set(HeaderContentLength, representation.contentLength)
+		w.WriteHeader(statusCode)
+		if req.Method != http.MethodHead {
+			io.Copy(w, content)
+		}
 	}
 	return
 }
@@ -143,18 +201,89 @@ func defaultWebappHandlerConfig() *WebappHandlerConfig {
 	}
 }
 
-func sendFile(folder fs.FS, path string, w http.ResponseWriter) (err error) {
-	file, err := folder.Open(path)
+// negotiateRepresentation returns the preferred representation of the file among the encodings accepted
+// by the client. Encodings are chosen by the q-values of the Accept-Encoding header and then by server
+// preference. The identity representation is used when no encoding is accepted.
+func (metadata fileMetadata) negotiateRepresentation(acceptEncoding string) (representation fileRepresentation) {
+	identity := metadata.representations[len(metadata.representations)-1]
+	if len(metadata.representations) == 1 || acceptEncoding == "" {
+		return identity
+	}
+
+	acceptedEncodings := parseAcceptEncoding(acceptEncoding)
+	bestQuality := 0.0
+	representation = identity
+	for _, candidate := range metadata.representations[:len(metadata.representations)-1] {
+		quality, accepted := acceptedEncodings[candidate.contentEncoding]
+		if !accepted {
+			quality, accepted = acceptedEncodings["*"]
+		}
+		if accepted && quality > bestQuality {
+			bestQuality = quality
+			representation = candidate
+		}
+	}
+
+	return
+}
+
+// parseAcceptEncoding parses an Accept-Encoding header and returns the quality of each encoding.
+// e.g. "gzip, br;q=0.9, *;q=0" returns {"gzip": 1, "br": 0.9, "*": 0}
+func parseAcceptEncoding(acceptEncoding string) (encodings map[string]float64) {
+	encodings = make(map[string]float64, 4)
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		encoding, params, _ := strings.Cut(part, ";")
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "" {
+			continue
+		}
+
+		quality := 1.0
+		params = strings.TrimSpace(params)
+		if qValue, hasQuality := strings.CutPrefix(params, "q="); hasQuality {
+			parsedQuality, err := strconv.ParseFloat(strings.TrimSpace(qValue), 64)
+			if err != nil || parsedQuality < 0 || parsedQuality > 1 {
+				continue
+			}
+			quality = parsedQuality
+		}
+
+		encodings[encoding] = quality
+	}
+
+	return
+}
+
+// open returns the content of the representation. It is an io.ReadSeeker, as required by http.ServeContent.
+func (representation fileRepresentation) open(folder fs.FS) (content io.ReadSeekCloser, err error) {
+	if representation.data != nil {
+		return nopCloser{bytes.NewReader(representation.data)}, nil
+	}
+
+	file, err := folder.Open(representation.path)
 	if err != nil {
 		return
 	}
 
+	if seeker, isSeeker := file.(io.ReadSeekCloser); isSeeker {
+		return seeker, nil
+	}
+
+	// fs.FS implementations are not required to implement io.Seeker
 	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
 
-	_, err = io.Copy(w, file)
-	return
+type nopCloser struct {
+	io.ReadSeeker
 }
 
+func (nopCloser) Close() error { return nil }
+
 func handleError(code int, message string, w http.ResponseWriter) {
 	http.Error(w, message, code)
 }
@@ -169,6 +298,7 @@ func CleanIfNoneMatchHeader(requestEtag string) string {
 
 func loadFilesMetdata(folder fs.FS, config *WebappHandlerConfig) (ret map[string]fileMetadata, err error) {
 	ret = make(map[string]fileMetadata, 10)
+	loadedAt := time.Now().UTC().Truncate(time.Second)
 
 	err = fs.WalkDir(folder, ".", func(path string, fileEntry fs.DirEntry, errWalk error) error {
 		if errWalk != nil {
@@ -184,19 +314,11 @@ func loadFilesMetdata(folder fs.FS, config *WebappHandlerConfig) (ret map[string
 			return fmt.Errorf("webappHandler: error getting info for file %s: %w", path, errWalk)
 		}
 
-		file, errWalk := folder.Open(path)
-		if errWalk != nil {
-			return fmt.Errorf("webappHandler: error opening file %s: %w", path, errWalk)
-		}
-		defer file.Close()
-
 		// we hash the file to generate its Etag
-		hasher := blake3.New(32, nil)
-		_, errWalk = io.Copy(hasher, file)
+		fileHash, errWalk := hashFile(folder, path)
 		if errWalk != nil {
-			return fmt.Errorf("webappHandler: error hashing file %s: %w", path, errWalk)
+			return errWalk
 		}
-		fileHash := hasher.Sum(nil)
 
 		etag := encodeEtag(fileHash)
 
@@ -213,24 +335,152 @@ func loadFilesMetdata(folder fs.FS, config *WebappHandlerConfig) (ret map[string
 			}
 		}
 
+		modTime := fileInfo.ModTime()
+		if modTime.IsZero() {
+			modTime = loadedAt
+		}
+
 		ret[path] = fileMetadata{
-			contentType:   contentType,
-			etag:          etag,
-			contentLength: strconv.FormatInt(fileInfo.Size(), 10),
-			cacheControl:  cacheControl,
+			contentType:  contentType,
+			cacheControl: cacheControl,
+			modTime:      modTime,
+			representations: []fileRepresentation{{
+				path:          path,
+				etag:          etag,
+				contentLength: strconv.FormatInt(fileInfo.Size(), 10),
+			}},
 		}
 
 		return nil
 	})
+	if err != nil {
+		return
+	}
 
 	if _, indexHtmlExists := ret[config.NotFoundFile]; !indexHtmlExists {
 		err = errFileIsMissing(config.NotFoundFile)
 		return
 	}
 
+	for path, metadata := range ret {
+		identity := metadata.representations[0]
+		representations := make([]fileRepresentation, 0, len(contentEncodings)+1)
+
+		for _, encoding := range contentEncodings {
+			if precompressed, exists := ret[path+encoding.extension]; exists {
+				representations = append(representations, fileRepresentation{
+					contentEncoding: encoding.name,
+					path:            precompressed.representations[0].path,
+					etag:            precompressed.representations[0].etag,
+					contentLength:   precompressed.representations[0].contentLength,
+				})
+				continue
+			}
+
+			if encoding.name == "gzip" && config.Compress && isCompressible(metadata.contentType) {
+				var compressed fileRepresentation
+				var compressedIsSmaller bool
+				compressed, compressedIsSmaller, err = gzipFile(folder, identity)
+				if err != nil {
+					return
+				}
+				if compressedIsSmaller {
+					representations = append(representations, compressed)
+				}
+			}
+		}
+
+		metadata.representations = append(representations, identity)
+		ret[path] = metadata
+	}
+
 	return
 }
 
+func hashFile(folder fs.FS, path string) (hash []byte, err error) {
+	file, err := folder.Open(path)
+	if err != nil {
+		err = fmt.Errorf("webappHandler: error opening file %s: %w", path, err)
+		return
+	}
+	defer file.Close()
+
+	hasher := blake3.New(32, nil)
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		err = fmt.Errorf("webappHandler: error hashing file %s: %w", path, err)
+		return
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+// gzipFile compresses the identity representation of a file. compressedIsSmaller is false if the
+// file is too small or if compression doesn't reduce its size enough to be worth it.
+func gzipFile(folder fs.FS, identity fileRepresentation) (compressed fileRepresentation, compressedIsSmaller bool, err error) {
+	data, err := fs.ReadFile(folder, identity.path)
+	if err != nil {
+		err = fmt.Errorf("webappHandler: error reading file %s: %w", identity.path, err)
+		return
+	}
+
+	if len(data) < compressMinSize {
+		return
+	}
+
+	var buffer bytes.Buffer
+	gzipWriter, err := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+	if err != nil {
+		return
+	}
+	_, err = gzipWriter.Write(data)
+	if err != nil {
+		err = fmt.Errorf("webappHandler: error compressing file %s: %w", identity.path, err)
+		return
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		err = fmt.Errorf("webappHandler: error compressing file %s: %w", identity.path, err)
+		return
+	}
+
+	// compression must save at least 10%
+	if buffer.Len() > len(data)*9/10 {
+		return
+	}
+
+	hash := blake3.Sum256(buffer.Bytes())
+	compressed = fileRepresentation{
+		contentEncoding: "gzip",
+		data:            buffer.Bytes(),
+		etag:            encodeEtag(hash[:]),
+		contentLength:   strconv.Itoa(buffer.Len()),
+	}
+	return compressed, true, nil
+}
+
+// isCompressible returns true if files of the given content type benefit from compression.
+// Images (except SVG), fonts in the WOFF formats, audio, video and archives are already compressed.
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case MediaTypeJson, MediaTypeXml, "application/javascript", "application/wasm", "application/manifest+json",
+		"image/x-icon", "image/vnd.microsoft.icon", "font/ttf", "font/otf":
+		return true
+	}
+
+	return false
+}
+
 func encodeEtag(hash []byte) string {
 	return `"` + base64.RawURLEncoding.EncodeToString(hash) + `"`
 }
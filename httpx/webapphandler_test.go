@@ -1,5 +1,19 @@
 package httpx
 
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
 // func TestWebapphandlerTypes(t *testing.T) {
 // 	var fileInfo webappFileInfo
 // 	fmt.Printf("size(webappFileInfo): %d\n", unsafe.Sizeof(fileInfo))
@@ -71,3 +85,139 @@ package httpx
 // 	// 	}
 // 	// })
 // }
+
+func TestWebappHandlerContentEncoding(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	appJs := []byte(strings.Repeat("console.log('hello world');\n", 200))
+	styleCss := []byte(strings.Repeat("body { margin: 0; }\n", 200))
+	folder := fstest.MapFS{
+		"index.html":    {Data: []byte("<html></html>"), ModTime: modTime},
+		"app.js":        {Data: appJs, ModTime: modTime},
+		"app.js.br":     {Data: []byte("brotli"), ModTime: modTime},
+		"app.js.zst":    {Data: []byte("zstd"), ModTime: modTime},
+		"style.css":     {Data: styleCss, ModTime: modTime},
+		"image.png":     {Data: bytes.Repeat([]byte{0}, 2000), ModTime: modTime},
+		"small.txt":     {Data: []byte("small"), ModTime: modTime},
+		"no_modtime.js": {Data: appJs},
+	}
+
+	handler, err := WebappHandler(folder, &WebappHandlerConfig{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		res := httptest.NewRecorder()
+		handler(res, req)
+		return res
+	}
+
+	tests := []struct {
+		path             string
+		acceptEncoding   string
+		expectedEncoding string
+		expectedVary     bool
+	}{
+		{"/app.js", "gzip, deflate, br, zstd", "br", true},
+		{"/app.js", "gzip, zstd", "zstd", true},
+		{"/app.js", "br;q=0.5, zstd;q=0.8", "zstd", true},
+		{"/app.js", "gzip", "gzip", true},
+		{"/app.js", "*", "br", true},
+		{"/app.js", "br;q=0, *;q=0", "", true},
+		{"/app.js", "", "", true},
+		{"/style.css", "br, gzip", "gzip", true},
+		{"/image.png", "gzip", "", false},
+		{"/small.txt", "gzip", "", false},
+	}
+
+	etags := map[string]string{}
+	for _, test := range tests {
+		res := serve(http.MethodGet, test.path, map[string]string{HeaderAcceptEncoding: test.acceptEncoding})
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s (%s): expected status 200, got %d", test.path, test.acceptEncoding, res.Code)
+		}
+		if encoding := res.Header().Get(HeaderContentEncoding); encoding != test.expectedEncoding {
+			t.Errorf("%s (%s): expected encoding %q, got %q", test.path, test.acceptEncoding, test.expectedEncoding, encoding)
+		}
+		if vary := res.Header().Get(HeaderVary) == HeaderAcceptEncoding; vary != test.expectedVary {
+			t.Errorf("%s (%s): expected Vary: %v, got %v", test.path, test.acceptEncoding, test.expectedVary, vary)
+		}
+
+		etag := res.Header().Get(HeaderETag)
+		if previousEtag, exists := etags[test.path+test.expectedEncoding]; exists && previousEtag != etag {
+			t.Errorf("%s (%s): ETag is not stable", test.path, test.acceptEncoding)
+		}
+		etags[test.path+test.expectedEncoding] = etag
+	}
+	if etags["/app.js"] == etags["/app.jsbr"] || etags["/app.jsbr"] == etags["/app.jsgzip"] {
+		t.Error("each encoding should have its own ETag")
+	}
+
+	res := serve(http.MethodGet, "/style.css", map[string]string{HeaderAcceptEncoding: "gzip"})
+	if res.Header().Get(HeaderContentLength) != strconv.Itoa(res.Body.Len()) {
+		t.Errorf("Content-Length (%s) is not valid", res.Header().Get(HeaderContentLength))
+	}
+	gzipReader, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, styleCss) {
+		t.Error("decompressed style.css is not valid")
+	}
+
+	res = serve(http.MethodGet, "/app.js", map[string]string{HeaderAcceptEncoding: "br", HeaderIfNoneMatch: etags["/app.jsbr"]})
+	if res.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: expected status 304, got %d", res.Code)
+	}
+	res = serve(http.MethodGet, "/app.js", map[string]string{HeaderAcceptEncoding: "gzip", HeaderIfNoneMatch: etags["/app.jsbr"]})
+	if res.Code != http.StatusOK {
+		t.Errorf("If-None-Match with the ETag of another encoding: expected status 200, got %d", res.Code)
+	}
+
+	res = serve(http.MethodGet, "/app.js", map[string]string{HeaderIfModifiedSince: modTime.Format(http.TimeFormat)})
+	if res.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: expected status 304, got %d", res.Code)
+	}
+	res = serve(http.MethodGet, "/app.js", map[string]string{HeaderIfModifiedSince: modTime.Add(-time.Hour).Format(http.TimeFormat)})
+	if res.Code != http.StatusOK {
+		t.Errorf("If-Modified-Since before modification: expected status 200, got %d", res.Code)
+	}
+	res = serve(http.MethodGet, "/no_modtime.js", nil)
+	if res.Header().Get(HeaderLastModified) == "" {
+		t.Error("files without modification time should have a Last-Modified header")
+	}
+
+	res = serve(http.MethodGet, "/app.js", map[string]string{HeaderRange: "bytes=8-18"})
+	if res.Code != http.StatusPartialContent {
+		t.Fatalf("Range: expected status 206, got %d", res.Code)
+	}
+	if res.Body.String() != string(appJs[8:19]) {
+		t.Errorf("Range: unexpected body: %q", res.Body.String())
+	}
+	if contentRange := res.Header().Get(HeaderContentRange); contentRange != fmt.Sprintf("bytes 8-18/%d", len(appJs)) {
+		t.Errorf("Range: unexpected Content-Range: %s", contentRange)
+	}
+
+	res = serve(http.MethodHead, "/app.js", nil)
+	if res.Code != http.StatusOK || res.Body.Len() != 0 || res.Header().Get(HeaderContentLength) != strconv.Itoa(len(appJs)) {
+		t.Errorf("HEAD: unexpected response: %d %d %s", res.Code, res.Body.Len(), res.Header().Get(HeaderContentLength))
+	}
+
+	res = serve(http.MethodGet, "/unknown/route", nil)
+	if res.Code != http.StatusOK || res.Body.String() != "<html></html>" {
+		t.Errorf("not found: expected index.html, got %d %q", res.Code, res.Body.String())
+	}
+
+	res = serve(http.MethodPost, "/app.js", nil)
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected status 405, got %d", res.Code)
+	}
+}
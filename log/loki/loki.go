@@ -9,10 +9,9 @@ import (
 	"io"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/bloom42/stdx-go/httpx"
-	"github.com/bloom42/stdx-go/retry"
+	"github.com/bloom42/stdx-go/uuid"
 )
 
 type lokiPushRequest struct {
@@ -46,15 +45,7 @@ func (writer *Writer) flushLogs() (err error) {
 		return
 	}
 
-	err = retry.Do(func() error {
-		return writer.pushLogs(ctx, requestBody)
-	},
-		retry.Context(ctx),
-		retry.Attempts(20),
-		retry.Delay(1*time.Second),
-		retry.DelayType(retry.CombineDelay(retry.FixedDelay, retry.RandomDelay)),
-	)
-
+	err = writer.pushLogs(ctx, requestBody)
 	return
 }
 
@@ -67,14 +58,23 @@ func (writer *Writer) pushLogs(ctx context.Context, requestBody []byte) (err err
 
 	req.Header.Add(httpx.HeaderContentType, httpx.MediaTypeJson)
 	req.Header.Add(httpx.HeaderContentEncoding, "gzip")
+	// Loki drops the entries it has already received (same stream, timestamp and line), so pushes can be
+	// retried by the client
+	req.Header.Add(httpx.HeaderIdempotencyKey, uuid.NewV4().String())
 
 	res, err := writer.httpClient.Do(req)
 	if err != nil {
 		err = fmt.Errorf("loki: flushing logs: making HTTP request: %w", err)
 		return err
 	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		err = fmt.Errorf("loki: flushing logs: status code: %d: %s", res.StatusCode, bytes.TrimSpace(body))
+		return
+	}
 	_, _ = io.Copy(io.Discard, res.Body)
-	res.Body.Close()
 	return
 }
 
@@ -82,7 +82,7 @@ func NewWriter(ctx context.Context, lokiEndpoint string, streams map[string]stri
 		emptyEndpointMaxBufferSize: options.EmptyEndpointMaxBufferSize,
 		flushTimeout:               options.FlushTimeout,
 
-		httpClient:         httpx.DefaultClient(),
+		httpClient:         newHTTPClient(),
 		recordsBuffer:      make([]record, 0, options.DefaultRecordsBufferSize),
 		recordsBufferMutex: sync.Mutex{},
 		childWriter:        options.ChildWriter,
@@ -157,3 +157,16 @@ func (writer *Writer) Write(data []byte) (n int, err error) {
 
 	return
 }
+
+// newHTTPClient returns the client used to push logs. It retries the failed pushes for about 15 seconds
+// before the logs are discarded, and discards them immediately while Loki is down (see
+// httpx.CircuitBreakerTransport) so the pushes don't pile up.
+func newHTTPClient() *http.Client {
+	return httpx.NewClient(httpx.ClientConfig{
+		Retry: httpx.RetryTransportConfig{
+			MaxAttempts: 5,
+			Delay:       time.Second,
+		},
+		MaxResponseBodySize: 1024 * 1024,
+	})
+}
@@ -19,7 +19,7 @@ type Client struct {
 
 func NewClient(accountApiToken string, httpClient *http.Client) *Client {
 	if httpClient == nil {
-		httpClient = httpx.DefaultClient()
+		httpClient = httpx.NewClient(httpx.ClientConfig{})
 	}
 
 	return &Client{
@@ -0,0 +1,463 @@
+// Package cache implements a read-through local disk cache in front of another storage.Storage
+// (typically S3). Cached objects are evicted in least-recently-used order once the total size of the
+// cache exceeds Config.MaxSize.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bloom42/stdx-go/guid"
+	"github.com/bloom42/stdx-go/storage"
+	"github.com/bloom42/stdx-go/storage/filesystem"
+	"golang.org/x/sync/singleflight"
+)
+
+// ensure that DiskCache satisfies the Storage and ObjectInfoGetter interfaces
+var _ storage.Storage = (*DiskCache)(nil)
+var _ storage.ObjectInfoGetter = (*DiskCache)(nil)
+
+// tmpDirectory is the directory, relative to Config.Directory, where objects are downloaded before
+// being moved to their final location.
+const tmpDirectory = ".tmp"
+
+var (
+	ErrBackendIsNull     = errors.New("cache: backend is null")
+	ErrDirectoryIsNull   = errors.New("cache: directory is empty")
+	ErrMaxSizeIsNotValid = errors.New("cache: max size must be greater than 0")
+)
+
+type Config struct {
+	// Backend is the storage that is cached. All the writes go directly to Backend.
+	Backend storage.Storage
+	// Directory is the local directory where cached objects are stored.
+	Directory string
+	// MaxSize is the maximum size, in bytes, of the objects stored in Directory.
+	MaxSize int64
+}
+
+type DiskCache struct {
+	backend storage.Storage
+	local   *filesystem.FilesystemStorage
+	maxSize int64
+
+	fetchGroup singleflight.Group
+
+	mutex   sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+	// fetches are the fetches in progress, which are invalidated when their object is written or deleted
+	// so that an object downloaded before a write is never cached.
+	fetches map[string]*fetchState
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+type fetchState struct {
+	invalidated bool
+}
+
+// tmpFile is a downloaded object that is not cached. It is removed when it is closed.
+type tmpFile struct {
+	*os.File
+}
+
+func (file tmpFile) Close() error {
+	err := file.File.Close()
+	os.Remove(file.Name())
+	return err
+}
+
+// NewDiskCache creates a new DiskCache. Objects already present in config.Directory (e.g. from a
+// previous run) are indexed, from the least to the most recently modified.
+func NewDiskCache(config Config) (*DiskCache, error) {
+	if config.Backend == nil {
+		return nil, ErrBackendIsNull
+	}
+	if config.Directory == "" {
+		return nil, ErrDirectoryIsNull
+	}
+	if config.MaxSize <= 0 {
+		return nil, ErrMaxSizeIsNotValid
+	}
+
+	cache := &DiskCache{
+		backend: config.Backend,
+		local:   filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: config.Directory}),
+		maxSize: config.MaxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		fetches: make(map[string]*fetchState),
+	}
+
+	err := cache.loadExistingEntries(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func (cache *DiskCache) loadExistingEntries(directory string) error {
+	type existingFile struct {
+		key     string
+		size    int64
+		modTime int64
+	}
+	existingFiles := make([]existingFile, 0)
+
+	// remove the leftovers of interrupted downloads
+	err := os.RemoveAll(filepath.Join(directory, tmpDirectory))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(directory, 0700)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+
+		existingFiles = append(existingFiles, existingFile{
+			key:     filepath.ToSlash(key),
+			size:    info.Size(),
+			modTime: info.ModTime().UnixNano(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(existingFiles, func(i, j int) bool {
+		return existingFiles[i].modTime < existingFiles[j].modTime
+	})
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, file := range existingFiles {
+		cache.insertEntry(file.key, file.size)
+	}
+	cache.evict(context.Background())
+
+	return nil
+}
+
+func (cache *DiskCache) BasePath() string {
+	return cache.backend.BasePath()
+}
+
+// Size returns the total size, in bytes, of the objects currently cached.
+func (cache *DiskCache) Size() int64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.size
+}
+
+func (cache *DiskCache) CopyObject(ctx context.Context, from, to string) error {
+	err := cache.backend.CopyObject(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	return cache.invalidate(ctx, to)
+}
+
+func (cache *DiskCache) DeleteObject(ctx context.Context, key string) error {
+	err := cache.backend.DeleteObject(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return cache.invalidate(ctx, key)
+}
+
+// GetObject returns the object from the local cache if it is present. Otherwise the object is
+// downloaded from the backend and stored in the local cache.
+// Range requests for objects that are not cached are forwarded to the backend as is and are not cached,
+// as are the objects whose key can't be mapped to a path inside Config.Directory (see isCacheableKey).
+func (cache *DiskCache) GetObject(ctx context.Context, key string, options *storage.GetObjectOptions) (io.ReadCloser, error) {
+	if !isCacheableKey(key) {
+		return cache.backend.GetObject(ctx, key, options)
+	}
+
+	if cache.touch(key) {
+		object, err := cache.local.GetObject(ctx, key, options)
+		if err == nil {
+			return object, nil
+		}
+		// the file may have been removed from the disk behind our back
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		cache.removeEntry(key)
+	}
+
+	if options != nil && options.Range != nil {
+		return cache.backend.GetObject(ctx, key, options)
+	}
+
+	// the download is shared by concurrent callers, so it must not be canceled with the context of the
+	// first caller
+	downloadedByCaller := false
+	result, err, _ := cache.fetchGroup.Do(key, func() (any, error) {
+		downloadedByCaller = true
+		return cache.fetch(context.WithoutCancel(ctx), key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if uncachedObject, _ := result.(io.ReadCloser); uncachedObject != nil {
+		if downloadedByCaller {
+			return uncachedObject, nil
+		}
+		// the temporary file can only be read by the caller that downloaded it
+		return cache.backend.GetObject(ctx, key, nil)
+	}
+
+	object, err := cache.local.GetObject(ctx, key, nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		// the object has already been evicted or invalidated
+		return cache.backend.GetObject(ctx, key, nil)
+	}
+	return object, err
+}
+
+func (cache *DiskCache) GetObjectInfo(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	return storage.GetObjectInfo(ctx, cache.backend, key)
+}
+
+func (cache *DiskCache) GetObjectSize(ctx context.Context, key string) (int64, error) {
+	cache.mutex.Lock()
+	element, isCached := cache.entries[key]
+	if isCached {
+		size := element.Value.(*cacheEntry).size
+		cache.mutex.Unlock()
+		return size, nil
+	}
+	cache.mutex.Unlock()
+
+	return cache.backend.GetObjectSize(ctx, key)
+}
+
+func (cache *DiskCache) PutObject(ctx context.Context, key string, size int64, object io.Reader, options *storage.PutObjectOptions) error {
+	err := cache.backend.PutObject(ctx, key, size, object, options)
+	if err != nil {
+		return err
+	}
+
+	return cache.invalidate(ctx, key)
+}
+
+func (cache *DiskCache) DeleteObjectsWithPrefix(ctx context.Context, prefix string) error {
+	err := cache.backend.DeleteObjectsWithPrefix(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for key, fetch := range cache.fetches {
+		if strings.HasPrefix(key, prefix) {
+			fetch.invalidated = true
+		}
+	}
+
+	for key, element := range cache.entries {
+		if strings.HasPrefix(key, prefix) {
+			cache.removeElement(element)
+			err = cache.local.DeleteObject(ctx, key)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetch downloads an object from the backend into the local cache and then evicts the least recently
+// used objects if the cache is over capacity.
+// The object is first downloaded to a temporary file which is then atomically renamed so readers never
+// see a partially written object.
+// If the object can't be cached, because it is larger than MaxSize or because it has been written or
+// deleted during the download, the temporary file is returned as uncachedObject so it is not downloaded
+// a second time.
+func (cache *DiskCache) fetch(ctx context.Context, key string) (uncachedObject io.ReadCloser, err error) {
+	fetch := &fetchState{}
+	cache.mutex.Lock()
+	cache.fetches[key] = fetch
+	cache.mutex.Unlock()
+	defer func() {
+		cache.mutex.Lock()
+		delete(cache.fetches, key)
+		cache.mutex.Unlock()
+	}()
+
+	object, err := cache.backend.GetObject(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	tmpKey := tmpDirectory + "/" + guid.NewRandom().String()
+	tmpPath := filepath.Join(cache.local.BasePath(), tmpKey)
+	err = cache.local.PutObject(ctx, tmpKey, -1, object, nil)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	size, err := cache.local.GetObjectSize(ctx, tmpKey)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if size > cache.maxSize || fetch.invalidated {
+		var file *os.File
+		file, err = os.Open(tmpPath)
+		if err != nil {
+			os.Remove(tmpPath)
+			return nil, err
+		}
+		return tmpFile{File: file}, nil
+	}
+
+	objectPath := filepath.Join(cache.local.BasePath(), key)
+	err = os.MkdirAll(filepath.Dir(objectPath), 0700)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	err = os.Rename(tmpPath, objectPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	cache.insertEntry(key, size)
+	cache.evict(ctx)
+
+	return nil, nil
+}
+
+// isCacheableKey returns true if key can be stored in the local cache. Backends such as S3 accept any
+// key, but keys that are not clean relative paths (e.g. "a/../../b", "/a", "a//b" or ".") could be stored
+// outside of Config.Directory or alias another key, and keys in tmpDirectory would collide with the
+// downloads.
+func isCacheableKey(key string) bool {
+	return key != "." && path.Clean(key) == key && filepath.IsLocal(filepath.FromSlash(key)) &&
+		key != tmpDirectory && !strings.HasPrefix(key, tmpDirectory+"/")
+}
+
+// touch marks the object as recently used and returns true if the object is cached.
+func (cache *DiskCache) touch(key string) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, isCached := cache.entries[key]
+	if isCached {
+		cache.lru.MoveToFront(element)
+	}
+	return isCached
+}
+
+func (cache *DiskCache) invalidate(ctx context.Context, key string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if fetch, isFetching := cache.fetches[key]; isFetching {
+		fetch.invalidated = true
+	}
+
+	element, isCached := cache.entries[key]
+	if !isCached {
+		return nil
+	}
+
+	cache.removeElement(element)
+	err := cache.local.DeleteObject(ctx, key)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (cache *DiskCache) removeEntry(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, isCached := cache.entries[key]
+	if isCached {
+		cache.removeElement(element)
+	}
+}
+
+// insertEntry must be called with cache.mutex held.
+func (cache *DiskCache) insertEntry(key string, size int64) {
+	element, isCached := cache.entries[key]
+	if isCached {
+		cache.removeElement(element)
+	}
+
+	cache.entries[key] = cache.lru.PushFront(&cacheEntry{key: key, size: size})
+	cache.size += size
+}
+
+// removeElement must be called with cache.mutex held.
+func (cache *DiskCache) removeElement(element *list.Element) {
+	entry := cache.lru.Remove(element).(*cacheEntry)
+	delete(cache.entries, entry.key)
+	cache.size -= entry.size
+}
+
+// evict removes the least recently used objects until the size of the cache is below maxSize.
+// Objects that are currently being read can safely be removed as the opened file descriptors remain valid.
+// evict must be called with cache.mutex held.
+func (cache *DiskCache) evict(ctx context.Context) {
+	for cache.size > cache.maxSize {
+		element := cache.lru.Back()
+		if element == nil {
+			return
+		}
+
+		key := element.Value.(*cacheEntry).key
+		cache.removeElement(element)
+		_ = cache.local.DeleteObject(ctx, key)
+	}
+}
@@ -0,0 +1,288 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bloom42/stdx-go/storage"
+	"github.com/bloom42/stdx-go/storage/filesystem"
+)
+
+func putObject(t *testing.T, backend storage.Storage, key string, data []byte) {
+	err := backend.PutObject(context.Background(), key, int64(len(data)), bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getObject(t *testing.T, cache *DiskCache, key string, options *storage.GetObjectOptions) []byte {
+	object, err := cache.GetObject(context.Background(), key, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testBackend counts the downloads of objects, which can be blocked until unblock is closed.
+type testBackend struct {
+	*filesystem.FilesystemStorage
+	downloads atomic.Int64
+	started   chan struct{}
+	unblock   chan struct{}
+}
+
+func (backend *testBackend) GetObject(ctx context.Context, key string, options *storage.GetObjectOptions) (io.ReadCloser, error) {
+	backend.downloads.Add(1)
+	object, err := backend.FilesystemStorage.GetObject(ctx, key, options)
+	if err != nil || backend.unblock == nil {
+		return object, err
+	}
+	defer object.Close()
+
+	// the object is read before blocking, so that it can be written while it is being downloaded
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, err
+	}
+	backend.started <- struct{}{}
+	<-backend.unblock
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	backendDirectory := t.TempDir()
+	cacheDirectory := t.TempDir()
+	backend := filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: backendDirectory})
+
+	putObject(t, backend, "a", bytes.Repeat([]byte("a"), 40))
+	putObject(t, backend, "dir/b", bytes.Repeat([]byte("b"), 40))
+	putObject(t, backend, "c", bytes.Repeat([]byte("c"), 40))
+	putObject(t, backend, "big", bytes.Repeat([]byte("x"), 200))
+
+	cache, err := NewDiskCache(Config{Backend: backend, Directory: cacheDirectory, MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data := getObject(t, cache, "a", nil); !bytes.Equal(data, bytes.Repeat([]byte("a"), 40)) {
+		t.Errorf("GetObject(a) = %q", data)
+	}
+	if data := getObject(t, cache, "dir/b", nil); !bytes.Equal(data, bytes.Repeat([]byte("b"), 40)) {
+		t.Errorf("GetObject(dir/b) = %q", data)
+	}
+	if cache.Size() != 80 {
+		t.Errorf("Size() = %d, want 80", cache.Size())
+	}
+
+	// the object is served from the cache even when the backend no longer has it
+	err = os.Remove(filepath.Join(backendDirectory, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	getObject(t, cache, "a", nil)
+
+	// "dir/b" is now the least recently used object and should be evicted
+	getObject(t, cache, "c", nil)
+	if cache.Size() != 80 {
+		t.Errorf("Size() = %d, want 80", cache.Size())
+	}
+	if _, err = os.Stat(filepath.Join(cacheDirectory, "dir", "b")); !os.IsNotExist(err) {
+		t.Errorf("dir/b should have been evicted")
+	}
+	if _, err = os.Stat(filepath.Join(cacheDirectory, "a")); err != nil {
+		t.Errorf("a should still be cached: %v", err)
+	}
+
+	// objects larger than MaxSize are served but never cached
+	if data := getObject(t, cache, "big", nil); len(data) != 200 {
+		t.Errorf("len(GetObject(big)) = %d, want 200", len(data))
+	}
+	if cache.Size() != 80 {
+		t.Errorf("Size() = %d, want 80", cache.Size())
+	}
+
+	// ranges are served from the cache
+	objectRange := "bytes=10-19"
+	if data := getObject(t, cache, "c", &storage.GetObjectOptions{Range: &objectRange}); !bytes.Equal(data, bytes.Repeat([]byte("c"), 10)) {
+		t.Errorf("GetObject(c, %s) = %q", objectRange, data)
+	}
+
+	// writes invalidate the cache
+	putObject(t, cache, "c", []byte("new"))
+	if data := getObject(t, cache, "c", nil); string(data) != "new" {
+		t.Errorf("GetObject(c) = %q, want \"new\"", data)
+	}
+
+	// a new cache indexes the objects already on disk
+	cache2, err := NewDiskCache(Config{Backend: backend, Directory: cacheDirectory, MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache2.Size() != cache.Size() {
+		t.Errorf("cache2.Size() = %d, want %d", cache2.Size(), cache.Size())
+	}
+
+	err = cache2.DeleteObjectsWithPrefix(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache2.Size() != 0 {
+		t.Errorf("cache2.Size() = %d, want 0", cache2.Size())
+	}
+}
+
+func TestDiskCacheLargeObjects(t *testing.T) {
+	backend := &testBackend{FilesystemStorage: filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: t.TempDir()})}
+	cacheDirectory := t.TempDir()
+	putObject(t, backend, "big", bytes.Repeat([]byte("x"), 200))
+
+	cache, err := NewDiskCache(Config{Backend: backend, Directory: cacheDirectory, MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 2 {
+		if data := getObject(t, cache, "big", nil); len(data) != 200 {
+			t.Errorf("len(GetObject(big)) = %d, want 200", len(data))
+		}
+		if downloads := backend.downloads.Load(); downloads != int64(i+1) {
+			t.Errorf("the object should be downloaded once per GetObject, got %d downloads", downloads)
+		}
+	}
+
+	// the temporary files are removed once they have been read
+	tmpFiles, err := os.ReadDir(filepath.Join(cacheDirectory, tmpDirectory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpFiles) != 0 {
+		t.Errorf("%d temporary files have not been removed", len(tmpFiles))
+	}
+}
+
+func TestDiskCacheConcurrentFetch(t *testing.T) {
+	backend := &testBackend{
+		FilesystemStorage: filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: t.TempDir()}),
+		started:           make(chan struct{}, 10),
+		unblock:           make(chan struct{}),
+	}
+	cacheDirectory := t.TempDir()
+	putObject(t, backend, "a", []byte("old"))
+
+	cache, err := NewDiskCache(Config{Backend: backend, Directory: cacheDirectory, MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first caller gives up while the object is downloaded, which must not fail the other callers
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(2)
+	go func() {
+		defer waitGroup.Done()
+		object, err := cache.GetObject(firstCtx, "a", nil)
+		if err == nil {
+			object.Close()
+		}
+	}()
+	<-backend.started
+
+	var secondData []byte
+	var secondErr error
+	go func() {
+		defer waitGroup.Done()
+		object, err := cache.GetObject(context.Background(), "a", nil)
+		if err != nil {
+			secondErr = err
+			return
+		}
+		defer object.Close()
+		secondData, secondErr = io.ReadAll(object)
+	}()
+
+	// the object is written while it is being downloaded, so the downloaded object must not be cached
+	cancelFirst()
+	err = backend.FilesystemStorage.PutObject(context.Background(), "a", 3, bytes.NewReader([]byte("new")), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.invalidate(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(backend.unblock)
+	waitGroup.Wait()
+
+	if secondErr != nil {
+		t.Fatalf("second caller: %v", secondErr)
+	}
+	// the second caller reads the object from the backend if it joined the download of the first caller
+	if string(secondData) != "old" && string(secondData) != "new" {
+		t.Errorf("second caller: data = %q", secondData)
+	}
+	// the second caller may have downloaded and cached the new object if it didn't join the first download
+	cachedData, err := os.ReadFile(filepath.Join(cacheDirectory, "a"))
+	if err == nil && string(cachedData) != "new" {
+		t.Errorf("the object downloaded before the write should not be cached: %q", cachedData)
+	}
+	if data := getObject(t, cache, "a", nil); string(data) != "new" {
+		t.Errorf("GetObject(a) = %q, want \"new\"", data)
+	}
+}
+
+// keyBackend returns the key of the object as its content, for any key.
+type keyBackend struct {
+	storage.Storage
+}
+
+func (backend keyBackend) GetObject(ctx context.Context, key string, options *storage.GetObjectOptions) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(key)), nil
+}
+
+func TestDiskCacheKeys(t *testing.T) {
+	parentDirectory := t.TempDir()
+	cacheDirectory := filepath.Join(parentDirectory, "cache")
+	cache, err := NewDiskCache(Config{Backend: keyBackend{}, Directory: cacheDirectory, MaxSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../x", "a/../../x", "a/../x", "/x", "a//x", "a/", ".", "", ".tmp", ".tmp/x"} {
+		if data := getObject(t, cache, key, nil); string(data) != key {
+			t.Errorf("GetObject(%q) = %q", key, data)
+		}
+		if cache.Size() != 0 {
+			t.Errorf("%q should not have been cached", key)
+		}
+	}
+
+	entries, err := os.ReadDir(parentDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "cache" {
+		t.Errorf("files have been written outside of the cache directory: %v", entries)
+	}
+
+	if data := getObject(t, cache, "a/x", nil); string(data) != "a/x" {
+		t.Errorf("GetObject(a/x) = %q", data)
+	}
+	if cache.Size() != 3 {
+		t.Errorf("Size() = %d, want 3", cache.Size())
+	}
+}
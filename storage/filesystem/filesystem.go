@@ -3,12 +3,19 @@ package filesystem
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/bloom42/stdx-go/storage"
 )
 
+// ensure that FilesystemStorage satisfies the Storage interface
+var _ storage.Storage = (*FilesystemStorage)(nil)
+
 type FilesystemStorage struct {
 	basePath string
 }
@@ -20,6 +27,7 @@ type Config struct {
 var (
 	ErrKeyIsNotValid    = errors.New("storage key is not valid")
 	ErrPrefixIsNotValid = errors.New("storage prefix is not valid")
+	ErrRangeIsNotValid  = errors.New("storage range is not valid")
 )
 
 func NewFilesystemStorage(config Config) *FilesystemStorage {
@@ -66,14 +74,87 @@ func (storage *FilesystemStorage) DeleteObject(ctx context.Context, key string)
 	return os.Remove(filePath)
 }
 
-func (storage *FilesystemStorage) GetObject(ctx context.Context, key string) (file io.ReadCloser, err error) {
+func (storage *FilesystemStorage) GetObject(ctx context.Context, key string, options *storage.GetObjectOptions) (ret io.ReadCloser, err error) {
 	if strings.Contains(key, "..") {
 		err = ErrKeyIsNotValid
 		return
 	}
 
 	filePath := filepath.Join(storage.basePath, key)
-	file, err = os.OpenFile(filePath, os.O_RDONLY, os.ModePerm)
+	file, err := os.OpenFile(filePath, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	if options == nil || options.Range == nil {
+		ret = file
+		return
+	}
+
+	fileStat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	start, length, err := parseRange(*options.Range, fileStat.Size())
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	ret = struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.NewSectionReader(file, start, length),
+		Closer: file,
+	}
+	return
+}
+
+// parseRange parses a single HTTP byte range (e.g. "bytes=0-499", "bytes=500-" or "bytes=-500")
+// as accepted by S3 and returns the offset and the length of the range.
+func parseRange(objectRange string, size int64) (start, length int64, err error) {
+	spec, found := strings.CutPrefix(objectRange, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		err = ErrRangeIsNotValid
+		return
+	}
+
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		err = ErrRangeIsNotValid
+		return
+	}
+
+	end := size - 1
+	if startStr == "" {
+		// suffix range: the last N bytes
+		var suffixLength int64
+		suffixLength, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffixLength < 0 {
+			err = ErrRangeIsNotValid
+			return
+		}
+		start = max(size-suffixLength, 0)
+	} else {
+		start, err = strconv.ParseInt(startStr, 10, 64)
+		if err != nil || start < 0 || start >= size {
+			err = fmt.Errorf("%w: %s", ErrRangeIsNotValid, objectRange)
+			return
+		}
+		if endStr != "" {
+			end, err = strconv.ParseInt(endStr, 10, 64)
+			if err != nil || end < start {
+				err = ErrRangeIsNotValid
+				return
+			}
+			end = min(end, size-1)
+		}
+	}
+
+	length = end - start + 1
 	return
 }
 
@@ -98,7 +179,7 @@ func (storage *FilesystemStorage) GetObjectSize(ctx context.Context, key string)
 // 	panic("not implemented") // TODO: Implement
 // }
 
-func (storage *FilesystemStorage) PutObject(ctx context.Context, key string, contentType string, size int64, object io.Reader) (err error) {
+func (storage *FilesystemStorage) PutObject(ctx context.Context, key string, size int64, object io.Reader, options *storage.PutObjectOptions) (err error) {
 	if strings.Contains(key, "..") {
 		err = ErrKeyIsNotValid
 		return
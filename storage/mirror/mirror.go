@@ -0,0 +1,175 @@
+// Package mirror implements a storage.Storage that writes every object to two backends and reads from
+// the primary backend, falling back to the secondary backend when the primary fails.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bloom42/stdx-go/storage"
+)
+
+// ensure that MirrorStorage satisfies the Storage and ObjectInfoGetter interfaces
+var _ storage.Storage = (*MirrorStorage)(nil)
+var _ storage.ObjectInfoGetter = (*MirrorStorage)(nil)
+
+var (
+	ErrPrimaryIsNull   = errors.New("mirror: primary storage is null")
+	ErrSecondaryIsNull = errors.New("mirror: secondary storage is null")
+)
+
+type Config struct {
+	Primary   storage.Storage
+	Secondary storage.Storage
+	// OnSecondaryError, if not nil, is called when a write to the secondary storage fails. In this case
+	// the error is not returned to the caller and the write is considered successful as long as the
+	// primary storage succeeded.
+	// If OnSecondaryError is nil, errors of the secondary storage are returned.
+	OnSecondaryError func(ctx context.Context, operation string, err error)
+}
+
+type MirrorStorage struct {
+	primary          storage.Storage
+	secondary        storage.Storage
+	onSecondaryError func(ctx context.Context, operation string, err error)
+}
+
+func NewMirrorStorage(config Config) (*MirrorStorage, error) {
+	if config.Primary == nil {
+		return nil, ErrPrimaryIsNull
+	}
+	if config.Secondary == nil {
+		return nil, ErrSecondaryIsNull
+	}
+
+	return &MirrorStorage{
+		primary:          config.Primary,
+		secondary:        config.Secondary,
+		onSecondaryError: config.OnSecondaryError,
+	}, nil
+}
+
+func (mirror *MirrorStorage) BasePath() string {
+	return mirror.primary.BasePath()
+}
+
+func (mirror *MirrorStorage) CopyObject(ctx context.Context, from, to string) error {
+	err := mirror.primary.CopyObject(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	return mirror.handleSecondaryError(ctx, "CopyObject", mirror.secondary.CopyObject(ctx, from, to))
+}
+
+func (mirror *MirrorStorage) DeleteObject(ctx context.Context, key string) error {
+	err := mirror.primary.DeleteObject(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return mirror.handleSecondaryError(ctx, "DeleteObject", mirror.secondary.DeleteObject(ctx, key))
+}
+
+func (mirror *MirrorStorage) GetObject(ctx context.Context, key string, options *storage.GetObjectOptions) (io.ReadCloser, error) {
+	object, err := mirror.primary.GetObject(ctx, key, options)
+	if err == nil {
+		return object, nil
+	}
+
+	object, secondaryErr := mirror.secondary.GetObject(ctx, key, options)
+	if secondaryErr != nil {
+		return nil, errors.Join(err, secondaryErr)
+	}
+
+	return object, nil
+}
+
+func (mirror *MirrorStorage) GetObjectSize(ctx context.Context, key string) (int64, error) {
+	size, err := mirror.primary.GetObjectSize(ctx, key)
+	if err == nil {
+		return size, nil
+	}
+
+	size, secondaryErr := mirror.secondary.GetObjectSize(ctx, key)
+	if secondaryErr != nil {
+		return 0, errors.Join(err, secondaryErr)
+	}
+
+	return size, nil
+}
+
+func (mirror *MirrorStorage) GetObjectInfo(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	info, err := storage.GetObjectInfo(ctx, mirror.primary, key)
+	if err == nil {
+		return info, nil
+	}
+
+	info, secondaryErr := storage.GetObjectInfo(ctx, mirror.secondary, key)
+	if secondaryErr != nil {
+		return storage.ObjectInfo{}, errors.Join(err, secondaryErr)
+	}
+
+	return info, nil
+}
+
+// PutObject streams object to both storages at the same time, so the object is never buffered in memory.
+func (mirror *MirrorStorage) PutObject(ctx context.Context, key string, size int64, object io.Reader, options *storage.PutObjectOptions) error {
+	pipeReader, pipeWriter := io.Pipe()
+	primaryReader := io.TeeReader(object, pipeWriter)
+
+	var secondaryErr error
+	var waitGroup sync.WaitGroup
+
+	waitGroup.Add(1)
+	go func() {
+		defer waitGroup.Done()
+
+		secondaryErr = mirror.secondary.PutObject(ctx, key, size, pipeReader, options)
+		// drain the pipe so that the primary storage is not blocked if the secondary storage
+		// stopped reading early
+		_, _ = io.Copy(io.Discard, pipeReader)
+	}()
+
+	err := mirror.primary.PutObject(ctx, key, size, primaryReader, options)
+	if err != nil {
+		pipeWriter.CloseWithError(err)
+	} else {
+		pipeWriter.Close()
+	}
+	waitGroup.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	if secondaryErr != nil {
+		secondaryErr = fmt.Errorf("mirror: writing object to secondary storage: %w", secondaryErr)
+	}
+	return mirror.handleSecondaryError(ctx, "PutObject", secondaryErr)
+}
+
+func (mirror *MirrorStorage) DeleteObjectsWithPrefix(ctx context.Context, prefix string) error {
+	err := mirror.primary.DeleteObjectsWithPrefix(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	return mirror.handleSecondaryError(ctx, "DeleteObjectsWithPrefix", mirror.secondary.DeleteObjectsWithPrefix(ctx, prefix))
+}
+
+func (mirror *MirrorStorage) handleSecondaryError(ctx context.Context, operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if mirror.onSecondaryError != nil {
+		mirror.onSecondaryError(ctx, operation, err)
+		return nil
+	}
+
+	return err
+}
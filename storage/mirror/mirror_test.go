@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/storage/filesystem"
+)
+
+func TestMirrorStorage(t *testing.T) {
+	ctx := context.Background()
+	primary := filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: t.TempDir()})
+	secondary := filesystem.NewFilesystemStorage(filesystem.Config{BaseDirectory: t.TempDir()})
+
+	mirror, err := NewMirrorStorage(Config{Primary: primary, Secondary: secondary})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := crypto.RandBytes(1_000_000)
+	err = mirror.PutObject(ctx, "dir/object", int64(len(data)), bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, backend := range []*filesystem.FilesystemStorage{primary, secondary} {
+		object, err := backend.GetObject(ctx, "dir/object", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objectData, err := io.ReadAll(object)
+		object.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(objectData, data) {
+			t.Errorf("object in %s is not equal to the original data", backend.BasePath())
+		}
+	}
+
+	// reads fall back to the secondary storage
+	err = primary.DeleteObject(ctx, "dir/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := mirror.GetObjectSize(ctx, "dir/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("GetObjectSize() = %d, want %d", size, len(data))
+	}
+
+	// secondary errors are reported to OnSecondaryError
+	var secondaryErr error
+	mirror.onSecondaryError = func(ctx context.Context, operation string, err error) {
+		secondaryErr = err
+	}
+	err = primary.PutObject(ctx, "dir/object", int64(len(data)), bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = secondary.DeleteObject(ctx, "dir/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mirror.DeleteObject(ctx, "dir/object")
+	if err != nil {
+		t.Errorf("DeleteObject() returned an error: %v", err)
+	}
+	if secondaryErr == nil {
+		t.Errorf("OnSecondaryError was not called")
+	}
+}
@@ -0,0 +1,162 @@
+// Package prefixrouter implements a storage.Storage that routes objects to different backends depending
+// on the prefix of their keys. Keys are passed to the backends unchanged.
+package prefixrouter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bloom42/stdx-go/storage"
+)
+
+// ensure that Router satisfies the Storage and ObjectInfoGetter interfaces
+var _ storage.Storage = (*Router)(nil)
+var _ storage.ObjectInfoGetter = (*Router)(nil)
+
+var (
+	ErrDefaultStorageIsNull = errors.New("prefixrouter: default storage is null")
+	ErrRouteIsNotValid      = errors.New("prefixrouter: route is not valid")
+)
+
+type Route struct {
+	Prefix  string
+	Storage storage.Storage
+}
+
+type Config struct {
+	// Default is the storage used for the keys that don't match any route.
+	Default storage.Storage
+	Routes  []Route
+}
+
+type Router struct {
+	defaultStorage storage.Storage
+	// routes are sorted from the longest to the shortest prefix
+	routes []Route
+}
+
+func NewRouter(config Config) (*Router, error) {
+	if config.Default == nil {
+		return nil, ErrDefaultStorageIsNull
+	}
+
+	routes := make([]Route, len(config.Routes))
+	copy(routes, config.Routes)
+	for _, route := range routes {
+		if route.Prefix == "" || route.Storage == nil {
+			return nil, ErrRouteIsNotValid
+		}
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Prefix) > len(routes[j].Prefix)
+	})
+
+	return &Router{
+		defaultStorage: config.Default,
+		routes:         routes,
+	}, nil
+}
+
+// StorageForKey returns the storage that key is routed to.
+// The route with the longest matching prefix wins.
+func (router *Router) StorageForKey(key string) storage.Storage {
+	for _, route := range router.routes {
+		if strings.HasPrefix(key, route.Prefix) {
+			return route.Storage
+		}
+	}
+
+	return router.defaultStorage
+}
+
+func (router *Router) BasePath() string {
+	return router.defaultStorage.BasePath()
+}
+
+// CopyObject copies the object within the same storage if both keys are routed to the same storage.
+// Otherwise the object is streamed from the source storage to the destination storage, with its content
+// type and metadata if the source storage implements storage.ObjectInfoGetter.
+func (router *Router) CopyObject(ctx context.Context, from, to string) error {
+	fromStorage := router.StorageForKey(from)
+	toStorage := router.StorageForKey(to)
+
+	if fromStorage == toStorage {
+		return fromStorage.CopyObject(ctx, from, to)
+	}
+
+	info, err := storage.GetObjectInfo(ctx, fromStorage, from)
+	if err != nil {
+		return err
+	}
+
+	object, err := fromStorage.GetObject(ctx, from, nil)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	var options *storage.PutObjectOptions
+	if info.ContentType != "" || info.Metadata != nil {
+		options = &storage.PutObjectOptions{
+			ContentType: info.ContentType,
+			Metadata:    info.Metadata,
+		}
+	}
+
+	return toStorage.PutObject(ctx, to, info.Size, object, options)
+}
+
+func (router *Router) DeleteObject(ctx context.Context, key string) error {
+	return router.StorageForKey(key).DeleteObject(ctx, key)
+}
+
+func (router *Router) GetObject(ctx context.Context, key string, options *storage.GetObjectOptions) (io.ReadCloser, error) {
+	return router.StorageForKey(key).GetObject(ctx, key, options)
+}
+
+func (router *Router) GetObjectInfo(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	return storage.GetObjectInfo(ctx, router.StorageForKey(key), key)
+}
+
+func (router *Router) GetObjectSize(ctx context.Context, key string) (int64, error) {
+	return router.StorageForKey(key).GetObjectSize(ctx, key)
+}
+
+func (router *Router) PutObject(ctx context.Context, key string, size int64, object io.Reader, options *storage.PutObjectOptions) error {
+	return router.StorageForKey(key).PutObject(ctx, key, size, object, options)
+}
+
+// DeleteObjectsWithPrefix deletes the objects with the given prefix from every storage that may contain
+// such objects: the storage that prefix is routed to, and the storages of the routes that are more specific
+// than prefix (e.g. prefix "users/" and route "users/avatars/").
+func (router *Router) DeleteObjectsWithPrefix(ctx context.Context, prefix string) error {
+	storages := []storage.Storage{router.StorageForKey(prefix)}
+
+	for _, route := range router.routes {
+		if strings.HasPrefix(route.Prefix, prefix) && !containsStorage(storages, route.Storage) {
+			storages = append(storages, route.Storage)
+		}
+	}
+
+	for _, backend := range storages {
+		err := backend.DeleteObjectsWithPrefix(ctx, prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func containsStorage(storages []storage.Storage, target storage.Storage) bool {
+	for _, s := range storages {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
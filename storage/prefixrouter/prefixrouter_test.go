@@ -0,0 +1,219 @@
+package prefixrouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bloom42/stdx-go/storage"
+)
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+}
+
+// memoryStorage is a storage that keeps the content type and metadata of objects, like s3.
+type memoryStorage struct {
+	mutex   sync.Mutex
+	objects map[string]memoryObject
+	copies  int
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{objects: map[string]memoryObject{}}
+}
+
+func (memory *memoryStorage) BasePath() string {
+	return ""
+}
+
+func (memory *memoryStorage) CopyObject(ctx context.Context, from, to string) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	object, exists := memory.objects[from]
+	if !exists {
+		return fs.ErrNotExist
+	}
+	memory.objects[to] = object
+	memory.copies += 1
+	return nil
+}
+
+func (memory *memoryStorage) DeleteObject(ctx context.Context, key string) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	delete(memory.objects, key)
+	return nil
+}
+
+func (memory *memoryStorage) GetObject(ctx context.Context, key string, options *storage.GetObjectOptions) (io.ReadCloser, error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	object, exists := memory.objects[key]
+	if !exists {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(object.data)), nil
+}
+
+func (memory *memoryStorage) GetObjectSize(ctx context.Context, key string) (int64, error) {
+	info, err := memory.GetObjectInfo(ctx, key)
+	return info.Size, err
+}
+
+func (memory *memoryStorage) GetObjectInfo(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	object, exists := memory.objects[key]
+	if !exists {
+		return storage.ObjectInfo{}, fs.ErrNotExist
+	}
+	return storage.ObjectInfo{Size: int64(len(object.data)), ContentType: object.contentType, Metadata: object.metadata}, nil
+}
+
+func (memory *memoryStorage) PutObject(ctx context.Context, key string, size int64, object io.Reader, options *storage.PutObjectOptions) error {
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return errors.New("size does not match")
+	}
+
+	memoryObject := memoryObject{data: data}
+	if options != nil {
+		memoryObject.contentType = options.ContentType
+		memoryObject.metadata = options.Metadata
+	}
+
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+	memory.objects[key] = memoryObject
+	return nil
+}
+
+func (memory *memoryStorage) DeleteObjectsWithPrefix(ctx context.Context, prefix string) error {
+	memory.mutex.Lock()
+	defer memory.mutex.Unlock()
+
+	for key := range memory.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(memory.objects, key)
+		}
+	}
+	return nil
+}
+
+func TestNewRouter(t *testing.T) {
+	backend := newMemoryStorage()
+
+	tests := []struct {
+		config      Config
+		expectedErr error
+	}{
+		{Config{Default: backend}, nil},
+		{Config{Default: backend, Routes: []Route{{Prefix: "users/", Storage: backend}}}, nil},
+		{Config{Routes: []Route{{Prefix: "users/", Storage: backend}}}, ErrDefaultStorageIsNull},
+		{Config{Default: backend, Routes: []Route{{Prefix: "", Storage: backend}}}, ErrRouteIsNotValid},
+		{Config{Default: backend, Routes: []Route{{Prefix: "users/"}}}, ErrRouteIsNotValid},
+	}
+
+	for index, test := range tests {
+		_, err := NewRouter(test.config)
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("%d: err = %v, want %v", index, err, test.expectedErr)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+	defaultStorage, usersStorage, avatarsStorage := newMemoryStorage(), newMemoryStorage(), newMemoryStorage()
+
+	router, err := NewRouter(Config{
+		Default: defaultStorage,
+		// the routes are matched from the longest to the shortest prefix, whatever their order
+		Routes: []Route{
+			{Prefix: "users/", Storage: usersStorage},
+			{Prefix: "users/avatars/", Storage: avatarsStorage},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := []struct {
+		key             string
+		expectedStorage storage.Storage
+	}{
+		{"users/1", usersStorage},
+		{"users/avatars/1.png", avatarsStorage},
+		{"users", defaultStorage},
+		{"files/users/1", defaultStorage},
+	}
+	for _, route := range routes {
+		if router.StorageForKey(route.key) != route.expectedStorage {
+			t.Errorf("%s is not routed to the expected storage", route.key)
+		}
+
+		err = router.PutObject(ctx, route.key, 4, strings.NewReader("data"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = route.expectedStorage.GetObjectSize(ctx, route.key); err != nil {
+			t.Errorf("%s: the object should have been written to the expected storage: %v", route.key, err)
+		}
+	}
+
+	// objects are copied within a storage when possible, and streamed between storages otherwise, with
+	// their content type and metadata
+	err = router.PutObject(ctx, "users/avatars/2.png", 5, strings.NewReader("image"), &storage.PutObjectOptions{
+		ContentType: "image/png",
+		Metadata:    map[string]string{"owner": "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = router.CopyObject(ctx, "users/avatars/2.png", "users/avatars/3.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avatarsStorage.copies != 1 {
+		t.Errorf("the object should have been copied within the storage")
+	}
+	err = router.CopyObject(ctx, "users/avatars/2.png", "backups/2.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := router.GetObjectInfo(ctx, "backups/2.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || info.ContentType != "image/png" || !maps.Equal(info.Metadata, map[string]string{"owner": "2"}) {
+		t.Errorf("the content type and metadata should be copied: %+v", info)
+	}
+
+	// prefixes are deleted from the storages of the more specific routes
+	err = router.DeleteObjectsWithPrefix(ctx, "users/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usersStorage.objects) != 0 || len(avatarsStorage.objects) != 0 {
+		t.Errorf("objects of users/ remain: %d and %d", len(usersStorage.objects), len(avatarsStorage.objects))
+	}
+	if len(defaultStorage.objects) != 3 {
+		t.Errorf("objects outside of users/ should not be deleted: %d remain", len(defaultStorage.objects))
+	}
+}
@@ -9,16 +9,17 @@ import (
 	"net/http"
 	"path/filepath"
 
-	"github.com/bloom42/stdx-go/storage"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bloom42/stdx-go/storage"
 )
 
-// ensure that Client satisfies the Storage interface
+// ensure that Client satisfies the Storage and ObjectInfoGetter interfaces
 var _ storage.Storage = (*Client)(nil)
+var _ storage.ObjectInfoGetter = (*Client)(nil)
 
 type Client struct {
 	basePath string
@@ -151,6 +152,30 @@ func (client *Client) GetObjectSize(ctx context.Context, key string) (int64, err
 	return *result.ContentLength, nil
 }
 
+func (client *Client) GetObjectInfo(ctx context.Context, key string) (info storage.ObjectInfo, err error) {
+	objectKey := filepath.Join(client.basePath, key)
+
+	result, err := client.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(client.bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return
+	}
+
+	if result.ContentLength == nil {
+		err = errors.New("s3: object size is null")
+		return
+	}
+
+	info = storage.ObjectInfo{
+		Size:        *result.ContentLength,
+		ContentType: aws.ToString(result.ContentType),
+		Metadata:    result.Metadata,
+	}
+	return
+}
+
 // func (storage *S3Storage) GetPresignedUploadUrl(ctx context.Context, key string, size uint64) (string, error) {
 // 	objectKey := filepath.Join(storage.basePath, key)
 
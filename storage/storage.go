@@ -25,3 +25,27 @@ type PutObjectOptions struct {
 	Metadata    map[string]string
 	HashSha256  []byte
 }
+
+// ObjectInfo is the information about an object returned by GetObjectInfo.
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	Metadata    map[string]string
+}
+
+// ObjectInfoGetter is implemented by the storages that keep the content type and the metadata of the
+// objects (e.g. s3), so that they are not lost when objects are copied between storages.
+type ObjectInfoGetter interface {
+	GetObjectInfo(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// GetObjectInfo returns the information about the object key of store. If store doesn't implement
+// ObjectInfoGetter, only the size of the object is returned.
+func GetObjectInfo(ctx context.Context, store Storage, key string) (info ObjectInfo, err error) {
+	if infoGetter, ok := store.(ObjectInfoGetter); ok {
+		return infoGetter.GetObjectInfo(ctx, key)
+	}
+
+	info.Size, err = store.GetObjectSize(ctx, key)
+	return
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bloom42/stdx-go/autoupdate"
+	"github.com/bloom42/stdx-go/cobra"
+)
+
+var (
+	flagCreateName           string
+	flagCreateVersion        string
+	flagCreateChannel        string
+	flagCreateDeltas         []string
+	flagCreatePrivateKeyFile string
+)
+
+func init() {
+	createCmd.Flags().StringVarP(&flagCreateName, "name", "n", "", "Name of the project (required)")
+	createCmd.Flags().StringVarP(&flagCreateVersion, "version", "v", "", "Version of the release (required)")
+	createCmd.Flags().StringVarP(&flagCreateChannel, "channel", "c", "", "Promote the release to this channel once published")
+	createCmd.Flags().StringArrayVar(&flagCreateDeltas, "delta", nil, "Create a patch from a previous version: from_version,os,arch,old_executable,new_executable. Can be repeated")
+	createCmd.Flags().StringVar(&flagCreatePrivateKeyFile, "private-key-file", defaultPrivateKeyFile, "Encrypted private key (default: "+privateKeyEnvVar+" if set)")
+	createCmd.MarkFlagRequired("name")
+	createCmd.MarkFlagRequired("version")
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create file...",
+	Short: "Sign and publish a release. Files are the archives of the release, one per platform",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		ctx := cmd.Context()
+
+		deltas := make([]autoupdate.CreateDeltaInput, len(flagCreateDeltas))
+		for index, delta := range flagCreateDeltas {
+			parts := strings.Split(delta, ",")
+			if len(parts) != 5 {
+				return fmt.Errorf("delta is not valid (%s): expected from_version,os,arch,old_executable,new_executable", delta)
+			}
+			deltas[index] = autoupdate.CreateDeltaInput{
+				FromVersion:   parts[0],
+				OS:            parts[1],
+				Arch:          parts[2],
+				OldExecutable: parts[3],
+				NewExecutable: parts[4],
+			}
+		}
+
+		privateKey, err := readPrivateKey(flagCreatePrivateKeyFile)
+		if err != nil {
+			return
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			return
+		}
+
+		release, err := autoupdate.CreateRelease(ctx, autoupdate.CreateReleaseInput{
+			Name:               flagCreateName,
+			Version:            flagCreateVersion,
+			Channel:            flagCreateChannel,
+			Files:              args,
+			PrivateKey:         privateKey,
+			PrivateKeyPassword: password,
+			Deltas:             deltas,
+		})
+		if err != nil {
+			return
+		}
+
+		store := newStorage()
+		err = autoupdate.PublishRelease(ctx, store, flagCreateName, release, append(args, release.Patches...))
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "release %s %s published with %d files and %d patches\n",
+			flagCreateName, flagCreateVersion, len(release.ReleaseManifest.Files), len(release.ReleaseManifest.Patches))
+
+		if flagCreateChannel != "" {
+			err = autoupdate.PromoteRelease(ctx, store, flagCreateName, release.ChannelManifest)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "channel %s now points to %s\n", flagCreateChannel, flagCreateVersion)
+		}
+
+		return nil
+	},
+}
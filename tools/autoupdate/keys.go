@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bloom42/stdx-go/autoupdate"
+	"github.com/bloom42/stdx-go/cobra"
+)
+
+var (
+	flagKeygenPrivateKeyFile string
+	flagKeygenPublicKeyFile  string
+	flagKeygenForce          bool
+)
+
+func init() {
+	keygenCmd.Flags().StringVar(&flagKeygenPrivateKeyFile, "private-key-file", defaultPrivateKeyFile, "File to write the encrypted private key to")
+	keygenCmd.Flags().StringVar(&flagKeygenPublicKeyFile, "public-key-file", defaultPublicKeyFile, "File to write the public key to")
+	keygenCmd.Flags().BoolVarP(&flagKeygenForce, "force", "f", false, "Overwrite existing key files")
+}
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a new signing keypair. The private key is encrypted with " + passwordEnvVar,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if !flagKeygenForce {
+			for _, file := range []string{flagKeygenPrivateKeyFile, flagKeygenPublicKeyFile} {
+				if _, statErr := os.Stat(file); statErr == nil {
+					return fmt.Errorf("%s already exists. Use --force to overwrite it", file)
+				}
+			}
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			return
+		}
+
+		encryptedPrivateKey, publicKey, err := autoupdate.GenerateSigningKeypair([]byte(password))
+		if err != nil {
+			return
+		}
+
+		err = errors.Join(
+			os.WriteFile(flagKeygenPrivateKeyFile, []byte(encryptedPrivateKey+"\n"), 0600),
+			os.WriteFile(flagKeygenPublicKeyFile, []byte(publicKey+"\n"), 0644),
+		)
+		if err != nil {
+			return fmt.Errorf("writing keys: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "private key: %s\npublic key:  %s (%s)\n", flagKeygenPrivateKeyFile, flagKeygenPublicKeyFile, publicKey)
+		return nil
+	},
+}
+
+func readPassword() (password string, err error) {
+	password = os.Getenv(passwordEnvVar)
+	if password == "" {
+		err = fmt.Errorf("%s is not set", passwordEnvVar)
+		return
+	}
+
+	return
+}
+
+// readPrivateKey reads the encrypted private key from the privateKeyEnvVar environment variable or,
+// if it is not set, from privateKeyFile
+func readPrivateKey(privateKeyFile string) (privateKey string, err error) {
+	if envPrivateKey := os.Getenv(privateKeyEnvVar); envPrivateKey != "" {
+		return strings.TrimSpace(envPrivateKey), nil
+	}
+
+	privateKeyData, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		err = fmt.Errorf("reading private key: %w", err)
+		return
+	}
+
+	return strings.TrimSpace(string(privateKeyData)), nil
+}
@@ -0,0 +1,75 @@
+/*
+autoupdate creates, publishes and serves releases for the autoupdate package.
+
+	$ export AUTOUPDATE_PASSWORD=...
+	$ autoupdate keygen
+	$ autoupdate create --name myapp --version 1.2.0 \
+		--delta 1.1.0,linux,amd64,dist/1.1.0/myapp,dist/myapp \
+		dist/myapp_1.2.0_linux_amd64.tar.gz
+	$ autoupdate promote --name myapp --version 1.2.0 --channel stable --rollout 10
+	$ autoupdate yank --name myapp --version 1.2.0 --channel stable --to 1.1.0
+	$ autoupdate serve --addr :8080
+
+Releases are stored in a directory (--storage-dir) with the layout expected by the updater, so the
+directory can also be uploaded as is to a bucket or served by any static file server.
+The base URL of the updater is then [server]/[name]. e.g. http://localhost:8080/myapp
+
+The password of the private key is read from the AUTOUPDATE_PASSWORD environment variable.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bloom42/stdx-go/cobra"
+	"github.com/bloom42/stdx-go/storage/filesystem"
+)
+
+const (
+	version = "1.0.0"
+
+	passwordEnvVar   = "AUTOUPDATE_PASSWORD"
+	privateKeyEnvVar = "AUTOUPDATE_PRIVATE_KEY"
+
+	defaultPrivateKeyFile = "autoupdate.private.key"
+	defaultPublicKeyFile  = "autoupdate.public.key"
+	defaultStorageDir     = "releases"
+)
+
+var (
+	flagStorageDir string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&flagStorageDir, "storage-dir", defaultStorageDir, "Directory where the releases are stored")
+
+	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(createCmd)
+	rootCmd.AddCommand(signCmd)
+	rootCmd.AddCommand(promoteCmd)
+	rootCmd.AddCommand(yankCmd)
+	rootCmd.AddCommand(serveCmd)
+}
+
+func main() {
+	err := rootCmd.Execute()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+var rootCmd = &cobra.Command{
+	Use:           "autoupdate",
+	Short:         "Create, publish and serve releases for autoupdate. Version: " + version,
+	Version:       version,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func newStorage() *filesystem.FilesystemStorage {
+	return filesystem.NewFilesystemStorage(filesystem.Config{
+		BaseDirectory: flagStorageDir,
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bloom42/stdx-go/autoupdate"
+	"github.com/bloom42/stdx-go/cobra"
+)
+
+var (
+	flagPromoteName           string
+	flagPromoteVersion        string
+	flagPromoteChannel        string
+	flagPromoteRollout        int
+	flagPromoteMinimumVersion string
+	flagPromoteForced         bool
+)
+
+func init() {
+	promoteCmd.Flags().StringVarP(&flagPromoteName, "name", "n", "", "Name of the project (required)")
+	promoteCmd.Flags().StringVarP(&flagPromoteVersion, "version", "v", "", "Version of the release to promote (required)")
+	promoteCmd.Flags().StringVarP(&flagPromoteChannel, "channel", "c", "", "Channel (required)")
+	promoteCmd.Flags().IntVar(&flagPromoteRollout, "rollout", 100, "Percentage of the installations that should update")
+	promoteCmd.Flags().StringVar(&flagPromoteMinimumVersion, "minimum-version", "", "Installations older than this version update regardless of the rollout percentage")
+	promoteCmd.Flags().BoolVar(&flagPromoteForced, "forced", false, "All installations update regardless of the rollout percentage")
+	promoteCmd.MarkFlagRequired("name")
+	promoteCmd.MarkFlagRequired("version")
+	promoteCmd.MarkFlagRequired("channel")
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Point a channel to a published release",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if flagPromoteRollout < 0 || flagPromoteRollout > 100 {
+			return fmt.Errorf("rollout percentage (%d) is not valid", flagPromoteRollout)
+		}
+
+		channelManifest := autoupdate.ChannelManifest{
+			Name:           flagPromoteName,
+			Channel:        flagPromoteChannel,
+			Version:        flagPromoteVersion,
+			MinimumVersion: flagPromoteMinimumVersion,
+			Forced:         flagPromoteForced,
+		}
+		if flagPromoteRollout != 100 {
+			rolloutPercentage := uint8(flagPromoteRollout)
+			channelManifest.RolloutPercentage = &rolloutPercentage
+		}
+
+		err = autoupdate.PromoteRelease(cmd.Context(), newStorage(), flagPromoteName, channelManifest)
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "channel %s now points to %s (rollout: %d%%)\n", flagPromoteChannel, flagPromoteVersion, flagPromoteRollout)
+		return nil
+	},
+}
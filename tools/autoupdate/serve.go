@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bloom42/stdx-go/autoupdate"
+	"github.com/bloom42/stdx-go/cobra"
+)
+
+var (
+	flagServeAddress string
+)
+
+func init() {
+	serveCmd.Flags().StringVarP(&flagServeAddress, "addr", "a", "localhost:8080", "Address to listen on")
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the channels and releases of the storage directory over HTTP",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		server, err := autoupdate.NewServer(autoupdate.ServerConfig{
+			Storage: newStorage(),
+		})
+		if err != nil {
+			return
+		}
+
+		httpServer := &http.Server{
+			Addr:              flagServeAddress,
+			Handler:           server,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "serving %s on http://%s\n", flagStorageDir, flagServeAddress)
+		return httpServer.ListenAndServe()
+	},
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bloom42/stdx-go/autoupdate"
+	"github.com/bloom42/stdx-go/cobra"
+)
+
+var (
+	flagSignPrivateKeyFile string
+)
+
+func init() {
+	signCmd.Flags().StringVar(&flagSignPrivateKeyFile, "private-key-file", defaultPrivateKeyFile, "Encrypted private key (default: "+privateKeyEnvVar+" if set)")
+}
+
+var signCmd = &cobra.Command{
+	Use:   "sign file...",
+	Short: "Sign files and print their hashes and signatures as JSON, in the format of the files of a release manifest",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		privateKey, err := readPrivateKey(flagSignPrivateKeyFile)
+		if err != nil {
+			return
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			return
+		}
+
+		signInput := make([]autoupdate.SignInput, 0, len(args))
+		for _, file := range args {
+			var fileHandle *os.File
+			fileHandle, err = os.Open(file)
+			if err != nil {
+				return
+			}
+			defer fileHandle.Close()
+
+			signInput = append(signInput, autoupdate.SignInput{
+				Filename: filepath.Base(file),
+				Reader:   fileHandle,
+			})
+		}
+
+		signatures, err := autoupdate.SignMany(privateKey, password, signInput)
+		if err != nil {
+			return
+		}
+
+		output, err := json.MarshalIndent(signatures, "", "  ")
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), string(output))
+		return nil
+	},
+}
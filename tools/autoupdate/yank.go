@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloom42/stdx-go/autoupdate"
+	"github.com/bloom42/stdx-go/cobra"
+)
+
+var (
+	flagYankName    string
+	flagYankVersion string
+	flagYankChannel string
+	flagYankTo      string
+)
+
+func init() {
+	yankCmd.Flags().StringVarP(&flagYankName, "name", "n", "", "Name of the project (required)")
+	yankCmd.Flags().StringVarP(&flagYankVersion, "version", "v", "", "Version of the release to yank (required)")
+	yankCmd.Flags().StringVarP(&flagYankChannel, "channel", "c", "", "Channel pointing to the yanked release to promote to --to")
+	yankCmd.Flags().StringVar(&flagYankTo, "to", "", "Release to promote to --channel")
+	yankCmd.MarkFlagRequired("name")
+	yankCmd.MarkFlagRequired("version")
+}
+
+var yankCmd = &cobra.Command{
+	Use:   "yank",
+	Short: "Mark a release as yanked so that updaters don't install it",
+	Long: `Mark a release as yanked so that updaters don't install it.
+Installations that already run the yanked release are not downgraded: publish a new release instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		ctx := cmd.Context()
+		store := newStorage()
+
+		if (flagYankChannel == "") != (flagYankTo == "") {
+			return errors.New("--channel and --to must be used together")
+		}
+
+		if flagYankChannel != "" {
+			// keep the rollout settings of the channel
+			var channelManifest autoupdate.ChannelManifest
+			channelManifest, err = autoupdate.GetChannelManifest(ctx, store, flagYankName, flagYankChannel)
+			if err != nil {
+				return
+			}
+			channelManifest.Version = flagYankTo
+			err = autoupdate.PromoteRelease(ctx, store, flagYankName, channelManifest)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "channel %s now points to %s\n", flagYankChannel, flagYankTo)
+		}
+
+		err = autoupdate.YankRelease(ctx, store, flagYankName, flagYankVersion)
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "release %s %s yanked\n", flagYankName, flagYankVersion)
+		return nil
+	},
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bloom42/stdx-go/cobra"
+	"github.com/bloom42/stdx-go/zign"
+)
+
+var (
+	flagInitPrivateKeyFile string
+	flagInitPublicKeyFile  string
+	flagInitForce          bool
+)
+
+func init() {
+	initCmd.Flags().StringVar(&flagInitPrivateKeyFile, "private-key-file", defaultPrivateKeyFile, "File to write the encrypted private key to")
+	initCmd.Flags().StringVar(&flagInitPublicKeyFile, "public-key-file", defaultPublicKeyFile, "File to write the public key to")
+	initCmd.Flags().BoolVarP(&flagInitForce, "force", "f", false, "Overwrite existing key files")
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate a new keypair. The private key is encrypted with a password",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if !flagInitForce {
+			for _, file := range []string{flagInitPrivateKeyFile, flagInitPublicKeyFile} {
+				if _, statErr := os.Stat(file); statErr == nil {
+					return fmt.Errorf("%s already exists. Use --force to overwrite it", file)
+				}
+			}
+		}
+
+		password, err := readPassword(true)
+		if err != nil {
+			return
+		}
+
+		encryptedPrivateKey, encodedPublicKey, err := zign.Init(password)
+		if err != nil {
+			return
+		}
+		publicKey, err := zign.ParsePublicKey(encodedPublicKey)
+		if err != nil {
+			return
+		}
+
+		err = errors.Join(
+			os.WriteFile(flagInitPrivateKeyFile, []byte(encryptedPrivateKey+"\n"), 0600),
+			// the public key is written in the minisign format so it can also be used with minisign
+			os.WriteFile(flagInitPublicKeyFile, []byte("untrusted comment: zign public key "+publicKey.ID.String()+"\n"+publicKey.String()+"\n"), 0644),
+		)
+		if err != nil {
+			return fmt.Errorf("writing keys: %w", err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "private key: %s\npublic key:  %s\nkey ID:      %s\n", flagInitPrivateKeyFile, flagInitPublicKeyFile, publicKey.ID)
+		return nil
+	},
+}
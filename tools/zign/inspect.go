@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bloom42/stdx-go/cobra"
+	"github.com/bloom42/stdx-go/zign"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect [manifest or signature]",
+	Short: "Print the content of a manifest (default: " + zign.DefaultManifestFilename + ") or of a detached signature",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		manifestPath := zign.DefaultManifestFilename
+		if len(args) == 1 {
+			manifestPath = args[0]
+		}
+
+		if strings.HasSuffix(manifestPath, zign.SignatureFileExtension) {
+			return inspectSignature(cmd, manifestPath)
+		}
+
+		manifest, err := readManifest(manifestPath)
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Manifest: %s\nVersion:  %d\nFiles:    %d\n\n", manifestPath, manifest.Version, len(manifest.Files))
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "FILE\tKEY ID\tSHA-256\tSIGNATURE")
+		for _, file := range manifest.Files {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", file.Filename, file.KeyID, file.HashSha256, base64.StdEncoding.EncodeToString(file.Signature))
+		}
+		return writer.Flush()
+	},
+}
+
+func inspectSignature(cmd *cobra.Command, path string) (err error) {
+	signatureData, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	signature, err := zign.ParseDetachedSignature(signatureData)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Signature:         %s\nAlgorithm:         %s\nKey ID:            %s\nTrusted comment:   %s\nUntrusted comment: %s\n",
+		path, signature.Algorithm, signature.KeyID, signature.TrustedComment, signature.UntrustedComment)
+	fields := signature.TrustedCommentFields()
+	if timestamp, parseErr := strconv.ParseInt(fields["timestamp"], 10, 64); parseErr == nil {
+		fmt.Fprintf(cmd.OutOrStdout(), "Signed at:         %s\n", time.Unix(timestamp, 0).UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), "\nThe trusted comment is authenticated only by 'zign verify'.")
+
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+zign signs release files and verifies their signatures.
+
+	$ zign init
+	$ zign sign dist/*.tar.gz dist/*.zip --output dist/zign.json
+	$ zign verify --manifest dist/zign.json --public-key-file zign.public.key
+	$ zign inspect dist/zign.json
+
+The password of the private key is read from the ZIGN_PASSWORD environment variable or, if it is not set,
+prompted on the terminal.
+
+Exit codes:
+
+	0: success
+	1: error (invalid arguments, missing files, wrong password...)
+	2: at least one signature is not valid
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bloom42/stdx-go/cobra"
+)
+
+const (
+	version = "1.0.0"
+
+	passwordEnvVar = "ZIGN_PASSWORD"
+
+	defaultPrivateKeyFile = "zign.private.key"
+	defaultPublicKeyFile  = "zign.public.key"
+
+	exitCodeError              = 1
+	exitCodeVerificationFailed = 2
+)
+
+// errVerificationFailed is returned by the verify command when at least one file is not valid, in order
+// to exit with exitCodeVerificationFailed
+var errVerificationFailed = errors.New("verification failed")
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(signCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(inspectCmd)
+}
+
+func main() {
+	err := rootCmd.Execute()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		if errors.Is(err, errVerificationFailed) {
+			os.Exit(exitCodeVerificationFailed)
+		}
+		os.Exit(exitCodeError)
+	}
+}
+
+var rootCmd = &cobra.Command{
+	Use:           "zign",
+	Short:         "Sign files and verify signatures. Version: " + version,
+	Version:       version,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
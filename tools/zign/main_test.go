@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/stdx-go/zign"
+)
+
+func runZign(t *testing.T, args ...string) (output string, err error) {
+	t.Helper()
+
+	// flags are global variables, so they keep the values of the previous commands
+	flagInitPrivateKeyFile, flagInitPublicKeyFile, flagInitForce = defaultPrivateKeyFile, defaultPublicKeyFile, false
+	flagSignPrivateKeyFile, flagSignOutput, flagSignDetached = defaultPrivateKeyFile, zign.DefaultManifestFilename, false
+	flagSignVersion, flagSignAlgorithm = "", "blake3"
+	flagVerifyManifest, flagVerifyPublicKeys, flagVerifyPublicKeyFiles = zign.DefaultManifestFilename, nil, nil
+
+	var buffer bytes.Buffer
+	rootCmd.SetOut(&buffer)
+	rootCmd.SetArgs(args)
+	err = rootCmd.Execute()
+	return buffer.String(), err
+}
+
+func writeTestFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(passwordEnvVar, "password")
+	writeTestFiles(t, map[string]string{
+		"dist/app_linux_amd64.tar.gz":  "linux",
+		"dist/app_darwin_arm64.tar.gz": "darwin",
+	})
+
+	_, err := runZign(t, "init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runZign(t, "init")
+	if err == nil {
+		t.Error("init should not overwrite existing keys without --force")
+	}
+
+	output, err := runZign(t, "sign", "dist/*.tar.gz", "--output", "dist/zign.json", "--detached", "--release-version", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "2 files signed") {
+		t.Errorf("unexpected sign output: %s", output)
+	}
+
+	output, err = runZign(t, "verify", "--manifest", "dist/zign.json")
+	if err != nil {
+		t.Fatalf("verifying manifest: %v\n%s", err, output)
+	}
+	output, err = runZign(t, "verify", "dist/app_linux_amd64.tar.gz", "dist/app_darwin_arm64.tar.gz")
+	if err != nil {
+		t.Fatalf("verifying detached signatures: %v\n%s", err, output)
+	}
+
+	writeTestFiles(t, map[string]string{"dist/app_linux_amd64.tar.gz": "tampered"})
+
+	output, err = runZign(t, "verify", "--manifest", "dist/zign.json")
+	if !errors.Is(err, errVerificationFailed) {
+		t.Errorf("expected errVerificationFailed, got: %v", err)
+	}
+	if !strings.Contains(output, "FAILED  app_linux_amd64.tar.gz") || !strings.Contains(output, "OK      app_darwin_arm64.tar.gz") {
+		t.Errorf("unexpected verify output: %s", output)
+	}
+	_, err = runZign(t, "verify", "dist/app_linux_amd64.tar.gz")
+	if !errors.Is(err, errVerificationFailed) {
+		t.Errorf("expected errVerificationFailed for the detached signature, got: %v", err)
+	}
+
+	t.Setenv(passwordEnvVar, "wrong password")
+	_, err = runZign(t, "sign", "dist/*.tar.gz", "--output", "dist/zign.json")
+	if err == nil {
+		t.Error("signing with a wrong password should fail")
+	}
+}
+
+func TestSignOutsideOfManifestDirectory(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(passwordEnvVar, "password")
+	writeTestFiles(t, map[string]string{
+		"app.tar.gz":            "app",
+		"dist/app_linux.tar.gz": "linux",
+	})
+
+	_, err := runZign(t, "init")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runZign(t, "sign", "app.tar.gz", "dist/app_linux.tar.gz", "--output", "dist/zign.json")
+	if err == nil || !strings.Contains(err.Error(), "is not in the directory of the manifest") {
+		t.Errorf("signing a file outside of the directory of the manifest: err = %v", err)
+	}
+	if _, err = os.Stat("dist/zign.json"); !os.IsNotExist(err) {
+		t.Error("the manifest should not have been written")
+	}
+}
+
+func TestExpandGlobs(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFiles(t, map[string]string{
+		"dist/b.zip":       "",
+		"dist/a.tar.gz":    "",
+		"dist/dir/c.zip":   "",
+		"dist/zign.json":   "",
+		"other/d.tar.gz":   "",
+		"other/e.checksum": "",
+	})
+
+	tests := []struct {
+		patterns      []string
+		expectedFiles []string
+		expectErr     bool
+	}{
+		{[]string{"dist/*"}, []string{"dist/a.tar.gz", "dist/b.zip", "dist/zign.json"}, false},
+		{[]string{"dist/*.zip", "dist/*", "*/*.tar.gz"}, []string{"dist/a.tar.gz", "dist/b.zip", "dist/zign.json", "other/d.tar.gz"}, false},
+		{[]string{"dist/*.zip", "dist/*.exe"}, nil, true},
+		{[]string{"dist/["}, nil, true},
+	}
+
+	for _, test := range tests {
+		files, err := expandGlobs(test.patterns)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%v: expected an error", test.patterns)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.patterns, err)
+			continue
+		}
+		if !slices.Equal(files, test.expectedFiles) {
+			t.Errorf("%v: files = %v, want %v", test.patterns, files, test.expectedFiles)
+		}
+	}
+}
+
+func TestFileReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	writeTestFiles(t, map[string]string{path: "Hello World"})
+
+	reader := &fileReader{path: path}
+	if reader.file != nil {
+		t.Fatal("the file should not be opened before the first Read")
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Hello World" {
+		t.Errorf("content = %q", content)
+	}
+	if reader.file != nil {
+		t.Error("the file should be closed once it has been read entirely")
+	}
+	if _, err = reader.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read after EOF: err = %v, want io.EOF", err)
+	}
+
+	reader = &fileReader{path: path}
+	_, err = reader.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeFileReaders([]*fileReader{reader})
+	if reader.file != nil {
+		t.Error("the file should be closed by Close")
+	}
+	if _, err = reader.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Read after Close: err = %v, want os.ErrClosed", err)
+	}
+
+	reader = &fileReader{path: filepath.Join(t.TempDir(), "missing")}
+	if _, err = io.ReadAll(reader); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want os.ErrNotExist", err)
+	}
+}
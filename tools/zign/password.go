@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// readPassword reads the password from the passwordEnvVar environment variable or, if it is not set,
+// prompts it on the terminal. If confirm is true, the password is prompted twice.
+func readPassword(confirm bool) (password []byte, err error) {
+	if envPassword := os.Getenv(passwordEnvVar); envPassword != "" {
+		return []byte(envPassword), nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not set and no terminal is available to prompt the password", passwordEnvVar)
+	}
+	defer tty.Close()
+
+	password, err = promptPassword(tty, "Password: ")
+	if err != nil {
+		return
+	}
+	if len(password) == 0 {
+		return nil, errors.New("password is empty")
+	}
+
+	if confirm {
+		var confirmation []byte
+		confirmation, err = promptPassword(tty, "Confirm password: ")
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(password, confirmation) {
+			return nil, errors.New("passwords don't match")
+		}
+	}
+
+	return password, nil
+}
+
+func promptPassword(tty *os.File, prompt string) (password []byte, err error) {
+	fmt.Fprint(tty, prompt)
+	defer fmt.Fprintln(tty)
+
+	restoreEcho, err := disableEcho(tty)
+	if err != nil {
+		return nil, fmt.Errorf("disabling terminal echo: %w", err)
+	}
+	defer restoreEcho()
+
+	line, err := bufio.NewReader(tty).ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading password: %w", err)
+	}
+
+	return bytes.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bloom42/stdx-go/cobra"
+	"github.com/bloom42/stdx-go/zign"
+)
+
+var (
+	flagSignPrivateKeyFile string
+	flagSignOutput         string
+	flagSignDetached       bool
+	flagSignVersion        string
+	flagSignAlgorithm      string
+)
+
+func init() {
+	signCmd.Flags().StringVar(&flagSignPrivateKeyFile, "private-key-file", defaultPrivateKeyFile, "Encrypted private key")
+	signCmd.Flags().StringVarP(&flagSignOutput, "output", "o", zign.DefaultManifestFilename, "File to write the manifest to")
+	signCmd.Flags().BoolVarP(&flagSignDetached, "detached", "d", false, "Also write a minisign-compatible detached signature <file>"+zign.SignatureFileExtension+" for each file")
+	signCmd.Flags().StringVar(&flagSignVersion, "release-version", "", "Version added to the trusted comment of detached signatures")
+	signCmd.Flags().StringVar(&flagSignAlgorithm, "algorithm", "blake3", "Prehash algorithm of detached signatures (valid values: [blake3, blake2b]). Use blake2b to verify signatures with minisign")
+}
+
+var signCmd = &cobra.Command{
+	Use:   "sign <file or glob>...",
+	Short: "Sign files and write the signatures to a manifest",
+	Long: `Sign files and write the signatures to a manifest.
+The paths of the files in the manifest are relative to the directory of the manifest.
+With --detached, a minisign-compatible signature is also written next to each file.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		files, err := expandGlobs(args)
+		if err != nil {
+			return
+		}
+		// never sign the manifest and signatures themselves
+		files = slices.DeleteFunc(files, func(file string) bool {
+			return filepath.Clean(file) == filepath.Clean(flagSignOutput) || strings.HasSuffix(file, zign.SignatureFileExtension)
+		})
+		if len(files) == 0 {
+			return fmt.Errorf("no files match %s", strings.Join(args, " "))
+		}
+
+		encryptedPrivateKey, err := os.ReadFile(flagSignPrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("reading private key: %w", err)
+		}
+
+		var detachedAlgorithm zign.SignatureAlgorithm
+		switch flagSignAlgorithm {
+		case "blake3":
+			detachedAlgorithm = zign.SignatureAlgorithmEd25519Blake3
+		case "blake2b":
+			detachedAlgorithm = zign.SignatureAlgorithmEd25519Blake2b
+		default:
+			return fmt.Errorf("invalid algorithm: %s. Valid values are: [blake3, blake2b]", flagSignAlgorithm)
+		}
+
+		password, err := readPassword(false)
+		if err != nil {
+			return
+		}
+
+		manifestDir := filepath.Dir(flagSignOutput)
+		signInput := make([]zign.SignInput, 0, len(files))
+		fileReaders := make([]*fileReader, 0, len(files))
+		defer func() { closeFileReaders(fileReaders) }()
+		for _, file := range files {
+			var filename string
+			filename, err = filepath.Rel(manifestDir, file)
+			if err != nil {
+				return fmt.Errorf("%s is not in the directory of the manifest: %w", file, err)
+			}
+			// filepath.Rel returns a "../" path for the files outside of the directory of the manifest
+			if !filepath.IsLocal(filename) {
+				return fmt.Errorf("%s is not in the directory of the manifest %s", file, flagSignOutput)
+			}
+
+			reader := &fileReader{path: file}
+			fileReaders = append(fileReaders, reader)
+			signInput = append(signInput, zign.SignInput{
+				Filename: filepath.ToSlash(filename),
+				Reader:   reader,
+			})
+		}
+
+		var signOutput []zign.SignOutput
+		var signatures []zign.DetachedSignature
+		if flagSignDetached {
+			signOutput, signatures, err = zign.SignManyAndDetached(strings.TrimSpace(string(encryptedPrivateKey)), string(password), signInput,
+				&zign.SignDetachedOptions{
+					Algorithm: detachedAlgorithm,
+					Version:   flagSignVersion,
+				})
+		} else {
+			signOutput, err = zign.SignMany(strings.TrimSpace(string(encryptedPrivateKey)), string(password), signInput)
+		}
+		if err != nil {
+			return
+		}
+
+		manifestJSON, err := zign.GenerateManifest(signOutput).ToJson()
+		if err != nil {
+			return
+		}
+
+		err = os.WriteFile(flagSignOutput, append(manifestJSON, '\n'), 0644)
+		if err != nil {
+			return fmt.Errorf("writing manifest: %w", err)
+		}
+
+		for _, file := range signOutput {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s  %s\n", file.HashSha256, file.Filename)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%d files signed. Manifest: %s\n", len(signOutput), flagSignOutput)
+
+		for index, signature := range signatures {
+			signatureFile := files[index] + zign.SignatureFileExtension
+			err = os.WriteFile(signatureFile, signature.Encode(), 0644)
+			if err != nil {
+				return fmt.Errorf("writing signature: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "signature: %s\n", signatureFile)
+		}
+
+		return nil
+	},
+}
+
+// expandGlobs returns the regular files matching patterns, sorted and without duplicates.
+func expandGlobs(patterns []string) (files []string, err error) {
+	files = make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		var matches []string
+		matches, err = filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %s is not valid: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+
+		for _, match := range matches {
+			var fileInfo os.FileInfo
+			fileInfo, err = os.Stat(match)
+			if err != nil {
+				return
+			}
+			if fileInfo.Mode().IsRegular() {
+				files = append(files, match)
+			}
+		}
+	}
+
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// fileReader opens its file at the first Read and closes it as soon as it has been read entirely, so that
+// only one file is open at a time when many files are signed.
+type fileReader struct {
+	path string
+	file *os.File
+	err  error
+}
+
+func (reader *fileReader) Read(p []byte) (n int, err error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+
+	if reader.file == nil {
+		reader.file, err = os.Open(reader.path)
+		if err != nil {
+			reader.err = err
+			return
+		}
+	}
+
+	n, err = reader.file.Read(p)
+	if err != nil {
+		reader.err = err
+		reader.Close()
+	}
+	return
+}
+
+// Close closes the file if it has not been read entirely, e.g. when signing a previous file failed.
+func (reader *fileReader) Close() error {
+	if reader.file == nil {
+		return nil
+	}
+	err := reader.file.Close()
+	reader.file = nil
+	if reader.err == nil {
+		reader.err = os.ErrClosed
+	}
+	return err
+}
+
+func closeFileReaders(fileReaders []*fileReader) {
+	for _, reader := range fileReaders {
+		reader.Close()
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func disableEcho(tty *os.File) (restore func(), err error) {
+	return nil, errors.New("prompting passwords is not supported on this platform: use the " + passwordEnvVar + " environment variable")
+}
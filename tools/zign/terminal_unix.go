@@ -0,0 +1,31 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// disableEcho disables the echo of the terminal and returns a function to restore its previous state.
+func disableEcho(tty *os.File) (restore func(), err error) {
+	fd := int(tty.Fd())
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return
+	}
+
+	previousState := *termios
+	termios.Lflag &^= unix.ECHO
+	termios.Lflag |= unix.ICANON | unix.ISIG
+	err = unix.IoctlSetTermios(fd, ioctlSetTermios, termios)
+	if err != nil {
+		return
+	}
+
+	restore = func() {
+		_ = unix.IoctlSetTermios(fd, ioctlSetTermios, &previousState)
+	}
+	return restore, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bloom42/stdx-go/cobra"
+	"github.com/bloom42/stdx-go/zign"
+)
+
+var (
+	flagVerifyManifest       string
+	flagVerifyPublicKeys     []string
+	flagVerifyPublicKeyFiles []string
+)
+
+func init() {
+	verifyCmd.Flags().StringVarP(&flagVerifyManifest, "manifest", "m", zign.DefaultManifestFilename, "Manifest containing the signatures")
+	verifyCmd.Flags().StringArrayVar(&flagVerifyPublicKeys, "public-key", nil, "Trusted public key (zign or minisign). Can be repeated")
+	verifyCmd.Flags().StringArrayVar(&flagVerifyPublicKeyFiles, "public-key-file", nil, "File containing a trusted public key. Can be repeated (default: "+defaultPublicKeyFile+" if no key is provided)")
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [file]...",
+	Short: "Verify the files of a manifest, or files with detached signatures",
+	Long: `Verify the hashes and signatures of all the files of a manifest.
+If files are provided, they are verified with their detached signature <file>` + zign.SignatureFileExtension + ` instead.
+Several public keys can be trusted at the same time to rotate keys.
+Exits with code 2 if at least one file is not valid.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		trustedPublicKeys, err := readTrustedPublicKeys()
+		if err != nil {
+			return
+		}
+
+		results := make([]verifyResult, 0)
+		if len(args) != 0 {
+			for _, file := range args {
+				results = append(results, verifyResult{
+					file: file,
+					err:  verifyDetachedFile(trustedPublicKeys, file),
+				})
+			}
+		} else {
+			var manifest zign.Manifest
+			manifest, err = readManifest(flagVerifyManifest)
+			if err != nil {
+				return
+			}
+
+			manifestDir := filepath.Dir(flagVerifyManifest)
+			for _, file := range manifest.Files {
+				results = append(results, verifyResult{
+					file: file.Filename,
+					err:  verifyFile(trustedPublicKeys, manifestDir, file),
+				})
+			}
+		}
+
+		invalidFiles := 0
+		for _, result := range results {
+			if result.err != nil {
+				invalidFiles += 1
+				fmt.Fprintf(cmd.OutOrStdout(), "FAILED  %s: %s\n", result.file, result.err)
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "OK      %s\n", result.file)
+		}
+
+		if invalidFiles != 0 {
+			return fmt.Errorf("%w: %d of %d files are not valid", errVerificationFailed, invalidFiles, len(results))
+		}
+
+		return nil
+	},
+}
+
+type verifyResult struct {
+	file string
+	err  error
+}
+
+func readTrustedPublicKeys() (publicKeys []string, err error) {
+	publicKeyFiles := flagVerifyPublicKeyFiles
+	if len(flagVerifyPublicKeys) == 0 && len(publicKeyFiles) == 0 {
+		publicKeyFiles = []string{defaultPublicKeyFile}
+	}
+
+	publicKeys = append(publicKeys, flagVerifyPublicKeys...)
+	for _, publicKeyFile := range publicKeyFiles {
+		var publicKey []byte
+		publicKey, err = os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading public key: %w", err)
+		}
+		publicKeys = append(publicKeys, string(publicKey))
+	}
+
+	// validate the keys before verifying any file, so an invalid key is not reported as an invalid file
+	for _, publicKey := range publicKeys {
+		_, err = zign.ParsePublicKey(publicKey)
+		if err != nil {
+			return
+		}
+	}
+
+	return publicKeys, nil
+}
+
+func verifyDetachedFile(trustedPublicKeys []string, file string) (err error) {
+	signatureData, err := os.ReadFile(file + zign.SignatureFileExtension)
+	if err != nil {
+		return
+	}
+
+	signature, err := zign.ParseDetachedSignature(signatureData)
+	if err != nil {
+		return
+	}
+
+	fileReader, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer fileReader.Close()
+
+	return zign.VerifyDetached(trustedPublicKeys, fileReader, signature)
+}
+
+func verifyFile(trustedPublicKeys []string, manifestDir string, file zign.SignOutput) (err error) {
+	hash, err := hex.DecodeString(file.HashSha256)
+	if err != nil {
+		return fmt.Errorf("hash is not valid: %w", err)
+	}
+
+	fileReader, err := os.Open(filepath.Join(manifestDir, filepath.FromSlash(file.Filename)))
+	if err != nil {
+		return
+	}
+	defer fileReader.Close()
+
+	return zign.VerifyMany(trustedPublicKeys, []zign.VerifyInput{{
+		Reader:     fileReader,
+		HashSha256: hash,
+		Signature:  file.Signature,
+		KeyID:      file.KeyID,
+	}})
+}
+
+func readManifest(path string) (manifest zign.Manifest, err error) {
+	manifestJSON, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("reading manifest: %w", err)
+		return
+	}
+
+	err = json.Unmarshal(manifestJSON, &manifest)
+	if err != nil {
+		err = fmt.Errorf("decoding manifest: %w", err)
+		return
+	}
+
+	if manifest.Version != zign.Version1 {
+		err = fmt.Errorf("manifest version %d is not supported", manifest.Version)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,307 @@
+package zign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/blake3"
+	"golang.org/x/crypto/blake2b"
+)
+
+// SignatureAlgorithm is the 2 bytes identifier of the algorithm of a detached signature, as defined by
+// minisign.
+type SignatureAlgorithm string
+
+const (
+	// SignatureAlgorithmEd25519 signs the whole file with Ed25519. It is only supported to verify legacy
+	// minisign signatures, as the whole file needs to be loaded in memory.
+	SignatureAlgorithmEd25519 SignatureAlgorithm = "Ed"
+	// SignatureAlgorithmEd25519Blake2b signs the BLAKE2b-512 hash of the file with Ed25519. It is the
+	// default algorithm of minisign, and can be verified with `minisign -V`.
+	SignatureAlgorithmEd25519Blake2b SignatureAlgorithm = "ED"
+	// SignatureAlgorithmEd25519Blake3 signs the BLAKE3 hash (512 bits) of the file with Ed25519, which is
+	// faster for large files. It is specific to zign.
+	SignatureAlgorithmEd25519Blake3 SignatureAlgorithm = "EB"
+
+	// SignatureFileExtension is the extension of detached signature files
+	SignatureFileExtension = ".sig"
+
+	signatureAlgorithmSize = 2
+	prehashSize            = 64
+
+	untrustedCommentPrefix  = "untrusted comment: "
+	trustedCommentPrefix    = "trusted comment: "
+	defaultUntrustedComment = "signature from zign secret key"
+)
+
+var (
+	ErrSignatureIsNotValid          = errors.New("zign: signature is not valid")
+	ErrSignatureAlgorithmIsNotValid = errors.New("zign: signature algorithm is not supported")
+	ErrCommentIsNotValid            = errors.New("zign: comments can't contain new lines")
+)
+
+// DetachedSignature is the signature of a file, stored in a separate file in the minisign format:
+//
+//	untrusted comment: <untrusted comment>
+//	base64(<algorithm> || <key ID> || <signature>)
+//	trusted comment: <trusted comment>
+//	base64(<signature of (<signature> || <trusted comment>)>)
+//
+// The trusted comment is signed, and thus can be used to store metadata about the file, such as its
+// version and the time it was signed. The untrusted comment is not signed.
+type DetachedSignature struct {
+	Algorithm        SignatureAlgorithm
+	KeyID            KeyID
+	Signature        []byte
+	UntrustedComment string
+	TrustedComment   string
+	GlobalSignature  []byte
+}
+
+type SignDetachedOptions struct {
+	// default: SignatureAlgorithmEd25519Blake3
+	Algorithm SignatureAlgorithm
+	// Version is added to the default trusted comment
+	Version string
+	// TrustedComment replaces the default trusted comment: "timestamp:<unix timestamp>\tfile:<filename>",
+	// followed by "\tversion:<version>" if Version is set. As with minisign, <filename> is the last element
+	// of the slash-separated SignInput.Filename.
+	TrustedComment string
+	// default: "signature from zign secret key"
+	UntrustedComment string
+}
+
+// SignDetached signs a file and returns its detached signature.
+func SignDetached(encryptedBase64PrivateKey string, password string, input SignInput, options *SignDetachedOptions) (signature DetachedSignature, err error) {
+	res, err := SignDetachedMany(encryptedBase64PrivateKey, password, []SignInput{input}, options)
+	if err != nil {
+		return
+	}
+	signature = res[0]
+	return
+}
+
+// SignDetachedMany signs files and returns their detached signatures. The private key is decrypted only
+// once.
+func SignDetachedMany(encryptedBase64PrivateKey string, password string, input []SignInput, options *SignDetachedOptions) (signatures []DetachedSignature, err error) {
+	if options == nil {
+		options = &SignDetachedOptions{}
+	}
+	_, signatures, err = signFiles(encryptedBase64PrivateKey, password, input, false, options)
+	return
+}
+
+// SignManyAndDetached returns both the outputs of SignMany, to generate a manifest, and the detached
+// signatures of SignDetachedMany. The private key is decrypted only once and each file is read only once.
+func SignManyAndDetached(encryptedBase64PrivateKey string, password string, input []SignInput, options *SignDetachedOptions) (output []SignOutput, signatures []DetachedSignature, err error) {
+	if options == nil {
+		options = &SignDetachedOptions{}
+	}
+	return signFiles(encryptedBase64PrivateKey, password, input, true, options)
+}
+
+// detachedSigner creates detached signatures with validated SignDetachedOptions.
+type detachedSigner struct {
+	algorithm        SignatureAlgorithm
+	version          string
+	trustedComment   string
+	untrustedComment string
+}
+
+func newDetachedSigner(options *SignDetachedOptions) (signer detachedSigner, err error) {
+	signer = detachedSigner{
+		algorithm:        options.Algorithm,
+		version:          options.Version,
+		trustedComment:   options.TrustedComment,
+		untrustedComment: options.UntrustedComment,
+	}
+	if signer.algorithm == "" {
+		signer.algorithm = SignatureAlgorithmEd25519Blake3
+	}
+	if signer.algorithm != SignatureAlgorithmEd25519Blake2b && signer.algorithm != SignatureAlgorithmEd25519Blake3 {
+		return signer, ErrSignatureAlgorithmIsNotValid
+	}
+	if signer.untrustedComment == "" {
+		signer.untrustedComment = defaultUntrustedComment
+	}
+	if strings.ContainsAny(signer.untrustedComment, "\r\n") || strings.ContainsAny(signer.trustedComment, "\r\n") ||
+		strings.ContainsAny(signer.version, "\t\r\n") {
+		return signer, ErrCommentIsNotValid
+	}
+
+	return signer, nil
+}
+
+// sign returns the detached signature of the file named filename, whose prehash is prehash.
+func (signer detachedSigner) sign(privateKey crypto.Ed25519PrivateKey, keyID KeyID, filename string, prehash []byte) (signature DetachedSignature, err error) {
+	trustedComment := signer.trustedComment
+	if trustedComment == "" {
+		trustedComment = defaultTrustedComment(filename, signer.version)
+	}
+
+	signature = DetachedSignature{
+		Algorithm:        signer.algorithm,
+		KeyID:            keyID,
+		UntrustedComment: signer.untrustedComment,
+		TrustedComment:   trustedComment,
+	}
+	signature.Signature, err = privateKey.Sign(nil, prehash, crypto.Ed25519SignerOpts)
+	if err != nil {
+		return DetachedSignature{}, fmt.Errorf("zign.SignDetached: signing %s: %w", filename, err)
+	}
+	signature.GlobalSignature, err = privateKey.Sign(nil, globalSignatureMessage(signature), crypto.Ed25519SignerOpts)
+	if err != nil {
+		return DetachedSignature{}, fmt.Errorf("zign.SignDetached: signing trusted comment of %s: %w", filename, err)
+	}
+
+	return signature, nil
+}
+
+// VerifyDetached verifies the detached signature of a file, and its trusted comment, with the trusted
+// public key matching the key ID of the signature. Public keys are encoded as accepted by ParsePublicKey.
+func VerifyDetached(trustedPublicKeys []string, file io.Reader, signature DetachedSignature) (err error) {
+	publicKeys, err := parseTrustedPublicKeys(trustedPublicKeys)
+	if err != nil {
+		return
+	}
+
+	publicKey, ok := publicKeys[signature.KeyID]
+	if !ok {
+		return ErrPublicKeyNotTrusted
+	}
+
+	prehash, err := prehashFile(signature.Algorithm, file)
+	if err != nil {
+		return
+	}
+
+	valid, err := publicKey.Key.Verify(prehash, signature.Signature)
+	if err != nil || !valid {
+		return ErrSignatureIsNotValid
+	}
+
+	valid, err = publicKey.Key.Verify(globalSignatureMessage(signature), signature.GlobalSignature)
+	if err != nil || !valid {
+		return ErrSignatureIsNotValid
+	}
+
+	return nil
+}
+
+// ParseDetachedSignature parses a detached signature in the minisign format.
+func ParseDetachedSignature(data []byte) (signature DetachedSignature, err error) {
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], untrustedCommentPrefix) ||
+		!strings.HasPrefix(lines[2], trustedCommentPrefix) {
+		return signature, ErrSignatureIsNotValid
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(signatureBytes) != signatureAlgorithmSize+KeyIDSize+crypto.Ed25519SignatureSize {
+		return signature, ErrSignatureIsNotValid
+	}
+	globalSignature, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSignature) != crypto.Ed25519SignatureSize {
+		return signature, ErrSignatureIsNotValid
+	}
+
+	signature.Algorithm = SignatureAlgorithm(signatureBytes[:signatureAlgorithmSize])
+	copy(signature.KeyID[:], signatureBytes[signatureAlgorithmSize:])
+	signature.Signature = signatureBytes[signatureAlgorithmSize+KeyIDSize:]
+	signature.UntrustedComment = strings.TrimPrefix(lines[0], untrustedCommentPrefix)
+	signature.TrustedComment = strings.TrimPrefix(lines[2], trustedCommentPrefix)
+	signature.GlobalSignature = globalSignature
+
+	return signature, nil
+}
+
+// Encode encodes the signature in the minisign format.
+func (signature DetachedSignature) Encode() []byte {
+	signatureBytes := make([]byte, 0, signatureAlgorithmSize+KeyIDSize+len(signature.Signature))
+	signatureBytes = append(signatureBytes, signature.Algorithm...)
+	signatureBytes = append(signatureBytes, signature.KeyID[:]...)
+	signatureBytes = append(signatureBytes, signature.Signature...)
+
+	var buffer bytes.Buffer
+	buffer.WriteString(untrustedCommentPrefix + signature.UntrustedComment + "\n")
+	buffer.WriteString(base64.StdEncoding.EncodeToString(signatureBytes) + "\n")
+	buffer.WriteString(trustedCommentPrefix + signature.TrustedComment + "\n")
+	buffer.WriteString(base64.StdEncoding.EncodeToString(signature.GlobalSignature) + "\n")
+	return buffer.Bytes()
+}
+
+// TrustedCommentFields parses the tab-separated "key:value" fields of the trusted comment, such as the
+// "timestamp", "file" and "version" fields of the default trusted comment.
+// The trusted comment is authenticated only once the signature has been verified.
+func (signature DetachedSignature) TrustedCommentFields() map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(signature.TrustedComment, "\t") {
+		key, value, found := strings.Cut(field, ":")
+		if found {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+func defaultTrustedComment(filename, version string) string {
+	if filename != "" {
+		filename = path.Base(filename)
+	}
+	filename = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(filename)
+	trustedComment := "timestamp:" + strconv.FormatInt(time.Now().Unix(), 10) + "\tfile:" + filename
+	if version != "" {
+		trustedComment += "\tversion:" + version
+	}
+	return trustedComment
+}
+
+func globalSignatureMessage(signature DetachedSignature) []byte {
+	message := make([]byte, 0, len(signature.Signature)+len(signature.TrustedComment))
+	message = append(message, signature.Signature...)
+	return append(message, signature.TrustedComment...)
+}
+
+// prehashFile returns the message signed for file with algorithm
+func prehashFile(algorithm SignatureAlgorithm, file io.Reader) (message []byte, err error) {
+	if algorithm == SignatureAlgorithmEd25519 {
+		return io.ReadAll(file)
+	}
+
+	hasher, err := newPrehasher(algorithm)
+	if err != nil {
+		return
+	}
+
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+// newPrehasher returns the hash function of a prehashed algorithm
+func newPrehasher(algorithm SignatureAlgorithm) (hasher hash.Hash, err error) {
+	switch algorithm {
+	case SignatureAlgorithmEd25519Blake2b:
+		hasher, _ = blake2b.New512(nil)
+	case SignatureAlgorithmEd25519Blake3:
+		hasher = blake3.New(prehashSize, nil)
+	default:
+		return nil, ErrSignatureAlgorithmIsNotValid
+	}
+	return hasher, nil
+}
@@ -0,0 +1,261 @@
+package zign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestDetachedSignature(t *testing.T) {
+	password := "correct horse battery staple"
+	encryptedPrivateKey, publicKey, err := Init([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEncryptedPrivateKey, otherPublicKey, err := Init([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("Hello World")
+
+	for _, algorithm := range []SignatureAlgorithm{SignatureAlgorithmEd25519Blake3, SignatureAlgorithmEd25519Blake2b} {
+		signature, err := SignDetached(encryptedPrivateKey, password, SignInput{Filename: "app.tar.gz", Reader: bytes.NewReader(data)},
+			&SignDetachedOptions{Algorithm: algorithm, Version: "1.2.3"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := ParseDetachedSignature(signature.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Algorithm != algorithm || parsed.KeyID != signature.KeyID || parsed.TrustedComment != signature.TrustedComment {
+			t.Errorf("%s: parsed signature = %+v, want %+v", algorithm, parsed, signature)
+		}
+		fields := parsed.TrustedCommentFields()
+		if fields["file"] != "app.tar.gz" || fields["version"] != "1.2.3" || fields["timestamp"] == "" {
+			t.Errorf("%s: trusted comment = %q", algorithm, parsed.TrustedComment)
+		}
+
+		// keys can be rotated by trusting both the old and the new key
+		err = VerifyDetached([]string{otherPublicKey, publicKey}, bytes.NewReader(data), parsed)
+		if err != nil {
+			t.Errorf("%s: %v", algorithm, err)
+		}
+
+		err = VerifyDetached([]string{otherPublicKey}, bytes.NewReader(data), parsed)
+		if !errors.Is(err, ErrPublicKeyNotTrusted) {
+			t.Errorf("%s: untrusted key: err = %v, want %v", algorithm, err, ErrPublicKeyNotTrusted)
+		}
+		err = VerifyDetached([]string{publicKey}, bytes.NewReader([]byte("Hello World!")), parsed)
+		if !errors.Is(err, ErrSignatureIsNotValid) {
+			t.Errorf("%s: tampered file: err = %v, want %v", algorithm, err, ErrSignatureIsNotValid)
+		}
+		tamperedComment := parsed
+		tamperedComment.TrustedComment += "\tversion:9.9.9"
+		err = VerifyDetached([]string{publicKey}, bytes.NewReader(data), tamperedComment)
+		if !errors.Is(err, ErrSignatureIsNotValid) {
+			t.Errorf("%s: tampered trusted comment: err = %v, want %v", algorithm, err, ErrSignatureIsNotValid)
+		}
+	}
+
+	// manifests: the key ID selects the key, and signatures without key ID are verified with all the keys
+	signOutput, err := SignMany(otherEncryptedPrivateKey, password, []SignInput{{Filename: "app.tar.gz", Reader: bytes.NewReader(data)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherParsedPublicKey, _ := ParsePublicKey(otherPublicKey)
+	if signOutput[0].KeyID != otherParsedPublicKey.ID.String() {
+		t.Errorf("manifest key ID = %s, want %s", signOutput[0].KeyID, otherParsedPublicKey.ID)
+	}
+	for _, keyID := range []string{signOutput[0].KeyID, ""} {
+		err = VerifyMany([]string{publicKey, otherPublicKey}, []VerifyInput{{
+			Reader:     bytes.NewReader(data),
+			HashSha256: mustDecodeHex(t, signOutput[0].HashSha256),
+			Signature:  signOutput[0].Signature,
+			KeyID:      keyID,
+		}})
+		if err != nil {
+			t.Errorf("key ID %q: %v", keyID, err)
+		}
+	}
+	err = VerifyMany([]string{publicKey}, []VerifyInput{{
+		Reader:     bytes.NewReader(data),
+		HashSha256: mustDecodeHex(t, signOutput[0].HashSha256),
+		Signature:  signOutput[0].Signature,
+		KeyID:      signOutput[0].KeyID,
+	}})
+	if !errors.Is(err, ErrPublicKeyNotTrusted) {
+		t.Errorf("manifest with untrusted key: err = %v, want %v", err, ErrPublicKeyNotTrusted)
+	}
+}
+
+func TestSignManyAndDetached(t *testing.T) {
+	password := "correct horse battery staple"
+	encryptedPrivateKey, publicKey, err := Init([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := [][]byte{[]byte("Hello World"), {}, crypto.RandBytes(100_000)}
+	input := make([]SignInput, len(files))
+	for index, data := range files {
+		input[index] = SignInput{Filename: "dir/file" + strconv.Itoa(index), Reader: bytes.NewReader(data)}
+	}
+
+	signOutput, signatures, err := SignManyAndDetached(encryptedPrivateKey, password, input, &SignDetachedOptions{Version: "1.2.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signOutput) != len(files) || len(signatures) != len(files) {
+		t.Fatalf("%d outputs and %d signatures, want %d", len(signOutput), len(signatures), len(files))
+	}
+
+	for index, data := range files {
+		err = VerifyMany([]string{publicKey}, []VerifyInput{{
+			Reader:     bytes.NewReader(data),
+			HashSha256: mustDecodeHex(t, signOutput[index].HashSha256),
+			Signature:  signOutput[index].Signature,
+			KeyID:      signOutput[index].KeyID,
+		}})
+		if err != nil {
+			t.Errorf("file %d: manifest: %v", index, err)
+		}
+
+		fields := signatures[index].TrustedCommentFields()
+		if signatures[index].Algorithm != SignatureAlgorithmEd25519Blake3 || fields["file"] != "file"+strconv.Itoa(index) ||
+			fields["version"] != "1.2.3" {
+			t.Errorf("file %d: signature = %+v", index, signatures[index])
+		}
+		err = VerifyDetached([]string{publicKey}, bytes.NewReader(data), signatures[index])
+		if err != nil {
+			t.Errorf("file %d: detached signature: %v", index, err)
+		}
+	}
+
+	_, _, err = SignManyAndDetached(encryptedPrivateKey, password, input, &SignDetachedOptions{Algorithm: SignatureAlgorithmEd25519})
+	if !errors.Is(err, ErrSignatureAlgorithmIsNotValid) {
+		t.Errorf("legacy algorithm: err = %v, want %v", err, ErrSignatureAlgorithmIsNotValid)
+	}
+}
+
+// TestMinisignCompatibility verifies a signature built as minisign does, with a minisign public key
+func TestMinisignCompatibility(t *testing.T) {
+	publicKey, privateKey, err := crypto.GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := KeyID{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	minisignPublicKey := "untrusted comment: minisign public key " + keyID.String() + "\n" +
+		PublicKey{ID: keyID, Key: publicKey}.String() + "\n"
+	data := []byte("Hello World")
+
+	prehash := blake2b.Sum512(data)
+	signature, _ := privateKey.Sign(nil, prehash[:], crypto.Ed25519SignerOpts)
+	trustedComment := "timestamp:1700000000\tfile:hello.txt\thashed"
+	globalSignature, _ := privateKey.Sign(nil, append(bytes.Clone(signature), trustedComment...), crypto.Ed25519SignerOpts)
+	signatureFile := "untrusted comment: signature from minisign secret key\n" +
+		encodeBase64(append(append([]byte("ED"), keyID[:]...), signature...)) + "\n" +
+		"trusted comment: " + trustedComment + "\n" +
+		encodeBase64(globalSignature) + "\n"
+
+	parsedKey, err := ParsePublicKey(minisignPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedKey.ID != keyID || keyID.String() != "EFCDAB8967452301" {
+		t.Errorf("key ID = %s", parsedKey.ID)
+	}
+
+	parsed, err := ParseDetachedSignature([]byte(signatureFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyDetached([]string{minisignPublicKey}, bytes.NewReader(data), parsed)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(parsed.Encode()) != signatureFile {
+		t.Errorf("encoded signature:\n%s\nwant:\n%s", parsed.Encode(), signatureFile)
+	}
+}
+
+// TestMinisignFixtures verifies signatures produced by the minisign tool itself. They come from the tests of
+// github.com/jedisct1/go-minisign, by the author of minisign, and sign the 4 bytes "test".
+func TestMinisignFixtures(t *testing.T) {
+	publicKey := "untrusted comment: minisign public key E7620F1842B4E81F\n" +
+		"RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3\n"
+
+	tests := []struct {
+		name              string
+		signatureFile     string
+		expectedAlgorithm SignatureAlgorithm
+	}{
+		{
+			name: "legacy",
+			signatureFile: "untrusted comment: signature from minisign secret key\n" +
+				"RWQf6LRCGA9i59SLOFxz6NxvASXDJeRtuZykwQepbDEGt87ig1BNpWaVWuNrm73YiIiJbq71Wi+dP9eKL8OC351vwIasSSbXxwA=\n" +
+				"trusted comment: timestamp:1635442742\tfile:test\n" +
+				"0YteLgV960ia80vnA/fHbvkyjl/IoP/HNOCaZfrF0CdhAlp7ok+Tpkya+VpWPX5C/Is3q8a/kEDSY7fBmmgJCg==\n",
+			expectedAlgorithm: SignatureAlgorithmEd25519,
+		},
+		{
+			name: "prehashed",
+			signatureFile: "untrusted comment: signature from minisign secret key\n" +
+				"RUQf6LRCGA9i559r3g7V1qNyJDApGip8MfqcadIgT9CuhV3EMhHoN1mGTkUidF/z7SrlQgXdy8ofjb7bNJJylDOocrCo8KLzZwo=\n" +
+				"trusted comment: timestamp:1635443258\tfile:test\thashed\n" +
+				"/cj37GK60vryibFn+ftOgbCvW9NKhKYgjVpFFQUcWPAnjO23wrvVDTt7cloNC06maoBli9q6qwZDXXoaxweICQ==\n",
+			expectedAlgorithm: SignatureAlgorithmEd25519Blake2b,
+		},
+	}
+
+	parsedKey, err := ParsePublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedKey.ID.String() != "E7620F1842B4E81F" {
+		t.Errorf("key ID = %s", parsedKey.ID)
+	}
+
+	for _, test := range tests {
+		signature, err := ParseDetachedSignature([]byte(test.signatureFile))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if signature.Algorithm != test.expectedAlgorithm || signature.KeyID != parsedKey.ID {
+			t.Errorf("%s: algorithm = %s, key ID = %s", test.name, signature.Algorithm, signature.KeyID)
+		}
+		if string(signature.Encode()) != test.signatureFile {
+			t.Errorf("%s: encoded signature:\n%s\nwant:\n%s", test.name, signature.Encode(), test.signatureFile)
+		}
+
+		err = VerifyDetached([]string{publicKey}, strings.NewReader("test"), signature)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		err = VerifyDetached([]string{publicKey}, strings.NewReader("tesT"), signature)
+		if !errors.Is(err, ErrSignatureIsNotValid) {
+			t.Errorf("%s: modified file: err = %v, want %v", test.name, err, ErrSignatureIsNotValid)
+		}
+	}
+}
+
+func mustDecodeHex(t *testing.T, data string) []byte {
+	t.Helper()
+	ret, err := hex.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func encodeBase64(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,108 @@
+package zign
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/bloom42/stdx-go/crypto"
+	"github.com/bloom42/stdx-go/crypto/blake3"
+)
+
+const (
+	KeyIDSize = 8
+
+	keyIDContext = "stdx-go/zign key ID"
+)
+
+var (
+	ErrPublicKeyIsNotValid = errors.New("zign: public key is not valid")
+	ErrKeyIDIsNotValid     = errors.New("zign: key ID is not valid")
+	ErrPublicKeyNotTrusted = errors.New("zign: the public key of the signature is not trusted")
+)
+
+// KeyID identifies a public key, in the same way as minisign. It is encoded in signatures so a verifier
+// can select the right key among a set of trusted keys.
+type KeyID [KeyIDSize]byte
+
+// String returns the key ID as printed by minisign: the little-endian integer in uppercase hexadecimal.
+func (keyID KeyID) String() string {
+	reversed := keyID
+	for i := range KeyIDSize / 2 {
+		reversed[i], reversed[KeyIDSize-1-i] = reversed[KeyIDSize-1-i], reversed[i]
+	}
+	return strings.ToUpper(hex.EncodeToString(reversed[:]))
+}
+
+func ParseKeyID(keyIDStr string) (keyID KeyID, err error) {
+	keyIDBytes, err := hex.DecodeString(keyIDStr)
+	if err != nil || len(keyIDBytes) != KeyIDSize {
+		return keyID, ErrKeyIDIsNotValid
+	}
+
+	for i := range KeyIDSize {
+		keyID[i] = keyIDBytes[KeyIDSize-1-i]
+	}
+	return keyID, nil
+}
+
+// PublicKey is an Ed25519 public key with its ID.
+type PublicKey struct {
+	ID  KeyID
+	Key crypto.Ed25519PublicKey
+}
+
+// NewPublicKey returns the PublicKey of a zign key. Its ID is derived from the key.
+func NewPublicKey(key crypto.Ed25519PublicKey) (publicKey PublicKey) {
+	publicKey.Key = key
+	blake3.DeriveKey(publicKey.ID[:], keyIDContext, key)
+	return
+}
+
+// ParsePublicKey parses a public key, either:
+//   - a base64 encoded Ed25519 public key, as returned by Init
+//   - a minisign public key, with or without its untrusted comment line
+func ParsePublicKey(encodedPublicKey string) (publicKey PublicKey, err error) {
+	lines := strings.Split(strings.TrimSpace(encodedPublicKey), "\n")
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return publicKey, ErrPublicKeyIsNotValid
+	}
+
+	switch {
+	case len(publicKeyBytes) == crypto.Ed25519PublicKeySize:
+		return NewPublicKey(crypto.Ed25519PublicKey(publicKeyBytes)), nil
+	case len(publicKeyBytes) == signatureAlgorithmSize+KeyIDSize+crypto.Ed25519PublicKeySize &&
+		string(publicKeyBytes[:signatureAlgorithmSize]) == string(SignatureAlgorithmEd25519):
+		copy(publicKey.ID[:], publicKeyBytes[signatureAlgorithmSize:])
+		publicKey.Key = crypto.Ed25519PublicKey(publicKeyBytes[signatureAlgorithmSize+KeyIDSize:])
+		return publicKey, nil
+	default:
+		return publicKey, ErrPublicKeyIsNotValid
+	}
+}
+
+// String returns the public key in the minisign format, without the untrusted comment line.
+func (publicKey PublicKey) String() string {
+	publicKeyBytes := make([]byte, 0, signatureAlgorithmSize+KeyIDSize+crypto.Ed25519PublicKeySize)
+	publicKeyBytes = append(publicKeyBytes, SignatureAlgorithmEd25519...)
+	publicKeyBytes = append(publicKeyBytes, publicKey.ID[:]...)
+	publicKeyBytes = append(publicKeyBytes, publicKey.Key...)
+	return base64.StdEncoding.EncodeToString(publicKeyBytes)
+}
+
+// parseTrustedPublicKeys parses a set of encoded public keys, indexed by ID.
+func parseTrustedPublicKeys(encodedPublicKeys []string) (publicKeys map[KeyID]PublicKey, err error) {
+	publicKeys = make(map[KeyID]PublicKey, len(encodedPublicKeys))
+	for _, encodedPublicKey := range encodedPublicKeys {
+		var publicKey PublicKey
+		publicKey, err = ParsePublicKey(encodedPublicKey)
+		if err != nil {
+			return
+		}
+		publicKeys[publicKey.ID] = publicKey
+	}
+
+	return publicKeys, nil
+}
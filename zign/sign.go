@@ -9,6 +9,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 
 	"github.com/bloom42/stdx-go/crypto"
@@ -23,6 +24,8 @@ type SignOutput struct {
 	Filename   string `json:"file"`
 	HashSha256 string `json:"hash_sha256"`
 	Signature  []byte `json:"signature"`
+	// KeyID is the ID of the public key that can verify the signature
+	KeyID string `json:"key_id,omitempty"`
 }
 
 func Sign(encryptedBase64PrivateKey string, password string, input SignInput) (output SignOutput, err error) {
@@ -35,8 +38,85 @@ func Sign(encryptedBase64PrivateKey string, password string, input SignInput) (o
 }
 
 func SignMany(encryptedBase64PrivateKey string, password string, input []SignInput) (output []SignOutput, err error) {
-	output = make([]SignOutput, len(input))
+	output, _, err = signFiles(encryptedBase64PrivateKey, password, input, true, nil)
+	return
+}
 
+// signFiles decrypts the private key once and reads each file once to sign it for the manifest
+// (withManifest) and/or with a detached signature (detachedOptions != nil).
+func signFiles(encryptedBase64PrivateKey string, password string, input []SignInput, withManifest bool,
+	detachedOptions *SignDetachedOptions) (output []SignOutput, signatures []DetachedSignature, err error) {
+	var detached detachedSigner
+	if detachedOptions != nil {
+		detached, err = newDetachedSigner(detachedOptions)
+		if err != nil {
+			return
+		}
+	}
+
+	privateKey, err := decryptPrivateKey(encryptedBase64PrivateKey, password)
+	if err != nil {
+		return
+	}
+	defer crypto.Zeroize(privateKey)
+	publicKey := NewPublicKey(privateKey.Public())
+
+	if withManifest {
+		output = make([]SignOutput, len(input))
+	}
+	if detachedOptions != nil {
+		signatures = make([]DetachedSignature, len(input))
+	}
+
+	for index, file := range input {
+		var hasher, prehasher hash.Hash
+		writers := make([]io.Writer, 0, 2)
+		if withManifest {
+			hasher = sha256.New()
+			writers = append(writers, hasher)
+		}
+		if detachedOptions != nil {
+			prehasher, err = newPrehasher(detached.algorithm)
+			if err != nil {
+				return nil, nil, err
+			}
+			writers = append(writers, prehasher)
+		}
+
+		var size int64
+		size, err = io.Copy(io.MultiWriter(writers...), file.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("zign.Sign: hashing %s: %w", file.Filename, err)
+		}
+
+		if withManifest {
+			fileHash := hasher.Sum(nil)
+			var signature []byte
+			signature, err = signFileHash(privateKey, size, fileHash)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			output[index] = SignOutput{
+				Filename:   file.Filename,
+				HashSha256: hex.EncodeToString(fileHash),
+				Signature:  signature,
+				KeyID:      publicKey.ID.String(),
+			}
+		}
+
+		if detachedOptions != nil {
+			signatures[index], err = detached.sign(privateKey, publicKey.ID, file.Filename, prehasher.Sum(nil))
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return output, signatures, nil
+}
+
+func decryptPrivateKey(encryptedBase64PrivateKey string, password string) (privateKey crypto.Ed25519PrivateKey, err error) {
 	privateKeyAndSalt, err := base64.StdEncoding.DecodeString(encryptedBase64PrivateKey)
 	if err != nil {
 		err = fmt.Errorf("zign.Sign: decoding encrypted private key: %w", err)
@@ -63,30 +143,14 @@ func SignMany(encryptedBase64PrivateKey string, password string, input []SignInp
 		err = fmt.Errorf("zign.Sign: decrypting private key: %w", err)
 		return
 	}
-	defer crypto.Zeroize(privateKeyBytes)
 
-	privateKey, err := crypto.NewEd25519PrivateKeyFromBytes(privateKeyBytes)
+	// privateKey uses the memory of privateKeyBytes, which is zeroized by the caller
+	privateKey, err = crypto.NewEd25519PrivateKeyFromBytes(privateKeyBytes)
 	if err != nil {
+		crypto.Zeroize(privateKeyBytes)
 		err = fmt.Errorf("zign.Sign: parsing private key: %w", err)
 		return
 	}
-	defer crypto.Zeroize(privateKey)
-
-	for index, file := range input {
-		var hash []byte
-		var signature []byte
-
-		hash, signature, err = hashAndSignFile(privateKey, file.Reader)
-		if err != nil {
-			return
-		}
-
-		output[index] = SignOutput{
-			Filename:   file.Filename,
-			HashSha256: hex.EncodeToString(hash),
-			Signature:  signature,
-		}
-	}
 
 	return
 }
@@ -102,7 +166,12 @@ func hashAndSignFile(privateKey crypto.Ed25519PrivateKey, file io.Reader) (hash,
 	}
 
 	hash = hasher.Sum(nil)
+	signature, err = signFileHash(privateKey, size, hash)
+	return
+}
 
+// signFileHash signs the size and the SHA-256 hash of a file, as stored in manifests.
+func signFileHash(privateKey crypto.Ed25519PrivateKey, size int64, hash []byte) (signature []byte, err error) {
 	// size of an uint64 and hash
 	sizeUint64 := uint64(size)
 	message := bytes.NewBuffer(make([]byte, 0, 8+crypto.HashSize256))
@@ -16,10 +16,13 @@ type VerifyInput struct {
 	Reader     io.Reader
 	HashSha256 []byte
 	Signature  []byte
+	// KeyID is the ID of the key that signed the file, as found in the manifest (SignOutput.KeyID).
+	// If empty, the signature is verified with all the trusted public keys.
+	KeyID string
 }
 
 func Verify(base64PublicKey string, input VerifyInput) (err error) {
-	err = VerifyMany(base64PublicKey, []VerifyInput{input})
+	err = VerifyMany([]string{base64PublicKey}, []VerifyInput{input})
 	if err != nil {
 		return
 	}
@@ -27,21 +30,35 @@ func Verify(base64PublicKey string, input VerifyInput) (err error) {
 	return
 }
 
-func VerifyMany(base64PublicKey string, input []VerifyInput) (err error) {
-	publicKeyBytes, err := base64.StdEncoding.DecodeString(base64PublicKey)
+// VerifyMany verifies files with a set of trusted public keys, encoded as accepted by ParsePublicKey.
+// Several keys can be trusted at the same time so keys can be rotated.
+func VerifyMany(trustedPublicKeys []string, input []VerifyInput) (err error) {
+	publicKeys, err := parseTrustedPublicKeys(trustedPublicKeys)
 	if err != nil {
-		err = fmt.Errorf("zign.Verify: decoding public key (%s): %w", base64PublicKey, err)
-		return
-	}
-
-	publicKey, err := crypto.NewEd25519PublicKeyFromBytes(publicKeyBytes)
-	if err != nil {
-		err = fmt.Errorf("zign.Verify: parsing public key (%s): %w", base64PublicKey, err)
+		err = fmt.Errorf("zign.Verify: parsing public keys: %w", err)
 		return
 	}
 
 	for _, file := range input {
-		err = hashDataAndVerifySignature(publicKey, file)
+		candidateKeys := make([]crypto.Ed25519PublicKey, 0, len(publicKeys))
+		if file.KeyID != "" {
+			var keyID KeyID
+			keyID, err = ParseKeyID(file.KeyID)
+			if err != nil {
+				return
+			}
+			publicKey, ok := publicKeys[keyID]
+			if !ok {
+				return ErrPublicKeyNotTrusted
+			}
+			candidateKeys = append(candidateKeys, publicKey.Key)
+		} else {
+			for _, publicKey := range publicKeys {
+				candidateKeys = append(candidateKeys, publicKey.Key)
+			}
+		}
+
+		err = hashDataAndVerifySignature(candidateKeys, file)
 		if err != nil {
 			return
 		}
@@ -50,7 +67,7 @@ func VerifyMany(base64PublicKey string, input []VerifyInput) (err error) {
 	return
 }
 
-func hashDataAndVerifySignature(publicKey crypto.Ed25519PublicKey, file VerifyInput) (err error) {
+func hashDataAndVerifySignature(publicKeys []crypto.Ed25519PublicKey, file VerifyInput) (err error) {
 	hasher := sha256.New()
 	var size int64
 
@@ -82,14 +99,16 @@ func hashDataAndVerifySignature(publicKey crypto.Ed25519PublicKey, file VerifyIn
 		return
 	}
 
-	verified := false
-	verified, err = publicKey.Verify(message.Bytes(), file.Signature)
-	if err != nil {
-		err = fmt.Errorf("zign.Verify: verifying signature (%s): %w", base64.StdEncoding.EncodeToString(file.Signature), err)
-		return
-	}
-	if verified {
-		return
+	for _, publicKey := range publicKeys {
+		verified := false
+		verified, err = publicKey.Verify(message.Bytes(), file.Signature)
+		if err != nil {
+			err = fmt.Errorf("zign.Verify: verifying signature (%s): %w", base64.StdEncoding.EncodeToString(file.Signature), err)
+			return
+		}
+		if verified {
+			return
+		}
 	}
 
 	err = errors.New("zign.Verify: signature is not valid")
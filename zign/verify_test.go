@@ -37,7 +37,7 @@ func TestSignAndVerifyInternal(t *testing.T) {
 			HashSha256: hash,
 			Signature:  signature,
 		}
-		err = hashDataAndVerifySignature(publicKey, verifyInput)
+		err = hashDataAndVerifySignature([]crypto.Ed25519PublicKey{publicKey}, verifyInput)
 		if err != nil {
 			t.Error(err)
 		}
@@ -75,7 +75,7 @@ func TestSignAndVerifyIvalidHashInternal(t *testing.T) {
 			HashSha256: hash,
 			Signature:  signature,
 		}
-		err = hashDataAndVerifySignature(publicKey, verifyInput)
+		err = hashDataAndVerifySignature([]crypto.Ed25519PublicKey{publicKey}, verifyInput)
 		if err == nil {
 			t.Errorf("verify accepting an invalid hash for test vector at index: %d", index)
 		}
@@ -113,7 +113,7 @@ func TestSignAndVerifyIvalidSignatureInternal(t *testing.T) {
 			HashSha256: hash,
 			Signature:  signature,
 		}
-		err = hashDataAndVerifySignature(publicKey, verifyInput)
+		err = hashDataAndVerifySignature([]crypto.Ed25519PublicKey{publicKey}, verifyInput)
 		if err == nil {
 			t.Errorf("verify accepting an invalid signature for test vector at index: %d", index)
 		}